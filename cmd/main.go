@@ -2,66 +2,223 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
+	"lead_management/pkg/auth"
+	"lead_management/pkg/certs"
+	"lead_management/pkg/config"
 	"lead_management/pkg/db"
 	"lead_management/pkg/handlers"
-)
-
-const (
-	address         = ":8080"
-	shutdownTimeout = 5 * time.Second
-	dbFilePath      = "lead_management.db"
+	"lead_management/pkg/health"
+	"lead_management/pkg/lifecycle"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/queue"
+	"lead_management/pkg/schedule"
+	"lead_management/pkg/tracing"
+	"lead_management/pkg/webhooks"
 )
 
 // setupServer initializes the HTTP server and sets up the routes.
-func setupServer(database *db.DB) *http.Server {
+// A non-nil reloader enables HTTPS with its certificates.
+func setupServer(cfg config.Config, database *db.DB, reloader *certs.Reloader) *http.Server {
 	mux := http.NewServeMux()
 	handlers.SetupRoutes(mux, database)
 
-	return &http.Server{
-		Addr:    address,
-		Handler: mux,
+	authenticator := auth.NewAuthenticator(auth.Options{
+		APIKeys:               cfg.Auth.APIKeys,
+		Certificates:          cfg.TLS.MutualTLS(),
+		CertificatePrincipals: cfg.Auth.CertificatePrincipals,
+	})
+	handler := handlers.Instrument(mux, authenticator)
+	if cfg.Limits.MaxBodyBytes > 0 {
+		handler = http.MaxBytesHandler(handler, cfg.Limits.MaxBodyBytes)
+	}
+
+	server := &http.Server{
+		Addr:         cfg.Server.Address,
+		Handler:      handler,
+		ReadTimeout:  cfg.Limits.ReadTimeout,
+		WriteTimeout: cfg.Limits.WriteTimeout,
+		IdleTimeout:  cfg.Limits.IdleTimeout,
 	}
+	if reloader != nil {
+		server.TLSConfig = reloader.TLSConfig()
+	}
+	return server
 }
 
-// waitForShutdown waits for an interrupt signal and attempts a graceful shutdown.
-func waitForShutdown(server *http.Server) {
-	// Channel to listen for OS signals.
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+// waitForShutdown waits for SIGINT or SIGTERM and then stops all registered
+// components in order within the configured shutdown timeout.
+func waitForShutdown(cfg config.Config, manager *lifecycle.Manager) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	<-stop
+	<-ctx.Done()
 
 	// Create a context with a timeout for the graceful shutdown.
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
-	// Attempt graceful shutdown.
 	log.Println("Shutting down server...")
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	if err := manager.Shutdown(shutdownCtx); err != nil {
+		log.Fatalf("Shutdown did not complete cleanly: %v", err)
 	}
 
 	log.Println("Server exiting")
 }
 
+// setupTracing installs the span exporter selected in the configuration.
+func setupTracing(cfg config.TracingConfig) error {
+	switch cfg.Exporter {
+	case "":
+		return nil
+	case "stdout":
+		tracing.SetExporter(tracing.NewWriterExporter(os.Stdout))
+	case "file":
+		exporter, err := tracing.NewFileExporter(cfg.File)
+		if err != nil {
+			return err
+		}
+		tracing.SetExporter(exporter)
+	default:
+		return fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	return nil
+}
+
 func main() {
-	database := db.InitDB(dbFilePath)
-	server := setupServer(database)
+	cfg, printConfig, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("Could not print configuration: %v", err)
+		}
+		return
+	}
+
+	err = logging.Setup(os.Stderr, logging.Options{
+		Level:  cfg.Logging.Level,
+		Format: cfg.Logging.Format,
+		Redact: cfg.Logging.Redact,
+	})
+	if err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	}
+	if err := setupTracing(cfg.Tracing); err != nil {
+		log.Fatalf("Invalid tracing configuration: %v", err)
+	}
+
+	// Components are stopped in reverse order of registration: readiness
+	// flips first, then the HTTP server drains, background workers finish,
+	// and the database and trace exporter close last.
+	manager := lifecycle.New()
+	manager.Register("tracing", tracing.Shutdown)
+
+	database := db.InitDB(cfg.Database.Path)
+	manager.Register("database", func(context.Context) error { return database.Close() })
+	health.Default.AddCheck("database", database.Ping)
+	health.Default.AddCheck("schema", database.CheckSchema)
+	database.SetEventBufferSize(cfg.Events.BufferSize)
+	if cfg.Assignment.Strategy == config.StrategyShare {
+		database.SetShareStrategy(cfg.Assignment.ShareWindow)
+	}
+	database.SetStickyWindow(cfg.Assignment.StickyWindow)
+	err = database.SetDedup(context.Background(), db.DedupOptions{
+		Keys:              cfg.Dedup.Keys,
+		Window:            cfg.Dedup.Window,
+		Policy:            cfg.Dedup.Policy,
+		CountryCode:       cfg.Dedup.CountryCode,
+		PostcodeAttribute: cfg.Dedup.PostcodeAttribute,
+	})
+	if err != nil {
+		log.Fatalf("Error backfilling lead identities: %v", err)
+	}
+
+	// Refuse to start serving with a broken database or schema.
+	if report := health.Default.Check(context.Background()); !report.Ready {
+		log.Fatalf("Startup checks failed: %+v", report.Checks)
+	}
+
+	worker := queue.NewWorker(database, cfg.Assignment.QueueInterval)
+	worker.SetHeartbeat(health.Default.Heartbeat("lead queue", 2*cfg.Assignment.QueueInterval))
+	manager.Go("lead queue", worker.Run)
+
+	scheduler := schedule.NewScheduler(database, cfg.Assignment.StatusInterval)
+	scheduler.SetHeartbeat(health.Default.Heartbeat("status scheduler", 2*cfg.Assignment.StatusInterval))
+	manager.Go("status scheduler", scheduler.Run)
+
+	dispatcher := webhooks.NewDispatcher(database, webhooks.Options{
+		PollInterval:   cfg.Webhooks.PollInterval,
+		Timeout:        cfg.Webhooks.Timeout,
+		MaxAttempts:    cfg.Webhooks.MaxAttempts,
+		InitialBackoff: cfg.Webhooks.InitialBackoff,
+		MaxBackoff:     cfg.Webhooks.MaxBackoff,
+	})
+	dispatcher.SetHeartbeat(health.Default.Heartbeat("webhook dispatcher", 3*cfg.Webhooks.PollInterval+2*cfg.Webhooks.Timeout))
+	manager.Go("webhook dispatcher", dispatcher.Run)
+
+	var reloader *certs.Reloader
+	if cfg.TLS.Enabled() {
+		clientCA := ""
+		if cfg.TLS.MutualTLS() {
+			clientCA = cfg.TLS.ClientCAFile
+		}
+		reloader, err = certs.NewReloader(certs.Options{
+			CertFile:     cfg.TLS.CertFile,
+			KeyFile:      cfg.TLS.KeyFile,
+			ClientCAFile: clientCA,
+			ClientAuth:   cfg.TLS.ClientAuth,
+		})
+		if err != nil {
+			log.Fatalf("Could not load TLS certificates: %v", err)
+		}
+		manager.Go("certificate reloader", func(ctx context.Context) {
+			reloader.Watch(ctx, cfg.TLS.ReloadInterval)
+		})
+	}
+
+	server := setupServer(cfg, database, reloader)
+	manager.Register("http server", server.Shutdown)
+	manager.Register("event streams", func(context.Context) error {
+		// End open streams, which would otherwise keep the server from draining.
+		database.Events().Close()
+		return nil
+	})
+	manager.Register("readiness", func(ctx context.Context) error {
+		// Report not ready, and keep serving for the drain delay so that load
+		// balancers stop routing here before the server stops accepting
+		// requests.
+		health.Default.SetDraining()
+		select {
+		case <-time.After(cfg.Server.DrainDelay):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
 
 	// Start the server in a goroutine.
 	go func() {
-		log.Printf("Server started on %s\n", address)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Could not listen on %s: %v\n", address, err)
+		log.Printf("Server started on %s (TLS: %t)\n", cfg.Server.Address, reloader != nil)
+		var err error
+		if reloader != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Could not listen on %s: %v\n", cfg.Server.Address, err)
 		}
 	}()
 
-	// Wait for interrupt signal to gracefully shutdown the server.
-	waitForShutdown(server)
+	// Wait for a termination signal to gracefully shut everything down.
+	waitForShutdown(cfg, manager)
 }
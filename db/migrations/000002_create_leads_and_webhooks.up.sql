@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS leads (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    phone TEXT NOT NULL,
+    clientId TEXT NOT NULL REFERENCES clients(id),
+    assignedAt TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS leads_client_assigned ON leads (clientId, assignedAt);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id TEXT PRIMARY KEY,
+    clientId TEXT NOT NULL REFERENCES clients(id),
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    eventTypes TEXT NOT NULL,
+    createdAt TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    webhookId TEXT NOT NULL REFERENCES webhooks(id),
+    eventType TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    lastError TEXT NOT NULL DEFAULT '',
+    lastStatusCode INTEGER NOT NULL DEFAULT 0,
+    nextAttemptAt TIMESTAMP NOT NULL,
+    createdAt TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (status, nextAttemptAt);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS events;
+DROP INDEX IF EXISTS leads_status;
+ALTER TABLE leads DROP COLUMN status;
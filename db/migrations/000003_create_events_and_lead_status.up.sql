@@ -0,0 +1,11 @@
+ALTER TABLE leads ADD COLUMN status TEXT NOT NULL DEFAULT 'assigned';
+CREATE INDEX IF NOT EXISTS leads_status ON leads (status);
+
+CREATE TABLE IF NOT EXISTS events (
+    sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+    id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    clientId TEXT NOT NULL,
+    createdAt TIMESTAMP NOT NULL,
+    data TEXT NOT NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS changes (
+    sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+    entity TEXT NOT NULL,
+    entityId TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    changedAt TIMESTAMP NOT NULL,
+    data TEXT NOT NULL
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS client_versions (
+    version INTEGER PRIMARY KEY AUTOINCREMENT,
+    clientId TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    changedAt TIMESTAMP NOT NULL,
+    changedBy TEXT NOT NULL,
+    data TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS client_versions_client_changed ON client_versions (clientId, changedAt);
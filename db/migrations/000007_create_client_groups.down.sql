@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS changes_entity;
+DROP INDEX IF EXISTS clients_group;
+ALTER TABLE clients DROP COLUMN groupId;
+DROP TABLE IF EXISTS client_groups;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS client_groups (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    parentId TEXT NOT NULL DEFAULT '',
+    priority INTEGER NOT NULL DEFAULT 0,
+    leadCapacity INTEGER NOT NULL DEFAULT 0,
+    currentLeadCount INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS client_groups_parent ON client_groups (parentId);
+ALTER TABLE clients ADD COLUMN groupId TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS clients_group ON clients (groupId);
+CREATE INDEX IF NOT EXISTS changes_entity ON changes (entity, entityId, changedAt);
@@ -0,0 +1,3 @@
+ALTER TABLE leads DROP COLUMN attributes;
+ALTER TABLE clients DROP COLUMN attributes;
+DROP TABLE IF EXISTS attribute_definitions;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS attribute_definitions (
+    entity TEXT NOT NULL,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    enumValues TEXT NOT NULL DEFAULT '[]',
+    required BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (entity, name)
+);
+ALTER TABLE clients ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE leads ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1 @@
+ALTER TABLE clients ADD COLUMN criteria TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,2 @@
+ALTER TABLE clients DROP COLUMN timezone;
+ALTER TABLE clients DROP COLUMN rule;
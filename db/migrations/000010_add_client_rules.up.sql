@@ -0,0 +1,2 @@
+ALTER TABLE clients ADD COLUMN rule TEXT NOT NULL DEFAULT '';
+ALTER TABLE clients ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE clients ADD COLUMN share REAL NOT NULL DEFAULT 0;
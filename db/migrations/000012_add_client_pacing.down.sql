@@ -0,0 +1,2 @@
+ALTER TABLE clients DROP COLUMN pacingCurve;
+ALTER TABLE clients DROP COLUMN pacing;
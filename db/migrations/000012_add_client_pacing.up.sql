@@ -0,0 +1,2 @@
+ALTER TABLE clients ADD COLUMN pacing TEXT NOT NULL DEFAULT '';
+ALTER TABLE clients ADD COLUMN pacingCurve TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1 @@
+ALTER TABLE clients ADD COLUMN throughputLimits TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS client_status_schedules;
+ALTER TABLE clients DROP COLUMN statusReason;
+ALTER TABLE clients DROP COLUMN status;
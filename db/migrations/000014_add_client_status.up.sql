@@ -0,0 +1,17 @@
+ALTER TABLE clients ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE clients ADD COLUMN statusReason TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS client_status_schedules (
+    id TEXT PRIMARY KEY,
+    clientId TEXT NOT NULL REFERENCES clients(id),
+    status TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    startsAt TIMESTAMP NOT NULL,
+    endsAt TIMESTAMP,
+    state TEXT NOT NULL DEFAULT 'pending',
+    previousStatus TEXT NOT NULL DEFAULT '',
+    previousReason TEXT NOT NULL DEFAULT '',
+    createdAt TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS client_status_schedules_client ON client_status_schedules (clientId, startsAt);
+CREATE INDEX IF NOT EXISTS client_status_schedules_due ON client_status_schedules (state, startsAt);
@@ -0,0 +1,4 @@
+ALTER TABLE leads DROP COLUMN fallbackStep;
+ALTER TABLE leads DROP COLUMN fallbackFrom;
+ALTER TABLE client_groups DROP COLUMN fallbacks;
+ALTER TABLE clients DROP COLUMN fallbacks;
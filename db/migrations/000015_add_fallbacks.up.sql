@@ -0,0 +1,4 @@
+ALTER TABLE clients ADD COLUMN fallbacks TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE client_groups ADD COLUMN fallbacks TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE leads ADD COLUMN fallbackFrom TEXT NOT NULL DEFAULT '';
+ALTER TABLE leads ADD COLUMN fallbackStep INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS leads_phone_key;
+DROP INDEX IF EXISTS leads_email_key;
+ALTER TABLE leads DROP COLUMN stickyFrom;
+ALTER TABLE leads DROP COLUMN phoneKey;
+ALTER TABLE leads DROP COLUMN emailKey;
@@ -0,0 +1,5 @@
+ALTER TABLE leads ADD COLUMN emailKey TEXT NOT NULL DEFAULT '';
+ALTER TABLE leads ADD COLUMN phoneKey TEXT NOT NULL DEFAULT '';
+ALTER TABLE leads ADD COLUMN stickyFrom TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS leads_email_key ON leads (emailKey, assignedAt);
+CREATE INDEX IF NOT EXISTS leads_phone_key ON leads (phoneKey, assignedAt);
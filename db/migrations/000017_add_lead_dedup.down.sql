@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS leads_duplicate_of;
+DROP INDEX IF EXISTS leads_name_postcode_received;
+DROP INDEX IF EXISTS leads_e164_received;
+DROP INDEX IF EXISTS leads_email_received;
+ALTER TABLE leads DROP COLUMN duplicateOf;
+ALTER TABLE leads DROP COLUMN namePostcodeKey;
+ALTER TABLE leads DROP COLUMN e164Key;
+ALTER TABLE leads DROP COLUMN receivedAt;
@@ -0,0 +1,9 @@
+ALTER TABLE leads ADD COLUMN receivedAt TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00+00:00';
+ALTER TABLE leads ADD COLUMN e164Key TEXT NOT NULL DEFAULT '';
+ALTER TABLE leads ADD COLUMN namePostcodeKey TEXT NOT NULL DEFAULT '';
+ALTER TABLE leads ADD COLUMN duplicateOf TEXT NOT NULL DEFAULT '';
+UPDATE leads SET receivedAt = assignedAt WHERE status = 'assigned';
+CREATE INDEX IF NOT EXISTS leads_email_received ON leads (emailKey, receivedAt);
+CREATE INDEX IF NOT EXISTS leads_e164_received ON leads (e164Key, receivedAt);
+CREATE INDEX IF NOT EXISTS leads_name_postcode_received ON leads (namePostcodeKey, receivedAt);
+CREATE INDEX IF NOT EXISTS leads_duplicate_of ON leads (duplicateOf);
@@ -0,0 +1,199 @@
+// Package attributes validates the values of custom client and lead
+// attributes against their definitions.
+package attributes
+
+import (
+	"fmt"
+	"lead_management/pkg/models"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// DateLayout is the format of date attribute values.
+const DateLayout = "2006-01-02"
+
+// namePattern restricts attribute names so they can be used as identifiers
+// in filters and routing rules.
+var namePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,63}$`)
+
+// Error describes why an attribute definition or value is invalid.
+type Error struct {
+	Attribute string
+	Message   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("attribute %s %s", e.Attribute, e.Message)
+}
+
+// CheckDefinition verifies that def is a well-formed definition.
+func CheckDefinition(def models.AttributeDefinition) error {
+	if def.Entity != models.EntityClient && def.Entity != models.EntityLead {
+		return &Error{Attribute: def.Name, Message: "must belong to clients or leads"}
+	}
+	if !namePattern.MatchString(def.Name) {
+		return &Error{Attribute: def.Name, Message: "name must start with a letter and contain only letters, digits and underscores"}
+	}
+	if !slices.Contains(models.AttributeTypes, def.Type) {
+		return &Error{Attribute: def.Name, Message: fmt.Sprintf("has unknown type %q", def.Type)}
+	}
+	if def.Type == models.AttributeEnum && len(def.Values) == 0 {
+		return &Error{Attribute: def.Name, Message: "must list the values of the enum"}
+	}
+	if def.Type != models.AttributeEnum && len(def.Values) > 0 {
+		return &Error{Attribute: def.Name, Message: "may only list values if it is an enum"}
+	}
+	return nil
+}
+
+// Validate checks values against the definitions: every value must be
+// defined and of its definition's type, and required attributes must be
+// present. It returns the first problem found, as an *Error.
+func Validate(defs []models.AttributeDefinition, values map[string]any) error {
+	byName := make(map[string]models.AttributeDefinition, len(defs))
+	for _, def := range defs {
+		byName[def.Name] = def
+		if _, ok := values[def.Name]; def.Required && !ok {
+			return &Error{Attribute: def.Name, Message: "is required"}
+		}
+	}
+	// Check in a stable order so the same input always reports the same error.
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		def, ok := byName[name]
+		if !ok {
+			return &Error{Attribute: name, Message: "is not defined"}
+		}
+		if err := checkValue(def, values[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkValue verifies that value, as decoded from JSON, has def's type.
+func checkValue(def models.AttributeDefinition, value any) error {
+	fail := func(message string) error {
+		return &Error{Attribute: def.Name, Message: message}
+	}
+	switch def.Type {
+	case models.AttributeString:
+		if _, ok := value.(string); !ok {
+			return fail("must be a string")
+		}
+	case models.AttributeNumber:
+		if _, ok := value.(float64); !ok {
+			return fail("must be a number")
+		}
+	case models.AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fail("must be true or false")
+		}
+	case models.AttributeEnum:
+		if s, ok := value.(string); !ok || !slices.Contains(def.Values, s) {
+			return fail(fmt.Sprintf("must be one of %v", def.Values))
+		}
+	case models.AttributeDate:
+		s, ok := value.(string)
+		if !ok {
+			return fail("must be a date formatted as YYYY-MM-DD")
+		}
+		if _, err := time.Parse(DateLayout, s); err != nil {
+			return fail("must be a date formatted as YYYY-MM-DD")
+		}
+	}
+	return nil
+}
+
+// Parse converts the text form of a value, as given in a query parameter or
+// CSV cell, to the typed value def describes.
+func Parse(def models.AttributeDefinition, text string) (any, error) {
+	var value any = text
+	switch def.Type {
+	case models.AttributeNumber:
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, &Error{Attribute: def.Name, Message: "must be a number"}
+		}
+		value = n
+	case models.AttributeBoolean:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, &Error{Attribute: def.Name, Message: "must be true or false"}
+		}
+		value = b
+	}
+	if err := checkValue(def, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// CheckCriteria verifies that client criteria refer to the lead attributes
+// defs defines, with values of their types. Min and Max apply to numbers only.
+func CheckCriteria(defs []models.AttributeDefinition, criteria []models.Criterion) error {
+	seen := make(map[string]bool, len(criteria))
+	for _, c := range criteria {
+		fail := func(message string) error {
+			return &Error{Attribute: c.Attribute, Message: "criterion " + message}
+		}
+		i := slices.IndexFunc(defs, func(def models.AttributeDefinition) bool { return def.Name == c.Attribute })
+		if i < 0 {
+			return fail("refers to an undefined lead attribute")
+		}
+		if seen[c.Attribute] {
+			return fail("is given more than once")
+		}
+		seen[c.Attribute] = true
+		if len(c.In) == 0 && c.Min == nil && c.Max == nil {
+			return fail("must give in, min or max")
+		}
+		for _, value := range c.In {
+			if err := checkValue(defs[i], value); err != nil {
+				return fail("value " + err.(*Error).Message)
+			}
+		}
+		if (c.Min != nil || c.Max != nil) && defs[i].Type != models.AttributeNumber {
+			return fail("may only give min and max for a number")
+		}
+		if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+			return fail("min must not be greater than max")
+		}
+	}
+	return nil
+}
+
+// Misses returns the attributes of the criteria that values, a lead's
+// attributes, do not meet.
+func Misses(criteria []models.Criterion, values map[string]any) []string {
+	var misses []string
+	for _, c := range criteria {
+		if !meets(c, values[c.Attribute]) {
+			misses = append(misses, c.Attribute)
+		}
+	}
+	return misses
+}
+
+// meets reports whether value, nil if the lead lacks the attribute, meets c.
+func meets(c models.Criterion, value any) bool {
+	if value == nil {
+		return false
+	}
+	if len(c.In) > 0 && !slices.Contains(c.In, value) {
+		return false
+	}
+	if c.Min != nil || c.Max != nil {
+		n, ok := value.(float64)
+		if !ok || (c.Min != nil && n < *c.Min) || (c.Max != nil && n > *c.Max) {
+			return false
+		}
+	}
+	return true
+}
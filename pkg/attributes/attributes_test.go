@@ -0,0 +1,161 @@
+package attributes
+
+import (
+	"lead_management/pkg/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testDefinitions = []models.AttributeDefinition{
+	{Entity: models.EntityClient, Name: "region", Type: models.AttributeEnum, Values: []string{"emea", "apac"}, Required: true},
+	{Entity: models.EntityClient, Name: "seats", Type: models.AttributeNumber},
+	{Entity: models.EntityClient, Name: "vip", Type: models.AttributeBoolean},
+	{Entity: models.EntityClient, Name: "since", Type: models.AttributeDate},
+	{Entity: models.EntityClient, Name: "crmId", Type: models.AttributeString},
+}
+
+func TestCheckDefinition(t *testing.T) {
+	tests := []struct {
+		name    string
+		def     models.AttributeDefinition
+		wantErr bool
+	}{
+		{name: "Valid string", def: models.AttributeDefinition{Entity: models.EntityLead, Name: "language", Type: models.AttributeString}},
+		{name: "Valid enum", def: models.AttributeDefinition{Entity: models.EntityClient, Name: "region", Type: models.AttributeEnum, Values: []string{"emea"}}},
+		{name: "Unknown entity", def: models.AttributeDefinition{Entity: "group", Name: "region", Type: models.AttributeString}, wantErr: true},
+		{name: "Invalid name", def: models.AttributeDefinition{Entity: models.EntityClient, Name: "crm-id", Type: models.AttributeString}, wantErr: true},
+		{name: "Unknown type", def: models.AttributeDefinition{Entity: models.EntityClient, Name: "region", Type: "list"}, wantErr: true},
+		{name: "Enum without values", def: models.AttributeDefinition{Entity: models.EntityClient, Name: "region", Type: models.AttributeEnum}, wantErr: true},
+		{name: "Values on a string", def: models.AttributeDefinition{Entity: models.EntityClient, Name: "region", Type: models.AttributeString, Values: []string{"emea"}}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckDefinition(tc.def)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name          string
+		values        map[string]any
+		wantAttribute string
+	}{
+		{name: "All types", values: map[string]any{"region": "emea", "seats": 12.0, "vip": true, "since": "2024-02-29", "crmId": "A-1"}},
+		{name: "Missing required", values: map[string]any{"seats": 1.0}, wantAttribute: "region"},
+		{name: "Undefined", values: map[string]any{"region": "emea", "colour": "red"}, wantAttribute: "colour"},
+		{name: "Value not in enum", values: map[string]any{"region": "amer"}, wantAttribute: "region"},
+		{name: "String for number", values: map[string]any{"region": "emea", "seats": "12"}, wantAttribute: "seats"},
+		{name: "String for boolean", values: map[string]any{"region": "emea", "vip": "yes"}, wantAttribute: "vip"},
+		{name: "Invalid date", values: map[string]any{"region": "emea", "since": "2023-02-29"}, wantAttribute: "since"},
+		{name: "Number for string", values: map[string]any{"region": "emea", "crmId": 1.0}, wantAttribute: "crmId"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(testDefinitions, tc.values)
+			if tc.wantAttribute == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var attrErr *Error
+			if assert.ErrorAs(t, err, &attrErr) {
+				assert.Equal(t, tc.wantAttribute, attrErr.Attribute)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		def      models.AttributeDefinition
+		text     string
+		expected any
+		wantErr  bool
+	}{
+		{name: "Number", def: testDefinitions[1], text: "12.5", expected: 12.5},
+		{name: "Invalid number", def: testDefinitions[1], text: "many", wantErr: true},
+		{name: "Boolean", def: testDefinitions[2], text: "true", expected: true},
+		{name: "Enum", def: testDefinitions[0], text: "apac", expected: "apac"},
+		{name: "Enum value not allowed", def: testDefinitions[0], text: "amer", wantErr: true},
+		{name: "Date", def: testDefinitions[3], text: "2024-01-31", expected: "2024-01-31"},
+		{name: "Invalid date", def: testDefinitions[3], text: "31/01/2024", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := Parse(tc.def, tc.text)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, value)
+		})
+	}
+}
+
+func TestCheckCriteria(t *testing.T) {
+	leadDefs := []models.AttributeDefinition{
+		{Entity: models.EntityLead, Name: "country", Type: models.AttributeEnum, Values: []string{"DE", "AT", "FR"}},
+		{Entity: models.EntityLead, Name: "score", Type: models.AttributeNumber},
+	}
+	low, high := 50.0, 10.0
+	tests := []struct {
+		name     string
+		criteria []models.Criterion
+		wantErr  bool
+	}{
+		{name: "Accepted values and minimum", criteria: []models.Criterion{{Attribute: "country", In: []any{"DE", "AT"}}, {Attribute: "score", Min: &low}}},
+		{name: "Undefined attribute", criteria: []models.Criterion{{Attribute: "region", In: []any{"emea"}}}, wantErr: true},
+		{name: "Repeated attribute", criteria: []models.Criterion{{Attribute: "score", Min: &low}, {Attribute: "score", Max: &high}}, wantErr: true},
+		{name: "Empty criterion", criteria: []models.Criterion{{Attribute: "country"}}, wantErr: true},
+		{name: "Value not in enum", criteria: []models.Criterion{{Attribute: "country", In: []any{"US"}}}, wantErr: true},
+		{name: "Minimum on an enum", criteria: []models.Criterion{{Attribute: "country", Min: &low}}, wantErr: true},
+		{name: "Minimum above maximum", criteria: []models.Criterion{{Attribute: "score", Min: &low, Max: &high}}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckCriteria(leadDefs, tc.criteria)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMisses(t *testing.T) {
+	min, max := 50.0, 100.0
+	criteria := []models.Criterion{
+		{Attribute: "country", In: []any{"DE", "AT"}},
+		{Attribute: "score", Min: &min, Max: &max},
+	}
+	tests := []struct {
+		name     string
+		values   map[string]any
+		expected []string
+	}{
+		{name: "All met", values: map[string]any{"country": "AT", "score": 50.0}},
+		{name: "Value not accepted", values: map[string]any{"country": "FR", "score": 75.0}, expected: []string{"country"}},
+		{name: "Below minimum", values: map[string]any{"country": "DE", "score": 49.0}, expected: []string{"score"}},
+		{name: "Above maximum", values: map[string]any{"country": "DE", "score": 101.0}, expected: []string{"score"}},
+		{name: "Missing attributes", expected: []string{"country", "score"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Misses(criteria, tc.values))
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Authentication methods recorded on a Principal.
+const (
+	MethodAPIKey      = "api_key"
+	MethodCertificate = "certificate"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+}
+
+// Options configures which credentials an Authenticator accepts.
+type Options struct {
+	// APIKeys maps each API key to the name of the principal it authenticates.
+	APIKeys map[string]string
+
+	// Certificates enables authentication with verified TLS client certificates.
+	Certificates bool
+
+	// CertificatePrincipals maps a client certificate subject, either its
+	// common name or its full distinguished name, to a principal name. When
+	// empty, the common name itself is the principal; otherwise certificates
+	// with unmapped subjects are rejected.
+	CertificatePrincipals map[string]string
+}
+
+// Authenticator identifies callers from request credentials.
+type Authenticator struct {
+	opts Options
+}
+
+// NewAuthenticator returns an authenticator accepting the given credentials.
+func NewAuthenticator(opts Options) *Authenticator {
+	return &Authenticator{opts: opts}
+}
+
+// Enabled reports whether any credentials are configured. When it is false
+// every request is allowed through anonymously.
+func (a *Authenticator) Enabled() bool {
+	return a != nil && (len(a.opts.APIKeys) > 0 || a.opts.Certificates)
+}
+
+// Authenticate returns the principal for the credentials in r, or nil if the
+// request carries none or they are not valid. A verified client certificate
+// takes precedence; otherwise API keys are read from the X-API-Key header or
+// an "Authorization: Bearer" header.
+func (a *Authenticator) Authenticate(r *http.Request) *Principal {
+	if a == nil {
+		return nil
+	}
+	if p := a.authenticateCertificate(r); p != nil {
+		return p
+	}
+	return a.authenticateAPIKey(r)
+}
+
+// authenticateCertificate maps the subject of a verified client certificate to a principal.
+func (a *Authenticator) authenticateCertificate(r *http.Request) *Principal {
+	if !a.opts.Certificates || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	name := subject.CommonName
+	if len(a.opts.CertificatePrincipals) > 0 {
+		var ok bool
+		if name, ok = a.opts.CertificatePrincipals[subject.String()]; !ok {
+			name = a.opts.CertificatePrincipals[subject.CommonName]
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	return &Principal{Name: name, Method: MethodCertificate}
+}
+
+// authenticateAPIKey looks up the API key presented in the request headers.
+func (a *Authenticator) authenticateAPIKey(r *http.Request) *Principal {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			key = bearer
+		}
+	}
+	if key == "" {
+		return nil
+	}
+	// Compare against every key so timing does not reveal which one matched.
+	var name string
+	for candidate, principal := range a.opts.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			name = principal
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	return &Principal{Name: name, Method: MethodAPIKey}
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of the request, or nil if it is anonymous.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate(t *testing.T) {
+	a := NewAuthenticator(Options{APIKeys: map[string]string{"secret-1": "alice", "secret-2": "bob"}})
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected *Principal
+	}{
+		{name: "X-API-Key header", headers: map[string]string{"X-API-Key": "secret-1"}, expected: &Principal{Name: "alice", Method: MethodAPIKey}},
+		{name: "Bearer token", headers: map[string]string{"Authorization": "Bearer secret-2"}, expected: &Principal{Name: "bob", Method: MethodAPIKey}},
+		{name: "Unknown key", headers: map[string]string{"X-API-Key": "nope"}, expected: nil},
+		{name: "No credentials", headers: nil, expected: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/client/all", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			assert.Equal(t, tc.expected, a.Authenticate(req))
+		})
+	}
+}
+
+func TestAuthenticateCertificate(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "supplier-a", Organization: []string{"Acme"}}}
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		state    *tls.ConnectionState
+		apiKey   string
+		expected *Principal
+	}{
+		{
+			name:     "Common name is the principal",
+			opts:     Options{Certificates: true},
+			state:    verified,
+			expected: &Principal{Name: "supplier-a", Method: MethodCertificate},
+		},
+		{
+			name:     "Mapped common name",
+			opts:     Options{Certificates: true, CertificatePrincipals: map[string]string{"supplier-a": "acme-leads"}},
+			state:    verified,
+			expected: &Principal{Name: "acme-leads", Method: MethodCertificate},
+		},
+		{
+			name:     "Mapped distinguished name",
+			opts:     Options{Certificates: true, CertificatePrincipals: map[string]string{"CN=supplier-a,O=Acme": "acme"}},
+			state:    verified,
+			expected: &Principal{Name: "acme", Method: MethodCertificate},
+		},
+		{
+			name:     "Unmapped subject is rejected",
+			opts:     Options{Certificates: true, CertificatePrincipals: map[string]string{"other": "x"}},
+			state:    verified,
+			expected: nil,
+		},
+		{
+			name:     "Unverified connection",
+			opts:     Options{Certificates: true},
+			state:    &tls.ConnectionState{},
+			expected: nil,
+		},
+		{
+			name:     "Certificates disabled falls back to API key",
+			opts:     Options{APIKeys: map[string]string{"k": "alice"}},
+			state:    verified,
+			apiKey:   "k",
+			expected: &Principal{Name: "alice", Method: MethodAPIKey},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/client/all", nil)
+			req.TLS = tc.state
+			if tc.apiKey != "" {
+				req.Header.Set("X-API-Key", tc.apiKey)
+			}
+			assert.Equal(t, tc.expected, NewAuthenticator(tc.opts).Authenticate(req))
+		})
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	var nilAuth *Authenticator
+	assert.False(t, nilAuth.Enabled())
+	assert.False(t, NewAuthenticator(Options{}).Enabled())
+	assert.True(t, NewAuthenticator(Options{APIKeys: map[string]string{"k": "p"}}).Enabled())
+	assert.True(t, NewAuthenticator(Options{Certificates: true}).Enabled())
+}
+
+func TestPrincipalContext(t *testing.T) {
+	p := &Principal{Name: "alice", Method: MethodAPIKey}
+	assert.Nil(t, FromContext(context.Background()))
+	assert.Equal(t, p, FromContext(WithPrincipal(context.Background(), p)))
+}
@@ -0,0 +1,155 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client authentication modes for mutual TLS.
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// Options describes the files a Reloader serves from.
+type Options struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string // CA bundle used to verify client certificates; empty disables mutual TLS
+	ClientAuth   string // none, optional or require
+}
+
+// Reloader serves a certificate, and optionally a client CA pool, that are
+// reloaded from disk whenever the files change, so certificates can be
+// rotated without restarting the server.
+type Reloader struct {
+	opts Options
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+// NewReloader loads the configured files and returns a Reloader serving them.
+func NewReloader(opts Options) (*Reloader, error) {
+	r := &Reloader{opts: opts}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// files returns the files the Reloader depends on.
+func (r *Reloader) files() []string {
+	files := []string{r.opts.CertFile, r.opts.KeyFile}
+	if r.opts.ClientCAFile != "" {
+		files = append(files, r.opts.ClientCAFile)
+	}
+	return files
+}
+
+// Reload re-reads the files if any of them changed since the last load and
+// reports whether it did. On error the previously loaded files stay in use.
+func (r *Reloader) Reload() (bool, error) {
+	modTimes := make(map[string]time.Time)
+	changed := false
+	r.mu.RLock()
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			r.mu.RUnlock()
+			return false, err
+		}
+		modTimes[f] = info.ModTime()
+		if !info.ModTime().Equal(r.modTimes[f]) {
+			changed = true
+		}
+	}
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("reading client CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return false, errors.New("client CA file contains no certificates")
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCA = pool
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return true, nil
+}
+
+// Watch polls the files every interval and reloads them when they change,
+// until ctx is cancelled.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				slog.Error("failed to reload TLS certificates", "error", err)
+			} else if reloaded {
+				slog.Info("reloaded TLS certificates", "cert", r.opts.CertFile)
+			}
+		}
+	}
+}
+
+// TLSConfig returns a server configuration that always uses the most
+// recently loaded certificate and client CA pool.
+func (r *Reloader) TLSConfig() *tls.Config {
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		cfg := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*r.cert},
+		}
+		if r.clientCA != nil {
+			cfg.ClientCAs = r.clientCA
+			cfg.ClientAuth = clientAuthType(r.opts.ClientAuth)
+		}
+		return cfg, nil
+	}
+	return base
+}
+
+func clientAuthType(mode string) tls.ClientAuthType {
+	switch mode {
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven
+	default:
+		return tls.NoClientCert
+	}
+}
@@ -0,0 +1,544 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the effective application configuration. Values are layered:
+// defaults, then the config file, then environment variables, then flags.
+// The env and flag tags name the variable and flag that set each field;
+// fields tagged secret are masked when the configuration is printed.
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	TLS        TLSConfig        `yaml:"tls"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Auth       AuthConfig       `yaml:"auth"`
+	Limits     LimitsConfig     `yaml:"limits"`
+	Assignment AssignmentConfig `yaml:"assignment"`
+	Dedup      DedupConfig      `yaml:"dedup"`
+	Webhooks   WebhooksConfig   `yaml:"webhooks"`
+	Events     EventsConfig     `yaml:"events"`
+}
+
+// ServerConfig configures the HTTP listener.
+type ServerConfig struct {
+	Address         string        `yaml:"address" env:"SERVER_ADDRESS" flag:"address"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SERVER_SHUTDOWN_TIMEOUT" flag:"shutdown-timeout"`
+	// DrainDelay is how long the server keeps accepting requests after it
+	// starts reporting not ready, counted within ShutdownTimeout.
+	DrainDelay time.Duration `yaml:"drainDelay" env:"SERVER_DRAIN_DELAY" flag:"drain-delay"`
+}
+
+// TLSConfig enables HTTPS and, with a client CA, mutual TLS. Certificate
+// files are watched and reloaded every ReloadInterval without a restart.
+type TLSConfig struct {
+	CertFile       string        `yaml:"certFile" env:"TLS_CERT_FILE" flag:"tls-cert"`
+	KeyFile        string        `yaml:"keyFile" env:"TLS_KEY_FILE" flag:"tls-key"`
+	ClientCAFile   string        `yaml:"clientCAFile" env:"TLS_CLIENT_CA_FILE" flag:"tls-client-ca"`
+	ClientAuth     string        `yaml:"clientAuth" env:"TLS_CLIENT_AUTH" flag:"tls-client-auth"`
+	ReloadInterval time.Duration `yaml:"reloadInterval" env:"TLS_RELOAD_INTERVAL" flag:"tls-reload-interval"`
+}
+
+// Enabled reports whether the server should serve HTTPS.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// MutualTLS reports whether client certificates are verified and used for authentication.
+func (c TLSConfig) MutualTLS() bool {
+	return c.ClientCAFile != "" && c.ClientAuth != "none"
+}
+
+// DatabaseConfig configures the SQLite database.
+type DatabaseConfig struct {
+	Path string `yaml:"path" env:"DATABASE_PATH" flag:"db"`
+}
+
+// LoggingConfig configures the slog logger.
+type LoggingConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL" flag:"log-level"`
+	Format string `yaml:"format" env:"LOG_FORMAT" flag:"log-format"`
+	Redact bool   `yaml:"redact" env:"LOG_REDACT" flag:"log-redact"`
+}
+
+// TracingConfig selects the span exporter.
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter"`
+	File     string `yaml:"file" env:"TRACING_FILE" flag:"tracing-file"`
+}
+
+// AuthConfig configures request authentication. Authentication is enforced
+// as soon as at least one API key is configured.
+type AuthConfig struct {
+	// APIKeys maps API keys to the principal they authenticate. In the
+	// environment they are given as "key1=alice,key2=bob".
+	APIKeys map[string]string `yaml:"apiKeys" env:"AUTH_API_KEYS" secret:"true"`
+
+	// CertificatePrincipals maps client certificate subjects (common name or
+	// full distinguished name) to principals when mutual TLS is enabled. When
+	// empty, the common name is used as the principal.
+	CertificatePrincipals map[string]string `yaml:"certificatePrincipals" env:"AUTH_CERTIFICATE_PRINCIPALS"`
+}
+
+// LimitsConfig bounds request sizes and connection timeouts. Zero disables a limit.
+type LimitsConfig struct {
+	MaxBodyBytes int64         `yaml:"maxBodyBytes" env:"LIMITS_MAX_BODY_BYTES" flag:"max-body-bytes"`
+	ReadTimeout  time.Duration `yaml:"readTimeout" env:"LIMITS_READ_TIMEOUT" flag:"read-timeout"`
+	WriteTimeout time.Duration `yaml:"writeTimeout" env:"LIMITS_WRITE_TIMEOUT" flag:"write-timeout"`
+	IdleTimeout  time.Duration `yaml:"idleTimeout" env:"LIMITS_IDLE_TIMEOUT" flag:"idle-timeout"`
+}
+
+// AssignmentConfig configures how leads are matched to clients.
+type AssignmentConfig struct {
+	Strategy string `yaml:"strategy" env:"ASSIGNMENT_STRATEGY" flag:"assignment-strategy"`
+
+	// QueueInterval is how often queued leads are retried when no activity
+	// has triggered a retry, e.g. so they are assigned as working hours open.
+	QueueInterval time.Duration `yaml:"queueInterval" env:"ASSIGNMENT_QUEUE_INTERVAL" flag:"assignment-queue-interval"`
+
+	// ShareWindow is the rolling window over which the share strategy
+	// compares the leads delivered to each client with its target share.
+	ShareWindow time.Duration `yaml:"shareWindow" env:"ASSIGNMENT_SHARE_WINDOW" flag:"assignment-share-window"`
+
+	// StatusInterval is how often scheduled client status changes are
+	// checked and applied, which bounds how late they take effect.
+	StatusInterval time.Duration `yaml:"statusInterval" env:"ASSIGNMENT_STATUS_INTERVAL" flag:"assignment-status-interval"`
+
+	// StickyWindow is how long a person's later leads go back to the client
+	// their earlier lead was assigned to, while it is eligible. Zero
+	// disables sticky routing.
+	StickyWindow time.Duration `yaml:"stickyWindow" env:"ASSIGNMENT_STICKY_WINDOW" flag:"assignment-sticky-window"`
+}
+
+// DedupConfig configures duplicate lead detection, which is enabled by
+// listing at least one key.
+type DedupConfig struct {
+	// Keys are what leads are matched on: email, phone (in E.164 form) or
+	// namePostcode. A match on any one of them is a duplicate.
+	Keys []string `yaml:"keys" env:"DEDUP_KEYS" flag:"dedup-keys"`
+
+	// Window is how far back a new lead is matched against earlier ones.
+	Window time.Duration `yaml:"window" env:"DEDUP_WINDOW" flag:"dedup-window"`
+
+	// Policy is reject, to refuse duplicates, or attach, to store them
+	// unassigned and attached to the original lead.
+	Policy string `yaml:"policy" env:"DEDUP_POLICY" flag:"dedup-policy"`
+
+	// CountryCode is the calling code, without "+", assumed for phone
+	// numbers written without one, so that phone numbers are matched in
+	// E.164 form, by duplicate detection and sticky routing. Without it
+	// numbers are matched as written.
+	CountryCode string `yaml:"countryCode" env:"DEDUP_COUNTRY_CODE" flag:"dedup-country-code"`
+
+	// PostcodeAttribute names the lead attribute holding the postcode for
+	// the namePostcode key.
+	PostcodeAttribute string `yaml:"postcodeAttribute" env:"DEDUP_POSTCODE_ATTRIBUTE" flag:"dedup-postcode-attribute"`
+}
+
+// EventsConfig configures the activity event stream.
+type EventsConfig struct {
+	// BufferSize is the number of recent events kept so that streams can resume.
+	BufferSize int `yaml:"bufferSize" env:"EVENTS_BUFFER_SIZE" flag:"events-buffer-size"`
+}
+
+// WebhooksConfig configures webhook delivery. Failed deliveries are retried
+// with exponential backoff and dead-lettered after MaxAttempts.
+type WebhooksConfig struct {
+	PollInterval   time.Duration `yaml:"pollInterval" env:"WEBHOOKS_POLL_INTERVAL" flag:"webhooks-poll-interval"`
+	Timeout        time.Duration `yaml:"timeout" env:"WEBHOOKS_TIMEOUT" flag:"webhooks-timeout"`
+	MaxAttempts    int           `yaml:"maxAttempts" env:"WEBHOOKS_MAX_ATTEMPTS" flag:"webhooks-max-attempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff" env:"WEBHOOKS_INITIAL_BACKOFF" flag:"webhooks-initial-backoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff" env:"WEBHOOKS_MAX_BACKOFF" flag:"webhooks-max-backoff"`
+}
+
+// Assignment strategies.
+const (
+	StrategyPriority = "priority"
+	StrategyShare    = "share"
+)
+
+// strategies lists the valid values of AssignmentConfig.Strategy.
+var strategies = []string{StrategyPriority, StrategyShare}
+
+// dedupKeys and dedupPolicies list the valid values of DedupConfig.Keys and
+// DedupConfig.Policy.
+var (
+	dedupKeys     = []string{"email", "phone", "namePostcode"}
+	dedupPolicies = []string{"reject", "attach"}
+)
+
+// Default returns the built-in configuration.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Address:         ":8080",
+			ShutdownTimeout: 5 * time.Second,
+		},
+		TLS: TLSConfig{
+			ClientAuth:     "require",
+			ReloadInterval: time.Minute,
+		},
+		Database: DatabaseConfig{
+			Path: "lead_management.db",
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+			Redact: true,
+		},
+		Limits: LimitsConfig{
+			MaxBodyBytes: 1 << 20,
+			ReadTimeout:  10 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		},
+		Assignment: AssignmentConfig{
+			Strategy:       StrategyPriority,
+			QueueInterval:  time.Minute,
+			ShareWindow:    24 * time.Hour,
+			StatusInterval: time.Minute,
+		},
+		Dedup: DedupConfig{
+			Window:            24 * time.Hour,
+			Policy:            "reject",
+			PostcodeAttribute: "postcode",
+		},
+		Webhooks: WebhooksConfig{
+			PollInterval:   time.Second,
+			Timeout:        10 * time.Second,
+			MaxAttempts:    8,
+			InitialBackoff: 30 * time.Second,
+			MaxBackoff:     time.Hour,
+		},
+		Events: EventsConfig{
+			BufferSize: 10000,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the file named by --config or
+// CONFIG_FILE, environment variables and command-line flags, and validates it.
+// It also reports whether --print-config was given.
+func Load(args []string, getenv func(string) string) (cfg Config, printConfig bool, err error) {
+	cfg = Default()
+
+	fs := flag.NewFlagSet("lead_management", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("CONFIG_FILE"), "path to a YAML or JSON config file")
+	fs.BoolVar(&printConfig, "print-config", false, "print the effective configuration and exit")
+
+	// Flag values are collected first and applied last so they take
+	// precedence over the file and the environment.
+	flagValues := make(map[string]string)
+	for _, f := range fields(&cfg) {
+		name := f.flag
+		if name == "" {
+			continue
+		}
+		fs.Func(name, f.path, func(v string) error {
+			flagValues[name] = v
+			return nil
+		})
+	}
+	if err = fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+
+	if *configFile != "" {
+		if err = loadFile(&cfg, *configFile); err != nil {
+			return cfg, false, err
+		}
+	}
+
+	for _, f := range fields(&cfg) {
+		if f.env == "" {
+			continue
+		}
+		if v := getenv(f.env); v != "" {
+			if err = f.set(v); err != nil {
+				return cfg, false, fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+	}
+
+	for _, f := range fields(&cfg) {
+		if v, ok := flagValues[f.flag]; ok && f.flag != "" {
+			if err = f.set(v); err != nil {
+				return cfg, false, fmt.Errorf("--%s: %w", f.flag, err)
+			}
+		}
+	}
+
+	return cfg, printConfig, cfg.Validate()
+}
+
+// loadFile merges the YAML or JSON file at path into cfg. JSON is parsed
+// as YAML, of which it is a subset, so durations can be written as "5s" in both.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err = yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports all problems with the configuration at once.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Server.Address == "" {
+		errs = append(errs, errors.New("server.address must not be empty"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdownTimeout must be positive"))
+	}
+	if c.Server.DrainDelay < 0 || c.Server.DrainDelay >= c.Server.ShutdownTimeout {
+		errs = append(errs, errors.New("server.drainDelay must not be negative and must be shorter than server.shutdownTimeout"))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls.certFile and tls.keyFile must be set together"))
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled() {
+		errs = append(errs, errors.New("tls.clientCAFile requires tls.certFile and tls.keyFile"))
+	}
+	switch c.TLS.ClientAuth {
+	case "none", "optional", "require":
+	default:
+		errs = append(errs, fmt.Errorf("tls.clientAuth %q must be none, optional or require", c.TLS.ClientAuth))
+	}
+	if c.TLS.ReloadInterval <= 0 {
+		errs = append(errs, errors.New("tls.reloadInterval must be positive"))
+	}
+	if c.Database.Path == "" {
+		errs = append(errs, errors.New("database.path must not be empty"))
+	}
+	switch strings.ToLower(c.Logging.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("logging.level %q must be debug, info, warn or error", c.Logging.Level))
+	}
+	switch strings.ToLower(c.Logging.Format) {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("logging.format %q must be text or json", c.Logging.Format))
+	}
+	switch c.Tracing.Exporter {
+	case "", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			errs = append(errs, errors.New("tracing.file is required with the file exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter %q must be empty, stdout or file", c.Tracing.Exporter))
+	}
+	for key, principal := range c.Auth.APIKeys {
+		if key == "" || principal == "" {
+			errs = append(errs, errors.New("auth.apiKeys entries need both a key and a principal"))
+			break
+		}
+	}
+	if c.Limits.MaxBodyBytes < 0 || c.Limits.ReadTimeout < 0 || c.Limits.WriteTimeout < 0 || c.Limits.IdleTimeout < 0 {
+		errs = append(errs, errors.New("limits must not be negative"))
+	}
+	if !contains(strategies, c.Assignment.Strategy) {
+		errs = append(errs, fmt.Errorf("assignment.strategy %q must be one of %s", c.Assignment.Strategy, strings.Join(strategies, ", ")))
+	}
+	if c.Assignment.QueueInterval <= 0 {
+		errs = append(errs, errors.New("assignment.queueInterval must be positive"))
+	}
+	if c.Assignment.ShareWindow <= 0 {
+		errs = append(errs, errors.New("assignment.shareWindow must be positive"))
+	}
+	if c.Assignment.StatusInterval <= 0 {
+		errs = append(errs, errors.New("assignment.statusInterval must be positive"))
+	}
+	if c.Assignment.StickyWindow < 0 {
+		errs = append(errs, errors.New("assignment.stickyWindow must not be negative"))
+	}
+	for _, key := range c.Dedup.Keys {
+		if !contains(dedupKeys, key) {
+			errs = append(errs, fmt.Errorf("dedup.keys entry %q must be one of %s", key, strings.Join(dedupKeys, ", ")))
+		}
+	}
+	if c.Dedup.Window <= 0 {
+		errs = append(errs, errors.New("dedup.window must be positive"))
+	}
+	if !contains(dedupPolicies, c.Dedup.Policy) {
+		errs = append(errs, fmt.Errorf("dedup.policy %q must be one of %s", c.Dedup.Policy, strings.Join(dedupPolicies, ", ")))
+	}
+	if n := len(c.Dedup.CountryCode); n > 3 || strings.Trim(c.Dedup.CountryCode, "0123456789") != "" || strings.HasPrefix(c.Dedup.CountryCode, "0") {
+		errs = append(errs, errors.New("dedup.countryCode must be a calling code of 1 to 3 digits"))
+	}
+	if c.Webhooks.PollInterval <= 0 || c.Webhooks.Timeout <= 0 {
+		errs = append(errs, errors.New("webhooks.pollInterval and webhooks.timeout must be positive"))
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, errors.New("webhooks.maxAttempts must be at least 1"))
+	}
+	if c.Webhooks.InitialBackoff <= 0 || c.Webhooks.MaxBackoff < c.Webhooks.InitialBackoff {
+		errs = append(errs, errors.New("webhooks.initialBackoff must be positive and not exceed webhooks.maxBackoff"))
+	}
+	if c.Events.BufferSize < 1 {
+		errs = append(errs, errors.New("events.bufferSize must be at least 1"))
+	}
+	return errors.Join(errs...)
+}
+
+// Print writes the configuration as YAML with secret values masked.
+func (c Config) Print(w io.Writer) error {
+	masked := c
+	for _, f := range fields(&masked) {
+		if f.secret {
+			f.mask()
+		}
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(masked); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// field is a settable leaf of the configuration tree.
+type field struct {
+	path   string
+	env    string
+	flag   string
+	secret bool
+	value  reflect.Value
+}
+
+// fields returns the leaf fields of cfg in declaration order.
+func fields(cfg *Config) []field {
+	var out []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+			path := name
+			if prefix != "" {
+				path = prefix + "." + name
+			}
+			if sf.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), path)
+				continue
+			}
+			out = append(out, field{
+				path:   path,
+				env:    sf.Tag.Get("env"),
+				flag:   sf.Tag.Get("flag"),
+				secret: sf.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return out
+}
+
+// set parses s into the field according to its type.
+func (f field) set(s string) error {
+	switch f.value.Interface().(type) {
+	case string:
+		f.value.SetString(s)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(d))
+	case int, int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(n)
+	case []string:
+		f.value.Set(reflect.ValueOf(splitList(s)))
+	case map[string]string:
+		m := make(map[string]string)
+		for _, pair := range splitList(s) {
+			// Split on the last "=" so keys such as distinguished names or
+			// padded base64 API keys may contain "=" themselves.
+			i := strings.LastIndex(pair, "=")
+			if i < 0 {
+				return fmt.Errorf("expected key=value, got %q", pair)
+			}
+			m[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+		}
+		f.value.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported config type %s", f.value.Type())
+	}
+	return nil
+}
+
+// mask replaces a secret value with a placeholder that keeps its shape.
+func (f field) mask() {
+	const placeholder = "****"
+	switch v := f.value.Interface().(type) {
+	case string:
+		if v != "" {
+			f.value.SetString(placeholder)
+		}
+	case []string:
+		masked := make([]string, len(v))
+		for i := range masked {
+			masked[i] = placeholder
+		}
+		f.value.Set(reflect.ValueOf(masked))
+	case map[string]string:
+		// Keys are the secrets (e.g. API keys); values stay visible.
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		masked := make(map[string]string, len(v))
+		for i, k := range keys {
+			masked[fmt.Sprintf("%s%d", placeholder, i+1)] = v[k]
+		}
+		f.value.Set(reflect.ValueOf(masked))
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
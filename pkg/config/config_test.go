@@ -0,0 +1,160 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultIsValid(t *testing.T) {
+	require.NoError(t, Default().Validate())
+}
+
+func TestLoadLayering(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte(`
+server:
+  address: ":9000"
+  shutdownTimeout: 10s
+database:
+  path: /data/file.db
+logging:
+  level: warn
+`), 0o600))
+	jsonFile := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{"server": {"address": ":9100"}, "limits": {"readTimeout": "3s"}}`), 0o600))
+
+	tests := []struct {
+		name   string
+		args   []string
+		env    map[string]string
+		verify func(t *testing.T, cfg Config)
+	}{
+		{
+			name: "Defaults only",
+			verify: func(t *testing.T, cfg Config) {
+				assert.Equal(t, Default(), cfg)
+			},
+		},
+		{
+			name: "YAML file overrides defaults",
+			args: []string{"--config", yamlFile},
+			verify: func(t *testing.T, cfg Config) {
+				assert.Equal(t, ":9000", cfg.Server.Address)
+				assert.Equal(t, 10*time.Second, cfg.Server.ShutdownTimeout)
+				assert.Equal(t, "/data/file.db", cfg.Database.Path)
+				assert.Equal(t, "warn", cfg.Logging.Level)
+				assert.Equal(t, "text", cfg.Logging.Format)
+			},
+		},
+		{
+			name: "JSON file named in the environment",
+			env:  map[string]string{"CONFIG_FILE": jsonFile},
+			verify: func(t *testing.T, cfg Config) {
+				assert.Equal(t, ":9100", cfg.Server.Address)
+				assert.Equal(t, 3*time.Second, cfg.Limits.ReadTimeout)
+			},
+		},
+		{
+			name: "Environment overrides file",
+			args: []string{"--config", yamlFile},
+			env: map[string]string{
+				"SERVER_ADDRESS": ":9001",
+				"LOG_REDACT":     "false",
+				"AUTH_API_KEYS":  "k1=alice, k2==bob",
+			},
+			verify: func(t *testing.T, cfg Config) {
+				assert.Equal(t, ":9001", cfg.Server.Address)
+				assert.False(t, cfg.Logging.Redact)
+				assert.Equal(t, map[string]string{"k1": "alice", "k2=": "bob"}, cfg.Auth.APIKeys)
+				assert.Equal(t, "/data/file.db", cfg.Database.Path)
+			},
+		},
+		{
+			name: "Flags override environment",
+			args: []string{"--config", yamlFile, "--address", ":9002", "--log-level", "debug"},
+			env:  map[string]string{"SERVER_ADDRESS": ":9001"},
+			verify: func(t *testing.T, cfg Config) {
+				assert.Equal(t, ":9002", cfg.Server.Address)
+				assert.Equal(t, "debug", cfg.Logging.Level)
+			},
+		},
+		{
+			name: "Dedup keys as a list",
+			args: []string{"--dedup-keys", "email, namePostcode", "--dedup-policy", "attach"},
+			verify: func(t *testing.T, cfg Config) {
+				assert.Equal(t, []string{"email", "namePostcode"}, cfg.Dedup.Keys)
+				assert.Equal(t, "attach", cfg.Dedup.Policy)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, printConfig, err := Load(tc.args, func(key string) string { return tc.env[key] })
+			require.NoError(t, err)
+			assert.False(t, printConfig)
+			tc.verify(t, cfg)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{name: "Unknown flag", args: []string{"--nope"}},
+		{name: "Missing config file", args: []string{"--config", "/does/not/exist.yaml"}},
+		{name: "Malformed duration", env: map[string]string{"SERVER_SHUTDOWN_TIMEOUT": "soon"}},
+		{name: "Drain delay past shutdown timeout", args: []string{"--drain-delay", "5s"}},
+		{name: "Invalid log level", args: []string{"--log-level", "loud"}},
+		{name: "File exporter without file", env: map[string]string{"TRACING_EXPORTER": "file"}},
+		{name: "Unknown strategy", args: []string{"--assignment-strategy", "random"}},
+		{name: "Empty share window", env: map[string]string{"ASSIGNMENT_SHARE_WINDOW": "0s"}},
+		{name: "Empty status interval", args: []string{"--assignment-status-interval", "0s"}},
+		{name: "Negative sticky window", env: map[string]string{"ASSIGNMENT_STICKY_WINDOW": "-1h"}},
+		{name: "Unknown dedup key", args: []string{"--dedup-keys", "email,address"}},
+		{name: "Empty dedup window", env: map[string]string{"DEDUP_WINDOW": "0s"}},
+		{name: "Unknown dedup policy", args: []string{"--dedup-policy", "ignore"}},
+		{name: "Malformed country code", env: map[string]string{"DEDUP_COUNTRY_CODE": "+44"}},
+		{name: "Malformed API keys", env: map[string]string{"AUTH_API_KEYS": "no-principal"}},
+		{name: "Certificate without key", args: []string{"--tls-cert", "server.crt"}},
+		{name: "Client CA without certificate", args: []string{"--tls-client-ca", "ca.crt"}},
+		{name: "Unknown client auth mode", args: []string{"--tls-cert", "a", "--tls-key", "b", "--tls-client-auth", "maybe"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := Load(tc.args, func(key string) string { return tc.env[key] })
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPrintMasksSecrets(t *testing.T) {
+	cfg, printConfig, err := Load([]string{"--print-config"}, func(key string) string {
+		if key == "AUTH_API_KEYS" {
+			return "super-secret=alice"
+		}
+		return ""
+	})
+	require.NoError(t, err)
+	assert.True(t, printConfig)
+
+	var buf bytes.Buffer
+	require.NoError(t, cfg.Print(&buf))
+	assert.NotContains(t, buf.String(), "super-secret")
+	assert.Contains(t, buf.String(), "alice")
+	assert.Contains(t, buf.String(), "address: :8080")
+
+	// Printing must not modify the configuration itself.
+	assert.Equal(t, "alice", cfg.Auth.APIKeys["super-secret"])
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"lead_management/pkg/attributes"
+	"lead_management/pkg/models"
+	"lead_management/pkg/rules"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefineAttribute creates or replaces a custom attribute definition. Values
+// already stored are not revalidated.
+func (db *DB) DefineAttribute(ctx context.Context, def models.AttributeDefinition) error {
+	ctx, done := trace(ctx, "define_attribute")
+	defer done()
+
+	values, err := json.Marshal(def.Values)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO attribute_definitions (entity, name, type, enumValues, required) VALUES (?, ?, ?, ?, ?)
+        ON CONFLICT (entity, name) DO UPDATE SET type = excluded.type, enumValues = excluded.enumValues, required = excluded.required`,
+		def.Entity, def.Name, def.Type, string(values), def.Required)
+	if err != nil {
+		slog.Error("failed to define attribute", "entity", def.Entity, "name", def.Name, "error", err)
+		return err
+	}
+	slog.Info("attribute defined", "entity", def.Entity, "name", def.Name, "type", def.Type)
+	return nil
+}
+
+// DeleteAttribute removes a custom attribute definition and reports whether
+// it existed. Values already stored are kept.
+func (db *DB) DeleteAttribute(ctx context.Context, entity, name string) (bool, error) {
+	ctx, done := trace(ctx, "delete_attribute")
+	defer done()
+
+	res, err := db.ExecContext(ctx, `DELETE FROM attribute_definitions WHERE entity = ? AND name = ?`, entity, name)
+	if err != nil {
+		slog.Error("failed to delete attribute", "entity", entity, "name", name, "error", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetAttributeDefinitions returns the custom attributes of clients or leads,
+// by name.
+func (db *DB) GetAttributeDefinitions(ctx context.Context, entity string) ([]models.AttributeDefinition, error) {
+	ctx, done := trace(ctx, "get_attribute_definitions")
+	defer done()
+
+	return attributeDefinitions(ctx, db, entity)
+}
+
+// attributeDefinitions reads definitions using q, which may be a transaction.
+func attributeDefinitions(ctx context.Context, q queryer, entity string) ([]models.AttributeDefinition, error) {
+	rows, err := q.QueryContext(ctx, `SELECT entity, name, type, enumValues, required FROM attribute_definitions WHERE entity = ? ORDER BY name`, entity)
+	if err != nil {
+		slog.Error("failed to query attribute definitions", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var defs []models.AttributeDefinition
+	for rows.Next() {
+		var def models.AttributeDefinition
+		var values string
+		if err := rows.Scan(&def.Entity, &def.Name, &def.Type, &values, &def.Required); err != nil {
+			slog.Error("failed to scan attribute definition", "error", err)
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(values), &def.Values); err != nil {
+			return nil, err
+		}
+		if len(def.Values) == 0 {
+			def.Values = nil
+		}
+		defs = append(defs, def)
+	}
+	return defs, rows.Err()
+}
+
+// validateAttributes checks an entity's attribute values against the
+// definitions, returning an *attributes.Error if they do not conform.
+func validateAttributes(ctx context.Context, q queryer, entity string, values map[string]any) error {
+	defs, err := attributeDefinitions(ctx, q, entity)
+	if err != nil {
+		return err
+	}
+	return attributes.Validate(defs, values)
+}
+
+// clientAttributes validates c's attributes, and its criteria and rule,
+// which refer to lead attributes, and returns the attribute and criteria
+// column values.
+func clientAttributes(ctx context.Context, q queryer, c models.Client) (attrs, criteria string, err error) {
+	if err := validateAttributes(ctx, q, models.EntityClient, c.Attributes); err != nil {
+		return "", "", err
+	}
+	if len(c.Criteria) > 0 || c.Rule != "" {
+		defs, err := attributeDefinitions(ctx, q, models.EntityLead)
+		if err != nil {
+			return "", "", err
+		}
+		if err := attributes.CheckCriteria(defs, c.Criteria); err != nil {
+			return "", "", err
+		}
+		if c.Rule != "" {
+			if _, err := rules.Compile(c.Rule, defs); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	if attrs, err = marshalAttributes(c.Attributes); err != nil {
+		return "", "", err
+	}
+	criteria = "[]"
+	if len(c.Criteria) > 0 {
+		raw, err := json.Marshal(c.Criteria)
+		if err != nil {
+			return "", "", err
+		}
+		criteria = string(raw)
+	}
+	return attrs, criteria, nil
+}
+
+// unmarshalCriteria decodes a criteria column value, leaving no criteria nil.
+func unmarshalCriteria(data string) ([]models.Criterion, error) {
+	var criteria []models.Criterion
+	if err := json.Unmarshal([]byte(data), &criteria); err != nil || len(criteria) == 0 {
+		return nil, err
+	}
+	return criteria, nil
+}
+
+// marshalAttributes returns the JSON column value for attribute values.
+func marshalAttributes(values map[string]any) (string, error) {
+	if len(values) == 0 {
+		return "{}", nil
+	}
+	raw, err := json.Marshal(values)
+	return string(raw), err
+}
+
+// unmarshalAttributes decodes a JSON column value, leaving no attributes nil.
+func unmarshalAttributes(data string) (map[string]any, error) {
+	var values map[string]any
+	if err := json.Unmarshal([]byte(data), &values); err != nil || len(values) == 0 {
+		return nil, err
+	}
+	return values, nil
+}
+
+// attributeConditions returns SQL conditions matching rows whose attributes
+// column holds each of the given values.
+func attributeConditions(values map[string]any) ([]string, []any) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var conditions []string
+	var args []any
+	for _, name := range names {
+		conditions = append(conditions, "json_extract(attributes, ?) = ?")
+		args = append(args, `$."`+strings.ReplaceAll(name, `"`, ``)+`"`, values[name])
+	}
+	return conditions, args
+}
+
+// ruleMet reports whether lead meets c's rule, if it has one, at now in c's
+// time zone. Rules that can no longer be evaluated are not met.
+func ruleMet(c models.Client, lead models.Lead, now time.Time) bool {
+	if c.Rule == "" {
+		return true
+	}
+	loc, err := rules.Location(c.Timezone)
+	if err != nil {
+		slog.Error("failed to load client time zone", "client", c.ID, "timezone", c.Timezone, "error", err)
+		return false
+	}
+	met, err := rules.Eval(c.Rule, lead.Attributes, now.In(loc))
+	if err != nil {
+		slog.Error("failed to evaluate client rule", "client", c.ID, "error", err)
+		return false
+	}
+	return met
+}
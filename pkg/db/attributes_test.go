@@ -0,0 +1,283 @@
+package db
+
+import (
+	"context"
+	"lead_management/pkg/attributes"
+	"lead_management/pkg/models"
+	"lead_management/pkg/rules"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAttributes(t *testing.T, database *DB, defs []models.AttributeDefinition) {
+	for _, def := range defs {
+		require.NoError(t, database.DefineAttribute(context.Background(), def))
+	}
+}
+
+func TestAttributeDefinitions(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+
+	region := models.AttributeDefinition{Entity: models.EntityClient, Name: "region", Type: models.AttributeEnum, Values: []string{"emea", "apac"}}
+	setupAttributes(t, database, []models.AttributeDefinition{
+		region,
+		{Entity: models.EntityLead, Name: "language", Type: models.AttributeString},
+	})
+
+	defs, err := database.GetAttributeDefinitions(ctx, models.EntityClient)
+	require.NoError(t, err)
+	assert.Equal(t, []models.AttributeDefinition{region}, defs)
+
+	// Defining an attribute again replaces it.
+	region.Required = true
+	require.NoError(t, database.DefineAttribute(ctx, region))
+	defs, err = database.GetAttributeDefinitions(ctx, models.EntityClient)
+	require.NoError(t, err)
+	assert.Equal(t, []models.AttributeDefinition{region}, defs)
+
+	found, err := database.DeleteAttribute(ctx, models.EntityClient, "region")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = database.DeleteAttribute(ctx, models.EntityClient, "region")
+	require.NoError(t, err)
+	assert.False(t, found)
+	defs, err = database.GetAttributeDefinitions(ctx, models.EntityClient)
+	require.NoError(t, err)
+	assert.Empty(t, defs)
+}
+
+func TestClientAttributes(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupAttributes(t, database, []models.AttributeDefinition{
+		{Entity: models.EntityClient, Name: "region", Type: models.AttributeEnum, Values: []string{"emea", "apac"}, Required: true},
+		{Entity: models.EntityClient, Name: "seats", Type: models.AttributeNumber},
+		{Entity: models.EntityClient, Name: "vip", Type: models.AttributeBoolean},
+	})
+
+	var attrErr *attributes.Error
+	err := database.CreateClient(ctx, models.Client{ID: "x", Name: "X", WorkingHours: allDay})
+	require.ErrorAs(t, err, &attrErr)
+	assert.Equal(t, "region", attrErr.Attribute)
+
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "a", Name: "A", WorkingHours: allDay, Attributes: map[string]any{"region": "emea", "seats": 10.0, "vip": true}},
+		{ID: "b", Name: "B", WorkingHours: allDay, Attributes: map[string]any{"region": "apac", "seats": 10.0}},
+		{ID: "c", Name: "C", WorkingHours: allDay, Attributes: map[string]any{"region": "emea", "seats": 2.5}},
+	})
+
+	client, err := database.GetClientByID(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"region": "emea", "seats": 10.0, "vip": true}, client.Attributes)
+
+	tests := []struct {
+		name     string
+		filter   map[string]any
+		expected []string
+	}{
+		{name: "Enum", filter: map[string]any{"region": "emea"}, expected: []string{"a", "c"}},
+		{name: "Number", filter: map[string]any{"seats": 10.0}, expected: []string{"a", "b"}},
+		{name: "Fractional number", filter: map[string]any{"seats": 2.5}, expected: []string{"c"}},
+		{name: "Boolean", filter: map[string]any{"vip": true}, expected: []string{"a"}},
+		{name: "Several attributes", filter: map[string]any{"region": "emea", "seats": 10.0}, expected: []string{"a"}},
+		{name: "No match", filter: map[string]any{"region": "apac", "vip": true}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clients, err := database.ListClients(ctx, ClientFilter{Attributes: tc.filter})
+			require.NoError(t, err)
+			var ids []string
+			for _, c := range clients {
+				ids = append(ids, c.ID)
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+
+	client.Attributes["region"] = "amer"
+	_, err = database.UpdateClient(ctx, *client)
+	require.ErrorAs(t, err, &attrErr)
+	assert.Equal(t, "region", attrErr.Attribute)
+
+	result, err := database.ImportClients(ctx, []models.Client{
+		{ID: "d", Name: "D", WorkingHours: allDay, Attributes: map[string]any{"region": "emea"}},
+		{ID: "e", Name: "E", WorkingHours: allDay, Attributes: map[string]any{"region": "emea", "vip": "yes"}},
+	}, ImportOptions{})
+	require.NoError(t, err)
+	require.Len(t, result.Rejected, 1)
+	assert.Equal(t, 1, result.Rejected[0].Index)
+	require.ErrorAs(t, result.Rejected[0].Err, &attrErr)
+	assert.Equal(t, "vip", attrErr.Attribute)
+	created, err := database.GetClientByID(ctx, "d")
+	require.NoError(t, err)
+	assert.Nil(t, created)
+}
+
+func TestLeadAttributes(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	setupDatabase(database)
+	setupAttributes(t, database, []models.AttributeDefinition{
+		{Entity: models.EntityLead, Name: "language", Type: models.AttributeEnum, Values: []string{"en", "de"}},
+	})
+
+	_, err := database.AssignLead(ctx, models.Lead{ID: "bad", Attributes: map[string]any{"language": "fr"}})
+	var attrErr *attributes.Error
+	require.ErrorAs(t, err, &attrErr)
+	lead, err := database.GetLeadByID(ctx, "bad")
+	require.NoError(t, err)
+	assert.Nil(t, lead)
+
+	for _, l := range []models.Lead{
+		{ID: "l1", Attributes: map[string]any{"language": "en"}},
+		{ID: "l2", Attributes: map[string]any{"language": "de"}},
+		{ID: "l3", Attributes: map[string]any{"language": "en"}},
+	} {
+		_, err := database.AssignLead(ctx, l)
+		require.NoError(t, err)
+	}
+
+	leads, err := database.ListLeads(ctx, LeadFilter{Attributes: map[string]any{"language": "en"}})
+	require.NoError(t, err)
+	require.Len(t, leads, 2)
+	assert.Equal(t, "l3", leads[0].ID)
+	assert.Equal(t, map[string]any{"language": "en"}, leads[0].Attributes)
+	assert.Equal(t, "l1", leads[1].ID)
+
+	leads, err = database.ListLeads(ctx, LeadFilter{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, leads, 1)
+	assert.Equal(t, "l3", leads[0].ID)
+}
+
+func TestCriteriaRouting(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	minScore := 50.0
+	setupAttributes(t, database, []models.AttributeDefinition{
+		{Entity: models.EntityLead, Name: "country", Type: models.AttributeString},
+		{Entity: models.EntityLead, Name: "score", Type: models.AttributeNumber},
+	})
+
+	var attrErr *attributes.Error
+	err := database.CreateClient(ctx, models.Client{ID: "x", Name: "X", WorkingHours: allDay, Criteria: []models.Criterion{{Attribute: "budget", Min: &minScore}}})
+	require.ErrorAs(t, err, &attrErr)
+	assert.Equal(t, "budget", attrErr.Attribute)
+
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "dach", Name: "DACH", Priority: 10, LeadCapacity: 10, WorkingHours: allDay, Criteria: []models.Criterion{
+			{Attribute: "country", In: []any{"DE", "AT", "CH"}},
+			{Attribute: "score", Min: &minScore},
+		}},
+		{ID: "general", Name: "General", Priority: 1, LeadCapacity: 1, WorkingHours: allDay},
+	})
+
+	client, err := database.GetClientByID(ctx, "dach")
+	require.NoError(t, err)
+	assert.Len(t, client.Criteria, 2)
+
+	tests := []struct {
+		name           string
+		lead           models.Lead
+		expectedStatus string
+		expectedClient string
+	}{
+		{name: "Lead meets criteria", lead: models.Lead{ID: "l1", Attributes: map[string]any{"country": "AT", "score": 80.0}}, expectedStatus: models.LeadAssigned, expectedClient: "dach"},
+		{name: "Score too low", lead: models.Lead{ID: "l2", Attributes: map[string]any{"country": "DE", "score": 20.0}}, expectedStatus: models.LeadAssigned, expectedClient: "general"},
+		{name: "No client accepts the lead", lead: models.Lead{ID: "l3", Attributes: map[string]any{"country": "FR"}}, expectedStatus: models.LeadQueued},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lead, err := database.AssignLead(ctx, tc.lead)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStatus, lead.Status)
+			assert.Equal(t, tc.expectedClient, lead.ClientID)
+		})
+	}
+
+	explanation, err := database.ExplainLead(ctx, "l2")
+	require.NoError(t, err)
+	require.Len(t, explanation.Candidates, 2)
+	assert.Equal(t, "dach", explanation.Candidates[0].Client.ID)
+	assert.Equal(t, []string{models.ReasonCriteriaNotMet}, explanation.Candidates[0].Reasons)
+	assert.Equal(t, []string{"score"}, explanation.Candidates[0].Misses)
+	assert.True(t, explanation.Candidates[1].Eligible)
+
+	// The queued lead no client accepts does not hold up those behind it.
+	client, err = database.GetClientByID(ctx, "dach")
+	require.NoError(t, err)
+	client.LeadCapacity = client.CurrentLeadCount
+	_, err = database.UpdateClient(ctx, *client)
+	require.NoError(t, err)
+	lead, err := database.AssignLead(ctx, models.Lead{ID: "l4", Attributes: map[string]any{"country": "DE", "score": 90.0}})
+	require.NoError(t, err)
+	require.Equal(t, models.LeadQueued, lead.Status)
+	client.LeadCapacity = 10
+	client.Version = 0
+	_, err = database.UpdateClient(ctx, *client)
+	require.NoError(t, err)
+	assigned, err := database.AssignQueuedLeads(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, assigned)
+	lead, err = database.GetLeadByID(ctx, "l3")
+	require.NoError(t, err)
+	assert.Equal(t, models.LeadQueued, lead.Status)
+}
+
+func TestRuleRouting(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupAttributes(t, database, []models.AttributeDefinition{
+		{Entity: models.EntityLead, Name: "country", Type: models.AttributeString},
+		{Entity: models.EntityLead, Name: "budget", Type: models.AttributeNumber},
+	})
+
+	var ruleErr *rules.Error
+	err := database.CreateClient(ctx, models.Client{ID: "x", Name: "X", WorkingHours: allDay, Rule: `lead.budget > "5000"`})
+	require.ErrorAs(t, err, &ruleErr)
+
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "big", Name: "Big", Priority: 10, LeadCapacity: 10, WorkingHours: allDay, Rule: `lead.country in ["DE", "AT"] && lead.budget > 5000`, Timezone: "Europe/Berlin"},
+		{ID: "general", Name: "General", Priority: 1, LeadCapacity: 10, WorkingHours: allDay},
+	})
+
+	lead, err := database.AssignLead(ctx, models.Lead{ID: "l1", Attributes: map[string]any{"country": "DE", "budget": 9000.0}})
+	require.NoError(t, err)
+	assert.Equal(t, "big", lead.ClientID)
+	lead, err = database.AssignLead(ctx, models.Lead{ID: "l2", Attributes: map[string]any{"country": "DE", "budget": 100.0}})
+	require.NoError(t, err)
+	assert.Equal(t, "general", lead.ClientID)
+
+	explanation, err := database.ExplainLead(ctx, "l2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.ReasonRuleNotMet}, explanation.Candidates[0].Reasons)
+
+	tests := []struct {
+		name     string
+		timezone string
+		at       time.Time
+		expected bool
+	}{
+		{name: "Friday evening in UTC", at: time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC), expected: true},
+		{name: "Already Saturday in Tokyo", timezone: "Asia/Tokyo", at: time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC)},
+		{name: "Unknown time zone", timezone: "Mars/Olympus", at: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := models.Client{ID: "c", Rule: `!now.weekend`, Timezone: tc.timezone}
+			assert.Equal(t, tc.expected, ruleMet(c, models.Lead{}, tc.at))
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"lead_management/pkg/models"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// recordChange appends the state of an entity after a change to the change
+// log, in the publisher's transaction.
+func (p *publisher) recordChange(ctx context.Context, entity, operation, id string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = p.q.ExecContext(ctx, `INSERT INTO changes (entity, entityId, operation, changedAt, data) VALUES (?, ?, ?, ?, ?)`,
+		entity, id, operation, p.now, string(raw))
+	if err != nil {
+		slog.Error("failed to record change", "entity", entity, "id", id, "error", err)
+	}
+	if entity == models.EntityGroup {
+		// A group's cap or priority may have been raised.
+		p.clientsChanged = true
+	}
+	return err
+}
+
+// recordLead appends a lead change and, for assigned leads, the assignment.
+func (p *publisher) recordLead(ctx context.Context, operation string, lead models.Lead) error {
+	if err := p.recordChange(ctx, models.EntityLead, operation, lead.ID, lead); err != nil {
+		return err
+	}
+	if lead.Status != models.LeadAssigned {
+		return nil
+	}
+	return p.recordChange(ctx, models.EntityAssignment, models.OperationInsert, lead.ID, models.Assignment{
+		LeadID:     lead.ID,
+		ClientID:   lead.ClientID,
+		AssignedAt: lead.AssignedAt,
+	})
+}
+
+// ErrInvalidCursor is returned by ParseCursor for malformed cursors.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FormatCursor returns the change log cursor for a sequence number.
+func FormatCursor(sequence int64) string {
+	return strconv.FormatInt(sequence, 10)
+}
+
+// ParseCursor returns the sequence number of a change log cursor. The empty
+// cursor is the start of the log.
+func ParseCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	sequence, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || sequence < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return sequence, nil
+}
+
+// GetChanges returns up to limit changes after the given sequence, in the
+// order they were made.
+func (db *DB) GetChanges(ctx context.Context, after int64, limit int) ([]models.Change, error) {
+	ctx, done := trace(ctx, "get_changes")
+	defer done()
+
+	return queryChanges(ctx, db, `SELECT sequence, entity, entityId, operation, changedAt, data FROM changes WHERE sequence > ? ORDER BY sequence LIMIT ?`, after, limit)
+}
+
+// GetLeadHistory returns the changes to the lead id and its assignments,
+// together with those of the leads merged into it, in the order they were
+// made. It returns no changes for an unknown lead.
+func (db *DB) GetLeadHistory(ctx context.Context, id string) ([]models.Change, error) {
+	ctx, done := trace(ctx, "get_lead_history")
+	defer done()
+
+	return queryChanges(ctx, db, `SELECT sequence, entity, entityId, operation, changedAt, data FROM changes
+		WHERE entity IN (?, ?) AND (entityId = ? OR entityId IN (SELECT id FROM leads WHERE status = ? AND duplicateOf = ?))
+		ORDER BY sequence`, models.EntityLead, models.EntityAssignment, id, models.LeadMerged, id)
+}
+
+// queryChanges runs a query selecting change columns.
+func queryChanges(ctx context.Context, q queryer, query string, args ...any) ([]models.Change, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("failed to query changes", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []models.Change
+	for rows.Next() {
+		var c models.Change
+		var sequence int64
+		var data string
+		if err := rows.Scan(&sequence, &c.Entity, &c.EntityID, &c.Operation, &c.ChangedAt, &data); err != nil {
+			slog.Error("failed to scan change row", "error", err)
+			return nil, err
+		}
+		c.Cursor = FormatCursor(sequence)
+		c.ChangedAt = c.ChangedAt.UTC()
+		c.Data = json.RawMessage(data)
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// backfillChanges seeds an empty change log with the current clients and
+// leads, so that databases created before the change log existed can be
+// mirrored from the start of the log.
+func backfillChanges(ctx context.Context, db *DB) error {
+	var empty bool
+	if err := db.QueryRowContext(ctx, `SELECT NOT EXISTS (SELECT 1 FROM changes)`).Scan(&empty); err != nil || !empty {
+		return err
+	}
+
+	clients, err := db.GetAllClients(ctx)
+	if err != nil {
+		return err
+	}
+	leads, err := queryLeads(ctx, db, `SELECT `+leadColumns+` FROM leads ORDER BY rowid`)
+	if err != nil {
+		return err
+	}
+	if len(clients) == 0 && len(leads) == 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	pub := db.publisher(tx, time.Now().UTC())
+	for _, c := range clients {
+		if err := pub.recordChange(ctx, models.EntityClient, models.OperationInsert, c.ID, c); err != nil {
+			return err
+		}
+	}
+	for _, l := range leads {
+		if err := pub.recordLead(ctx, models.OperationInsert, l); err != nil {
+			return err
+		}
+	}
+	slog.Info("change log backfilled", "clients", len(clients), "leads", len(leads))
+	return tx.Commit()
+}
+
+// queryLeads runs a query selecting leadColumns.
+func queryLeads(ctx context.Context, q queryer, query string, args ...any) ([]models.Lead, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("failed to query leads", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leads []models.Lead
+	for rows.Next() {
+		l, err := scanLead(rows)
+		if err != nil {
+			slog.Error("failed to scan lead row", "error", err)
+			return nil, err
+		}
+		leads = append(leads, l)
+	}
+	return leads, rows.Err()
+}
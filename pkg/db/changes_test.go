@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"lead_management/pkg/models"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfillChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leads.db")
+	ctx := context.Background()
+
+	// Simulate a database from before the change log existed.
+	database := InitDB(path)
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "1", Name: "Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay},
+	})
+	_, err := database.AssignLead(ctx, models.Lead{ID: "l1", Name: "Ada"})
+	require.NoError(t, err)
+	_, err = database.Exec(`DELETE FROM changes`)
+	require.NoError(t, err)
+	require.NoError(t, database.Close())
+
+	database = InitDB(path)
+
+	changes, err := database.GetChanges(ctx, 0, 100)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, models.EntityClient, changes[0].Entity)
+	assert.JSONEq(t, `{"id":"1","name":"Client","priority":1,"leadCapacity":10,"currentLeadCount":1,"workingHours":["0000-01-01T00:00:00Z","0000-01-01T23:59:00Z"],"version":1,"status":"active"}`, string(changes[0].Data))
+	assert.Equal(t, models.EntityLead, changes[1].Entity)
+	assert.Equal(t, models.EntityAssignment, changes[2].Entity)
+
+	// A log that is not empty is left alone.
+	require.NoError(t, database.Close())
+	database = InitDB(path)
+	defer database.Close()
+	changes, err = database.GetChanges(ctx, 0, 100)
+	require.NoError(t, err)
+	assert.Len(t, changes, 3)
+}
@@ -1,9 +1,17 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"lead_management/pkg/attributes"
+	"lead_management/pkg/events"
+	"lead_management/pkg/metrics"
 	"lead_management/pkg/models"
+	"lead_management/pkg/tracing"
 	"log"
+	"log/slog"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -12,6 +20,47 @@ import (
 // DB is a wrapper for the SQL database.
 type DB struct {
 	*sql.DB
+
+	// webhookQueued is signalled, without blocking, whenever webhook
+	// deliveries are enqueued so the dispatcher can send them right away.
+	webhookQueued chan struct{}
+
+	// clientsChanged is signalled, without blocking, whenever a change that
+	// may make a client eligible commits, so queued leads are retried.
+	clientsChanged chan struct{}
+
+	// events wakes event stream subscribers once stored events commit.
+	events *events.Broker
+
+	// eventBufferSize bounds the number of events kept in the events table.
+	eventBufferSize int
+
+	// shareWindow enables the share strategy when positive; see
+	// SetShareStrategy.
+	shareWindow time.Duration
+
+	// stickyWindow enables sticky routing when positive; see
+	// SetStickyWindow.
+	stickyWindow time.Duration
+
+	// dedup configures duplicate detection; see SetDedup.
+	dedup DedupOptions
+}
+
+// DefaultEventBufferSize is the number of events kept for stream resumption
+// unless changed with SetEventBufferSize.
+const DefaultEventBufferSize = 10000
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
 }
 
 // InitDB initializes and returns a database object.
@@ -21,178 +70,652 @@ func InitDB(dataSourceName string) *DB {
 		log.Fatalf("Error opening database: %v", err)
 	}
 
-	// Create the clients table if it does not already exist
-	createTableSQL := `CREATE TABLE IF NOT EXISTS clients (
-        id TEXT PRIMARY KEY,
-        name TEXT NOT NULL,
-        priority INTEGER NOT NULL,
-        leadCapacity INTEGER NOT NULL,
-        currentLeadCount INTEGER NOT NULL,
-        workingHoursStart TEXT NOT NULL,
-        workingHoursEnd TEXT NOT NULL
-    );`
-	if _, err = db.Exec(createTableSQL); err != nil {
+	// Every connection to ":memory:" opens a separate, empty database, so
+	// background workers must share the single connection.
+	if dataSourceName == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+
+	// Create the tables if they do not already exist
+	if err = migrate(db); err != nil {
 		log.Fatalf("Error creating table: %v", err)
-	} else {
-		log.Println("Clients table created or already exists.")
 	}
+	slog.Debug("tables created or already exist")
+
+	database := &DB{
+		DB:              db,
+		webhookQueued:   make(chan struct{}, 1),
+		clientsChanged:  make(chan struct{}, 1),
+		events:          events.NewBroker(),
+		eventBufferSize: DefaultEventBufferSize,
+	}
+	if err = backfillLeadIdentities(context.Background(), database, DedupOptions{}); err != nil {
+		log.Fatalf("Error backfilling lead identities: %v", err)
+	}
+	if err = backfillReceivedAt(context.Background(), database); err != nil {
+		log.Fatalf("Error backfilling lead receipt times: %v", err)
+	}
+	if err = backfillChanges(context.Background(), database); err != nil {
+		log.Fatalf("Error backfilling change log: %v", err)
+	}
+	if err = backfillClientVersions(context.Background(), database); err != nil {
+		log.Fatalf("Error backfilling client history: %v", err)
+	}
+	return database
+}
 
-	return &DB{db}
+// trace starts a span for a database operation and returns a function that
+// ends it and records the operation latency.
+func trace(ctx context.Context, operation string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "db."+operation)
+	span.SetAttribute("db.system", "sqlite")
+	span.SetAttribute("db.operation", operation)
+	return ctx, func() {
+		span.End()
+		metrics.ObserveQuery(operation, start)
+	}
+}
+
+// clientColumns lists the client columns in the order scanClient expects them.
+const clientColumns = `id, name, priority, leadCapacity, currentLeadCount, workingHoursStart, workingHoursEnd, version, groupId, attributes, criteria, rule, timezone, share, pacing, pacingCurve, throughputLimits, status, statusReason, fallbacks`
+
+// scanClient scans a row selected with clientColumns.
+func scanClient(row scanner) (models.Client, error) {
+	var c models.Client
+	var start, end, attrs, criteria, curve, limits, fallbacks string
+	if err := row.Scan(&c.ID, &c.Name, &c.Priority, &c.LeadCapacity, &c.CurrentLeadCount, &start, &end, &c.Version, &c.GroupID, &attrs, &criteria, &c.Rule, &c.Timezone, &c.Share, &c.Pacing, &curve, &limits, &c.Status, &c.StatusReason, &fallbacks); err != nil {
+		return c, err
+	}
+
+	var err error
+	if c.Attributes, err = unmarshalAttributes(attrs); err != nil {
+		slog.Error("failed to parse client attributes", "error", err)
+		return c, err
+	}
+	if c.Criteria, err = unmarshalCriteria(criteria); err != nil {
+		slog.Error("failed to parse client criteria", "error", err)
+		return c, err
+	}
+	if c.PacingCurve, err = unmarshalCurve(curve); err != nil {
+		slog.Error("failed to parse client pacing curve", "error", err)
+		return c, err
+	}
+	if c.ThroughputLimits, err = unmarshalLimits(limits); err != nil {
+		slog.Error("failed to parse client throughput limits", "error", err)
+		return c, err
+	}
+	if c.Fallbacks, err = unmarshalFallbacks(fallbacks); err != nil {
+		slog.Error("failed to parse client fallbacks", "error", err)
+		return c, err
+	}
+	c.WorkingHours[0], err = time.Parse("15:04", start)
+	if err != nil {
+		slog.Error("failed to parse working hours start", "error", err)
+		return c, err
+	}
+	c.WorkingHours[1], err = time.Parse("15:04", end)
+	if err != nil {
+		slog.Error("failed to parse working hours end", "error", err)
+		return c, err
+	}
+	return c, nil
 }
 
 // CreateClient inserts a new client into the database.
-func (db *DB) CreateClient(c models.Client) error {
-	tx, err := db.Begin()
+func (db *DB) CreateClient(ctx context.Context, c models.Client) error {
+	ctx, done := trace(ctx, "create_client")
+	defer done()
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Error beginning transaction: %v", err)
+		slog.Error("failed to begin transaction", "error", err)
 		return err
 	}
+	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`INSERT INTO clients (id, name, priority, leadCapacity, currentLeadCount, workingHoursStart, workingHoursEnd) VALUES (?, ?, ?, ?, ?, ?, ?)`)
-	if err != nil {
-		log.Printf("Error preparing statement: %v", err)
+	pub := db.publisher(tx, time.Now().UTC())
+	if err := insertClient(ctx, tx, pub, c); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to commit transaction", "error", err)
 		return err
 	}
-	defer stmt.Close()
+	db.notify(pub)
+
+	slog.Info("client created", "client", c)
+	return nil
+}
 
-	_, err = stmt.Exec(c.ID, c.Name, c.Priority, c.LeadCapacity, c.CurrentLeadCount, c.WorkingHours[0].Format("15:04"), c.WorkingHours[1].Format("15:04"))
+// insertClient inserts a client at version 1, ignoring c.Version, and
+// records its creation in pub's transaction. It returns ErrGroupNotFound if
+// the client's group does not exist, ErrFallbackNotFound if one of its
+// fallback clients does not, an *attributes.Error if its attributes or
+// criteria do not match the definitions and a *rules.Error if its rule is
+// invalid.
+func insertClient(ctx context.Context, q queryer, pub *publisher, c models.Client) error {
+	if err := checkGroup(ctx, q, c.GroupID); err != nil {
+		return err
+	}
+	attrs, criteria, err := clientAttributes(ctx, q, c)
+	if err != nil {
+		return err
+	}
+	curve, err := marshalCurve(c.PacingCurve)
+	if err != nil {
+		return err
+	}
+	limits, err := marshalLimits(c.ThroughputLimits)
+	if err != nil {
+		return err
+	}
+	fallbacks, err := checkFallbacks(ctx, q, c.Fallbacks)
 	if err != nil {
-		log.Printf("Error executing statement: %v", err)
-		tx.Rollback()
 		return err
 	}
+	if c.Status == "" {
+		c.Status = models.ClientActive
+	}
+	c.Version = 1
+	_, err = q.ExecContext(ctx, `INSERT INTO clients (`+clientColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.Name, c.Priority, c.LeadCapacity, c.CurrentLeadCount, c.WorkingHours[0].Format("15:04"), c.WorkingHours[1].Format("15:04"), c.Version, c.GroupID, attrs, criteria, c.Rule, c.Timezone, c.Share, c.Pacing, curve, limits, c.Status, c.StatusReason, fallbacks)
+	if err != nil {
+		slog.Error("failed to insert client", "id", c.ID, "error", err)
+		return err
+	}
+	if err := pub.recordClient(ctx, models.OperationInsert, c); err != nil {
+		return err
+	}
+	return pub.publish(ctx, models.EventClientCreated, c.ID, c)
+}
+
+// ErrVersionMismatch is returned when a client is changed on the condition
+// that it is at a version it no longer has.
+var ErrVersionMismatch = errors.New("client version mismatch")
+
+// UpdateClient replaces the stored fields of an existing client and returns
+// it with its new version, or nil if it does not exist. If c.Version is not
+// zero the update only applies to that version of the client, and
+// ErrVersionMismatch is returned if the client has changed since. A client
+// given without a status keeps its status. c.CurrentLeadCount is ignored:
+// the lead count is kept, as only assignments change it, and it is not part
+// of the version.
+func (db *DB) UpdateClient(ctx context.Context, c models.Client) (*models.Client, error) {
+	ctx, done := trace(ctx, "update_client")
+	defer done()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	pub := db.publisher(tx, time.Now().UTC())
+	updated, err := updateClient(ctx, tx, pub, c)
+	if err != nil || updated == nil {
+		return nil, err
+	}
 
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		return err
+		slog.Error("failed to commit transaction", "error", err)
+		return nil, err
+	}
+	db.notify(pub)
+
+	slog.Info("client updated", "client", *updated)
+	return updated, nil
+}
+
+// updateClient updates a client, under the same version condition as
+// UpdateClient, and records the change in pub's transaction. It returns the
+// updated client, or nil if it does not exist, and the same errors as
+// insertClient for invalid groups, fallbacks, attributes, criteria and
+// rules.
+func updateClient(ctx context.Context, q queryer, pub *publisher, c models.Client) (*models.Client, error) {
+	if err := checkGroup(ctx, q, c.GroupID); err != nil {
+		return nil, err
+	}
+	attrs, criteria, err := clientAttributes(ctx, q, c)
+	if err != nil {
+		return nil, err
+	}
+	curve, err := marshalCurve(c.PacingCurve)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := marshalLimits(c.ThroughputLimits)
+	if err != nil {
+		return nil, err
+	}
+	fallbacks, err := checkFallbacks(ctx, q, c.Fallbacks)
+	if err != nil {
+		return nil, err
+	}
+	// An update without a status keeps the client's status and its reason.
+	query := `UPDATE clients SET name = ?, priority = ?, leadCapacity = ?, workingHoursStart = ?, workingHoursEnd = ?, groupId = ?, attributes = ?, criteria = ?, rule = ?, timezone = ?, share = ?, pacing = ?, pacingCurve = ?, throughputLimits = ?, fallbacks = ?,
+        status = COALESCE(NULLIF(?, ''), status), statusReason = CASE WHEN ? = '' THEN statusReason ELSE ? END, version = version + 1 WHERE id = ?`
+	args := []any{c.Name, c.Priority, c.LeadCapacity, c.WorkingHours[0].Format("15:04"), c.WorkingHours[1].Format("15:04"), c.GroupID, attrs, criteria, c.Rule, c.Timezone, c.Share, c.Pacing, curve, limits, fallbacks, c.Status, c.Status, c.StatusReason, c.ID}
+	if c.Version != 0 {
+		query += ` AND version = ?`
+		args = append(args, c.Version)
 	}
+	err = q.QueryRowContext(ctx, query+` RETURNING version, currentLeadCount, status, statusReason`, args...).Scan(&c.Version, &c.CurrentLeadCount, &c.Status, &c.StatusReason)
+	if err == sql.ErrNoRows {
+		return nil, versionConflict(ctx, q, c.ID)
+	}
+	if err != nil {
+		slog.Error("failed to update client", "id", c.ID, "error", err)
+		return nil, err
+	}
+	if err := pub.recordClient(ctx, models.OperationUpdate, c); err != nil {
+		return nil, err
+	}
+	return &c, pub.publish(ctx, models.EventClientUpdated, c.ID, c)
+}
 
-	log.Printf("Client created: %+v", c)
+// versionConflict is called when a conditional change matched no client. It
+// returns ErrVersionMismatch if the client exists, at another version.
+func versionConflict(ctx context.Context, q queryer, id string) error {
+	existing, err := getClientByID(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrVersionMismatch
+	}
 	return nil
 }
 
+// DeleteClient removes a client with its webhooks and their delivery logs
+// and its scheduled status changes, drops it from the fallback chains of
+// other clients and groups, and reports whether it existed. Its leads and
+// history are kept. If version is not zero the client is only
+// removed at that version, and ErrVersionMismatch is returned if it has
+// changed since.
+func (db *DB) DeleteClient(ctx context.Context, id string, version int) (bool, error) {
+	ctx, done := trace(ctx, "delete_client")
+	defer done()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM clients WHERE id = ?`
+	args := []any{id}
+	if version != 0 {
+		query += ` AND version = ?`
+		args = append(args, version)
+	}
+	c, err := scanClient(tx.QueryRowContext(ctx, query+` RETURNING `+clientColumns, args...))
+	if err == sql.ErrNoRows {
+		return false, versionConflict(ctx, tx, id)
+	}
+	if err != nil {
+		slog.Error("failed to delete client", "id", id, "error", err)
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhookId IN (SELECT id FROM webhooks WHERE clientId = ?)`, id); err != nil {
+		slog.Error("failed to delete webhook deliveries", "client", id, "error", err)
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhooks WHERE clientId = ?`, id); err != nil {
+		slog.Error("failed to delete webhooks", "client", id, "error", err)
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM client_status_schedules WHERE clientId = ?`, id); err != nil {
+		slog.Error("failed to delete status schedules", "client", id, "error", err)
+		return false, err
+	}
+	pub := db.publisher(tx, time.Now().UTC())
+	if err := removeFallback(ctx, tx, pub, id); err != nil {
+		return false, err
+	}
+	if err := pub.recordClient(ctx, models.OperationDelete, c); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to commit transaction", "error", err)
+		return false, err
+	}
+	db.notify(pub)
+
+	slog.Info("client deleted", "client", c)
+	return true, nil
+}
+
+// ClientFilter selects clients in list and export queries. Zero fields
+// select all clients.
+type ClientFilter struct {
+	MinPriority *int
+	MaxPriority *int
+	// HasCapacity selects clients below (true) or at (false) their lead capacity.
+	HasCapacity *bool
+	// Name selects clients whose name contains it, ignoring case.
+	Name string
+	// Attributes selects clients with each of the given attribute values.
+	Attributes map[string]any
+	// Status selects clients with the given status.
+	Status string
+}
+
+// where returns the filter's SQL condition and arguments.
+func (f ClientFilter) where() (string, []any) {
+	conditions := []string{"1 = 1"}
+	var args []any
+	if f.MinPriority != nil {
+		conditions = append(conditions, "priority >= ?")
+		args = append(args, *f.MinPriority)
+	}
+	if f.MaxPriority != nil {
+		conditions = append(conditions, "priority <= ?")
+		args = append(args, *f.MaxPriority)
+	}
+	if f.HasCapacity != nil {
+		if *f.HasCapacity {
+			conditions = append(conditions, "currentLeadCount < leadCapacity")
+		} else {
+			conditions = append(conditions, "currentLeadCount >= leadCapacity")
+		}
+	}
+	if f.Name != "" {
+		conditions = append(conditions, "name LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+likeEscaper.Replace(f.Name)+"%")
+	}
+	if f.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, f.Status)
+	}
+	attrConditions, attrArgs := attributeConditions(f.Attributes)
+	conditions = append(conditions, attrConditions...)
+	args = append(args, attrArgs...)
+	return strings.Join(conditions, " AND "), args
+}
+
+// likeEscaper escapes LIKE wildcards so they match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 // GetAllClients retrieves all clients from the database.
-func (db *DB) GetAllClients() ([]models.Client, error) {
-	log.Println("Attempting to fetch all clients")
-	query := `SELECT id, name, priority, leadCapacity, currentLeadCount, workingHoursStart, workingHoursEnd FROM clients`
-	rows, err := db.Query(query)
+func (db *DB) GetAllClients(ctx context.Context) ([]models.Client, error) {
+	ctx, done := trace(ctx, "get_all_clients")
+	defer done()
+
+	return db.listClients(ctx, ClientFilter{})
+}
+
+// ListClients retrieves the clients selected by filter.
+func (db *DB) ListClients(ctx context.Context, filter ClientFilter) ([]models.Client, error) {
+	ctx, done := trace(ctx, "list_clients")
+	defer done()
+
+	return db.listClients(ctx, filter)
+}
+
+func (db *DB) listClients(ctx context.Context, filter ClientFilter) ([]models.Client, error) {
+	var clients []models.Client
+	err := db.eachClient(ctx, filter, func(c models.Client) error {
+		clients = append(clients, c)
+		return nil
+	})
 	if err != nil {
-		log.Printf("Error querying clients: %v", err)
 		return nil, err
 	}
+	slog.Debug("fetched clients", "count", len(clients))
+	return clients, nil
+}
+
+// EachClient calls fn for every client selected by filter, in ID order,
+// without loading them all into memory. It stops at the first error from fn
+// and returns it.
+func (db *DB) EachClient(ctx context.Context, filter ClientFilter, fn func(models.Client) error) error {
+	ctx, done := trace(ctx, "each_client")
+	defer done()
+
+	return db.eachClient(ctx, filter, fn)
+}
+
+func (db *DB) eachClient(ctx context.Context, filter ClientFilter, fn func(models.Client) error) error {
+	where, args := filter.where()
+	rows, err := db.QueryContext(ctx, `SELECT `+clientColumns+` FROM clients WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		slog.Error("failed to query clients", "error", err)
+		return err
+	}
 	defer rows.Close()
 
-	var clients []models.Client
 	for rows.Next() {
-		var c models.Client
-		var start, end string
-		if err := rows.Scan(&c.ID, &c.Name, &c.Priority, &c.LeadCapacity, &c.CurrentLeadCount, &start, &end); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			return nil, err
-		}
-
-		c.WorkingHours[0], err = time.Parse("15:04", start)
+		c, err := scanClient(rows)
 		if err != nil {
-			log.Printf("Error parsing start time: %v", err)
-			return nil, err
+			slog.Error("failed to scan client row", "error", err)
+			return err
 		}
-		c.WorkingHours[1], err = time.Parse("15:04", end)
-		if err != nil {
-			log.Printf("Error parsing end time: %v", err)
-			return nil, err
+		if err := fn(c); err != nil {
+			return err
 		}
-
-		clients = append(clients, c)
 	}
 	if err = rows.Err(); err != nil {
-		log.Printf("Error with rows: %v", err)
-		return nil, err
-	}
-	if len(clients) == 0 {
-		log.Println("No clients found")
-	} else {
-		log.Printf("Fetched clients: %v", clients)
+		slog.Error("failed to iterate clients", "error", err)
+		return err
 	}
-	return clients, nil
+	return nil
 }
 
 // GetClientByID retrieves a client by its ID from the database.
-func (db *DB) GetClientByID(id string) (*models.Client, error) {
-	query := `SELECT id, name, priority, leadCapacity, currentLeadCount, workingHoursStart, workingHoursEnd FROM clients WHERE id = ?`
-	row := db.QueryRow(query, id)
+func (db *DB) GetClientByID(ctx context.Context, id string) (*models.Client, error) {
+	ctx, done := trace(ctx, "get_client_by_id")
+	defer done()
 
-	var c models.Client
-	var start, end string
-	if err := row.Scan(&c.ID, &c.Name, &c.Priority, &c.LeadCapacity, &c.CurrentLeadCount, &start, &end); err != nil {
+	return getClientByID(ctx, db, id)
+}
+
+// getClientByID retrieves a client using q, which may be a transaction.
+func getClientByID(ctx context.Context, q queryer, id string) (*models.Client, error) {
+	query := `SELECT ` + clientColumns + ` FROM clients WHERE id = ?`
+	c, err := scanClient(q.QueryRowContext(ctx, query, id))
+	if err != nil {
 		if err == sql.ErrNoRows {
-			log.Println("No rows found")
+			slog.Debug("client not found", "id", id)
 			return nil, nil
 		}
-		log.Printf("Error scanning row: %v", err)
+		slog.Error("failed to scan client row", "error", err)
 		return nil, err
 	}
 
-	var err error
+	slog.Debug("fetched client", "client", c)
+	return &c, nil
+}
 
-	c.WorkingHours[0], err = time.Parse("15:04", start)
+// GetEligibleClient finds the most eligible client based on priority, current lead count, and working hours.
+// Clients in a group that has reached its cap are not eligible, and group
+// priorities add to the priority of their members. Clients with criteria are
+// not considered, as there is no lead to match them against. Under the share
+// strategy the eligible client furthest below its target share is chosen.
+func (db *DB) GetEligibleClient(ctx context.Context) (*models.Client, error) {
+	ctx, done := trace(ctx, "get_eligible_client")
+	defer done()
+
+	client, _, err := findEligibleClient(ctx, db, models.Lead{}, time.Now().UTC(), db.shareWindow, db.sticky())
+	return client, err
+}
+
+// route records how findEligibleClient chose a client beyond the general
+// ordering: the fallback chain step, as in fallbackClient, or the earlier
+// lead whose client sticky routing kept the lead with. It is zero when
+// neither was used.
+type route struct {
+	fallbackFrom string
+	fallbackStep int
+	stickyFrom   string
+}
+
+// findEligibleClient returns the first client in order that accepts the
+// lead, among those openClients returns using q, which may be a
+// transaction. If shareWindow is positive it instead returns the one the
+// share strategy prefers, counting the leads assigned within shareWindow
+// before now. If the sticky window is positive the client of the latest
+// lead from the same person assigned within it is returned first, if it is
+// eligible; fallback chains are followed next, as in fallbackClient. The
+// returned route tells whether either was used.
+func findEligibleClient(ctx context.Context, q queryer, lead models.Lead, now time.Time, shareWindow time.Duration, sticky stickyRouting) (*models.Client, route, error) {
+	clients, err := openClients(ctx, q, now)
 	if err != nil {
-		log.Printf("Error parsing start time: %v", err)
-		return nil, err
+		return nil, route{}, err
 	}
-	c.WorkingHours[1], err = time.Parse("15:04", end)
-	if err != nil {
-		log.Printf("Error parsing end time: %v", err)
-		return nil, err
+
+	// Eligibility is checked at most once per client, as the fallback
+	// chains and the ordering below may both need it.
+	open := make(map[string]models.Client, len(clients))
+	for _, c := range clients {
+		open[c.ID] = c
+	}
+	checked := make(map[string]bool)
+	eligible := func(id string) (*models.Client, error) {
+		c, ok := open[id]
+		if !ok {
+			return nil, nil
+		}
+		accepted, seen := checked[id]
+		if !seen {
+			var err error
+			if accepted, err = accepts(ctx, q, c, lead, now); err != nil {
+				return nil, err
+			}
+			checked[id] = accepted
+		}
+		if !accepted {
+			return nil, nil
+		}
+		return &c, nil
 	}
 
-	log.Printf("Fetched client: %+v", c)
-	return &c, nil
-}
+	if sticky.window > 0 {
+		from, owner, err := stickyOwner(ctx, q, lead, sticky.countryCode, now.Add(-sticky.window))
+		if err != nil {
+			return nil, route{}, err
+		}
+		if owner != "" {
+			c, err := eligible(owner)
+			if err != nil {
+				return nil, route{}, err
+			}
+			if c != nil {
+				slog.Debug("found sticky client", "client", c, "from", from)
+				return c, route{stickyFrom: from}, nil
+			}
+			slog.Debug("sticky client not eligible", "client", owner, "from", from)
+		}
+	}
 
-// GetEligibleClient finds the most eligible client based on priority, current lead count, and working hours.
-func (db *DB) GetEligibleClient() (*models.Client, error) {
-	log.Println("Attempting to find eligible client for lead")
-	currentTime := time.Now().Format("15:04")
-	log.Printf("Current Time: %s", currentTime)
-
-	query := `
-        SELECT id, name, priority, leadCapacity, currentLeadCount, workingHoursStart, workingHoursEnd 
-        FROM clients 
-        WHERE 
-            (workingHoursStart < workingHoursEnd AND ? BETWEEN workingHoursStart AND workingHoursEnd)
-            OR
-            (workingHoursStart > workingHoursEnd AND (? >= workingHoursStart OR ? <= workingHoursEnd))
-        AND currentLeadCount < leadCapacity 
-        ORDER BY priority DESC, currentLeadCount ASC 
-        LIMIT 1
-    `
-	log.Printf("Running query: %s with currentTime: %s", query, currentTime)
+	if c, r, err := fallbackClient(ctx, q, lead, now, eligible); err != nil || c != nil {
+		if c != nil {
+			slog.Debug("found fallback client", "client", c, "from", r.fallbackFrom, "step", r.fallbackStep)
+		}
+		return c, r, err
+	}
 
-	row := db.QueryRow(query, currentTime, currentTime, currentTime)
+	var candidates []models.Client
+	for _, c := range clients {
+		e, err := eligible(c.ID)
+		if err != nil {
+			return nil, route{}, err
+		}
+		if e == nil {
+			continue
+		}
+		if shareWindow <= 0 {
+			slog.Debug("found eligible client", "client", c)
+			return e, route{}, nil
+		}
+		candidates = append(candidates, c)
+	}
+	if len(candidates) == 0 {
+		slog.Info("no eligible client found", "time", now.Format("15:04"), "lead", lead.ID)
+		return nil, route{}, nil
+	}
 
-	var c models.Client
-	var start, end string
-	err := row.Scan(&c.ID, &c.Name, &c.Priority, &c.LeadCapacity, &c.CurrentLeadCount, &start, &end)
+	s, err := loadShares(ctx, q, now.Add(-shareWindow), now)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Println("No eligible clients found")
-			return nil, nil
+		return nil, route{}, err
+	}
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if s.before(c, best) {
+			best = c
 		}
-		log.Printf("Error querying eligible client: %v", err)
-		return nil, err
 	}
+	slog.Debug("found eligible client", "client", best, "deficit", s.deficit(best))
+	return &best, route{}, nil
+}
 
-	c.WorkingHours[0], err = time.Parse("15:04", start)
+// openClients returns the active clients within their working hours and
+// with capacity left, also in their groups, ordered by effective priority and
+// then lead count. Working hours are in UTC.
+func openClients(ctx context.Context, q queryer, now time.Time) ([]models.Client, error) {
+	currentTime := now.UTC().Format("15:04")
+	return rankedClients(ctx, q, `
+            (
+                (workingHoursStart < workingHoursEnd AND ? BETWEEN workingHoursStart AND workingHoursEnd)
+                OR
+                (workingHoursStart > workingHoursEnd AND (? >= workingHoursStart OR ? <= workingHoursEnd))
+            )
+        AND currentLeadCount < leadCapacity 
+        AND COALESCE(groupFull, 0) = 0
+        AND status = 'active'`, currentTime, currentTime, currentTime)
+}
+
+// rankedClients returns the clients matching condition, which may refer to
+// the groupPriority and groupFull of their groups, ordered by effective
+// priority and then lead count.
+func rankedClients(ctx context.Context, q queryer, condition string, args ...any) ([]models.Client, error) {
+	query := groupTotals + `
+        SELECT ` + clientColumns + `
+        FROM clients LEFT JOIN group_totals ON group_totals.clientId = clients.id
+        WHERE ` + condition + `
+        ORDER BY priority + COALESCE(groupPriority, 0) DESC, currentLeadCount ASC 
+    `
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
-		log.Printf("Error parsing start time: %v", err)
+		slog.Error("failed to query eligible client", "error", err)
 		return nil, err
 	}
-	c.WorkingHours[1], err = time.Parse("15:04", end)
-	if err != nil {
-		log.Printf("Error parsing end time: %v", err)
+	defer rows.Close()
+
+	var clients []models.Client
+	for rows.Next() {
+		c, err := scanClient(rows)
+		if err != nil {
+			slog.Error("failed to scan eligible client", "error", err)
+			return nil, err
+		}
+		clients = append(clients, c)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("failed to query eligible client", "error", err)
 		return nil, err
 	}
+	return clients, nil
+}
 
-	log.Printf("Found client: %+v", c)
-	return &c, nil
+// accepts reports whether lead meets c's criteria and rule at now and c is
+// neither throttled by a throughput limit nor ahead of its pace.
+func accepts(ctx context.Context, q queryer, c models.Client, lead models.Lead, now time.Time) (bool, error) {
+	if len(attributes.Misses(c.Criteria, lead.Attributes)) > 0 || !ruleMet(c, lead, now) {
+		return false, nil
+	}
+	usage, err := throughputAt(ctx, q, c, now)
+	if err != nil || throttled(usage) {
+		return false, err
+	}
+	p, err := pacingAt(ctx, q, c, now)
+	if err != nil {
+		return false, err
+	}
+	return p == nil || !p.Ahead, nil
 }
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"lead_management/pkg/models"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -129,6 +131,8 @@ func TestGetAllClients(t *testing.T) {
 					LeadCapacity:     100,
 					CurrentLeadCount: 50,
 					WorkingHours:     [2]time.Time{parseTime("09:00"), parseTime("17:00")},
+					Version:          1,
+					Status:           models.ClientActive,
 				},
 			},
 			expectedError: false,
@@ -139,7 +143,7 @@ func TestGetAllClients(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.setupData(database)
 
-			clients, err := database.GetAllClients()
+			clients, err := database.GetAllClients(context.Background())
 
 			if tc.expectedError {
 				require.Error(t, err)
@@ -179,6 +183,8 @@ func TestGetClientByID(t *testing.T) {
 				LeadCapacity:     100,
 				CurrentLeadCount: 50,
 				WorkingHours:     [2]time.Time{parseTime("09:00"), parseTime("17:00")},
+				Version:          1,
+				Status:           models.ClientActive,
 			},
 			expectedErr: false,
 		},
@@ -192,7 +198,7 @@ func TestGetClientByID(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			client, err := database.GetClientByID(tc.clientID)
+			client, err := database.GetClientByID(context.Background(), tc.clientID)
 
 			if tc.expectedErr {
 				require.Error(t, err)
@@ -219,7 +225,7 @@ func TestGetEligibleClient(t *testing.T) {
 		{
 			name: "Highest priority client available during working hours",
 			setupData: func(db *DB) {
-				now := time.Now()
+				now := time.Now().UTC()
 				start := now.Add(-1 * time.Hour).Format("15:04")
 				end := now.Add(1 * time.Hour).Format("15:04")
 				setupEligibleClientsDatabase(db, []models.Client{
@@ -247,14 +253,16 @@ func TestGetEligibleClient(t *testing.T) {
 				Priority:         10,
 				LeadCapacity:     100,
 				CurrentLeadCount: 20,
-				WorkingHours:     [2]time.Time{parseTime(time.Now().Add(-1 * time.Hour).Format("15:04")), parseTime(time.Now().Add(1 * time.Hour).Format("15:04"))},
+				WorkingHours:     [2]time.Time{parseTime(time.Now().UTC().Add(-1 * time.Hour).Format("15:04")), parseTime(time.Now().UTC().Add(1 * time.Hour).Format("15:04"))},
+				Version:          1,
+				Status:           models.ClientActive,
 			},
 			expectedErr: false,
 		},
 		{
 			name: "Clients with same priority but different lead counts",
 			setupData: func(db *DB) {
-				now := time.Now()
+				now := time.Now().UTC()
 				start := now.Add(-1 * time.Hour).Format("15:04")
 				end := now.Add(1 * time.Hour).Format("15:04")
 				setupEligibleClientsDatabase(db, []models.Client{
@@ -282,7 +290,9 @@ func TestGetEligibleClient(t *testing.T) {
 				Priority:         10,
 				LeadCapacity:     100,
 				CurrentLeadCount: 5,
-				WorkingHours:     [2]time.Time{parseTime(time.Now().Add(-1 * time.Hour).Format("15:04")), parseTime(time.Now().Add(1 * time.Hour).Format("15:04"))},
+				WorkingHours:     [2]time.Time{parseTime(time.Now().UTC().Add(-1 * time.Hour).Format("15:04")), parseTime(time.Now().UTC().Add(1 * time.Hour).Format("15:04"))},
+				Version:          1,
+				Status:           models.ClientActive,
 			},
 			expectedErr: false,
 		},
@@ -296,7 +306,7 @@ func TestGetEligibleClient(t *testing.T) {
 						Priority:         10,
 						LeadCapacity:     100,
 						CurrentLeadCount: 50,
-						WorkingHours:     [2]time.Time{parseTime(time.Now().Add(-2 * time.Hour).Format("15:04")), parseTime(time.Now().Add(-1 * time.Hour).Format("15:04"))},
+						WorkingHours:     [2]time.Time{parseTime(time.Now().UTC().Add(-2 * time.Hour).Format("15:04")), parseTime(time.Now().UTC().Add(-1 * time.Hour).Format("15:04"))},
 					},
 				})
 			},
@@ -310,7 +320,7 @@ func TestGetEligibleClient(t *testing.T) {
 			// Setup database with test-specific data
 			tc.setupData(database)
 
-			client, err := database.GetEligibleClient()
+			client, err := database.GetEligibleClient(context.Background())
 
 			if tc.expectedErr {
 				require.Error(t, err)
@@ -324,7 +334,7 @@ func TestGetEligibleClient(t *testing.T) {
 
 func setupEligibleClientsDatabase(database *DB, clients []models.Client) {
 	for _, client := range clients {
-		err := database.CreateClient(client)
+		err := database.CreateClient(context.Background(), client)
 		if err != nil {
 			panic("Failed to setup database: " + err.Error())
 		}
@@ -340,7 +350,7 @@ func setupDatabase(database *DB) {
 		CurrentLeadCount: 50,
 		WorkingHours:     [2]time.Time{parseTime("09:00"), parseTime("17:00")},
 	}
-	err := database.CreateClient(client)
+	err := database.CreateClient(context.Background(), client)
 	if err != nil {
 		panic("Failed to setup database: " + err.Error())
 	}
@@ -350,3 +360,205 @@ func parseTime(t string) time.Time {
 	timeParsed, _ := time.Parse("15:04", t)
 	return timeParsed
 }
+
+func TestCheckSchema(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+
+	tests := []struct {
+		name        string
+		setup       func(*DB)
+		expectedErr bool
+	}{
+		{
+			name:        "Fresh database is current",
+			setup:       func(db *DB) {},
+			expectedErr: false,
+		},
+		{
+			name: "Migrations not applied",
+			setup: func(db *DB) {
+				_, err := db.Exec(`DROP INDEX leads_duplicate_of`)
+				require.NoError(t, err)
+				_, err = db.Exec(`ALTER TABLE leads DROP COLUMN duplicateOf`)
+				require.NoError(t, err)
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Dirty migration",
+			setup: func(db *DB) {
+				_, err := db.Exec(`UPDATE schema_migrations SET dirty = true`)
+				require.NoError(t, err)
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Newer schema than this build",
+			setup: func(db *DB) {
+				_, err := db.Exec(`UPDATE schema_migrations SET version = ?, dirty = false`, SchemaVersion+1)
+				require.NoError(t, err)
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setup(database)
+
+			err := database.CheckSchema(context.Background())
+
+			if tc.expectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name            string
+		version         int
+		expectedVersion int
+		expectedErr     bool
+	}{
+		{name: "Older database is migrated", version: 5, expectedVersion: SchemaVersion},
+		{name: "Current database", version: SchemaVersion, expectedVersion: SchemaVersion},
+		{name: "Newer database is left alone", version: SchemaVersion + 1, expectedVersion: SchemaVersion + 1, expectedErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "leads.db")
+			database := InitDB(path)
+			_, err := database.Exec(`UPDATE schema_migrations SET version = ?`, tc.version)
+			require.NoError(t, err)
+			require.NoError(t, database.Close())
+
+			database = InitDB(path)
+			defer database.Close()
+			var version int
+			var dirty bool
+			require.NoError(t, database.QueryRow(`SELECT version, dirty FROM schema_migrations`).Scan(&version, &dirty))
+			assert.Equal(t, tc.expectedVersion, version)
+			assert.False(t, dirty)
+			err = database.CheckSchema(context.Background())
+			if tc.expectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAssignLead(t *testing.T) {
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+
+	tests := []struct {
+		name           string
+		clients        []models.Client
+		expectedClient string
+		expectedCount  int
+	}{
+		{
+			name: "Assigns to highest priority client",
+			clients: []models.Client{
+				{ID: "1", Name: "Low", Priority: 1, LeadCapacity: 10, WorkingHours: allDay},
+				{ID: "2", Name: "High", Priority: 5, LeadCapacity: 10, CurrentLeadCount: 3, WorkingHours: allDay},
+			},
+			expectedClient: "2",
+			expectedCount:  4,
+		},
+		{
+			name: "No client with capacity queues the lead",
+			clients: []models.Client{
+				{ID: "1", Name: "Full", Priority: 1, LeadCapacity: 2, CurrentLeadCount: 2, WorkingHours: allDay},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := InitDB(":memory:")
+			defer database.Close()
+			setupEligibleClientsDatabase(database, tc.clients)
+
+			lead, err := database.AssignLead(context.Background(), models.Lead{ID: "l1", Name: "Ada"})
+			require.NoError(t, err)
+
+			require.NotNil(t, lead)
+			stored, err := database.GetLeadByID(context.Background(), "l1")
+			require.NoError(t, err)
+			assert.Equal(t, lead, stored)
+
+			if tc.expectedClient == "" {
+				assert.Equal(t, models.LeadQueued, lead.Status)
+				queued, err := database.CountQueuedLeads(context.Background())
+				require.NoError(t, err)
+				assert.Equal(t, 1, queued)
+				return
+			}
+			assert.Equal(t, models.LeadAssigned, lead.Status)
+			assert.Equal(t, tc.expectedClient, lead.ClientID)
+
+			client, err := database.GetClientByID(context.Background(), tc.expectedClient)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCount, client.CurrentLeadCount)
+		})
+	}
+}
+
+func TestClientVersions(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	client := models.Client{ID: "1", Name: "Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay}
+	setupEligibleClientsDatabase(database, []models.Client{client})
+
+	// Assigning a lead changes only the lead count, which is not versioned.
+	_, err := database.AssignLead(ctx, models.Lead{ID: "l1"})
+	require.NoError(t, err)
+	stored, err := database.GetClientByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.Version)
+
+	// An update keeps the lead count the client was given.
+	client.Version = 1
+	updated, err := database.UpdateClient(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	assert.Equal(t, 1, updated.CurrentLeadCount)
+
+	_, err = database.UpdateClient(ctx, client)
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	// Version 0 updates unconditionally.
+	client.Version = 0
+	updated, err = database.UpdateClient(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated.Version)
+
+	found, err := database.DeleteClient(ctx, "1", 2)
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	assert.False(t, found)
+	found, err = database.DeleteClient(ctx, "1", 3)
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = database.DeleteClient(ctx, "1", 0)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// A deleted client keeps its history but no longer exists as of now.
+	versions, err := database.GetClientHistory(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, versions, 5)
+	assert.Equal(t, models.OperationDelete, versions[4].Operation)
+	asOf, err := database.GetClientAsOf(ctx, "1", time.Now())
+	require.NoError(t, err)
+	assert.Nil(t, asOf)
+}
@@ -0,0 +1,267 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"lead_management/pkg/identity"
+	"lead_management/pkg/models"
+	"log/slog"
+	"maps"
+	"strings"
+	"time"
+)
+
+// Keys leads are matched on to detect duplicates.
+const (
+	DedupEmail        = "email"
+	DedupPhone        = "phone"
+	DedupNamePostcode = "namePostcode"
+)
+
+// Policies for duplicate leads.
+const (
+	DedupReject = "reject"
+	DedupAttach = "attach"
+)
+
+// DedupOptions configures duplicate detection; see SetDedup.
+type DedupOptions struct {
+	// Keys are the keys a lead is matched on: DedupEmail, DedupPhone or
+	// DedupNamePostcode. A match on any one of them is a duplicate. No keys
+	// disables duplicate detection.
+	Keys []string
+	// Window is how far back leads are matched.
+	Window time.Duration
+	// Policy is DedupReject or DedupAttach.
+	Policy string
+	// CountryCode is the calling code assumed for phone numbers written
+	// without one, e.g. "44".
+	CountryCode string
+	// PostcodeAttribute names the lead attribute holding the postcode.
+	PostcodeAttribute string
+}
+
+// SetDedup enables duplicate detection on AssignLead: a lead matching one
+// received within the window, on any of the keys, is rejected with a
+// *DuplicateError or, under DedupAttach, stored as a duplicate attached to
+// the original lead without being assigned. The keys of leads stored before
+// they were recorded are computed with opts, so that they are matched too.
+func (db *DB) SetDedup(ctx context.Context, opts DedupOptions) error {
+	db.dedup = opts
+	return backfillLeadIdentities(ctx, db, opts)
+}
+
+// DuplicateError is returned by AssignLead for a duplicate lead under the
+// DedupReject policy.
+type DuplicateError struct {
+	// Original is the ID of the lead it duplicates.
+	Original string
+}
+
+func (e *DuplicateError) Error() string {
+	return "duplicate of lead " + e.Original
+}
+
+// Errors returned by MergeLeads.
+var (
+	ErrLeadNotFound = errors.New("lead not found")
+	ErrLeadMerged   = errors.New("lead already merged")
+)
+
+// leadKeys are the normalized identities stored with a lead for sticky
+// routing and duplicate detection.
+type leadKeys struct {
+	email, phone, e164, namePostcode string
+}
+
+// keys returns the identities of lead.
+func (o DedupOptions) keys(lead models.Lead) leadKeys {
+	var postcode string
+	if v, ok := lead.Attributes[o.PostcodeAttribute]; ok && o.PostcodeAttribute != "" && v != nil {
+		postcode = fmt.Sprint(v)
+	}
+	return leadKeys{
+		email:        identity.Email(lead.Email),
+		phone:        identity.Phone(lead.Phone),
+		e164:         identity.E164(lead.Phone, o.CountryCode),
+		namePostcode: identity.NamePostcode(lead.Name, postcode),
+	}
+}
+
+// findDuplicate returns the ID of the earliest lead received since since
+// that matches keys on any of the keys in match, ignoring duplicates and
+// merged leads, using q, which may be a transaction. Phones are compared by
+// their E.164 keys if countryCode is set and by their phone keys otherwise,
+// as in stickyOwner. It returns "" if there is none.
+func findDuplicate(ctx context.Context, q queryer, keys leadKeys, match []string, countryCode string, since time.Time) (string, error) {
+	var conditions []string
+	args := []any{models.LeadAssigned, models.LeadQueued, since}
+	for _, key := range match {
+		var column, value string
+		switch key {
+		case DedupEmail:
+			column, value = "emailKey", keys.email
+		case DedupPhone:
+			column, value = "phoneKey", keys.phone
+			if countryCode != "" {
+				column, value = "e164Key", keys.e164
+			}
+		case DedupNamePostcode:
+			column, value = "namePostcodeKey", keys.namePostcode
+		}
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	var id string
+	err := q.QueryRowContext(ctx, `SELECT id FROM leads WHERE status IN (?, ?) AND receivedAt >= ? AND (`+
+		strings.Join(conditions, " OR ")+`) ORDER BY receivedAt, rowid LIMIT 1`, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		slog.Error("failed to query duplicate leads", "error", err)
+	}
+	return id, err
+}
+
+// MergeLeads merges the lead from into the lead id, which must differ, and
+// returns the merged lead. Details missing from id are taken from from, and
+// if id has not been assigned but from has, id takes over from's
+// assignment; client lead counts are not changed. from is marked merged
+// into id, and the leads attached to or merged into from are moved to id,
+// so that GetLeadHistory of id includes theirs. It returns ErrLeadNotFound
+// if either lead does not exist and ErrLeadMerged if either has already been
+// merged.
+func (db *DB) MergeLeads(ctx context.Context, id, from string) (*models.Lead, error) {
+	ctx, done := trace(ctx, "merge_leads")
+	defer done()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var leads [2]models.Lead
+	for i, leadID := range []string{id, from} {
+		leads[i], err = scanLead(tx.QueryRowContext(ctx, `SELECT `+leadColumns+` FROM leads WHERE id = ?`, leadID))
+		if err == sql.ErrNoRows {
+			return nil, ErrLeadNotFound
+		}
+		if err != nil {
+			slog.Error("failed to scan lead row", "id", leadID, "error", err)
+			return nil, err
+		}
+		if leads[i].Status == models.LeadMerged {
+			return nil, ErrLeadMerged
+		}
+	}
+	lead, other := mergeLead(leads[0], leads[1]), leads[1]
+
+	attrs, err := marshalAttributes(lead.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	keys := db.dedup.keys(lead)
+	_, err = tx.ExecContext(ctx, `UPDATE leads SET name = ?, email = ?, phone = ?, status = ?, clientId = ?, assignedAt = ?,
+		attributes = ?, fallbackFrom = ?, fallbackStep = ?, stickyFrom = ?, receivedAt = ?, duplicateOf = ?,
+		emailKey = ?, phoneKey = ?, e164Key = ?, namePostcodeKey = ? WHERE id = ?`,
+		lead.Name, lead.Email, lead.Phone, lead.Status, lead.ClientID, lead.AssignedAt,
+		attrs, lead.FallbackFrom, lead.FallbackStep, lead.StickyFrom, lead.ReceivedAt, lead.DuplicateOf,
+		keys.email, keys.phone, keys.e164, keys.namePostcode, lead.ID)
+	if err != nil {
+		slog.Error("failed to update merged lead", "id", lead.ID, "error", err)
+		return nil, err
+	}
+	other.Status, other.DuplicateOf = models.LeadMerged, lead.ID
+	if _, err := tx.ExecContext(ctx, `UPDATE leads SET status = ?, duplicateOf = ? WHERE id = ?`, other.Status, other.DuplicateOf, other.ID); err != nil {
+		slog.Error("failed to mark lead merged", "id", other.ID, "error", err)
+		return nil, err
+	}
+	moved, err := queryLeads(ctx, tx, `SELECT `+leadColumns+` FROM leads WHERE duplicateOf = ? ORDER BY rowid`, other.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE leads SET duplicateOf = ? WHERE duplicateOf = ?`, lead.ID, other.ID); err != nil {
+		slog.Error("failed to move attached leads", "from", other.ID, "to", lead.ID, "error", err)
+		return nil, err
+	}
+
+	for i := range moved {
+		moved[i].DuplicateOf = lead.ID
+	}
+
+	pub := db.publisher(tx, time.Now().UTC())
+	for _, l := range append([]models.Lead{lead, other}, moved...) {
+		if err := pub.recordChange(ctx, models.EntityLead, models.OperationUpdate, l.ID, l); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to commit transaction", "error", err)
+		return nil, err
+	}
+	db.notify(pub)
+
+	slog.Info("leads merged", "lead", lead, "from", other.ID)
+	return &lead, nil
+}
+
+// mergeLead returns lead with the details it lacks taken from other.
+// Attribute values of lead win. The merged lead keeps the most advanced
+// status of the two: assigned, then queued, then duplicate, and the earlier
+// receipt.
+func mergeLead(lead, other models.Lead) models.Lead {
+	if lead.Name == "" {
+		lead.Name = other.Name
+	}
+	if lead.Email == "" {
+		lead.Email = other.Email
+	}
+	if lead.Phone == "" {
+		lead.Phone = other.Phone
+	}
+	if len(other.Attributes) > 0 {
+		attrs := maps.Clone(other.Attributes)
+		maps.Copy(attrs, lead.Attributes)
+		lead.Attributes = attrs
+	}
+	if !other.ReceivedAt.IsZero() && (lead.ReceivedAt.IsZero() || other.ReceivedAt.Before(lead.ReceivedAt)) {
+		lead.ReceivedAt = other.ReceivedAt
+	}
+
+	switch {
+	case lead.Status == models.LeadAssigned:
+	case other.Status == models.LeadAssigned:
+		lead.Status, lead.ClientID, lead.AssignedAt = other.Status, other.ClientID, other.AssignedAt
+		lead.FallbackFrom, lead.FallbackStep, lead.StickyFrom = other.FallbackFrom, other.FallbackStep, other.StickyFrom
+		lead.DuplicateOf = ""
+	case lead.Status == models.LeadDuplicate && other.Status == models.LeadQueued:
+		lead.Status, lead.DuplicateOf = models.LeadQueued, ""
+	}
+	// A lead merged with its original is no longer attached to it.
+	if lead.DuplicateOf == other.ID {
+		lead.DuplicateOf = ""
+		if lead.Status == models.LeadDuplicate {
+			lead.Status = models.LeadQueued
+		}
+	}
+	return lead
+}
+
+// backfillReceivedAt sets the receipt time of assigned leads stored before
+// it was recorded to their assignment time.
+func backfillReceivedAt(ctx context.Context, db *DB) error {
+	_, err := db.ExecContext(ctx, `UPDATE leads SET receivedAt = assignedAt WHERE status = ? AND receivedAt = ?`, models.LeadAssigned, time.Time{})
+	return err
+}
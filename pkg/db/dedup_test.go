@@ -0,0 +1,234 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedup(t *testing.T) {
+	original := models.Lead{ID: "original", Name: "Jane Doe", Email: "jane@example.com", Phone: "020 7946 0958",
+		Attributes: map[string]any{"postcode": "SW1A 1AA"}}
+
+	tests := []struct {
+		name         string
+		opts         DedupOptions
+		lead         models.Lead
+		wantOriginal string
+	}{
+		{
+			name:         "Same email",
+			opts:         DedupOptions{Keys: []string{DedupEmail}, Window: time.Hour},
+			lead:         models.Lead{ID: "copy", Email: "JANE@example.com "},
+			wantOriginal: "original",
+		},
+		{
+			name:         "Same phone in international form",
+			opts:         DedupOptions{Keys: []string{DedupPhone}, Window: time.Hour, CountryCode: "44"},
+			lead:         models.Lead{ID: "copy", Phone: "+44 20 7946 0958"},
+			wantOriginal: "original",
+		},
+		{
+			name:         "Same national phone without a country code",
+			opts:         DedupOptions{Keys: []string{DedupPhone}, Window: time.Hour},
+			lead:         models.Lead{ID: "copy", Phone: "(020) 7946-0958"},
+			wantOriginal: "original",
+		},
+		{
+			name: "International phone without a country code",
+			opts: DedupOptions{Keys: []string{DedupPhone}, Window: time.Hour},
+			lead: models.Lead{ID: "copy", Phone: "+44 20 7946 0958"},
+		},
+		{
+			name:         "Same name and postcode",
+			opts:         DedupOptions{Keys: []string{DedupNamePostcode}, Window: time.Hour, PostcodeAttribute: "postcode"},
+			lead:         models.Lead{ID: "copy", Name: "jane doe", Attributes: map[string]any{"postcode": "sw1a1aa"}},
+			wantOriginal: "original",
+		},
+		{
+			name:         "Any key matches",
+			opts:         DedupOptions{Keys: []string{DedupEmail, DedupPhone}, Window: time.Hour, CountryCode: "44"},
+			lead:         models.Lead{ID: "copy", Email: "other@example.com", Phone: "02079460958"},
+			wantOriginal: "original",
+		},
+		{
+			name: "Key not configured",
+			opts: DedupOptions{Keys: []string{DedupPhone}, Window: time.Hour},
+			lead: models.Lead{ID: "copy", Email: "jane@example.com"},
+		},
+		{
+			name: "Different person",
+			opts: DedupOptions{Keys: []string{DedupEmail}, Window: time.Hour},
+			lead: models.Lead{ID: "copy", Email: "john@example.com"},
+		},
+		{
+			name: "Outside the window",
+			opts: DedupOptions{Keys: []string{DedupEmail}, Window: time.Nanosecond},
+			lead: models.Lead{ID: "copy", Email: "jane@example.com"},
+		},
+	}
+
+	for _, tc := range tests {
+		for _, policy := range []string{DedupReject, DedupAttach} {
+			t.Run(tc.name+" "+policy, func(t *testing.T) {
+				database := InitDB(":memory:")
+				defer database.Close()
+				ctx := context.Background()
+				setupEligibleClientsDatabase(database, []models.Client{
+					{ID: "a", Name: "A", Priority: 1, LeadCapacity: 100, WorkingHours: [2]time.Time{parseTime("00:00"), parseTime("23:59")}},
+				})
+				err := database.DefineAttribute(ctx, models.AttributeDefinition{Entity: models.EntityLead, Name: "postcode", Type: models.AttributeString})
+				require.NoError(t, err)
+				opts := tc.opts
+				opts.Policy = policy
+				require.NoError(t, database.SetDedup(ctx, opts))
+
+				_, err = database.AssignLead(ctx, original)
+				require.NoError(t, err)
+				lead, err := database.AssignLead(ctx, tc.lead)
+
+				var dupErr *DuplicateError
+				switch {
+				case tc.wantOriginal == "":
+					require.NoError(t, err)
+					assert.Equal(t, models.LeadAssigned, lead.Status)
+					assert.Empty(t, lead.DuplicateOf)
+				case policy == DedupReject:
+					require.True(t, errors.As(err, &dupErr), "got %v", err)
+					assert.Equal(t, tc.wantOriginal, dupErr.Original)
+					stored, err := database.GetLeadByID(ctx, tc.lead.ID)
+					require.NoError(t, err)
+					assert.Nil(t, stored)
+				default:
+					require.NoError(t, err)
+					assert.Equal(t, models.LeadDuplicate, lead.Status)
+					assert.Equal(t, tc.wantOriginal, lead.DuplicateOf)
+					assert.Empty(t, lead.ClientID)
+					stored, err := database.GetLeadByID(ctx, tc.lead.ID)
+					require.NoError(t, err)
+					assert.Equal(t, lead, stored)
+				}
+
+				client, err := database.GetClientByID(ctx, "a")
+				require.NoError(t, err)
+				want := 2
+				if tc.wantOriginal != "" {
+					want = 1
+				}
+				assert.Equal(t, want, client.CurrentLeadCount, "duplicates must not use capacity")
+			})
+		}
+	}
+}
+
+func TestMergeLeads(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "a", Name: "A", Priority: 1, LeadCapacity: 1, WorkingHours: allDay},
+	})
+	require.NoError(t, database.SetDedup(ctx, DedupOptions{Keys: []string{DedupEmail}, Window: time.Hour, Policy: DedupAttach}))
+
+	// The original takes the only unit of capacity, so the lead merged into
+	// stays queued until it takes over the original's assignment.
+	original, err := database.AssignLead(ctx, models.Lead{ID: "original", Name: "Jane", Email: "jane@example.com"})
+	require.NoError(t, err)
+	duplicate, err := database.AssignLead(ctx, models.Lead{ID: "duplicate", Email: "jane@example.com"})
+	require.NoError(t, err)
+	require.Equal(t, models.LeadDuplicate, duplicate.Status)
+	lead, err := database.AssignLead(ctx, models.Lead{ID: "lead", Phone: "555 123 4567", Email: "j.doe@example.com"})
+	require.NoError(t, err)
+	require.Equal(t, models.LeadQueued, lead.Status)
+
+	merged, err := database.MergeLeads(ctx, "lead", "original")
+	require.NoError(t, err)
+	assert.Equal(t, "Jane", merged.Name)
+	assert.Equal(t, "j.doe@example.com", merged.Email)
+	assert.Equal(t, "555 123 4567", merged.Phone)
+	assert.Equal(t, models.LeadAssigned, merged.Status)
+	assert.Equal(t, "a", merged.ClientID)
+	assert.Equal(t, original.AssignedAt, merged.AssignedAt)
+	assert.Equal(t, original.ReceivedAt, merged.ReceivedAt)
+
+	stored, err := database.GetLeadByID(ctx, "lead")
+	require.NoError(t, err)
+	assert.Equal(t, merged, stored)
+	stored, err = database.GetLeadByID(ctx, "original")
+	require.NoError(t, err)
+	assert.Equal(t, models.LeadMerged, stored.Status)
+	assert.Equal(t, "lead", stored.DuplicateOf)
+	stored, err = database.GetLeadByID(ctx, "duplicate")
+	require.NoError(t, err)
+	assert.Equal(t, "lead", stored.DuplicateOf, "leads attached to the merged lead move")
+
+	queued, err := database.CountQueuedLeads(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, queued)
+
+	history, err := database.GetLeadHistory(ctx, "lead")
+	require.NoError(t, err)
+	var entities []string
+	for _, c := range history {
+		entities = append(entities, c.Entity+" "+c.EntityID)
+	}
+	assert.Equal(t, []string{
+		"lead original", "assignment original", "lead lead", "lead lead", "lead original",
+	}, entities)
+
+	_, err = database.MergeLeads(ctx, "lead", "original")
+	assert.ErrorIs(t, err, ErrLeadMerged)
+	_, err = database.MergeLeads(ctx, "lead", "missing")
+	assert.ErrorIs(t, err, ErrLeadNotFound)
+
+	// Merged leads are no longer matched as originals.
+	again, err := database.AssignLead(ctx, models.Lead{ID: "again", Email: "jane@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, models.LeadQueued, again.Status)
+}
+
+func TestMergeLead(t *testing.T) {
+	received := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		lead  models.Lead
+		other models.Lead
+		want  models.Lead
+	}{
+		{
+			name:  "Attributes of the lead win",
+			lead:  models.Lead{ID: "l", Status: models.LeadAssigned, ClientID: "a", Attributes: map[string]any{"region": "emea"}},
+			other: models.Lead{ID: "o", Status: models.LeadAssigned, ClientID: "b", Attributes: map[string]any{"region": "apac", "product": "x"}},
+			want:  models.Lead{ID: "l", Status: models.LeadAssigned, ClientID: "a", Attributes: map[string]any{"region": "emea", "product": "x"}},
+		},
+		{
+			name:  "Earlier receipt",
+			lead:  models.Lead{ID: "l", Status: models.LeadQueued, ReceivedAt: received.Add(time.Hour)},
+			other: models.Lead{ID: "o", Status: models.LeadQueued, ReceivedAt: received},
+			want:  models.Lead{ID: "l", Status: models.LeadQueued, ReceivedAt: received},
+		},
+		{
+			name:  "Duplicate merged with its queued original",
+			lead:  models.Lead{ID: "l", Status: models.LeadDuplicate, DuplicateOf: "o"},
+			other: models.Lead{ID: "o", Status: models.LeadQueued},
+			want:  models.Lead{ID: "l", Status: models.LeadQueued},
+		},
+		{
+			name:  "Duplicate merged with another duplicate",
+			lead:  models.Lead{ID: "l", Status: models.LeadDuplicate, DuplicateOf: "x"},
+			other: models.Lead{ID: "o", Status: models.LeadDuplicate, DuplicateOf: "x"},
+			want:  models.Lead{ID: "l", Status: models.LeadDuplicate, DuplicateOf: "x"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, mergeLead(tc.lead, tc.other))
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"lead_management/pkg/events"
+	"lead_management/pkg/models"
+	"lead_management/pkg/utils"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Events returns the broker that is notified whenever events are stored.
+func (db *DB) Events() *events.Broker {
+	return db.events
+}
+
+// ClientsChanged returns a channel that receives a value whenever a change
+// that may make a client eligible for queued leads has committed: a client
+// created or updated, its status changed or a group changed. Assigning and
+// queueing leads only take capacity, so they do not signal it. Signals are
+// coalesced.
+func (db *DB) ClientsChanged() <-chan struct{} {
+	return db.clientsChanged
+}
+
+// SetEventBufferSize sets how many of the most recent events are kept for
+// stream resumption. Older events are pruned as new ones are stored.
+func (db *DB) SetEventBufferSize(n int) {
+	db.eventBufferSize = n
+}
+
+// publisher stores the events and change log entries of one transaction and
+// enqueues the events' webhook deliveries. Subscribers are notified with
+// db.notify once it has committed.
+type publisher struct {
+	q          queryer
+	now        time.Time
+	bufferSize int
+	events     int
+	deliveries int
+	// clientsChanged is set by changes that may make a client eligible.
+	clientsChanged bool
+}
+
+func (db *DB) publisher(q queryer, now time.Time) *publisher {
+	return &publisher{q: q, now: now, bufferSize: db.eventBufferSize}
+}
+
+// publish stores an event of the given type about clientID carrying data.
+func (p *publisher) publish(ctx context.Context, eventType, clientID string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	event := models.Event{
+		ID:        utils.GenerateUUID(),
+		Type:      eventType,
+		ClientID:  clientID,
+		CreatedAt: p.now,
+		Data:      raw,
+	}
+	res, err := p.q.ExecContext(ctx, `INSERT INTO events (id, type, clientId, createdAt, data) VALUES (?, ?, ?, ?, ?)`,
+		event.ID, event.Type, event.ClientID, event.CreatedAt, string(event.Data))
+	if err != nil {
+		slog.Error("failed to insert event", "type", eventType, "error", err)
+		return err
+	}
+	if event.Sequence, err = res.LastInsertId(); err != nil {
+		return err
+	}
+	if _, err := p.q.ExecContext(ctx, `DELETE FROM events WHERE sequence <= ?`, event.Sequence-int64(p.bufferSize)); err != nil {
+		slog.Error("failed to prune events", "error", err)
+		return err
+	}
+	p.events++
+	if eventType == models.EventClientCreated || eventType == models.EventClientUpdated || eventType == models.EventGroupUpdated {
+		p.clientsChanged = true
+	}
+
+	queued, err := enqueueWebhookDeliveries(ctx, p.q, event)
+	p.deliveries += queued
+	return err
+}
+
+// notify wakes event subscribers, the webhook dispatcher and, if clients
+// changed, the queue after the publisher's transaction has committed.
+func (db *DB) notify(p *publisher) {
+	if p.events > 0 {
+		db.events.Notify()
+	}
+	if p.clientsChanged {
+		select {
+		case db.clientsChanged <- struct{}{}:
+		default:
+		}
+	}
+	if p.deliveries > 0 {
+		db.signalWebhookQueued()
+	}
+}
+
+// EventFilter selects events by client and type. Empty fields match all events.
+type EventFilter struct {
+	ClientID string
+	Types    []string
+}
+
+// GetEvents returns up to limit events with a sequence greater than after
+// that match filter, in sequence order.
+func (db *DB) GetEvents(ctx context.Context, after int64, filter EventFilter, limit int) ([]models.Event, error) {
+	ctx, done := trace(ctx, "get_events")
+	defer done()
+
+	query := `SELECT sequence, id, type, clientId, createdAt, data FROM events WHERE sequence > ? AND (? = '' OR clientId = ?)`
+	args := []any{after, filter.ClientID, filter.ClientID}
+	if len(filter.Types) > 0 {
+		query += ` AND type IN (?` + strings.Repeat(`, ?`, len(filter.Types)-1) + `)`
+		for _, t := range filter.Types {
+			args = append(args, t)
+		}
+	}
+	query += ` ORDER BY sequence LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("failed to query events", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.Event
+	for rows.Next() {
+		var e models.Event
+		var data string
+		if err := rows.Scan(&e.Sequence, &e.ID, &e.Type, &e.ClientID, &e.CreatedAt, &data); err != nil {
+			slog.Error("failed to scan event row", "error", err)
+			return nil, err
+		}
+		e.CreatedAt = e.CreatedAt.UTC()
+		e.Data = json.RawMessage(data)
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+// LatestEventSequence returns the sequence of the newest event, or 0 if there is none.
+func (db *DB) LatestEventSequence(ctx context.Context) (int64, error) {
+	ctx, done := trace(ctx, "latest_event_sequence")
+	defer done()
+
+	var sequence int64
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(sequence), 0) FROM events`).Scan(&sequence)
+	return sequence, err
+}
+
+// OldestEventSequence returns the sequence of the oldest event still in the
+// buffer, or 0 if there is none.
+func (db *DB) OldestEventSequence(ctx context.Context) (int64, error) {
+	ctx, done := trace(ctx, "oldest_event_sequence")
+	defer done()
+
+	var sequence int64
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(MIN(sequence), 0) FROM events`).Scan(&sequence)
+	return sequence, err
+}
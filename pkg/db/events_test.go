@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetEvents(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "1", Name: "Small", Priority: 5, LeadCapacity: 1, WorkingHours: allDay},
+	})
+	for _, id := range []string{"l1", "l2"} {
+		_, err := database.AssignLead(ctx, models.Lead{ID: id, Name: "Ada"})
+		require.NoError(t, err)
+	}
+	updated, err := database.UpdateClient(ctx, models.Client{ID: "1", Name: "Bigger", Priority: 5, LeadCapacity: 2, CurrentLeadCount: 1, WorkingHours: allDay})
+	require.NoError(t, err)
+	require.NotNil(t, updated)
+
+	tests := []struct {
+		name     string
+		after    int64
+		filter   EventFilter
+		expected []string
+	}{
+		{
+			name:     "All events in order",
+			expected: []string{models.EventClientCreated, models.EventLeadAssigned, models.EventCapacityExhausted, models.EventLeadQueued, models.EventClientUpdated},
+		},
+		{
+			name:     "After a sequence",
+			after:    3,
+			expected: []string{models.EventLeadQueued, models.EventClientUpdated},
+		},
+		{
+			name:     "By client",
+			filter:   EventFilter{ClientID: "1"},
+			expected: []string{models.EventClientCreated, models.EventLeadAssigned, models.EventCapacityExhausted, models.EventClientUpdated},
+		},
+		{
+			name:     "By type",
+			filter:   EventFilter{Types: []string{models.EventLeadAssigned, models.EventLeadQueued}},
+			expected: []string{models.EventLeadAssigned, models.EventLeadQueued},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := database.GetEvents(ctx, tc.after, tc.filter, 100)
+			require.NoError(t, err)
+
+			var types []string
+			for _, e := range events {
+				types = append(types, e.Type)
+				assert.Greater(t, e.Sequence, tc.after)
+			}
+			assert.Equal(t, tc.expected, types)
+		})
+	}
+}
+
+func TestEventBufferIsBounded(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	database.SetEventBufferSize(2)
+	ctx := context.Background()
+
+	changed := database.Events().Changed()
+	for _, id := range []string{"1", "2", "3"} {
+		setupEligibleClientsDatabase(database, []models.Client{{ID: id, Name: "Client"}})
+	}
+	<-changed
+
+	events, err := database.GetEvents(ctx, 0, EventFilter{}, 100)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "2", events[0].ClientID)
+	assert.Equal(t, "3", events[1].ClientID)
+
+	latest, err := database.LatestEventSequence(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, events[1].Sequence, latest)
+	oldest, err := database.OldestEventSequence(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, events[0].Sequence, oldest)
+}
+
+func TestClientsChanged(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	signalled := func() bool {
+		select {
+		case <-database.ClientsChanged():
+			return true
+		default:
+			return false
+		}
+	}
+
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "1", Name: "Client", Priority: 1, LeadCapacity: 10, WorkingHours: [2]time.Time{parseTime("00:00"), parseTime("23:59")}},
+	})
+	assert.True(t, signalled(), "creating a client")
+
+	_, err := database.AssignLead(ctx, models.Lead{ID: "l1", Name: "Ada"})
+	require.NoError(t, err)
+	assert.False(t, signalled(), "assigning a lead only takes capacity")
+
+	_, err = database.UpdateClient(ctx, models.Client{ID: "1", Name: "Client", LeadCapacity: 20, WorkingHours: [2]time.Time{parseTime("00:00"), parseTime("23:59")}})
+	require.NoError(t, err)
+	assert.True(t, signalled(), "updating a client")
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"lead_management/pkg/attributes"
+	"lead_management/pkg/models"
+	"sort"
+	"time"
+)
+
+// ExplainLead reconstructs how a lead was routed. Assigned leads are
+// explained against the state every client and group had just before the
+// assignment, taken from the client histories and the change log; queued
+// leads against the current state.
+// It returns nil if the lead does not exist.
+func (db *DB) ExplainLead(ctx context.Context, id string) (*models.Explanation, error) {
+	ctx, done := trace(ctx, "explain_lead")
+	defer done()
+
+	lead, err := db.GetLeadByID(ctx, id)
+	if err != nil || lead == nil {
+		return nil, err
+	}
+
+	at := time.Now().UTC()
+	statesAt := at
+	if lead.Status == models.LeadAssigned {
+		// The assignment itself recorded a new version of the chosen client.
+		at = lead.AssignedAt
+		statesAt = at.Add(-time.Nanosecond)
+	}
+	clients, err := clientsAsOf(ctx, db, statesAt)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := groupsAsOf(ctx, db, statesAt)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &models.Explanation{
+		LeadID:      lead.ID,
+		Status:      lead.Status,
+		ClientID:    lead.ClientID,
+		EvaluatedAt: at,
+		Candidates:  make([]models.Candidate, 0, len(clients)),
+	}
+	if lead.Status == models.LeadAssigned {
+		explanation.Route = explainRoute(*lead, clients, groups, db.shareWindow)
+	}
+	for _, c := range clients {
+		usage, err := throughputAt(ctx, db, c, at)
+		if err != nil {
+			return nil, err
+		}
+		pacing, err := pacingAt(ctx, db, c, at)
+		if err != nil {
+			return nil, err
+		}
+		explanation.Candidates = append(explanation.Candidates, evaluate(c, groups, *lead, at, usage, pacing))
+	}
+
+	// Rank the candidates as findEligibleClient does.
+	candidates := explanation.Candidates
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority > candidates[j].Priority
+		}
+		return candidates[i].Client.CurrentLeadCount < candidates[j].Client.CurrentLeadCount
+	})
+	if db.shareWindow > 0 {
+		if err := rankByShare(ctx, db, candidates, at.Add(-db.shareWindow), at); err != nil {
+			return nil, err
+		}
+	}
+	return explanation, nil
+}
+
+// explainRoute describes how the assigned lead reached its client, taking
+// the fallback chain from the clients and groups as they were at the time.
+func explainRoute(lead models.Lead, clients []models.Client, groups map[string]models.Group, shareWindow time.Duration) *models.Route {
+	r := &models.Route{Via: models.RoutePriority, StickyFrom: lead.StickyFrom, FallbackFrom: lead.FallbackFrom, FallbackStep: lead.FallbackStep}
+	switch {
+	case lead.StickyFrom != "":
+		r.Via = models.RouteSticky
+	case lead.FallbackFrom != "":
+		r.Via = models.RouteFallback
+		for _, c := range clients {
+			if c.ID == lead.FallbackFrom {
+				r.FallbackChain = fallbackChain(c, groups)
+			}
+		}
+	case shareWindow > 0:
+		r.Via = models.RouteShare
+	}
+	return r
+}
+
+// rankByShare ranks candidates, already ordered by priority, as the share
+// strategy does with the leads assigned in [since, until), and records the
+// share deficit of those with a share.
+func rankByShare(ctx context.Context, q queryer, candidates []models.Candidate, since, until time.Time) error {
+	s, err := deliveredBetween(ctx, q, since, until)
+	if err != nil {
+		return err
+	}
+	for _, c := range candidates {
+		if c.Client.Share > 0 {
+			s.totalShare += c.Client.Share
+		}
+	}
+	for i, c := range candidates {
+		if c.Client.Share > 0 {
+			deficit := s.deficit(c.Client)
+			candidates[i].ShareDeficit = &deficit
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return s.before(candidates[i].Client, candidates[j].Client)
+	})
+	return nil
+}
+
+// evaluate returns c as a candidate for lead at the given time, with the
+// reasons it could not take it, mirroring the conditions of
+// findEligibleClient. usage and pacing are c's use of its throughput limits
+// and its pacing state at that time.
+func evaluate(c models.Client, groups map[string]models.Group, lead models.Lead, at time.Time, usage []models.ThroughputUsage, pacing *models.Pacing) models.Candidate {
+	candidate := models.Candidate{Client: c, Priority: c.Priority}
+	switch c.Status {
+	case models.ClientPaused:
+		candidate.Reasons = append(candidate.Reasons, models.ReasonPaused)
+	case models.ClientSuspended:
+		candidate.Reasons = append(candidate.Reasons, models.ReasonSuspended)
+	}
+	if !openAt(c, at) {
+		candidate.Reasons = append(candidate.Reasons, models.ReasonOutsideWorkingHours)
+	}
+	if c.CurrentLeadCount >= c.LeadCapacity {
+		candidate.Reasons = append(candidate.Reasons, models.ReasonAtCapacity)
+	}
+
+	groupFull := false
+	seen := make(map[string]bool)
+	for id := c.GroupID; id != "" && !seen[id]; id = groups[id].ParentID {
+		seen[id] = true
+		g := groups[id]
+		candidate.Priority += g.Priority
+		groupFull = groupFull || (g.LeadCapacity > 0 && g.CurrentLeadCount >= g.LeadCapacity)
+	}
+	if groupFull {
+		candidate.Reasons = append(candidate.Reasons, models.ReasonGroupAtCapacity)
+	}
+	if candidate.Misses = attributes.Misses(c.Criteria, lead.Attributes); len(candidate.Misses) > 0 {
+		candidate.Reasons = append(candidate.Reasons, models.ReasonCriteriaNotMet)
+	}
+	if !ruleMet(c, lead, at) {
+		candidate.Reasons = append(candidate.Reasons, models.ReasonRuleNotMet)
+	}
+	if candidate.Throughput = usage; throttled(usage) {
+		candidate.Reasons = append(candidate.Reasons, models.ReasonThroughputLimited)
+	}
+	if candidate.Pacing = pacing; pacing != nil && pacing.Ahead {
+		candidate.Reasons = append(candidate.Reasons, models.ReasonAheadOfPace)
+	}
+	candidate.Eligible = len(candidate.Reasons) == 0
+	return candidate
+}
+
+// openAt reports whether at falls within c's working hours, which are in
+// UTC and may span midnight.
+func openAt(c models.Client, at time.Time) bool {
+	now := at.UTC().Format("15:04")
+	start, end := c.WorkingHours[0].Format("15:04"), c.WorkingHours[1].Format("15:04")
+	switch {
+	case start < end:
+		return start <= now && now <= end
+	case start > end:
+		return now >= start || now <= end
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"lead_management/pkg/attributes"
+	"lead_management/pkg/models"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// ErrFallbackNotFound is returned when a client or group falls back to a
+// client that does not exist.
+var ErrFallbackNotFound = errors.New("fallback client not found")
+
+// CheckFallbacks validates the fallback chain of the client or group id: it
+// must not name id, an empty ID or any client twice.
+func CheckFallbacks(id string, fallbacks []string) error {
+	for i, f := range fallbacks {
+		switch {
+		case f == "":
+			return errors.New("fallbacks must not contain empty IDs")
+		case f == id:
+			return errors.New("fallbacks must not contain the client itself")
+		case slices.Contains(fallbacks[:i], f):
+			return errors.New("fallbacks must not contain a client twice")
+		}
+	}
+	return nil
+}
+
+// checkFallbacks returns ErrFallbackNotFound unless every fallback names a
+// client, and otherwise the fallbacks column value.
+func checkFallbacks(ctx context.Context, q queryer, fallbacks []string) (string, error) {
+	if len(fallbacks) == 0 {
+		return "[]", nil
+	}
+	for _, id := range fallbacks {
+		c, err := getClientByID(ctx, q, id)
+		if err != nil {
+			return "", err
+		}
+		if c == nil {
+			return "", ErrFallbackNotFound
+		}
+	}
+	raw, err := json.Marshal(fallbacks)
+	return string(raw), err
+}
+
+// unmarshalFallbacks decodes a fallbacks column value, leaving no fallbacks
+// nil.
+func unmarshalFallbacks(data string) ([]string, error) {
+	var fallbacks []string
+	if err := json.Unmarshal([]byte(data), &fallbacks); err != nil || len(fallbacks) == 0 {
+		return nil, err
+	}
+	return fallbacks, nil
+}
+
+// fallbackClient walks the active clients whose criteria and rule lead
+// meets, in the order of effective priority, until one is eligible. Each
+// client on the way that cannot take the lead, because it is closed, full,
+// throttled or ahead of its pace, offers it down its fallback chain first,
+// and the first eligible client in the chain is returned; paused and
+// suspended clients are passed over with their chains. It returns nil if
+// the walk reaches an eligible client, which the general ordering then
+// picks, or every chain is exhausted. eligible returns the client id if it
+// can take the lead, and q may be a transaction.
+func fallbackClient(ctx context.Context, q queryer, lead models.Lead, now time.Time, eligible func(id string) (*models.Client, error)) (*models.Client, route, error) {
+	var chained bool
+	err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM clients WHERE fallbacks != '[]') OR EXISTS (SELECT 1 FROM client_groups WHERE fallbacks != '[]')`).Scan(&chained)
+	if err != nil {
+		slog.Error("failed to check fallback chains", "error", err)
+		return nil, route{}, err
+	}
+	if !chained {
+		return nil, route{}, nil
+	}
+
+	clients, err := rankedClients(ctx, q, "status = 'active'")
+	if err != nil {
+		return nil, route{}, err
+	}
+	groups, err := queryGroups(ctx, q, `SELECT `+groupColumns+` FROM client_groups`)
+	if err != nil {
+		return nil, route{}, err
+	}
+	byID := make(map[string]models.Group, len(groups))
+	for _, g := range groups {
+		byID[g.ID] = g
+	}
+
+	for _, c := range clients {
+		if len(attributes.Misses(c.Criteria, lead.Attributes)) > 0 || !ruleMet(c, lead, now) {
+			continue
+		}
+		if e, err := eligible(c.ID); err != nil || e != nil {
+			return nil, route{}, err
+		}
+		for i, id := range fallbackChain(c, byID) {
+			e, err := eligible(id)
+			if err != nil {
+				return nil, route{}, err
+			}
+			if e != nil {
+				return e, route{fallbackFrom: c.ID, fallbackStep: i + 1}, nil
+			}
+		}
+	}
+	return nil, route{}, nil
+}
+
+// fallbackChain returns c's fallbacks followed by those of its groups, from
+// its own group up, without repeats or c itself.
+func fallbackChain(c models.Client, groups map[string]models.Group) []string {
+	chain := slices.Clone(c.Fallbacks)
+	seen := make(map[string]bool)
+	for id := c.GroupID; id != "" && !seen[id]; id = groups[id].ParentID {
+		seen[id] = true
+		for _, f := range groups[id].Fallbacks {
+			if f != c.ID && !slices.Contains(chain, f) {
+				chain = append(chain, f)
+			}
+		}
+	}
+	return chain
+}
+
+// removeFallback drops the client id from the fallback chains of the other
+// clients and of the groups, recording the changes and publishing their
+// update events in pub's transaction.
+func removeFallback(ctx context.Context, q queryer, pub *publisher, id string) error {
+	clients, err := rankedClients(ctx, q, `EXISTS (SELECT 1 FROM json_each(clients.fallbacks) WHERE value = ?)`, id)
+	if err != nil {
+		return err
+	}
+	for _, c := range clients {
+		fallbacks, err := json.Marshal(slices.DeleteFunc(c.Fallbacks, func(f string) bool { return f == id }))
+		if err != nil {
+			return err
+		}
+		updated, err := scanClient(q.QueryRowContext(ctx, `UPDATE clients SET fallbacks = ?, version = version + 1 WHERE id = ? RETURNING `+clientColumns,
+			string(fallbacks), c.ID))
+		if err != nil {
+			slog.Error("failed to remove fallback", "client", c.ID, "fallback", id, "error", err)
+			return err
+		}
+		if err := pub.recordClient(ctx, models.OperationUpdate, updated); err != nil {
+			return err
+		}
+		if err := pub.publish(ctx, models.EventClientUpdated, updated.ID, updated); err != nil {
+			return err
+		}
+	}
+
+	groups, err := queryGroups(ctx, q, `SELECT `+groupColumns+` FROM client_groups
+        WHERE EXISTS (SELECT 1 FROM json_each(fallbacks) WHERE value = ?)`, id)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		g.Fallbacks = slices.DeleteFunc(g.Fallbacks, func(f string) bool { return f == id })
+		fallbacks, err := json.Marshal(g.Fallbacks)
+		if err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx, `UPDATE client_groups SET fallbacks = ? WHERE id = ?`, string(fallbacks), g.ID); err != nil {
+			slog.Error("failed to remove fallback", "group", g.ID, "fallback", id, "error", err)
+			return err
+		}
+		if err := pub.recordChange(ctx, models.EntityGroup, models.OperationUpdate, g.ID, g); err != nil {
+			return err
+		}
+		if err := pub.publish(ctx, models.EventGroupUpdated, "", g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
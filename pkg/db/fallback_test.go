@@ -0,0 +1,228 @@
+package db
+
+import (
+	"context"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFallbacks(t *testing.T) {
+	tests := []struct {
+		name        string
+		fallbacks   []string
+		expectedErr bool
+	}{
+		{name: "No fallbacks"},
+		{name: "Chain", fallbacks: []string{"b", "c"}},
+		{name: "Self", fallbacks: []string{"b", "a"}, expectedErr: true},
+		{name: "Repeated", fallbacks: []string{"b", "c", "b"}, expectedErr: true},
+		{name: "Empty ID", fallbacks: []string{""}, expectedErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckFallbacks("a", tc.fallbacks)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFallbackChains(t *testing.T) {
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	closed := [2]time.Time{parseTime("00:00"), parseTime("00:00")}
+	partner := models.Client{ID: "partner", Name: "Partner", Priority: 1, LeadCapacity: 10, WorkingHours: allDay}
+	backup := models.Client{ID: "backup", Name: "Backup", Priority: 1, LeadCapacity: 10, WorkingHours: allDay}
+	pool := models.Client{ID: "pool", Name: "Pool", Priority: 5, LeadCapacity: 10, WorkingHours: allDay}
+	tests := []struct {
+		name           string
+		groups         []models.Group
+		clients        []models.Client
+		lead           models.Lead
+		expectedClient string
+		expectedFrom   string
+		expectedStep   int
+		expectedChain  []string
+	}{
+		{
+			name: "Available preferred client keeps its leads",
+			clients: []models.Client{partner, pool,
+				{ID: "premium", Name: "Premium", Priority: 10, LeadCapacity: 10, WorkingHours: allDay, Fallbacks: []string{"partner"}}},
+			expectedClient: "premium",
+		},
+		{
+			name: "Closed client overflows to its partner",
+			clients: []models.Client{partner, pool,
+				{ID: "premium", Name: "Premium", Priority: 10, LeadCapacity: 10, WorkingHours: closed, Fallbacks: []string{"partner"}}},
+			expectedClient: "partner",
+			expectedFrom:   "premium",
+			expectedStep:   1,
+			expectedChain:  []string{"partner"},
+		},
+		{
+			name: "Unavailable fallbacks are skipped",
+			clients: []models.Client{partner, pool,
+				{ID: "full", Name: "Full", Priority: 1, LeadCapacity: 1, CurrentLeadCount: 1, WorkingHours: allDay},
+				{ID: "premium", Name: "Premium", Priority: 10, LeadCapacity: 5, CurrentLeadCount: 5, WorkingHours: allDay, Fallbacks: []string{"full", "partner"}}},
+			expectedClient: "partner",
+			expectedFrom:   "premium",
+			expectedStep:   2,
+			expectedChain:  []string{"full", "partner"},
+		},
+		{
+			name: "Exhausted chain falls back to the general ordering",
+			clients: []models.Client{pool,
+				{ID: "full", Name: "Full", Priority: 1, LeadCapacity: 1, CurrentLeadCount: 1, WorkingHours: allDay},
+				{ID: "premium", Name: "Premium", Priority: 10, LeadCapacity: 10, WorkingHours: closed, Fallbacks: []string{"full"}}},
+			expectedClient: "pool",
+		},
+		{
+			name:   "Group chain follows the client's own",
+			groups: []models.Group{{ID: "g", Name: "Premium", Fallbacks: []string{"partner", "backup"}}},
+			clients: []models.Client{backup, pool,
+				{ID: "partner", Name: "Partner", Priority: 1, LeadCapacity: 10, WorkingHours: allDay, Status: models.ClientPaused},
+				{ID: "premium", Name: "Premium", Priority: 10, LeadCapacity: 10, WorkingHours: closed, GroupID: "g", Fallbacks: []string{"partner"}}},
+			expectedClient: "backup",
+			expectedFrom:   "premium",
+			expectedStep:   2,
+			expectedChain:  []string{"partner", "backup"},
+		},
+		{
+			name: "Clients the lead does not fit have no say",
+			clients: []models.Client{partner, pool,
+				{ID: "premium", Name: "Premium", Priority: 10, LeadCapacity: 10, WorkingHours: closed, Fallbacks: []string{"partner"},
+					Rule: "false"}},
+			expectedClient: "pool",
+		},
+		{
+			name: "A higher-priority eligible client takes precedence",
+			clients: []models.Client{partner,
+				{ID: "top", Name: "Top", Priority: 20, LeadCapacity: 10, WorkingHours: allDay},
+				{ID: "premium", Name: "Premium", Priority: 10, LeadCapacity: 10, WorkingHours: closed, Fallbacks: []string{"partner"}}},
+			expectedClient: "top",
+		},
+		{
+			name: "Inactive clients do not divert their leads",
+			clients: []models.Client{partner, pool,
+				{ID: "premium", Name: "Premium", Priority: 10, LeadCapacity: 10, WorkingHours: allDay, Fallbacks: []string{"partner"},
+					Status: models.ClientSuspended}},
+			expectedClient: "pool",
+		},
+		{
+			name: "Closed clients divert their leads before lower-priority open ones",
+			clients: []models.Client{partner,
+				{ID: "open", Name: "Open", Priority: 5, LeadCapacity: 10, WorkingHours: allDay},
+				{ID: "premium", Name: "Premium", Priority: 10, LeadCapacity: 10, WorkingHours: closed, Fallbacks: []string{"partner"}}},
+			expectedClient: "partner",
+			expectedFrom:   "premium",
+			expectedStep:   1,
+			expectedChain:  []string{"partner"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := InitDB(":memory:")
+			defer database.Close()
+			ctx := context.Background()
+			setupEligibleClientsDatabase(database, tc.clients[:len(tc.clients)-1])
+			setupGroups(t, database, tc.groups)
+			setupEligibleClientsDatabase(database, tc.clients[len(tc.clients)-1:])
+
+			tc.lead.ID = "l1"
+			lead, err := database.AssignLead(ctx, tc.lead)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedClient, lead.ClientID)
+			assert.Equal(t, tc.expectedFrom, lead.FallbackFrom)
+			assert.Equal(t, tc.expectedStep, lead.FallbackStep)
+
+			stored, err := database.GetLeadByID(ctx, "l1")
+			require.NoError(t, err)
+			assert.Equal(t, *lead, *stored)
+
+			explanation, err := database.ExplainLead(ctx, "l1")
+			require.NoError(t, err)
+			require.NotNil(t, explanation.Route)
+			assert.Equal(t, tc.expectedFrom, explanation.Route.FallbackFrom)
+			assert.Equal(t, tc.expectedStep, explanation.Route.FallbackStep)
+			assert.Equal(t, tc.expectedChain, explanation.Route.FallbackChain)
+			if tc.expectedStep > 0 {
+				assert.Equal(t, models.RouteFallback, explanation.Route.Via)
+				assert.Equal(t, tc.expectedClient, tc.expectedChain[tc.expectedStep-1])
+			} else {
+				assert.Equal(t, models.RoutePriority, explanation.Route.Via)
+			}
+		})
+	}
+}
+
+func TestFallbackChainErrors(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+
+	err := database.CreateClient(ctx, models.Client{ID: "a", Name: "A", WorkingHours: allDay, Fallbacks: []string{"missing"}})
+	assert.ErrorIs(t, err, ErrFallbackNotFound)
+	err = database.CreateGroup(ctx, models.Group{ID: "g", Name: "G", Fallbacks: []string{"missing"}})
+	assert.ErrorIs(t, err, ErrFallbackNotFound)
+
+	require.NoError(t, database.CreateClient(ctx, models.Client{ID: "b", Name: "B", WorkingHours: allDay}))
+	require.NoError(t, database.CreateGroup(ctx, models.Group{ID: "g", Name: "G", Fallbacks: []string{"b"}}))
+	g, err := database.GetGroupByID(ctx, "g")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, g.Fallbacks)
+}
+
+func TestDeleteClientRemovesFallbacks(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+
+	require.NoError(t, database.CreateClient(ctx, models.Client{ID: "backup", Name: "Backup", WorkingHours: allDay}))
+	require.NoError(t, database.CreateClient(ctx, models.Client{ID: "partner", Name: "Partner", WorkingHours: allDay}))
+	require.NoError(t, database.CreateClient(ctx, models.Client{ID: "a", Name: "A", WorkingHours: allDay, Fallbacks: []string{"backup", "partner"}}))
+	require.NoError(t, database.CreateClient(ctx, models.Client{ID: "b", Name: "B", WorkingHours: allDay, Fallbacks: []string{"backup"}}))
+	require.NoError(t, database.CreateGroup(ctx, models.Group{ID: "g", Name: "G", Fallbacks: []string{"partner", "backup"}}))
+
+	found, err := database.DeleteClient(ctx, "backup", 0)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	a, err := database.GetClientByID(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"partner"}, a.Fallbacks)
+	assert.Equal(t, 2, a.Version, "removing a fallback changes the client")
+	b, err := database.GetClientByID(ctx, "b")
+	require.NoError(t, err)
+	assert.Empty(t, b.Fallbacks)
+	g, err := database.GetGroupByID(ctx, "g")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"partner"}, g.Fallbacks)
+
+	history, err := database.GetClientHistory(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"partner"}, history[len(history)-1].Client.Fallbacks)
+
+	events, err := database.GetEvents(ctx, 0, EventFilter{Types: []string{models.EventClientUpdated, models.EventGroupUpdated}}, 10)
+	require.NoError(t, err)
+	var updated []string
+	for _, e := range events {
+		updated = append(updated, e.Type+" "+e.ClientID)
+	}
+	assert.ElementsMatch(t, []string{"client.updated a", "client.updated b", "group.updated "}, updated)
+
+	// A client left without fallbacks stores an empty chain, like one
+	// created without.
+	var fallbacks string
+	require.NoError(t, database.QueryRowContext(ctx, `SELECT fallbacks FROM clients WHERE id = 'b'`).Scan(&fallbacks))
+	assert.Equal(t, "[]", fallbacks)
+}
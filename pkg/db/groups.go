@@ -0,0 +1,396 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"lead_management/pkg/models"
+	"log/slog"
+	"time"
+)
+
+// Errors returned by group operations.
+var (
+	// ErrGroupNotFound is returned when a client or group refers to a
+	// group that does not exist.
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrGroupCycle is returned when a group would become its own ancestor.
+	ErrGroupCycle = errors.New("group cannot be nested within itself")
+	// ErrGroupNotEmpty is returned when deleting a group that still has
+	// clients or subgroups.
+	ErrGroupNotEmpty = errors.New("group has members")
+)
+
+// groupTotals is a WITH clause defining group_totals, which holds for every
+// client in a group the sum of the priorities of its groups, up to the top
+// of the hierarchy, and whether any of them has reached its cap.
+const groupTotals = `
+    WITH RECURSIVE membership(clientId, groupId) AS (
+        SELECT id, groupId FROM clients WHERE groupId != ''
+        UNION
+        SELECT membership.clientId, g.parentId
+        FROM membership JOIN client_groups g ON g.id = membership.groupId
+        WHERE g.parentId != ''
+    ),
+    group_totals AS (
+        SELECT membership.clientId,
+            SUM(g.priority) AS groupPriority,
+            MAX(g.leadCapacity > 0 AND g.currentLeadCount >= g.leadCapacity) AS groupFull
+        FROM membership JOIN client_groups g ON g.id = membership.groupId
+        GROUP BY membership.clientId
+    )`
+
+// groupColumns lists the group columns in the order scanGroup expects them.
+const groupColumns = `id, name, parentId, priority, leadCapacity, currentLeadCount, fallbacks`
+
+// scanGroup scans a row selected with groupColumns.
+func scanGroup(row scanner) (models.Group, error) {
+	var g models.Group
+	var fallbacks string
+	if err := row.Scan(&g.ID, &g.Name, &g.ParentID, &g.Priority, &g.LeadCapacity, &g.CurrentLeadCount, &fallbacks); err != nil {
+		return g, err
+	}
+	var err error
+	g.Fallbacks, err = unmarshalFallbacks(fallbacks)
+	return g, err
+}
+
+// CreateGroup inserts a new group. It returns ErrGroupNotFound if its parent
+// does not exist and ErrFallbackNotFound if a fallback client does not.
+func (db *DB) CreateGroup(ctx context.Context, g models.Group) error {
+	ctx, done := trace(ctx, "create_group")
+	defer done()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkGroup(ctx, tx, g.ParentID); err != nil {
+		return err
+	}
+	fallbacks, err := checkFallbacks(ctx, tx, g.Fallbacks)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO client_groups (`+groupColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		g.ID, g.Name, g.ParentID, g.Priority, g.LeadCapacity, g.CurrentLeadCount, fallbacks)
+	if err != nil {
+		slog.Error("failed to insert group", "id", g.ID, "error", err)
+		return err
+	}
+	pub := db.publisher(tx, time.Now().UTC())
+	if err := pub.recordChange(ctx, models.EntityGroup, models.OperationInsert, g.ID, g); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to commit transaction", "error", err)
+		return err
+	}
+	slog.Info("group created", "id", g.ID, "parent", g.ParentID)
+	return nil
+}
+
+// UpdateGroup replaces the stored fields of an existing group and reports
+// whether it existed. It returns ErrGroupNotFound if the new parent does not
+// exist, ErrGroupCycle if the group would be nested within itself and
+// ErrFallbackNotFound if a fallback client does not exist.
+func (db *DB) UpdateGroup(ctx context.Context, g models.Group) (bool, error) {
+	ctx, done := trace(ctx, "update_group")
+	defer done()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := checkParent(ctx, tx, g.ID, g.ParentID); err != nil {
+		return false, err
+	}
+	fallbacks, err := checkFallbacks(ctx, tx, g.Fallbacks)
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE client_groups SET name = ?, parentId = ?, priority = ?, leadCapacity = ?, currentLeadCount = ?, fallbacks = ? WHERE id = ?`,
+		g.Name, g.ParentID, g.Priority, g.LeadCapacity, g.CurrentLeadCount, fallbacks, g.ID)
+	if err != nil {
+		slog.Error("failed to update group", "id", g.ID, "error", err)
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	pub := db.publisher(tx, time.Now().UTC())
+	if err := pub.recordChange(ctx, models.EntityGroup, models.OperationUpdate, g.ID, g); err != nil {
+		return false, err
+	}
+	if err := pub.publish(ctx, models.EventGroupUpdated, "", g); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to commit transaction", "error", err)
+		return false, err
+	}
+	// A raised cap may let queued leads through.
+	db.notify(pub)
+
+	slog.Info("group updated", "id", g.ID, "parent", g.ParentID)
+	return true, nil
+}
+
+// DeleteGroup removes a group and reports whether it existed. It returns
+// ErrGroupNotEmpty if clients or subgroups still belong to it.
+func (db *DB) DeleteGroup(ctx context.Context, id string) (bool, error) {
+	ctx, done := trace(ctx, "delete_group")
+	defer done()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var members bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM clients WHERE groupId = ?) OR EXISTS (SELECT 1 FROM client_groups WHERE parentId = ?)`, id, id).Scan(&members)
+	if err != nil {
+		slog.Error("failed to check group members", "id", id, "error", err)
+		return false, err
+	}
+	g, err := scanGroup(tx.QueryRowContext(ctx, `DELETE FROM client_groups WHERE id = ? RETURNING `+groupColumns, id))
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		slog.Error("failed to delete group", "id", id, "error", err)
+		return false, err
+	}
+	if members {
+		return false, ErrGroupNotEmpty
+	}
+	pub := db.publisher(tx, time.Now().UTC())
+	if err := pub.recordChange(ctx, models.EntityGroup, models.OperationDelete, g.ID, g); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to commit transaction", "error", err)
+		return false, err
+	}
+	slog.Info("group deleted", "id", id)
+	return true, nil
+}
+
+// GetGroupByID retrieves a group by its ID, or nil if it does not exist.
+func (db *DB) GetGroupByID(ctx context.Context, id string) (*models.Group, error) {
+	ctx, done := trace(ctx, "get_group_by_id")
+	defer done()
+
+	return getGroupByID(ctx, db, id)
+}
+
+// getGroupByID retrieves a group using q, which may be a transaction.
+func getGroupByID(ctx context.Context, q queryer, id string) (*models.Group, error) {
+	g, err := scanGroup(q.QueryRowContext(ctx, `SELECT `+groupColumns+` FROM client_groups WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		slog.Error("failed to scan group row", "error", err)
+		return nil, err
+	}
+	return &g, nil
+}
+
+// GetAllGroups retrieves all groups in ID order.
+func (db *DB) GetAllGroups(ctx context.Context) ([]models.Group, error) {
+	ctx, done := trace(ctx, "get_all_groups")
+	defer done()
+
+	return queryGroups(ctx, db, `SELECT `+groupColumns+` FROM client_groups ORDER BY id`)
+}
+
+// queryGroups runs a query selecting groupColumns.
+func queryGroups(ctx context.Context, q queryer, query string, args ...any) ([]models.Group, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("failed to query groups", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.Group
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			slog.Error("failed to scan group row", "error", err)
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// checkGroup returns ErrGroupNotFound unless id is empty or names a group.
+func checkGroup(ctx context.Context, q queryer, id string) error {
+	if id == "" {
+		return nil
+	}
+	g, err := getGroupByID(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	if g == nil {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// checkParent verifies that the group id may be nested in parentID: the
+// parent must exist and must not be id or one of its descendants.
+func checkParent(ctx context.Context, q queryer, id, parentID string) error {
+	if err := checkGroup(ctx, q, parentID); err != nil {
+		return err
+	}
+	ancestors, err := ancestorGroups(ctx, q, parentID)
+	if err != nil {
+		return err
+	}
+	for _, g := range ancestors {
+		if g.ID == id {
+			return ErrGroupCycle
+		}
+	}
+	return nil
+}
+
+// ancestorGroups returns the group id and all groups above it.
+func ancestorGroups(ctx context.Context, q queryer, id string) ([]models.Group, error) {
+	if id == "" {
+		return nil, nil
+	}
+	return queryGroups(ctx, q, `
+        WITH RECURSIVE chain(id) AS (
+            SELECT ?
+            UNION
+            SELECT g.parentId FROM client_groups g JOIN chain ON g.id = chain.id WHERE g.parentId != ''
+        )
+        SELECT `+groupColumns+` FROM client_groups WHERE id IN chain`, id)
+}
+
+// countGroupLead takes one unit of capacity from the group id and all
+// groups above it, and records their changes in pub's transaction.
+func countGroupLead(ctx context.Context, q queryer, pub *publisher, id string) error {
+	groups, err := ancestorGroups(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if _, err := q.ExecContext(ctx, `UPDATE client_groups SET currentLeadCount = currentLeadCount + 1 WHERE id = ?`, g.ID); err != nil {
+			slog.Error("failed to increment group lead count", "group", g.ID, "error", err)
+			return err
+		}
+		g.CurrentLeadCount++
+		if err := pub.recordChange(ctx, models.EntityGroup, models.OperationUpdate, g.ID, g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupsAsOf returns the state every group had at the given time, by ID,
+// reconstructed from the change log.
+func groupsAsOf(ctx context.Context, q queryer, at time.Time) (map[string]models.Group, error) {
+	rows, err := q.QueryContext(ctx, `
+        SELECT data FROM changes c
+        WHERE entity = ? AND sequence = (
+            SELECT MAX(sequence) FROM changes
+            WHERE entity = c.entity AND entityId = c.entityId AND changedAt <= ?
+        )
+        AND operation != ?`, models.EntityGroup, at.UTC(), models.OperationDelete)
+	if err != nil {
+		slog.Error("failed to query group changes", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make(map[string]models.Group)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var g models.Group
+		if err := json.Unmarshal([]byte(data), &g); err != nil {
+			return nil, err
+		}
+		groups[g.ID] = g
+	}
+	return groups, rows.Err()
+}
+
+// GroupReports rolls up the group id and its subgroups, or every top-level
+// group if id is empty. It returns no reports for unknown groups.
+func (db *DB) GroupReports(ctx context.Context, id string) ([]models.GroupReport, error) {
+	ctx, done := trace(ctx, "group_reports")
+	defer done()
+
+	groups, err := queryGroups(ctx, db, `SELECT `+groupColumns+` FROM client_groups ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := db.listClients(ctx, ClientFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	subgroups := make(map[string][]models.Group)
+	for _, g := range groups {
+		subgroups[g.ParentID] = append(subgroups[g.ParentID], g)
+	}
+	members := make(map[string][]models.Client)
+	for _, c := range clients {
+		members[c.GroupID] = append(members[c.GroupID], c)
+	}
+
+	var report func(g models.Group) models.GroupReport
+	report = func(g models.Group) models.GroupReport {
+		r := models.GroupReport{Group: g, Subgroups: []models.GroupReport{}}
+		for _, c := range members[g.ID] {
+			r.Clients++
+			r.ClientCapacity += c.LeadCapacity
+			r.ClientLeadCount += c.CurrentLeadCount
+			r.AvailableCapacity += max(c.LeadCapacity-c.CurrentLeadCount, 0)
+		}
+		for _, sub := range subgroups[g.ID] {
+			s := report(sub)
+			r.Clients += s.Clients
+			r.ClientCapacity += s.ClientCapacity
+			r.ClientLeadCount += s.ClientLeadCount
+			r.AvailableCapacity += s.AvailableCapacity
+			r.Subgroups = append(r.Subgroups, s)
+		}
+		if g.LeadCapacity > 0 {
+			r.AvailableCapacity = min(r.AvailableCapacity, max(g.LeadCapacity-g.CurrentLeadCount, 0))
+			r.Utilization = float64(g.CurrentLeadCount) / float64(g.LeadCapacity)
+		} else if r.ClientCapacity > 0 {
+			r.Utilization = float64(r.ClientLeadCount) / float64(r.ClientCapacity)
+		}
+		return r
+	}
+
+	var reports []models.GroupReport
+	for _, g := range groups {
+		if (id == "" && g.ParentID == "") || g.ID == id {
+			reports = append(reports, report(g))
+		}
+	}
+	return reports, nil
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupGroups(t *testing.T, database *DB, groups []models.Group) {
+	for _, g := range groups {
+		require.NoError(t, database.CreateGroup(context.Background(), g))
+	}
+}
+
+func TestGroupEligibility(t *testing.T) {
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	tests := []struct {
+		name           string
+		groups         []models.Group
+		clients        []models.Client
+		expectedClient string
+	}{
+		{
+			name:   "Group priority adds to member priority",
+			groups: []models.Group{{ID: "g", Name: "Agency", Priority: 10}},
+			clients: []models.Client{
+				{ID: "solo", Name: "Solo", Priority: 5, LeadCapacity: 10, WorkingHours: allDay},
+				{ID: "member", Name: "Member", Priority: 1, LeadCapacity: 10, WorkingHours: allDay, GroupID: "g"},
+			},
+			expectedClient: "member",
+		},
+		{
+			name:   "Nested group priorities add up",
+			groups: []models.Group{{ID: "top", Name: "Agency", Priority: 3}, {ID: "branch", Name: "Branch", ParentID: "top", Priority: 3}},
+			clients: []models.Client{
+				{ID: "solo", Name: "Solo", Priority: 6, LeadCapacity: 10, CurrentLeadCount: 1, WorkingHours: allDay},
+				{ID: "member", Name: "Member", Priority: 1, LeadCapacity: 10, WorkingHours: allDay, GroupID: "branch"},
+			},
+			expectedClient: "member",
+		},
+		{
+			name:   "Full group excludes its members",
+			groups: []models.Group{{ID: "g", Name: "Agency", Priority: 10, LeadCapacity: 5, CurrentLeadCount: 5}},
+			clients: []models.Client{
+				{ID: "solo", Name: "Solo", Priority: 1, LeadCapacity: 10, WorkingHours: allDay},
+				{ID: "member", Name: "Member", Priority: 1, LeadCapacity: 10, WorkingHours: allDay, GroupID: "g"},
+			},
+			expectedClient: "solo",
+		},
+		{
+			name:   "Full parent group excludes nested members",
+			groups: []models.Group{{ID: "top", Name: "Agency", LeadCapacity: 5, CurrentLeadCount: 5}, {ID: "branch", Name: "Branch", ParentID: "top", Priority: 10}},
+			clients: []models.Client{
+				{ID: "member", Name: "Member", Priority: 1, LeadCapacity: 10, WorkingHours: allDay, GroupID: "branch"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := InitDB(":memory:")
+			defer database.Close()
+			setupGroups(t, database, tc.groups)
+			setupEligibleClientsDatabase(database, tc.clients)
+
+			client, err := database.GetEligibleClient(context.Background())
+			require.NoError(t, err)
+			if tc.expectedClient == "" {
+				assert.Nil(t, client)
+				return
+			}
+			require.NotNil(t, client)
+			assert.Equal(t, tc.expectedClient, client.ID)
+		})
+	}
+}
+
+func TestGroupCapacity(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupGroups(t, database, []models.Group{
+		{ID: "top", Name: "Agency", LeadCapacity: 2},
+		{ID: "branch", Name: "Branch", ParentID: "top"},
+	})
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "a", Name: "A", LeadCapacity: 10, WorkingHours: allDay, GroupID: "top"},
+		{ID: "b", Name: "B", LeadCapacity: 10, WorkingHours: allDay, GroupID: "branch"},
+	})
+
+	for _, id := range []string{"l1", "l2", "l3"} {
+		_, err := database.AssignLead(ctx, models.Lead{ID: id})
+		require.NoError(t, err)
+	}
+	lead, err := database.GetLeadByID(ctx, "l3")
+	require.NoError(t, err)
+	assert.Equal(t, models.LeadQueued, lead.Status)
+
+	top, err := database.GetGroupByID(ctx, "top")
+	require.NoError(t, err)
+	assert.Equal(t, 2, top.CurrentLeadCount)
+	branch, err := database.GetGroupByID(ctx, "branch")
+	require.NoError(t, err)
+
+	reports, err := database.GroupReports(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal(t, 2, reports[0].Clients)
+	assert.Equal(t, 20, reports[0].ClientCapacity)
+	assert.Equal(t, 2, reports[0].ClientLeadCount)
+	assert.Equal(t, 0, reports[0].AvailableCapacity)
+	assert.Equal(t, 1.0, reports[0].Utilization)
+	require.Len(t, reports[0].Subgroups, 1)
+	assert.Equal(t, branch.CurrentLeadCount, reports[0].Subgroups[0].Group.CurrentLeadCount)
+	assert.Equal(t, 1, reports[0].Subgroups[0].Clients)
+
+	// The explanation shows why the queued lead is waiting.
+	explanation, err := database.ExplainLead(ctx, "l3")
+	require.NoError(t, err)
+	assert.Nil(t, explanation.Route, "queued leads have no route")
+	for _, c := range explanation.Candidates {
+		assert.Equal(t, []string{models.ReasonGroupAtCapacity}, c.Reasons)
+	}
+
+	// Raising the cap lets the queued lead through.
+	top.LeadCapacity = 3
+	found, err := database.UpdateGroup(ctx, *top)
+	require.NoError(t, err)
+	assert.True(t, found)
+	select {
+	case <-database.ClientsChanged():
+	default:
+		t.Error("updating a group did not signal the queue")
+	}
+	events, err := database.GetEvents(ctx, 0, EventFilter{Types: []string{models.EventGroupUpdated}}, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.JSONEq(t, `{"id":"top","name":"Agency","priority":0,"leadCapacity":3,"currentLeadCount":2}`, string(events[0].Data))
+	assigned, err := database.AssignQueuedLeads(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, assigned)
+}
+
+func TestGroupHierarchyChecks(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	setupGroups(t, database, []models.Group{
+		{ID: "top", Name: "Agency"},
+		{ID: "branch", Name: "Branch", ParentID: "top"},
+	})
+
+	assert.ErrorIs(t, database.CreateGroup(ctx, models.Group{ID: "x", Name: "X", ParentID: "missing"}), ErrGroupNotFound)
+
+	_, err := database.UpdateGroup(ctx, models.Group{ID: "top", Name: "Agency", ParentID: "branch"})
+	assert.ErrorIs(t, err, ErrGroupCycle)
+	_, err = database.UpdateGroup(ctx, models.Group{ID: "top", Name: "Agency", ParentID: "top"})
+	assert.ErrorIs(t, err, ErrGroupCycle)
+
+	err = database.CreateClient(ctx, models.Client{ID: "c", Name: "C", GroupID: "missing"})
+	assert.ErrorIs(t, err, ErrGroupNotFound)
+
+	_, err = database.DeleteGroup(ctx, "top")
+	assert.ErrorIs(t, err, ErrGroupNotEmpty)
+	found, err := database.DeleteGroup(ctx, "branch")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = database.DeleteGroup(ctx, "branch")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"lead_management/pkg/auth"
+	"lead_management/pkg/models"
+	"log/slog"
+	"time"
+)
+
+// recordClient appends the state of a client after a change to both the
+// change log and the client's version history, in the publisher's
+// transaction. The version is attributed to the principal in ctx.
+func (p *publisher) recordClient(ctx context.Context, operation string, c models.Client) error {
+	if err := p.recordChange(ctx, models.EntityClient, operation, c.ID, c); err != nil {
+		return err
+	}
+	return insertClientVersion(ctx, p.q, operation, changedBy(ctx), p.now, c)
+}
+
+// insertClientVersion appends one version of a client to its history.
+func insertClientVersion(ctx context.Context, q queryer, operation, principal string, at time.Time, c models.Client) error {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `INSERT INTO client_versions (clientId, operation, changedAt, changedBy, data) VALUES (?, ?, ?, ?, ?)`,
+		c.ID, operation, at, principal, string(raw))
+	if err != nil {
+		slog.Error("failed to record client version", "id", c.ID, "error", err)
+	}
+	return err
+}
+
+// changedBy returns the name of the principal making the request in ctx, or
+// "" if there is none.
+func changedBy(ctx context.Context) string {
+	if p := auth.FromContext(ctx); p != nil {
+		return p.Name
+	}
+	return ""
+}
+
+// clientVersionColumns lists the version columns in the order
+// scanClientVersion expects them.
+const clientVersionColumns = `version, operation, changedAt, changedBy, data`
+
+// scanClientVersion scans a row selected with clientVersionColumns.
+func scanClientVersion(row scanner) (models.ClientVersion, error) {
+	var v models.ClientVersion
+	var data string
+	if err := row.Scan(&v.Sequence, &v.Operation, &v.ChangedAt, &v.ChangedBy, &data); err != nil {
+		return v, err
+	}
+	v.ChangedAt = v.ChangedAt.UTC()
+	return v, json.Unmarshal([]byte(data), &v.Client)
+}
+
+// GetClientHistory returns every version of a client, oldest first. It
+// returns no versions for unknown clients.
+func (db *DB) GetClientHistory(ctx context.Context, id string) ([]models.ClientVersion, error) {
+	ctx, done := trace(ctx, "get_client_history")
+	defer done()
+
+	rows, err := db.QueryContext(ctx, `SELECT `+clientVersionColumns+` FROM client_versions WHERE clientId = ? ORDER BY version`, id)
+	if err != nil {
+		slog.Error("failed to query client history", "id", id, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.ClientVersion
+	for rows.Next() {
+		v, err := scanClientVersion(rows)
+		if err != nil {
+			slog.Error("failed to scan client version", "error", err)
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetClientAsOf returns the state a client had at the given time, or nil if
+// it did not exist yet or had been deleted.
+func (db *DB) GetClientAsOf(ctx context.Context, id string, at time.Time) (*models.Client, error) {
+	ctx, done := trace(ctx, "get_client_as_of")
+	defer done()
+
+	query := `SELECT ` + clientVersionColumns + ` FROM client_versions WHERE clientId = ? AND changedAt <= ? ORDER BY version DESC LIMIT 1`
+	v, err := scanClientVersion(db.QueryRowContext(ctx, query, id, at.UTC()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		slog.Error("failed to scan client version", "error", err)
+		return nil, err
+	}
+	if v.Operation == models.OperationDelete {
+		return nil, nil
+	}
+	return &v.Client, nil
+}
+
+// clientsAsOf returns the state every client had at the given time, in ID
+// order. Clients created later or deleted by then are omitted.
+func clientsAsOf(ctx context.Context, q queryer, at time.Time) ([]models.Client, error) {
+	rows, err := q.QueryContext(ctx, `
+        SELECT `+clientVersionColumns+`
+        FROM client_versions v
+        WHERE version = (
+            SELECT MAX(version) FROM client_versions
+            WHERE clientId = v.clientId AND changedAt <= ?
+        )
+        AND operation != ?
+        ORDER BY clientId`, at.UTC(), models.OperationDelete)
+	if err != nil {
+		slog.Error("failed to query client versions", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []models.Client
+	for rows.Next() {
+		v, err := scanClientVersion(rows)
+		if err != nil {
+			slog.Error("failed to scan client version", "error", err)
+			return nil, err
+		}
+		clients = append(clients, v.Client)
+	}
+	return clients, rows.Err()
+}
+
+// backfillClientVersions seeds an empty version history with the current
+// clients, so that databases created before histories were kept can be
+// looked up from now on.
+func backfillClientVersions(ctx context.Context, db *DB) error {
+	var empty bool
+	if err := db.QueryRowContext(ctx, `SELECT NOT EXISTS (SELECT 1 FROM client_versions)`).Scan(&empty); err != nil || !empty {
+		return err
+	}
+
+	clients, err := db.GetAllClients(ctx)
+	if err != nil || len(clients) == 0 {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, c := range clients {
+		if err := insertClientVersion(ctx, tx, models.OperationInsert, "", now, c); err != nil {
+			return err
+		}
+	}
+	slog.Info("client history backfilled", "clients", len(clients))
+	return tx.Commit()
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"lead_management/pkg/auth"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientHistory(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Name: "alice"})
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+
+	client := models.Client{ID: "1", Name: "Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay}
+	require.NoError(t, database.CreateClient(ctx, client))
+	created := time.Now().UTC()
+	client.Priority = 5
+	_, err := database.UpdateClient(ctx, client)
+	require.NoError(t, err)
+	updated := time.Now().UTC()
+	_, err = database.AssignLead(context.Background(), models.Lead{ID: "l1"})
+	require.NoError(t, err)
+
+	versions, err := database.GetClientHistory(context.Background(), "1")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, models.OperationInsert, versions[0].Operation)
+	assert.Equal(t, "alice", versions[0].ChangedBy)
+	assert.Equal(t, 1, versions[0].Client.Priority)
+	assert.Equal(t, 5, versions[1].Client.Priority)
+	assert.Equal(t, "alice", versions[1].ChangedBy)
+	assert.Equal(t, 1, versions[2].Client.CurrentLeadCount)
+	assert.Equal(t, "", versions[2].ChangedBy)
+
+	tests := []struct {
+		name             string
+		at               time.Time
+		expectedPriority int
+		expectedCount    int
+		notFound         bool
+	}{
+		{name: "Before creation", at: created.Add(-time.Hour), notFound: true},
+		{name: "After creation", at: created, expectedPriority: 1},
+		{name: "After update", at: updated, expectedPriority: 5},
+		{name: "Now", at: time.Now(), expectedPriority: 5, expectedCount: 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := database.GetClientAsOf(context.Background(), "1", tc.at)
+			require.NoError(t, err)
+			if tc.notFound {
+				assert.Nil(t, c)
+				return
+			}
+			require.NotNil(t, c)
+			assert.Equal(t, tc.expectedPriority, c.Priority)
+			assert.Equal(t, tc.expectedCount, c.CurrentLeadCount)
+		})
+	}
+}
+
+func TestExplainLead(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "a", Name: "Low", Priority: 1, LeadCapacity: 10, WorkingHours: allDay},
+		{ID: "b", Name: "High", Priority: 5, LeadCapacity: 1, WorkingHours: allDay},
+	})
+
+	// The first lead fills b; the second goes to a.
+	_, err := database.AssignLead(ctx, models.Lead{ID: "l1"})
+	require.NoError(t, err)
+	_, err = database.AssignLead(ctx, models.Lead{ID: "l2"})
+	require.NoError(t, err)
+
+	// A later change must not alter the explanation of earlier leads.
+	_, err = database.UpdateClient(ctx, models.Client{ID: "a", Name: "Low", Priority: 9, LeadCapacity: 10, CurrentLeadCount: 1, WorkingHours: allDay})
+	require.NoError(t, err)
+
+	explanation, err := database.ExplainLead(ctx, "l1")
+	require.NoError(t, err)
+	require.NotNil(t, explanation)
+	assert.Equal(t, "b", explanation.ClientID)
+	require.Len(t, explanation.Candidates, 2)
+	assert.Equal(t, "b", explanation.Candidates[0].Client.ID)
+	assert.True(t, explanation.Candidates[0].Eligible)
+	assert.Equal(t, 0, explanation.Candidates[0].Client.CurrentLeadCount)
+	assert.Equal(t, 1, explanation.Candidates[1].Client.Priority)
+
+	explanation, err = database.ExplainLead(ctx, "l2")
+	require.NoError(t, err)
+	assert.Equal(t, "a", explanation.ClientID)
+	assert.Equal(t, "b", explanation.Candidates[0].Client.ID)
+	assert.False(t, explanation.Candidates[0].Eligible)
+	assert.Equal(t, []string{models.ReasonAtCapacity}, explanation.Candidates[0].Reasons)
+	assert.True(t, explanation.Candidates[1].Eligible)
+
+	explanation, err = database.ExplainLead(ctx, "missing")
+	require.NoError(t, err)
+	assert.Nil(t, explanation)
+}
+
+func TestOpenAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    string
+		end      string
+		at       string
+		expected bool
+	}{
+		{name: "Within daytime hours", start: "09:00", end: "17:00", at: "12:00", expected: true},
+		{name: "Closing time is inclusive", start: "09:00", end: "17:00", at: "17:00", expected: true},
+		{name: "Outside daytime hours", start: "09:00", end: "17:00", at: "18:00", expected: false},
+		{name: "Overnight before midnight", start: "22:00", end: "06:00", at: "23:00", expected: true},
+		{name: "Overnight after midnight", start: "22:00", end: "06:00", at: "05:00", expected: true},
+		{name: "Outside overnight hours", start: "22:00", end: "06:00", at: "12:00", expected: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := models.Client{WorkingHours: [2]time.Time{parseTime(tc.start), parseTime(tc.end)}}
+			assert.Equal(t, tc.expected, openAt(c, parseTime(tc.at)))
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"lead_management/pkg/attributes"
+	"lead_management/pkg/models"
+	"lead_management/pkg/rules"
+	"log/slog"
+	"time"
+)
+
+// ImportOptions controls ImportClients.
+type ImportOptions struct {
+	// Upsert updates clients whose ID already exists instead of rejecting them.
+	Upsert bool
+	// DryRun checks the import without writing anything.
+	DryRun bool
+}
+
+// ImportResult reports what ImportClients did, or would have done in a dry run.
+type ImportResult struct {
+	Created int
+	Updated int
+	// Conflicts holds the indexes of clients whose ID already exists when
+	// not upserting. Nothing is written if there are any.
+	Conflicts []int
+	// Rejected holds the clients that name an unknown group or fallback
+	// client, whose attributes or criteria do not match the definitions or
+	// whose rule is invalid. Nothing is written if there are any.
+	Rejected []RejectedClient
+}
+
+// RejectedClient is a client ImportClients could not write. Err is
+// ErrGroupNotFound, ErrFallbackNotFound, an *attributes.Error or a
+// *rules.Error.
+type RejectedClient struct {
+	Index int
+	Err   error
+}
+
+// ImportClients creates, or with Upsert creates or updates, all clients in a
+// single transaction. Nothing is written if any client conflicts or is
+// rejected, any write fails or DryRun is set.
+func (db *DB) ImportClients(ctx context.Context, clients []models.Client, opts ImportOptions) (ImportResult, error) {
+	ctx, done := trace(ctx, "import_clients")
+	defer done()
+
+	var result ImportResult
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return result, err
+	}
+	defer tx.Rollback()
+
+	pub := db.publisher(tx, time.Now().UTC())
+	for i, c := range clients {
+		existing, err := getClientByID(ctx, tx, c.ID)
+		if err != nil {
+			return result, err
+		}
+		switch {
+		case existing == nil:
+			err = insertClient(ctx, tx, pub, c)
+			if err == nil {
+				result.Created++
+			}
+		case opts.Upsert:
+			_, err = updateClient(ctx, tx, pub, c)
+			if err == nil {
+				result.Updated++
+			}
+		default:
+			result.Conflicts = append(result.Conflicts, i)
+		}
+		var attrErr *attributes.Error
+		var ruleErr *rules.Error
+		if errors.Is(err, ErrGroupNotFound) || errors.Is(err, ErrFallbackNotFound) || errors.As(err, &attrErr) || errors.As(err, &ruleErr) {
+			result.Rejected = append(result.Rejected, RejectedClient{Index: i, Err: err})
+		} else if err != nil {
+			return result, err
+		}
+	}
+	if len(result.Conflicts) > 0 || len(result.Rejected) > 0 || opts.DryRun {
+		return result, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to commit transaction", "error", err)
+		return result, err
+	}
+	db.notify(pub)
+
+	slog.Info("clients imported", "created", result.Created, "updated", result.Updated)
+	return result, nil
+}
@@ -0,0 +1,305 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"lead_management/pkg/models"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// leadColumns lists the lead columns in the order scanLead expects them.
+const leadColumns = `id, name, email, phone, status, clientId, assignedAt, attributes, fallbackFrom, fallbackStep, stickyFrom, receivedAt, duplicateOf`
+
+// scanLead scans a row selected with leadColumns.
+func scanLead(row scanner) (models.Lead, error) {
+	var l models.Lead
+	var attrs string
+	if err := row.Scan(&l.ID, &l.Name, &l.Email, &l.Phone, &l.Status, &l.ClientID, &l.AssignedAt, &attrs, &l.FallbackFrom, &l.FallbackStep, &l.StickyFrom, &l.ReceivedAt, &l.DuplicateOf); err != nil {
+		return l, err
+	}
+	l.AssignedAt, l.ReceivedAt = l.AssignedAt.UTC(), l.ReceivedAt.UTC()
+	var err error
+	l.Attributes, err = unmarshalAttributes(attrs)
+	return l, err
+}
+
+// AssignLead stores the lead and assigns it to the most eligible client,
+// incrementing the client's lead count, in one transaction. If no client is
+// eligible the lead is queued until AssignQueuedLeads finds one, and if
+// duplicate detection is enabled a duplicate is stored unassigned or
+// rejected, as described at SetDedup. The returned lead's Status tells
+// which happened. Events and webhook deliveries for the outcome are stored
+// in the same transaction. It returns an *attributes.Error if the lead's
+// attributes do not match their definitions and a *DuplicateError if it is
+// rejected as a duplicate.
+func (db *DB) AssignLead(ctx context.Context, lead models.Lead) (*models.Lead, error) {
+	ctx, done := trace(ctx, "assign_lead")
+	defer done()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := validateAttributes(ctx, tx, models.EntityLead, lead.Attributes); err != nil {
+		return nil, err
+	}
+	attrs, err := marshalAttributes(lead.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	lead.ReceivedAt = now
+	keys := db.dedup.keys(lead)
+	var original string
+	if len(db.dedup.Keys) > 0 {
+		if original, err = findDuplicate(ctx, tx, keys, db.dedup.Keys, db.dedup.CountryCode, now.Add(-db.dedup.Window)); err != nil {
+			return nil, err
+		}
+	}
+	if original != "" && db.dedup.Policy != DedupAttach {
+		slog.Info("duplicate lead rejected", "lead", lead, "original", original)
+		return nil, &DuplicateError{Original: original}
+	}
+
+	pub := db.publisher(tx, now)
+	assigned := false
+	if original == "" {
+		if assigned, err = assignLead(ctx, tx, pub, &lead, now, db.shareWindow, db.sticky()); err != nil {
+			return nil, err
+		}
+	}
+	if !assigned {
+		lead.Status = models.LeadQueued
+		if original != "" {
+			lead.Status, lead.DuplicateOf = models.LeadDuplicate, original
+		}
+		lead.ClientID = ""
+		lead.AssignedAt = time.Time{}
+		lead.FallbackFrom, lead.FallbackStep, lead.StickyFrom = "", 0, ""
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO leads (`+leadColumns+`, emailKey, phoneKey, e164Key, namePostcodeKey)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		lead.ID, lead.Name, lead.Email, lead.Phone, lead.Status, lead.ClientID, lead.AssignedAt, attrs,
+		lead.FallbackFrom, lead.FallbackStep, lead.StickyFrom, lead.ReceivedAt, lead.DuplicateOf,
+		keys.email, keys.phone, keys.e164, keys.namePostcode)
+	if err != nil {
+		slog.Error("failed to insert lead", "id", lead.ID, "error", err)
+		return nil, err
+	}
+	if err := pub.recordLead(ctx, models.OperationInsert, lead); err != nil {
+		return nil, err
+	}
+	if lead.Status == models.LeadQueued {
+		if err := pub.publish(ctx, models.EventLeadQueued, "", lead); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to commit transaction", "error", err)
+		return nil, err
+	}
+	db.notify(pub)
+
+	switch lead.Status {
+	case models.LeadAssigned:
+		slog.Info("lead assigned", "lead", lead)
+	case models.LeadQueued:
+		slog.Info("lead queued", "lead", lead)
+	default:
+		slog.Info("duplicate lead attached", "lead", lead, "original", original)
+	}
+	return &lead, nil
+}
+
+// assignLead picks the most eligible client for lead and takes one unit of
+// its capacity and of its groups' capacity. On success it fills in the
+// lead's assignment, including the fallback chain step or the sticky lead it
+// went through, if any, and publishes the lead.assigned event, plus
+// client.capacity_exhausted when the lead used the client's last unit, and
+// records the changes to the client and its groups. The caller stores the
+// lead. It reports whether a client was found. A positive shareWindow
+// selects the share strategy and sticky configures sticky routing, as in
+// findEligibleClient.
+func assignLead(ctx context.Context, tx *sql.Tx, pub *publisher, lead *models.Lead, now time.Time, shareWindow time.Duration, sticky stickyRouting) (bool, error) {
+	client, r, err := findEligibleClient(ctx, tx, *lead, now, shareWindow, sticky)
+	if err != nil || client == nil {
+		return false, err
+	}
+
+	// Guard against the client filling up between the query and the update.
+	res, err := tx.ExecContext(ctx, `UPDATE clients SET currentLeadCount = currentLeadCount + 1 WHERE id = ? AND currentLeadCount < leadCapacity`, client.ID)
+	if err != nil {
+		slog.Error("failed to increment lead count", "client", client.ID, "error", err)
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		slog.Info("eligible client reached capacity during assignment", "client", client.ID)
+		return false, nil
+	}
+	client.CurrentLeadCount++
+	if err := pub.recordClient(ctx, models.OperationUpdate, *client); err != nil {
+		return false, err
+	}
+	if err := countGroupLead(ctx, tx, pub, client.GroupID); err != nil {
+		return false, err
+	}
+
+	lead.Status = models.LeadAssigned
+	lead.ClientID = client.ID
+	lead.AssignedAt = now
+	lead.FallbackFrom, lead.FallbackStep, lead.StickyFrom = r.fallbackFrom, r.fallbackStep, r.stickyFrom
+	if err := pub.publish(ctx, models.EventLeadAssigned, client.ID, lead); err != nil {
+		return false, err
+	}
+	if client.CurrentLeadCount >= client.LeadCapacity {
+		if err := pub.publish(ctx, models.EventCapacityExhausted, client.ID, client); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// AssignQueuedLeads assigns queued leads, oldest first, until every queued
+// lead has been tried or limit leads have been assigned. Leads no client is
+// eligible for stay queued without holding up those behind them. It returns
+// the number of leads assigned.
+func (db *DB) AssignQueuedLeads(ctx context.Context, limit int) (int, error) {
+	ctx, done := trace(ctx, "assign_queued_leads")
+	defer done()
+
+	assigned := 0
+	var after int64
+	for assigned < limit {
+		next, ok, err := db.assignQueuedLead(ctx, after)
+		if err != nil || next == 0 {
+			return assigned, err
+		}
+		if ok {
+			assigned++
+		}
+		after = next
+	}
+	return assigned, nil
+}
+
+// assignQueuedLead tries to assign the oldest queued lead after the given
+// rowid in its own transaction. It returns the lead's rowid, or 0 if there is
+// none, and whether a client was eligible.
+func (db *DB) assignQueuedLead(ctx context.Context, after int64) (int64, bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	var rowid int64
+	err = tx.QueryRowContext(ctx, `SELECT rowid FROM leads WHERE status = ? AND rowid > ? ORDER BY rowid LIMIT 1`, models.LeadQueued, after).Scan(&rowid)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		slog.Error("failed to query queued leads", "error", err)
+		return 0, false, err
+	}
+	lead, err := scanLead(tx.QueryRowContext(ctx, `SELECT `+leadColumns+` FROM leads WHERE rowid = ?`, rowid))
+	if err != nil {
+		slog.Error("failed to scan queued lead", "error", err)
+		return 0, false, err
+	}
+
+	now := time.Now().UTC()
+	pub := db.publisher(tx, now)
+	ok, err := assignLead(ctx, tx, pub, &lead, now, db.shareWindow, db.sticky())
+	if err != nil || !ok {
+		return rowid, false, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE leads SET status = ?, clientId = ?, assignedAt = ?, fallbackFrom = ?, fallbackStep = ?, stickyFrom = ? WHERE id = ?`,
+		lead.Status, lead.ClientID, lead.AssignedAt, lead.FallbackFrom, lead.FallbackStep, lead.StickyFrom, lead.ID)
+	if err != nil {
+		slog.Error("failed to update queued lead", "id", lead.ID, "error", err)
+		return 0, false, err
+	}
+	if err := pub.recordLead(ctx, models.OperationUpdate, lead); err != nil {
+		return 0, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to commit transaction", "error", err)
+		return 0, false, err
+	}
+	db.notify(pub)
+
+	slog.Info("queued lead assigned", "lead", lead)
+	return rowid, true, nil
+}
+
+// CountQueuedLeads returns the number of leads waiting for an eligible client.
+func (db *DB) CountQueuedLeads(ctx context.Context) (int, error) {
+	ctx, done := trace(ctx, "count_queued_leads")
+	defer done()
+
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM leads WHERE status = ?`, models.LeadQueued).Scan(&n)
+	return n, err
+}
+
+// GetLeadByID retrieves a lead by its ID from the database.
+func (db *DB) GetLeadByID(ctx context.Context, id string) (*models.Lead, error) {
+	ctx, done := trace(ctx, "get_lead_by_id")
+	defer done()
+
+	l, err := scanLead(db.QueryRowContext(ctx, `SELECT `+leadColumns+` FROM leads WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		slog.Error("failed to scan lead row", "error", err)
+		return nil, err
+	}
+	return &l, nil
+}
+
+// LeadFilter selects leads in list queries. Zero fields select all leads.
+type LeadFilter struct {
+	Status   string
+	ClientID string
+	// Attributes selects leads with each of the given attribute values.
+	Attributes map[string]any
+	// Limit caps the number of leads returned; zero means no limit.
+	Limit int
+}
+
+// ListLeads retrieves the leads selected by filter, newest first.
+func (db *DB) ListLeads(ctx context.Context, filter LeadFilter) ([]models.Lead, error) {
+	ctx, done := trace(ctx, "list_leads")
+	defer done()
+
+	conditions := []string{"1 = 1"}
+	var args []any
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.ClientID != "" {
+		conditions = append(conditions, "clientId = ?")
+		args = append(args, filter.ClientID)
+	}
+	attrConditions, attrArgs := attributeConditions(filter.Attributes)
+	conditions = append(conditions, attrConditions...)
+	args = append(args, attrArgs...)
+
+	query := `SELECT ` + leadColumns + ` FROM leads WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY rowid DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+	return queryLeads(ctx, db, query, args...)
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"lead_management/pkg/models"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// CheckPacing validates a client's pacing mode and curve. A curve must have
+// a non-negative weight for each of the 24 hours and be given only in curve
+// mode, with some weight within the client's working hours.
+func CheckPacing(c models.Client) error {
+	switch c.Pacing {
+	case "", models.PacingEven, models.PacingFrontLoaded:
+		if len(c.PacingCurve) > 0 {
+			return errors.New("pacingCurve is only used in curve pacing")
+		}
+		return nil
+	case models.PacingCurve:
+	default:
+		return errors.New("pacing must be even, front_loaded or curve")
+	}
+	if len(c.PacingCurve) != 24 {
+		return errors.New("pacingCurve must have 24 hourly weights")
+	}
+	for _, w := range c.PacingCurve {
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return errors.New("pacingCurve weights must not be negative")
+		}
+	}
+	start, length := workingWindow(c)
+	if curveWeight(c.PacingCurve, start, length) <= 0 {
+		return errors.New("pacingCurve must have weight within working hours")
+	}
+	return nil
+}
+
+// marshalCurve returns the pacingCurve column value.
+func marshalCurve(curve []float64) (string, error) {
+	if len(curve) == 0 {
+		return "[]", nil
+	}
+	raw, err := json.Marshal(curve)
+	return string(raw), err
+}
+
+// unmarshalCurve decodes a pacingCurve column value, leaving no curve nil.
+func unmarshalCurve(data string) ([]float64, error) {
+	var curve []float64
+	if err := json.Unmarshal([]byte(data), &curve); err != nil || len(curve) == 0 {
+		return nil, err
+	}
+	return curve, nil
+}
+
+// Pacing returns c's progress through its current working window at now,
+// or nil if c is not paced.
+func (db *DB) Pacing(ctx context.Context, c models.Client, now time.Time) (*models.Pacing, error) {
+	ctx, done := trace(ctx, "pacing")
+	defer done()
+
+	return pacingAt(ctx, db, c, now)
+}
+
+// pacingAt counts the leads c was assigned in its working window up to now
+// using q, which may be a transaction, and returns its pacing state, or nil
+// if c is not paced.
+func pacingAt(ctx context.Context, q queryer, c models.Client, now time.Time) (*models.Pacing, error) {
+	if c.Pacing == "" {
+		return nil, nil
+	}
+	start := windowStart(c, now)
+	var delivered int
+	err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM leads WHERE clientId = ? AND status = ? AND assignedAt >= ? AND assignedAt < ?`,
+		c.ID, models.LeadAssigned, start.UTC(), now.UTC()).Scan(&delivered)
+	if err != nil {
+		slog.Error("failed to count paced leads", "client", c.ID, "error", err)
+		return nil, err
+	}
+	p := pace(c, delivered, now)
+	return &p, nil
+}
+
+// pace returns c's pacing state at now, given the leads delivered since its
+// working window opened. The budget of the window is the capacity c had
+// left when it opened, and the pace allows the share of the budget given by
+// the mode for the part of the window that has passed. A client that has
+// been delivered more is ahead of its pace.
+func pace(c models.Client, delivered int, now time.Time) models.Pacing {
+	start := windowStart(c, now)
+	_, length := workingWindow(c)
+	p := models.Pacing{
+		Mode:        c.Pacing,
+		WindowStart: start,
+		WindowEnd:   start.Add(time.Duration(length * float64(time.Minute))),
+		Budget:      max(c.LeadCapacity-c.CurrentLeadCount+delivered, 0),
+		Delivered:   delivered,
+	}
+
+	elapsed := min(now.Sub(start).Minutes(), length)
+	fraction := 1.0
+	if length > 0 {
+		x := elapsed / length
+		switch c.Pacing {
+		case models.PacingEven:
+			fraction = x
+		case models.PacingFrontLoaded:
+			// Twice the even rate at the start, slowing to nothing at the end.
+			fraction = 1 - (1-x)*(1-x)
+		case models.PacingCurve:
+			startMinute, _ := workingWindow(c)
+			if total := curveWeight(c.PacingCurve, startMinute, length); total > 0 {
+				fraction = curveWeight(c.PacingCurve, startMinute, elapsed) / total
+			}
+		}
+	}
+	p.Target = float64(p.Budget) * fraction
+	p.Ahead = float64(delivered) > p.Target
+	return p
+}
+
+// workingWindow returns the minute of the day c's working hours start at
+// and their length in minutes, which may span midnight.
+func workingWindow(c models.Client) (start, length float64) {
+	start = float64(c.WorkingHours[0].Hour()*60 + c.WorkingHours[0].Minute())
+	end := float64(c.WorkingHours[1].Hour()*60 + c.WorkingHours[1].Minute())
+	if end < start {
+		end += 24 * 60
+	}
+	return start, end - start
+}
+
+// windowStart returns when the working window that now falls in, or the
+// last one before it, opened. Working hours are in UTC.
+func windowStart(c models.Client, now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	start := time.Date(y, m, d, c.WorkingHours[0].Hour(), c.WorkingHours[0].Minute(), 0, 0, time.UTC)
+	if start.After(now) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start
+}
+
+// curveWeight sums the hourly weights of curve over the given number of
+// minutes from the minute of the day from, wrapping past midnight.
+func curveWeight(curve []float64, from, minutes float64) float64 {
+	total := 0.0
+	for minutes > 0 {
+		hour := int(from/60) % 24
+		step := min(60-math.Mod(from, 60), minutes)
+		total += curve[hour] * step / 60
+		from += step
+		minutes -= step
+	}
+	return total
+}
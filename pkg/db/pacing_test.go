@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPace(t *testing.T) {
+	day := [2]time.Time{parseTime("09:00"), parseTime("17:00")}
+	night := [2]time.Time{parseTime("22:00"), parseTime("06:00")}
+	curve := make([]float64, 24)
+	curve[9], curve[10] = 3, 1 // three quarters of the leads from 09:00 to 10:00
+	at := func(clock string) time.Time {
+		c := parseTime(clock)
+		return time.Date(2024, 3, 1, c.Hour(), c.Minute(), 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name           string
+		client         models.Client
+		delivered      int
+		now            time.Time
+		expectedStart  time.Time
+		expectedBudget int
+		expectedTarget float64
+		expectedAhead  bool
+	}{
+		{
+			name:           "Even, a quarter through the day",
+			client:         models.Client{LeadCapacity: 50, CurrentLeadCount: 10, WorkingHours: day, Pacing: models.PacingEven},
+			delivered:      10,
+			now:            at("11:00"),
+			expectedStart:  at("09:00"),
+			expectedBudget: 50,
+			expectedTarget: 12.5,
+		},
+		{
+			name:           "Even, ahead of pace",
+			client:         models.Client{LeadCapacity: 50, CurrentLeadCount: 13, WorkingHours: day, Pacing: models.PacingEven},
+			delivered:      13,
+			now:            at("11:00"),
+			expectedStart:  at("09:00"),
+			expectedBudget: 50,
+			expectedTarget: 12.5,
+			expectedAhead:  true,
+		},
+		{
+			name:           "Even, first lead of the window",
+			client:         models.Client{LeadCapacity: 50, CurrentLeadCount: 20, WorkingHours: day, Pacing: models.PacingEven},
+			now:            at("09:00"),
+			expectedStart:  at("09:00"),
+			expectedBudget: 30,
+			expectedTarget: 0,
+		},
+		{
+			name:           "Front-loaded, half through the day",
+			client:         models.Client{LeadCapacity: 40, CurrentLeadCount: 30, WorkingHours: day, Pacing: models.PacingFrontLoaded},
+			delivered:      30,
+			now:            at("13:00"),
+			expectedStart:  at("09:00"),
+			expectedBudget: 40,
+			expectedTarget: 30,
+		},
+		{
+			name:           "Curve",
+			client:         models.Client{LeadCapacity: 40, CurrentLeadCount: 31, WorkingHours: day, Pacing: models.PacingCurve, PacingCurve: curve},
+			delivered:      31,
+			now:            at("10:00"),
+			expectedStart:  at("09:00"),
+			expectedBudget: 40,
+			expectedTarget: 30,
+			expectedAhead:  true,
+		},
+		{
+			name:           "Window spanning midnight",
+			client:         models.Client{LeadCapacity: 80, CurrentLeadCount: 1, WorkingHours: night, Pacing: models.PacingEven},
+			delivered:      1,
+			now:            at("02:00"),
+			expectedStart:  at("22:00").AddDate(0, 0, -1),
+			expectedBudget: 80,
+			expectedTarget: 40,
+		},
+		{
+			name:           "Closed after the window",
+			client:         models.Client{LeadCapacity: 50, CurrentLeadCount: 50, WorkingHours: day, Pacing: models.PacingEven},
+			delivered:      50,
+			now:            at("18:00"),
+			expectedStart:  at("09:00"),
+			expectedBudget: 50,
+			expectedTarget: 50,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := pace(tc.client, tc.delivered, tc.now)
+			assert.Equal(t, tc.expectedStart, p.WindowStart)
+			assert.Equal(t, tc.expectedBudget, p.Budget)
+			assert.InDelta(t, tc.expectedTarget, p.Target, 0.001)
+			assert.Equal(t, tc.expectedAhead, p.Ahead)
+		})
+	}
+}
+
+func TestCheckPacing(t *testing.T) {
+	day := [2]time.Time{parseTime("09:00"), parseTime("17:00")}
+	evening := make([]float64, 24)
+	evening[20] = 1
+	morning := make([]float64, 24)
+	morning[9] = 1
+
+	tests := []struct {
+		name        string
+		client      models.Client
+		expectedErr bool
+	}{
+		{name: "Unpaced", client: models.Client{WorkingHours: day}},
+		{name: "Even", client: models.Client{WorkingHours: day, Pacing: models.PacingEven}},
+		{name: "Curve", client: models.Client{WorkingHours: day, Pacing: models.PacingCurve, PacingCurve: morning}},
+		{name: "Unknown mode", client: models.Client{WorkingHours: day, Pacing: "fast"}, expectedErr: true},
+		{name: "Curve without curve mode", client: models.Client{WorkingHours: day, Pacing: models.PacingEven, PacingCurve: morning}, expectedErr: true},
+		{name: "Short curve", client: models.Client{WorkingHours: day, Pacing: models.PacingCurve, PacingCurve: []float64{1, 2}}, expectedErr: true},
+		{name: "Negative weight", client: models.Client{WorkingHours: day, Pacing: models.PacingCurve, PacingCurve: append([]float64{-1}, morning[1:]...)}, expectedErr: true},
+		{name: "No weight in working hours", client: models.Client{WorkingHours: day, Pacing: models.PacingCurve, PacingCurve: evening}, expectedErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckPacing(tc.client)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPacingEligibility(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+
+	// Open the paced client's window a minute ago, so its pace allows only
+	// the first of its 100 leads.
+	now := time.Now().UTC()
+	opened := [2]time.Time{parseTime(now.Add(-time.Minute).Format("15:04")), parseTime(now.Add(-time.Hour).Format("15:04"))}
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "paced", Name: "Paced", Priority: 10, LeadCapacity: 100, WorkingHours: opened, Pacing: models.PacingEven},
+		{ID: "other", Name: "Other", Priority: 1, LeadCapacity: 100, WorkingHours: allDay},
+	})
+
+	for _, expected := range []string{"paced", "other"} {
+		lead, err := database.AssignLead(ctx, models.Lead{ID: "to-" + expected})
+		require.NoError(t, err)
+		assert.Equal(t, expected, lead.ClientID)
+	}
+
+	client, err := database.GetClientByID(ctx, "paced")
+	require.NoError(t, err)
+	p, err := database.Pacing(ctx, *client, time.Now().UTC())
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	assert.Equal(t, 1, p.Delivered)
+	assert.Equal(t, 100, p.Budget)
+	assert.True(t, p.Ahead)
+
+	explanation, err := database.ExplainLead(ctx, "to-other")
+	require.NoError(t, err)
+	assert.Equal(t, "paced", explanation.Candidates[0].Client.ID)
+	assert.Equal(t, []string{models.ReasonAheadOfPace}, explanation.Candidates[0].Reasons)
+	require.NotNil(t, explanation.Candidates[0].Pacing)
+	assert.Nil(t, explanation.Candidates[1].Pacing)
+}
@@ -0,0 +1,297 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// SchemaVersion is the schema version this build expects. It matches the
+// number of the newest migration in db/migrations.
+const SchemaVersion = 17
+
+// schemaStatements create the current schema on an empty database and are
+// no-ops on a database that is already up to date. They must be kept in step
+// with the migrations in db/migrations.
+var schemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS clients (
+        id TEXT PRIMARY KEY,
+        name TEXT NOT NULL,
+        priority INTEGER NOT NULL,
+        leadCapacity INTEGER NOT NULL,
+        currentLeadCount INTEGER NOT NULL,
+        workingHoursStart TEXT NOT NULL,
+        workingHoursEnd TEXT NOT NULL,
+        version INTEGER NOT NULL DEFAULT 1,
+        groupId TEXT NOT NULL DEFAULT '',
+        attributes TEXT NOT NULL DEFAULT '{}',
+        criteria TEXT NOT NULL DEFAULT '[]',
+        rule TEXT NOT NULL DEFAULT '',
+        timezone TEXT NOT NULL DEFAULT '',
+        share REAL NOT NULL DEFAULT 0,
+        pacing TEXT NOT NULL DEFAULT '',
+        pacingCurve TEXT NOT NULL DEFAULT '[]',
+        throughputLimits TEXT NOT NULL DEFAULT '[]',
+        status TEXT NOT NULL DEFAULT 'active',
+        statusReason TEXT NOT NULL DEFAULT '',
+        fallbacks TEXT NOT NULL DEFAULT '[]'
+    );`,
+	`CREATE TABLE IF NOT EXISTS leads (
+        id TEXT PRIMARY KEY,
+        name TEXT NOT NULL,
+        email TEXT NOT NULL,
+        phone TEXT NOT NULL,
+        clientId TEXT NOT NULL REFERENCES clients(id),
+        assignedAt TIMESTAMP NOT NULL,
+        status TEXT NOT NULL DEFAULT 'assigned',
+        attributes TEXT NOT NULL DEFAULT '{}',
+        fallbackFrom TEXT NOT NULL DEFAULT '',
+        fallbackStep INTEGER NOT NULL DEFAULT 0,
+        emailKey TEXT NOT NULL DEFAULT '',
+        phoneKey TEXT NOT NULL DEFAULT '',
+        stickyFrom TEXT NOT NULL DEFAULT '',
+        receivedAt TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00+00:00',
+        e164Key TEXT NOT NULL DEFAULT '',
+        namePostcodeKey TEXT NOT NULL DEFAULT '',
+        duplicateOf TEXT NOT NULL DEFAULT ''
+    );`,
+	`CREATE INDEX IF NOT EXISTS leads_client_assigned ON leads (clientId, assignedAt);`,
+	`CREATE TABLE IF NOT EXISTS webhooks (
+        id TEXT PRIMARY KEY,
+        clientId TEXT NOT NULL REFERENCES clients(id),
+        url TEXT NOT NULL,
+        secret TEXT NOT NULL,
+        eventTypes TEXT NOT NULL,
+        createdAt TIMESTAMP NOT NULL
+    );`,
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id TEXT PRIMARY KEY,
+        webhookId TEXT NOT NULL REFERENCES webhooks(id),
+        eventType TEXT NOT NULL,
+        payload TEXT NOT NULL,
+        status TEXT NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        lastError TEXT NOT NULL DEFAULT '',
+        lastStatusCode INTEGER NOT NULL DEFAULT 0,
+        nextAttemptAt TIMESTAMP NOT NULL,
+        createdAt TIMESTAMP NOT NULL,
+        updatedAt TIMESTAMP NOT NULL
+    );`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (status, nextAttemptAt);`,
+	`CREATE TABLE IF NOT EXISTS events (
+        sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+        id TEXT NOT NULL,
+        type TEXT NOT NULL,
+        clientId TEXT NOT NULL,
+        createdAt TIMESTAMP NOT NULL,
+        data TEXT NOT NULL
+    );`,
+	`CREATE TABLE IF NOT EXISTS changes (
+        sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+        entity TEXT NOT NULL,
+        entityId TEXT NOT NULL,
+        operation TEXT NOT NULL,
+        changedAt TIMESTAMP NOT NULL,
+        data TEXT NOT NULL
+    );`,
+	`CREATE TABLE IF NOT EXISTS client_versions (
+        version INTEGER PRIMARY KEY AUTOINCREMENT,
+        clientId TEXT NOT NULL,
+        operation TEXT NOT NULL,
+        changedAt TIMESTAMP NOT NULL,
+        changedBy TEXT NOT NULL,
+        data TEXT NOT NULL
+    );`,
+	`CREATE INDEX IF NOT EXISTS client_versions_client_changed ON client_versions (clientId, changedAt);`,
+	`CREATE INDEX IF NOT EXISTS changes_entity ON changes (entity, entityId, changedAt);`,
+	`CREATE TABLE IF NOT EXISTS client_groups (
+        id TEXT PRIMARY KEY,
+        name TEXT NOT NULL,
+        parentId TEXT NOT NULL DEFAULT '',
+        priority INTEGER NOT NULL DEFAULT 0,
+        leadCapacity INTEGER NOT NULL DEFAULT 0,
+        currentLeadCount INTEGER NOT NULL DEFAULT 0,
+        fallbacks TEXT NOT NULL DEFAULT '[]'
+    );`,
+	`CREATE INDEX IF NOT EXISTS client_groups_parent ON client_groups (parentId);`,
+	`CREATE TABLE IF NOT EXISTS attribute_definitions (
+        entity TEXT NOT NULL,
+        name TEXT NOT NULL,
+        type TEXT NOT NULL,
+        enumValues TEXT NOT NULL DEFAULT '[]',
+        required BOOLEAN NOT NULL DEFAULT false,
+        PRIMARY KEY (entity, name)
+    );`,
+	`CREATE TABLE IF NOT EXISTS client_status_schedules (
+        id TEXT PRIMARY KEY,
+        clientId TEXT NOT NULL REFERENCES clients(id),
+        status TEXT NOT NULL,
+        reason TEXT NOT NULL DEFAULT '',
+        startsAt TIMESTAMP NOT NULL,
+        endsAt TIMESTAMP,
+        state TEXT NOT NULL DEFAULT 'pending',
+        previousStatus TEXT NOT NULL DEFAULT '',
+        previousReason TEXT NOT NULL DEFAULT '',
+        createdAt TIMESTAMP NOT NULL
+    );`,
+	`CREATE INDEX IF NOT EXISTS client_status_schedules_client ON client_status_schedules (clientId, startsAt);`,
+	`CREATE INDEX IF NOT EXISTS client_status_schedules_due ON client_status_schedules (state, startsAt);`,
+}
+
+// schemaColumns are columns added to existing tables after they were first
+// created. They are added to databases that predate them; the CREATE TABLE
+// statements above already include them.
+var schemaColumns = []struct {
+	table, column, definition string
+}{
+	{"leads", "status", `TEXT NOT NULL DEFAULT 'assigned'`},
+	{"clients", "version", `INTEGER NOT NULL DEFAULT 1`},
+	{"clients", "groupId", `TEXT NOT NULL DEFAULT ''`},
+	{"clients", "attributes", `TEXT NOT NULL DEFAULT '{}'`},
+	{"clients", "criteria", `TEXT NOT NULL DEFAULT '[]'`},
+	{"clients", "rule", `TEXT NOT NULL DEFAULT ''`},
+	{"clients", "timezone", `TEXT NOT NULL DEFAULT ''`},
+	{"clients", "share", `REAL NOT NULL DEFAULT 0`},
+	{"clients", "pacing", `TEXT NOT NULL DEFAULT ''`},
+	{"clients", "pacingCurve", `TEXT NOT NULL DEFAULT '[]'`},
+	{"clients", "throughputLimits", `TEXT NOT NULL DEFAULT '[]'`},
+	{"clients", "status", `TEXT NOT NULL DEFAULT 'active'`},
+	{"clients", "statusReason", `TEXT NOT NULL DEFAULT ''`},
+	{"leads", "attributes", `TEXT NOT NULL DEFAULT '{}'`},
+	{"clients", "fallbacks", `TEXT NOT NULL DEFAULT '[]'`},
+	{"client_groups", "fallbacks", `TEXT NOT NULL DEFAULT '[]'`},
+	{"leads", "fallbackFrom", `TEXT NOT NULL DEFAULT ''`},
+	{"leads", "fallbackStep", `INTEGER NOT NULL DEFAULT 0`},
+	{"leads", "emailKey", `TEXT NOT NULL DEFAULT ''`},
+	{"leads", "phoneKey", `TEXT NOT NULL DEFAULT ''`},
+	{"leads", "stickyFrom", `TEXT NOT NULL DEFAULT ''`},
+	{"leads", "receivedAt", `TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00+00:00'`},
+	{"leads", "e164Key", `TEXT NOT NULL DEFAULT ''`},
+	{"leads", "namePostcodeKey", `TEXT NOT NULL DEFAULT ''`},
+	{"leads", "duplicateOf", `TEXT NOT NULL DEFAULT ''`},
+}
+
+// schemaIndexes are created once schemaColumns exist.
+var schemaIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS leads_status ON leads (status);`,
+	`CREATE INDEX IF NOT EXISTS clients_group ON clients (groupId);`,
+	`CREATE INDEX IF NOT EXISTS leads_email_key ON leads (emailKey, assignedAt);`,
+	`CREATE INDEX IF NOT EXISTS leads_phone_key ON leads (phoneKey, assignedAt);`,
+	`CREATE INDEX IF NOT EXISTS leads_email_received ON leads (emailKey, receivedAt);`,
+	`CREATE INDEX IF NOT EXISTS leads_e164_received ON leads (e164Key, receivedAt);`,
+	`CREATE INDEX IF NOT EXISTS leads_name_postcode_received ON leads (namePostcodeKey, receivedAt);`,
+	`CREATE INDEX IF NOT EXISTS leads_duplicate_of ON leads (duplicateOf);`,
+}
+
+// migrateSchema brings the database up to the current schema.
+func migrateSchema(db *sql.DB) error {
+	for _, stmt := range schemaStatements {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	for _, c := range schemaColumns {
+		if err := ensureColumn(db, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range schemaIndexes {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureColumn adds the column to table unless it already exists.
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	var exists bool
+	err := db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
+// migrate brings the database up to SchemaVersion with migrateSchema and
+// records the version in the schema_migrations table used by golang-migrate,
+// so that a database initialised by InitDB is seen as up to date by the
+// migrate tool and vice versa. The version is marked dirty while the
+// migration runs, so an interrupted migration stays visible. A database at a
+// newer version, migrated by a newer build, is left alone for CheckSchema to
+// report, and a dirty one is not migrated.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version uint64, dirty bool)`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS version_unique ON schema_migrations (version)`); err != nil {
+		return err
+	}
+
+	var version int
+	var dirty bool
+	err := db.QueryRow(`SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = db.Exec(`INSERT INTO schema_migrations (version, dirty) VALUES (?, true)`, SchemaVersion)
+	case err != nil:
+	case dirty:
+		return fmt.Errorf("schema version %d is dirty", version)
+	case version > SchemaVersion:
+		slog.Warn("database schema is newer than this build", "version", version, "expected", SchemaVersion)
+		return nil
+	default:
+		_, err = db.Exec(`UPDATE schema_migrations SET version = ?, dirty = true`, SchemaVersion)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := migrateSchema(db); err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE schema_migrations SET dirty = false`)
+	return err
+}
+
+// Ping verifies that the database is reachable.
+func (db *DB) Ping(ctx context.Context) error {
+	ctx, done := trace(ctx, "ping")
+	defer done()
+
+	return db.PingContext(ctx)
+}
+
+// CheckSchema verifies that the database schema is at the version this build
+// expects, that no migration was left half-applied and that the columns the
+// migrations add exist.
+func (db *DB) CheckSchema(ctx context.Context) error {
+	ctx, done := trace(ctx, "check_schema")
+	defer done()
+
+	var version int
+	var dirty bool
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("schema version %d is dirty", version)
+	}
+	if version != SchemaVersion {
+		return fmt.Errorf("schema version %d, expected %d", version, SchemaVersion)
+	}
+	for _, c := range schemaColumns {
+		var exists bool
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("reading schema: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("schema version %d is missing column %s.%s", version, c.table, c.column)
+		}
+	}
+	return nil
+}
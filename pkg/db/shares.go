@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"lead_management/pkg/models"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// DefaultShareWindow is the window share reports cover unless the share
+// strategy is enabled with another one.
+const DefaultShareWindow = 24 * time.Hour
+
+// SetShareStrategy makes assignment choose, among the eligible clients with
+// a share, the one furthest below its target share of the leads assigned
+// within the last window, instead of the one with the highest priority.
+// Clients without a share are only chosen, by priority, when no client with
+// one is eligible.
+func (db *DB) SetShareStrategy(window time.Duration) {
+	db.shareWindow = window
+}
+
+// ShareWindow returns the window of the share strategy, or
+// DefaultShareWindow if it is not enabled.
+func (db *DB) ShareWindow() time.Duration {
+	if db.shareWindow > 0 {
+		return db.shareWindow
+	}
+	return DefaultShareWindow
+}
+
+// shares holds what the share strategy ranks clients by: the leads assigned
+// to each client within the window and the sum of all clients' shares.
+type shares struct {
+	delivered  map[string]int
+	total      int
+	totalShare float64
+}
+
+// loadShares counts the leads assigned in [since, until) using q, which may
+// be a transaction, and sums the shares of the current clients.
+func loadShares(ctx context.Context, q queryer, since, until time.Time) (*shares, error) {
+	s, err := deliveredBetween(ctx, q, since, until)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.QueryRowContext(ctx, `SELECT COALESCE(SUM(share), 0) FROM clients WHERE share > 0`).Scan(&s.totalShare); err != nil {
+		slog.Error("failed to sum client shares", "error", err)
+		return nil, err
+	}
+	return s, nil
+}
+
+// deliveredBetween counts the leads assigned to each client in [since,
+// until). The caller sets totalShare.
+func deliveredBetween(ctx context.Context, q queryer, since, until time.Time) (*shares, error) {
+	rows, err := q.QueryContext(ctx, `SELECT clientId, COUNT(*) FROM leads WHERE status = ? AND assignedAt >= ? AND assignedAt < ? GROUP BY clientId`,
+		models.LeadAssigned, since.UTC(), until.UTC())
+	if err != nil {
+		slog.Error("failed to count delivered leads", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	s := &shares{delivered: make(map[string]int)}
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			slog.Error("failed to scan delivered leads", "error", err)
+			return nil, err
+		}
+		s.delivered[id] = n
+		s.total += n
+	}
+	return s, rows.Err()
+}
+
+// target returns c's target share as a percentage.
+func (s *shares) target(c models.Client) float64 {
+	if c.Share <= 0 || s.totalShare <= 0 {
+		return 0
+	}
+	return 100 * c.Share / s.totalShare
+}
+
+// actual returns the percentage of the window's leads assigned to c.
+func (s *shares) actual(c models.Client) float64 {
+	if s.total == 0 {
+		return 0
+	}
+	return 100 * float64(s.delivered[c.ID]) / float64(s.total)
+}
+
+// deficit returns how many percentage points c is below its target share.
+func (s *shares) deficit(c models.Client) float64 {
+	return s.target(c) - s.actual(c)
+}
+
+// before reports whether the share strategy prefers a over b: clients with
+// a share come first, the one furthest below its target first, then the one
+// with the larger share.
+func (s *shares) before(a, b models.Client) bool {
+	if (a.Share > 0) != (b.Share > 0) {
+		return a.Share > 0
+	}
+	if x, y := s.deficit(a), s.deficit(b); x != y {
+		return x > y
+	}
+	return a.Share > b.Share
+}
+
+// ShareReport compares every client's target share with its share of the
+// leads assigned in the window ending now. Clients without a share appear
+// only if they were assigned leads in the window. They are listed furthest
+// below target first.
+func (db *DB) ShareReport(ctx context.Context, window time.Duration) (*models.ShareReport, error) {
+	ctx, done := trace(ctx, "share_report")
+	defer done()
+
+	until := time.Now().UTC()
+	since := until.Add(-window)
+	s, err := deliveredBetween(ctx, db, since, until)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := db.listClients(ctx, ClientFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clients {
+		if c.Share > 0 {
+			s.totalShare += c.Share
+		}
+	}
+
+	report := &models.ShareReport{Since: since, Until: until, Total: s.total, Clients: []models.ClientShare{}}
+	for _, c := range clients {
+		if c.Share <= 0 && s.delivered[c.ID] == 0 {
+			continue
+		}
+		report.Clients = append(report.Clients, models.ClientShare{
+			ClientID:    c.ID,
+			Name:        c.Name,
+			Share:       c.Share,
+			TargetShare: s.target(c),
+			ActualShare: s.actual(c),
+			Delivered:   s.delivered[c.ID],
+			Deficit:     s.deficit(c),
+		})
+	}
+	sort.SliceStable(report.Clients, func(i, j int) bool {
+		a, b := report.Clients[i], report.Clients[j]
+		if a.Deficit != b.Deficit {
+			return a.Deficit > b.Deficit
+		}
+		return a.ClientID < b.ClientID
+	})
+	return report, nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareStrategy(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	database.SetShareStrategy(time.Hour)
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "a", Name: "A", Priority: 1, LeadCapacity: 100, WorkingHours: allDay, Share: 30},
+		{ID: "b", Name: "B", Priority: 1, LeadCapacity: 100, WorkingHours: allDay, Share: 50},
+		{ID: "c", Name: "C", Priority: 1, LeadCapacity: 100, WorkingHours: allDay, Share: 20},
+		{ID: "fallback", Name: "Fallback", Priority: 10, LeadCapacity: 100, WorkingHours: allDay},
+	})
+
+	delivered := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		lead, err := database.AssignLead(ctx, models.Lead{ID: fmt.Sprintf("l%d", i)})
+		require.NoError(t, err)
+		delivered[lead.ClientID]++
+	}
+	assert.Equal(t, map[string]int{"a": 3, "b": 5, "c": 2}, delivered)
+
+	report, err := database.ShareReport(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 10, report.Total)
+	require.Len(t, report.Clients, 3)
+	byID := make(map[string]models.ClientShare)
+	for _, s := range report.Clients {
+		byID[s.ClientID] = s
+	}
+	assert.InDelta(t, 30, byID["a"].TargetShare, 0.001)
+	assert.InDelta(t, 30, byID["a"].ActualShare, 0.001)
+	assert.InDelta(t, 50, byID["b"].ActualShare, 0.001)
+	assert.Equal(t, 2, byID["c"].Delivered)
+
+	explanation, err := database.ExplainLead(ctx, "l9")
+	require.NoError(t, err)
+	assert.Equal(t, &models.Route{Via: models.RouteShare}, explanation.Route)
+	require.NotNil(t, explanation.Candidates[0].ShareDeficit)
+	assert.Equal(t, explanation.ClientID, explanation.Candidates[0].Client.ID)
+	assert.Nil(t, explanation.Candidates[3].ShareDeficit)
+
+	// Clients without a share take leads only when no client with one is
+	// eligible.
+	_, err = database.ExecContext(ctx, `UPDATE clients SET workingHoursStart = '00:00', workingHoursEnd = '00:01' WHERE share > 0`)
+	require.NoError(t, err)
+	client, err := database.GetEligibleClient(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, client)
+	assert.Equal(t, "fallback", client.ID)
+}
+
+func TestShareReportWindow(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "a", Name: "A", Priority: 2, LeadCapacity: 100, WorkingHours: allDay, Share: 25},
+		{ID: "b", Name: "B", Priority: 1, LeadCapacity: 100, WorkingHours: allDay, Share: 75},
+		{ID: "c", Name: "C", Priority: 0, LeadCapacity: 100, WorkingHours: allDay},
+	})
+
+	// Without the share strategy leads go by priority.
+	for _, id := range []string{"l1", "l2"} {
+		lead, err := database.AssignLead(ctx, models.Lead{ID: id})
+		require.NoError(t, err)
+		assert.Equal(t, "a", lead.ClientID)
+	}
+	_, err := database.ExecContext(ctx, `UPDATE leads SET assignedAt = ? WHERE id = 'l1'`, time.Now().UTC().Add(-2*time.Hour))
+	require.NoError(t, err)
+
+	report, err := database.ShareReport(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Total)
+	require.Len(t, report.Clients, 2)
+	assert.Equal(t, "b", report.Clients[0].ClientID)
+	assert.InDelta(t, 75, report.Clients[0].Deficit, 0.001)
+	assert.Equal(t, "a", report.Clients[1].ClientID)
+	assert.InDelta(t, -75, report.Clients[1].Deficit, 0.001)
+
+	report, err = database.ShareReport(ctx, 3*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, 2, report.Clients[1].Delivered)
+}
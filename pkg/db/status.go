@@ -0,0 +1,252 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"lead_management/pkg/models"
+	"log/slog"
+	"time"
+)
+
+// ErrClientNotFound is returned when a status change is scheduled for a
+// client that does not exist.
+var ErrClientNotFound = errors.New("client not found")
+
+// SetClientStatus sets a client's status and its reason, leaving its other
+// fields unchanged, and returns the updated client, or nil if it does not
+// exist. If version is not zero the status only changes at that version of
+// the client, and ErrVersionMismatch is returned if it has changed since.
+func (db *DB) SetClientStatus(ctx context.Context, id, status, reason string, version int) (*models.Client, error) {
+	ctx, done := trace(ctx, "set_client_status")
+	defer done()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	pub := db.publisher(tx, time.Now().UTC())
+	c, err := setClientStatus(ctx, tx, pub, id, status, reason, version)
+	if err != nil || c == nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to commit transaction", "error", err)
+		return nil, err
+	}
+	db.notify(pub)
+
+	slog.Info("client status changed", "client", c.ID, "status", status, "reason", reason)
+	return c, nil
+}
+
+// setClientStatus sets a client's status, under the same version condition
+// as SetClientStatus, and records the change in pub's transaction. It
+// returns the updated client, or nil if it does not exist.
+func setClientStatus(ctx context.Context, q queryer, pub *publisher, id, status, reason string, version int) (*models.Client, error) {
+	query := `UPDATE clients SET status = ?, statusReason = ?, version = version + 1 WHERE id = ?`
+	args := []any{status, reason, id}
+	if version != 0 {
+		query += ` AND version = ?`
+		args = append(args, version)
+	}
+	c, err := scanClient(q.QueryRowContext(ctx, query+` RETURNING `+clientColumns, args...))
+	if err == sql.ErrNoRows {
+		return nil, versionConflict(ctx, q, id)
+	}
+	if err != nil {
+		slog.Error("failed to set client status", "id", id, "error", err)
+		return nil, err
+	}
+	if err := pub.recordClient(ctx, models.OperationUpdate, c); err != nil {
+		return nil, err
+	}
+	return &c, pub.publish(ctx, models.EventClientUpdated, c.ID, c)
+}
+
+// statusScheduleColumns lists the schedule columns in the order
+// scanStatusSchedule expects them.
+const statusScheduleColumns = `id, clientId, status, reason, startsAt, endsAt, state, previousStatus, previousReason, createdAt`
+
+// scanStatusSchedule scans a row selected with statusScheduleColumns.
+func scanStatusSchedule(row scanner) (models.StatusSchedule, error) {
+	var s models.StatusSchedule
+	var endsAt sql.NullTime
+	err := row.Scan(&s.ID, &s.ClientID, &s.Status, &s.Reason, &s.StartsAt, &endsAt, &s.State, &s.PreviousStatus, &s.PreviousReason, &s.CreatedAt)
+	s.StartsAt = s.StartsAt.UTC()
+	s.CreatedAt = s.CreatedAt.UTC()
+	if endsAt.Valid {
+		end := endsAt.Time.UTC()
+		s.EndsAt = &end
+	}
+	return s, err
+}
+
+// ScheduleStatus stores a pending status change. It returns
+// ErrClientNotFound if the client does not exist.
+func (db *DB) ScheduleStatus(ctx context.Context, s models.StatusSchedule) error {
+	ctx, done := trace(ctx, "schedule_status")
+	defer done()
+
+	var endsAt any
+	if s.EndsAt != nil {
+		endsAt = s.EndsAt.UTC()
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO client_status_schedules (`+statusScheduleColumns+`)
+        SELECT ?, id, ?, ?, ?, ?, ?, '', '', ? FROM clients WHERE id = ?`,
+		s.ID, s.Status, s.Reason, s.StartsAt.UTC(), endsAt, models.SchedulePending, s.CreatedAt.UTC(), s.ClientID)
+	if err != nil {
+		slog.Error("failed to schedule client status", "client", s.ClientID, "error", err)
+		return err
+	}
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM client_status_schedules WHERE id = ?`, s.ID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrClientNotFound
+	}
+	slog.Info("client status scheduled", "client", s.ClientID, "status", s.Status, "startsAt", s.StartsAt)
+	return nil
+}
+
+// GetStatusSchedules returns the scheduled status changes of a client, by
+// start time.
+func (db *DB) GetStatusSchedules(ctx context.Context, clientID string) ([]models.StatusSchedule, error) {
+	ctx, done := trace(ctx, "get_status_schedules")
+	defer done()
+
+	return queryStatusSchedules(ctx, db, `clientId = ? ORDER BY startsAt, createdAt`, clientID)
+}
+
+// GetStatusSchedule returns a scheduled status change of a client, or nil if
+// it does not exist.
+func (db *DB) GetStatusSchedule(ctx context.Context, clientID, id string) (*models.StatusSchedule, error) {
+	ctx, done := trace(ctx, "get_status_schedule")
+	defer done()
+
+	schedules, err := queryStatusSchedules(ctx, db, `id = ? AND clientId = ?`, id, clientID)
+	if err != nil || len(schedules) == 0 {
+		return nil, err
+	}
+	return &schedules[0], nil
+}
+
+// queryStatusSchedules selects the schedules matching the condition, which
+// may end with an ORDER BY clause.
+func queryStatusSchedules(ctx context.Context, q queryer, condition string, args ...any) ([]models.StatusSchedule, error) {
+	rows, err := q.QueryContext(ctx, `SELECT `+statusScheduleColumns+` FROM client_status_schedules WHERE `+condition, args...)
+	if err != nil {
+		slog.Error("failed to query status schedules", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []models.StatusSchedule
+	for rows.Next() {
+		s, err := scanStatusSchedule(rows)
+		if err != nil {
+			slog.Error("failed to scan status schedule", "error", err)
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// DeleteStatusSchedule cancels a scheduled status change of a client and
+// reports whether it existed. A change already applied is kept, but the
+// previous status is no longer restored.
+func (db *DB) DeleteStatusSchedule(ctx context.Context, clientID, id string) (bool, error) {
+	ctx, done := trace(ctx, "delete_status_schedule")
+	defer done()
+
+	res, err := db.ExecContext(ctx, `DELETE FROM client_status_schedules WHERE id = ? AND clientId = ?`, id, clientID)
+	if err != nil {
+		slog.Error("failed to delete status schedule", "id", id, "error", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ApplyStatusSchedules applies the status changes due at now, in one
+// transaction: pending changes whose start has passed, and then the
+// restoration of the previous status for started changes whose end has
+// passed. A previous status is only restored if the client still has the
+// scheduled one. It returns the number of client status changes made.
+func (db *DB) ApplyStatusSchedules(ctx context.Context, now time.Time) (int, error) {
+	ctx, done := trace(ctx, "apply_status_schedules")
+	defer done()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now = now.UTC()
+	pub := db.publisher(tx, now)
+	changed := 0
+
+	starting, err := queryStatusSchedules(ctx, tx, `state = ? AND startsAt <= ? ORDER BY startsAt, createdAt`, models.SchedulePending, now)
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range starting {
+		c, err := getClientByID(ctx, tx, s.ClientID)
+		if err != nil {
+			return 0, err
+		}
+		state := models.ScheduleStarted
+		if s.EndsAt == nil {
+			state = models.ScheduleDone
+		}
+		if c != nil {
+			if _, err := setClientStatus(ctx, tx, pub, c.ID, s.Status, s.Reason, 0); err != nil {
+				return 0, err
+			}
+			changed++
+			s.PreviousStatus, s.PreviousReason = c.Status, c.StatusReason
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE client_status_schedules SET state = ?, previousStatus = ?, previousReason = ? WHERE id = ?`,
+			state, s.PreviousStatus, s.PreviousReason, s.ID)
+		if err != nil {
+			slog.Error("failed to update status schedule", "id", s.ID, "error", err)
+			return 0, err
+		}
+	}
+
+	ending, err := queryStatusSchedules(ctx, tx, `state = ? AND endsAt <= ? ORDER BY endsAt, createdAt`, models.ScheduleStarted, now)
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range ending {
+		c, err := getClientByID(ctx, tx, s.ClientID)
+		if err != nil {
+			return 0, err
+		}
+		if c != nil && c.Status == s.Status && c.StatusReason == s.Reason {
+			if _, err := setClientStatus(ctx, tx, pub, c.ID, s.PreviousStatus, s.PreviousReason, 0); err != nil {
+				return 0, err
+			}
+			changed++
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE client_status_schedules SET state = ? WHERE id = ?`, models.ScheduleDone, s.ID); err != nil {
+			slog.Error("failed to update status schedule", "id", s.ID, "error", err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to commit transaction", "error", err)
+		return 0, err
+	}
+	db.notify(pub)
+	return changed, nil
+}
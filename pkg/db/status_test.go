@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientStatusEligibility(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "first", Name: "First", Priority: 10, LeadCapacity: 100, WorkingHours: allDay},
+		{ID: "second", Name: "Second", Priority: 1, LeadCapacity: 100, WorkingHours: allDay},
+	})
+
+	c, err := database.SetClientStatus(ctx, "first", models.ClientPaused, "vacation", 0)
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.Equal(t, models.ClientPaused, c.Status)
+	assert.Equal(t, "vacation", c.StatusReason)
+	assert.Equal(t, 2, c.Version)
+
+	lead, err := database.AssignLead(ctx, models.Lead{ID: "l1"})
+	require.NoError(t, err)
+	assert.Equal(t, "second", lead.ClientID)
+
+	explanation, err := database.ExplainLead(ctx, "l1")
+	require.NoError(t, err)
+	for _, candidate := range explanation.Candidates {
+		if candidate.Client.ID == "first" {
+			assert.Equal(t, []string{models.ReasonPaused}, candidate.Reasons)
+		}
+	}
+
+	availability, err := database.Availability(ctx, time.Now().UTC())
+	require.NoError(t, err)
+	for _, a := range availability {
+		if a.ClientID == "first" {
+			assert.Equal(t, 0, a.Available)
+			assert.Equal(t, models.LimitStatus, a.LimitedBy)
+		}
+	}
+
+	// Updating the client without a status keeps it paused.
+	c.Status, c.StatusReason, c.Version = "", "", 0
+	c, err = database.UpdateClient(ctx, *c)
+	require.NoError(t, err)
+	assert.Equal(t, models.ClientPaused, c.Status)
+	assert.Equal(t, "vacation", c.StatusReason)
+
+	// Status changes at a version the client no longer has are refused.
+	_, err = database.SetClientStatus(ctx, "first", models.ClientActive, "", c.Version-1)
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	c, err = database.SetClientStatus(ctx, "first", models.ClientActive, "", c.Version)
+	require.NoError(t, err)
+	assert.Equal(t, models.ClientActive, c.Status)
+
+	c, err = database.SetClientStatus(ctx, "missing", models.ClientPaused, "", 0)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+	c, err = database.SetClientStatus(ctx, "missing", models.ClientPaused, "", 1)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+}
+
+func TestApplyStatusSchedules(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "c1", Name: "Client", Priority: 1, LeadCapacity: 100, WorkingHours: allDay},
+		{ID: "c2", Name: "Other", Priority: 1, LeadCapacity: 100, WorkingHours: allDay},
+	})
+
+	friday := time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)
+	monday := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	first := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, database.ScheduleStatus(ctx, models.StatusSchedule{
+		ID: "weekend", ClientID: "c1", Status: models.ClientPaused, Reason: "weekend", StartsAt: friday, EndsAt: &monday, CreatedAt: friday,
+	}))
+	require.NoError(t, database.ScheduleStatus(ctx, models.StatusSchedule{
+		ID: "suspend", ClientID: "c2", Status: models.ClientSuspended, Reason: "unpaid", StartsAt: friday, CreatedAt: friday,
+	}))
+	require.NoError(t, database.ScheduleStatus(ctx, models.StatusSchedule{
+		ID: "activate", ClientID: "c2", Status: models.ClientActive, StartsAt: first, CreatedAt: friday,
+	}))
+	assert.ErrorIs(t, database.ScheduleStatus(ctx, models.StatusSchedule{
+		ID: "missing", ClientID: "missing", Status: models.ClientPaused, StartsAt: friday, CreatedAt: friday,
+	}), ErrClientNotFound)
+
+	status := func(id string) (string, string) {
+		c, err := database.GetClientByID(ctx, id)
+		require.NoError(t, err)
+		return c.Status, c.StatusReason
+	}
+
+	n, err := database.ApplyStatusSchedules(ctx, friday.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = database.ApplyStatusSchedules(ctx, friday)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	s, reason := status("c1")
+	assert.Equal(t, models.ClientPaused, s)
+	assert.Equal(t, "weekend", reason)
+	s, _ = status("c2")
+	assert.Equal(t, models.ClientSuspended, s)
+
+	// Applying again changes nothing.
+	n, err = database.ApplyStatusSchedules(ctx, friday.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = database.ApplyStatusSchedules(ctx, monday)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	s, reason = status("c1")
+	assert.Equal(t, models.ClientActive, s)
+	assert.Empty(t, reason)
+
+	n, err = database.ApplyStatusSchedules(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	s, _ = status("c2")
+	assert.Equal(t, models.ClientActive, s)
+
+	schedules, err := database.GetStatusSchedules(ctx, "c1")
+	require.NoError(t, err)
+	require.Len(t, schedules, 1)
+	assert.Equal(t, models.ScheduleDone, schedules[0].State)
+	assert.Equal(t, models.ClientActive, schedules[0].PreviousStatus)
+	assert.Equal(t, monday, *schedules[0].EndsAt)
+}
+
+func TestStatusScheduleNotRestoredAfterChange(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "c1", Name: "Client", Priority: 1, LeadCapacity: 100, WorkingHours: allDay},
+	})
+
+	start := time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	require.NoError(t, database.ScheduleStatus(ctx, models.StatusSchedule{
+		ID: "s1", ClientID: "c1", Status: models.ClientPaused, StartsAt: start, EndsAt: &end, CreatedAt: start,
+	}))
+	_, err := database.ApplyStatusSchedules(ctx, start)
+	require.NoError(t, err)
+
+	// Suspending the client while it is paused is not undone at the end.
+	_, err = database.SetClientStatus(ctx, "c1", models.ClientSuspended, "fraud", 0)
+	require.NoError(t, err)
+	n, err := database.ApplyStatusSchedules(ctx, end)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	c, err := database.GetClientByID(ctx, "c1")
+	require.NoError(t, err)
+	assert.Equal(t, models.ClientSuspended, c.Status)
+
+	found, err := database.DeleteStatusSchedule(ctx, "c1", "s1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = database.DeleteStatusSchedule(ctx, "c1", "s1")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
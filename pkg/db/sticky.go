@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"lead_management/pkg/identity"
+	"lead_management/pkg/models"
+	"log/slog"
+	"time"
+)
+
+// SetStickyWindow makes assignment send a lead to the client of the latest
+// lead from the same person, matched on normalized email or phone, assigned
+// within the last window, as long as that client is still eligible. Zero
+// disables sticky routing. Phone numbers are matched in E.164 form when the
+// dedup options set a country code.
+func (db *DB) SetStickyWindow(window time.Duration) {
+	db.stickyWindow = window
+}
+
+// stickyRouting configures sticky routing for findEligibleClient.
+type stickyRouting struct {
+	// window enables sticky routing when positive.
+	window time.Duration
+	// countryCode, if set, makes phone numbers match in E.164 form, so that
+	// national and international forms of a number match.
+	countryCode string
+}
+
+// sticky returns the sticky routing configuration.
+func (db *DB) sticky() stickyRouting {
+	return stickyRouting{window: db.stickyWindow, countryCode: db.dedup.CountryCode}
+}
+
+// stickyOwner returns the ID of the latest lead assigned since since whose
+// email or phone key matches lead's, other than lead itself, and its client.
+// Phones are compared by their E.164 keys if countryCode is set and by their
+// phone keys otherwise. It returns empty IDs if there is none.
+func stickyOwner(ctx context.Context, q queryer, lead models.Lead, countryCode string, since time.Time) (leadID, clientID string, err error) {
+	phoneColumn, phoneKey := "phoneKey", identity.Phone(lead.Phone)
+	if countryCode != "" {
+		phoneColumn, phoneKey = "e164Key", identity.E164(lead.Phone, countryCode)
+	}
+	emailKey := identity.Email(lead.Email)
+	if emailKey == "" && phoneKey == "" {
+		return "", "", nil
+	}
+	err = q.QueryRowContext(ctx, `SELECT id, clientId FROM leads
+		WHERE status = ? AND id != ? AND assignedAt >= ?
+		AND ((emailKey != '' AND emailKey = ?) OR (`+phoneColumn+` != '' AND `+phoneColumn+` = ?))
+		ORDER BY assignedAt DESC, rowid DESC LIMIT 1`,
+		models.LeadAssigned, lead.ID, since, emailKey, phoneKey).Scan(&leadID, &clientID)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	if err != nil {
+		slog.Error("failed to query sticky owner", "lead", lead.ID, "error", err)
+	}
+	return leadID, clientID, err
+}
+
+// backfillLeadIdentities fills in the keys of leads stored before they were
+// recorded, as opts computes them. Keys already stored are kept.
+func backfillLeadIdentities(ctx context.Context, db *DB, opts DedupOptions) error {
+	// National numbers have no E.164 key without a country code, and leads
+	// without a postcode no name and postcode key, so they are not selected
+	// again on every start.
+	leads, err := queryLeads(ctx, db, `SELECT `+leadColumns+` FROM leads
+		WHERE (email != '' AND emailKey = '') OR (phone != '' AND phoneKey = '')
+		OR (phone != '' AND e164Key = '' AND (? != '' OR ltrim(phone) LIKE '+%' OR ltrim(phone) LIKE '00%'))
+		OR (? != '' AND name != '' AND namePostcodeKey = '' AND json_type(attributes, '$.' || ?) IS NOT NULL)`,
+		opts.CountryCode, opts.PostcodeAttribute, opts.PostcodeAttribute)
+	if err != nil || len(leads) == 0 {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var backfilled int64
+	for _, lead := range leads {
+		k := opts.keys(lead)
+		res, err := tx.ExecContext(ctx, `UPDATE leads SET emailKey = IIF(emailKey = '', ?1, emailKey),
+			phoneKey = IIF(phoneKey = '', ?2, phoneKey), e164Key = IIF(e164Key = '', ?3, e164Key),
+			namePostcodeKey = IIF(namePostcodeKey = '', ?4, namePostcodeKey)
+			WHERE id = ?5 AND ((emailKey = '' AND ?1 != '') OR (phoneKey = '' AND ?2 != '')
+			OR (e164Key = '' AND ?3 != '') OR (namePostcodeKey = '' AND ?4 != ''))`,
+			k.email, k.phone, k.e164, k.namePostcode, lead.ID)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		backfilled += n
+	}
+	if backfilled > 0 {
+		slog.Info("lead identities backfilled", "leads", backfilled)
+	}
+	return tx.Commit()
+}
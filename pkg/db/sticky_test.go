@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"lead_management/pkg/identity"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStickyRouting(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "top", Name: "Top", Priority: 10, LeadCapacity: 100, WorkingHours: allDay},
+		{ID: "owner", Name: "Owner", Priority: 1, LeadCapacity: 100, WorkingHours: allDay},
+	})
+	database.SetStickyWindow(time.Hour)
+
+	// The first lead only goes to owner because top is paused.
+	_, err := database.SetClientStatus(ctx, "top", models.ClientPaused, "", 0)
+	require.NoError(t, err)
+	lead, err := database.AssignLead(ctx, models.Lead{ID: "l1", Email: "jane@example.com", Phone: "+1 555 123 4567"})
+	require.NoError(t, err)
+	require.Equal(t, "owner", lead.ClientID)
+	_, err = database.SetClientStatus(ctx, "top", models.ClientActive, "", 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		lead       models.Lead
+		wantClient string
+		wantSticky string
+	}{
+		{"Same email", models.Lead{ID: "l2", Email: " Jane@Example.com"}, "owner", "l1"},
+		{"Same phone", models.Lead{ID: "l3", Phone: "001 (555) 123-4567"}, "owner", "l1"},
+		{"Other person", models.Lead{ID: "l4", Email: "john@example.com", Phone: "5559876543"}, "top", ""},
+		{"No contact details", models.Lead{ID: "l5"}, "top", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lead, err := database.AssignLead(ctx, tc.lead)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantClient, lead.ClientID)
+			assert.Equal(t, tc.wantSticky, lead.StickyFrom)
+
+			stored, err := database.GetLeadByID(ctx, tc.lead.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantSticky, stored.StickyFrom)
+		})
+	}
+
+	explanation, err := database.ExplainLead(ctx, "l2")
+	require.NoError(t, err)
+	assert.Equal(t, &models.Route{Via: models.RouteSticky, StickyFrom: "l1"}, explanation.Route)
+
+	// An owner that is no longer eligible falls back to normal routing.
+	_, err = database.SetClientStatus(ctx, "owner", models.ClientPaused, "", 0)
+	require.NoError(t, err)
+	lead, err = database.AssignLead(ctx, models.Lead{ID: "l6", Email: "jane@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "top", lead.ClientID)
+	assert.Empty(t, lead.StickyFrom)
+	_, err = database.SetClientStatus(ctx, "owner", models.ClientActive, "", 0)
+	require.NoError(t, err)
+
+	// The latest lead from the person decides, which is now l6 with top.
+	lead, err = database.AssignLead(ctx, models.Lead{ID: "l7", Email: "jane@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "top", lead.ClientID)
+	assert.Equal(t, "l6", lead.StickyFrom)
+
+	// Leads assigned before the window are not matched.
+	database.SetStickyWindow(time.Nanosecond)
+	_, err = database.SetClientStatus(ctx, "top", models.ClientPaused, "", 0)
+	require.NoError(t, err)
+	lead, err = database.AssignLead(ctx, models.Lead{ID: "l8", Email: "jane@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "owner", lead.ClientID)
+	assert.Empty(t, lead.StickyFrom)
+}
+
+func TestStickyRoutingPhoneForms(t *testing.T) {
+	tests := []struct {
+		name        string
+		countryCode string
+		first       string
+		second      string
+		wantSticky  bool
+	}{
+		{"International then national", "44", "+44 20 7946 0958", "020 7946 0958", true},
+		{"National then international", "44", "020 7946 0958", "0044 20 7946 0958", true},
+		{"Other country", "1", "+44 20 7946 0958", "020 7946 0958", false},
+		{"Without country code", "", "+44 20 7946 0958", "020 7946 0958", false},
+		{"Same form without country code", "", "020 7946 0958", "020-7946-0958", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := InitDB(":memory:")
+			defer database.Close()
+			ctx := context.Background()
+			allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+			setupEligibleClientsDatabase(database, []models.Client{
+				{ID: "top", Name: "Top", Priority: 10, LeadCapacity: 100, WorkingHours: allDay},
+				{ID: "owner", Name: "Owner", Priority: 1, LeadCapacity: 100, WorkingHours: allDay},
+			})
+			database.SetStickyWindow(time.Hour)
+			require.NoError(t, database.SetDedup(ctx, DedupOptions{CountryCode: tc.countryCode}))
+
+			_, err := database.SetClientStatus(ctx, "top", models.ClientPaused, "", 0)
+			require.NoError(t, err)
+			_, err = database.AssignLead(ctx, models.Lead{ID: "l1", Phone: tc.first})
+			require.NoError(t, err)
+			_, err = database.SetClientStatus(ctx, "top", models.ClientActive, "", 0)
+			require.NoError(t, err)
+
+			lead, err := database.AssignLead(ctx, models.Lead{ID: "l2", Phone: tc.second})
+			require.NoError(t, err)
+			if tc.wantSticky {
+				assert.Equal(t, "owner", lead.ClientID)
+				assert.Equal(t, "l1", lead.StickyFrom)
+			} else {
+				assert.Equal(t, "top", lead.ClientID)
+				assert.Empty(t, lead.StickyFrom)
+			}
+		})
+	}
+}
+
+func TestBackfillLeadIdentities(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "a", Name: "A", Priority: 1, LeadCapacity: 100, WorkingHours: allDay},
+	})
+	err := database.DefineAttribute(ctx, models.AttributeDefinition{Entity: models.EntityLead, Name: "postcode", Type: models.AttributeString})
+	require.NoError(t, err)
+	_, err = database.AssignLead(ctx, models.Lead{ID: "l1", Name: "Jane Doe", Email: "Jane@Example.com", Phone: "020 7946 0958",
+		Attributes: map[string]any{"postcode": "SW1A 1AA"}})
+	require.NoError(t, err)
+	// Simulate a lead stored before its keys were recorded.
+	_, err = database.ExecContext(ctx, `UPDATE leads SET emailKey = '', phoneKey = '', e164Key = '', namePostcodeKey = ''`)
+	require.NoError(t, err)
+
+	require.NoError(t, backfillLeadIdentities(ctx, database, DedupOptions{}))
+	var emailKey, phoneKey, e164Key, namePostcodeKey string
+	keys := func() {
+		require.NoError(t, database.QueryRowContext(ctx, `SELECT emailKey, phoneKey, e164Key, namePostcodeKey FROM leads WHERE id = 'l1'`).
+			Scan(&emailKey, &phoneKey, &e164Key, &namePostcodeKey))
+	}
+	keys()
+	assert.Equal(t, "jane@example.com", emailKey)
+	assert.Equal(t, "02079460958", phoneKey)
+	assert.Empty(t, e164Key, "a national number has no E.164 form without a country code")
+	assert.Empty(t, namePostcodeKey, "no postcode attribute is configured")
+
+	// Configuring duplicate detection fills in the remaining keys, so the
+	// lead is matched as an original.
+	opts := DedupOptions{Keys: []string{DedupPhone, DedupNamePostcode}, Window: time.Hour, Policy: DedupAttach,
+		CountryCode: "44", PostcodeAttribute: "postcode"}
+	require.NoError(t, database.SetDedup(ctx, opts))
+	keys()
+	assert.Equal(t, "+442079460958", e164Key)
+	assert.Equal(t, identity.NamePostcode("Jane Doe", "SW1A 1AA"), namePostcodeKey)
+
+	for _, lead := range []models.Lead{
+		{ID: "phone", Phone: "+44 20 7946 0958"},
+		{ID: "postcode", Name: "jane doe", Attributes: map[string]any{"postcode": "sw1a1aa"}},
+	} {
+		duplicate, err := database.AssignLead(ctx, lead)
+		require.NoError(t, err)
+		assert.Equal(t, "l1", duplicate.DuplicateOf, lead.ID)
+	}
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"lead_management/pkg/models"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// CheckThroughput validates a client's throughput limits.
+func CheckThroughput(limits []models.ThroughputLimit) error {
+	for i, limit := range limits {
+		if limit.MaxLeads <= 0 {
+			return fmt.Errorf("throughputLimits[%d].maxLeads must be positive", i)
+		}
+		if per, err := time.ParseDuration(limit.Per); err != nil || per <= 0 {
+			return fmt.Errorf("throughputLimits[%d].per must be a positive duration such as 1h or 5m", i)
+		}
+	}
+	return nil
+}
+
+// marshalLimits returns the throughputLimits column value.
+func marshalLimits(limits []models.ThroughputLimit) (string, error) {
+	if len(limits) == 0 {
+		return "[]", nil
+	}
+	raw, err := json.Marshal(limits)
+	return string(raw), err
+}
+
+// unmarshalLimits decodes a throughputLimits column value, leaving no
+// limits nil.
+func unmarshalLimits(data string) ([]models.ThroughputLimit, error) {
+	var limits []models.ThroughputLimit
+	if err := json.Unmarshal([]byte(data), &limits); err != nil || len(limits) == 0 {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// throughputAt counts the leads c was assigned in the window of each of its
+// throughput limits ending at now, using q, which may be a transaction.
+func throughputAt(ctx context.Context, q queryer, c models.Client, now time.Time) ([]models.ThroughputUsage, error) {
+	var usage []models.ThroughputUsage
+	for _, limit := range c.ThroughputLimits {
+		per, err := time.ParseDuration(limit.Per)
+		if err != nil {
+			return nil, err
+		}
+		u := models.ThroughputUsage{ThroughputLimit: limit}
+		err = q.QueryRowContext(ctx, `SELECT COUNT(*) FROM leads WHERE clientId = ? AND status = ? AND assignedAt >= ? AND assignedAt < ?`,
+			c.ID, models.LeadAssigned, now.Add(-per).UTC(), now.UTC()).Scan(&u.Used)
+		if err != nil {
+			slog.Error("failed to count leads for throughput limit", "client", c.ID, "error", err)
+			return nil, err
+		}
+		u.Remaining = max(limit.MaxLeads-u.Used, 0)
+		usage = append(usage, u)
+	}
+	return usage, nil
+}
+
+// throttled reports whether any throughput limit is used up.
+func throttled(usage []models.ThroughputUsage) bool {
+	for _, u := range usage {
+		if u.Remaining == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Availability returns how many leads each client can take right now and
+// the tightest limit on it: its status, its working hours, its own and its
+// groups' capacity, its throughput limits and its pacing. Criteria and rules are
+// not considered, as they depend on the lead.
+func (db *DB) Availability(ctx context.Context, now time.Time) ([]models.Availability, error) {
+	ctx, done := trace(ctx, "availability")
+	defer done()
+
+	clients, err := db.listClients(ctx, ClientFilter{})
+	if err != nil {
+		return nil, err
+	}
+	groups, err := db.GetAllGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Group, len(groups))
+	for _, g := range groups {
+		byID[g.ID] = g
+	}
+
+	availability := make([]models.Availability, 0, len(clients))
+	for _, c := range clients {
+		a := models.Availability{ClientID: c.ID, Name: c.Name, Available: math.MaxInt}
+		limit := func(n int, by string) {
+			if n < a.Available {
+				a.Available, a.LimitedBy = max(n, 0), by
+			}
+		}
+		if c.Status != models.ClientActive {
+			limit(0, models.LimitStatus)
+		}
+		if !openAt(c, now) {
+			limit(0, models.LimitWorkingHours)
+		}
+		limit(c.LeadCapacity-c.CurrentLeadCount, models.LimitCapacity)
+		seen := make(map[string]bool)
+		for id := c.GroupID; id != "" && !seen[id]; id = byID[id].ParentID {
+			seen[id] = true
+			if g := byID[id]; g.LeadCapacity > 0 {
+				limit(g.LeadCapacity-g.CurrentLeadCount, models.LimitGroupCapacity)
+			}
+		}
+		if a.Throughput, err = throughputAt(ctx, db, c, now); err != nil {
+			return nil, err
+		}
+		for _, u := range a.Throughput {
+			limit(u.Remaining, models.LimitThroughput)
+		}
+		if a.Pacing, err = pacingAt(ctx, db, c, now); err != nil {
+			return nil, err
+		}
+		if a.Pacing != nil {
+			// The pace allows leads while no more than Target were delivered.
+			limit(int(math.Floor(a.Pacing.Target))+1-a.Pacing.Delivered, models.LimitPacing)
+		}
+		availability = append(availability, a)
+	}
+	return availability, nil
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckThroughput(t *testing.T) {
+	tests := []struct {
+		name        string
+		limits      []models.ThroughputLimit
+		expectedErr bool
+	}{
+		{name: "No limits"},
+		{name: "Valid limits", limits: []models.ThroughputLimit{{MaxLeads: 10, Per: "1h"}, {MaxLeads: 2, Per: "5m"}}},
+		{name: "Zero leads", limits: []models.ThroughputLimit{{MaxLeads: 0, Per: "1h"}}, expectedErr: true},
+		{name: "Missing window", limits: []models.ThroughputLimit{{MaxLeads: 10}}, expectedErr: true},
+		{name: "Negative window", limits: []models.ThroughputLimit{{MaxLeads: 10, Per: "-1h"}}, expectedErr: true},
+		{name: "Invalid window", limits: []models.ThroughputLimit{{MaxLeads: 10, Per: "hourly"}}, expectedErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckThroughput(tc.limits)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestThroughputLimits(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupGroups(t, database, []models.Group{{ID: "g", Name: "Agency", LeadCapacity: 5}})
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "limited", Name: "Limited", Priority: 10, LeadCapacity: 100, WorkingHours: allDay,
+			ThroughputLimits: []models.ThroughputLimit{{MaxLeads: 10, Per: "1h"}, {MaxLeads: 2, Per: "5m"}}},
+		{ID: "member", Name: "Member", Priority: 1, LeadCapacity: 100, WorkingHours: allDay, GroupID: "g"},
+	})
+
+	for i, expected := range []string{"limited", "limited", "member"} {
+		lead, err := database.AssignLead(ctx, models.Lead{ID: fmt.Sprintf("l%d", i)})
+		require.NoError(t, err)
+		assert.Equal(t, expected, lead.ClientID)
+	}
+
+	availability, err := database.Availability(ctx, time.Now().UTC())
+	require.NoError(t, err)
+	require.Len(t, availability, 2)
+	byID := make(map[string]models.Availability)
+	for _, a := range availability {
+		byID[a.ClientID] = a
+	}
+	assert.Equal(t, 0, byID["limited"].Available)
+	assert.Equal(t, models.LimitThroughput, byID["limited"].LimitedBy)
+	require.Len(t, byID["limited"].Throughput, 2)
+	assert.Equal(t, 8, byID["limited"].Throughput[0].Remaining)
+	assert.Equal(t, 4, byID["member"].Available)
+	assert.Equal(t, models.LimitGroupCapacity, byID["member"].LimitedBy)
+
+	// The window slides: leads older than five minutes no longer count
+	// against the tighter limit.
+	_, err = database.ExecContext(ctx, `UPDATE leads SET assignedAt = ? WHERE clientId = 'limited'`, time.Now().UTC().Add(-10*time.Minute))
+	require.NoError(t, err)
+	availability, err = database.Availability(ctx, time.Now().UTC())
+	require.NoError(t, err)
+	for _, a := range availability {
+		if a.ClientID == "limited" {
+			assert.Equal(t, 2, a.Available)
+			assert.Equal(t, models.LimitThroughput, a.LimitedBy)
+		}
+	}
+	client, err := database.GetEligibleClient(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, client)
+	assert.Equal(t, "limited", client.ID)
+}
+
+func TestExplainThroughputLimited(t *testing.T) {
+	database := InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+	allDay := [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "limited", Name: "Limited", Priority: 10, LeadCapacity: 100, WorkingHours: allDay,
+			ThroughputLimits: []models.ThroughputLimit{{MaxLeads: 1, Per: "1h"}}},
+	})
+
+	first, err := database.AssignLead(ctx, models.Lead{ID: "l1"})
+	require.NoError(t, err)
+	assert.Equal(t, models.LeadAssigned, first.Status)
+	second, err := database.AssignLead(ctx, models.Lead{ID: "l2"})
+	require.NoError(t, err)
+	assert.Equal(t, models.LeadQueued, second.Status)
+
+	explanation, err := database.ExplainLead(ctx, "l2")
+	require.NoError(t, err)
+	require.Len(t, explanation.Candidates, 1)
+	assert.Equal(t, []string{models.ReasonThroughputLimited}, explanation.Candidates[0].Reasons)
+	assert.Equal(t, 1, explanation.Candidates[0].Throughput[0].Used)
+}
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"lead_management/pkg/models"
+	"lead_management/pkg/utils"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// WebhookQueued returns a channel that receives a value whenever webhook
+// deliveries have been enqueued. Signals are coalesced.
+func (db *DB) WebhookQueued() <-chan struct{} {
+	return db.webhookQueued
+}
+
+func (db *DB) signalWebhookQueued() {
+	select {
+	case db.webhookQueued <- struct{}{}:
+	default:
+	}
+}
+
+// CreateWebhook registers a webhook endpoint for a client.
+func (db *DB) CreateWebhook(ctx context.Context, w models.Webhook) error {
+	ctx, done := trace(ctx, "create_webhook")
+	defer done()
+
+	_, err := db.ExecContext(ctx, `INSERT INTO webhooks (id, clientId, url, secret, eventTypes, createdAt) VALUES (?, ?, ?, ?, ?, ?)`,
+		w.ID, w.ClientID, w.URL, w.Secret, strings.Join(w.EventTypes, ","), w.CreatedAt.UTC())
+	if err != nil {
+		slog.Error("failed to insert webhook", "id", w.ID, "error", err)
+		return err
+	}
+	slog.Info("webhook created", "id", w.ID, "client", w.ClientID, "url", w.URL)
+	return nil
+}
+
+// GetWebhooksByClient lists a client's webhooks. Secrets are not returned.
+func (db *DB) GetWebhooksByClient(ctx context.Context, clientID string) ([]models.Webhook, error) {
+	ctx, done := trace(ctx, "get_webhooks_by_client")
+	defer done()
+
+	return getWebhooksByClient(ctx, db, clientID, false)
+}
+
+// getWebhooksByClient lists a client's webhooks using q, which may be a transaction.
+func getWebhooksByClient(ctx context.Context, q queryer, clientID string, withSecret bool) ([]models.Webhook, error) {
+	rows, err := q.QueryContext(ctx, `SELECT id, clientId, url, secret, eventTypes, createdAt FROM webhooks WHERE clientId = ? ORDER BY createdAt, id`, clientID)
+	if err != nil {
+		slog.Error("failed to query webhooks", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		var w models.Webhook
+		var eventTypes string
+		if err := rows.Scan(&w.ID, &w.ClientID, &w.URL, &w.Secret, &eventTypes, &w.CreatedAt); err != nil {
+			slog.Error("failed to scan webhook row", "error", err)
+			return nil, err
+		}
+		w.EventTypes = strings.Split(eventTypes, ",")
+		w.CreatedAt = w.CreatedAt.UTC()
+		if !withSecret {
+			w.Secret = ""
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a client's webhook and its delivery log. It reports
+// whether the webhook existed.
+func (db *DB) DeleteWebhook(ctx context.Context, clientID, id string) (bool, error) {
+	ctx, done := trace(ctx, "delete_webhook")
+	defer done()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ? AND clientId = ?`, id, clientID)
+	if err != nil {
+		slog.Error("failed to delete webhook", "id", id, "error", err)
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhookId = ?`, id); err != nil {
+		slog.Error("failed to delete webhook deliveries", "id", id, "error", err)
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// enqueueWebhookDeliveries creates a pending delivery of the event for every
+// webhook of the event's client subscribed to its type, and returns how many it created.
+func enqueueWebhookDeliveries(ctx context.Context, q queryer, event models.Event) (int, error) {
+	webhooks, err := getWebhooksByClient(ctx, q, event.ClientID, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var payload []byte
+	queued := 0
+	for _, w := range webhooks {
+		if !subscribed(w.EventTypes, event.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return 0, err
+			}
+		}
+		_, err := q.ExecContext(ctx, `INSERT INTO webhook_deliveries (id, webhookId, eventType, payload, status, nextAttemptAt, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			utils.GenerateUUID(), w.ID, event.Type, string(payload), models.DeliveryPending, event.CreatedAt, event.CreatedAt, event.CreatedAt)
+		if err != nil {
+			slog.Error("failed to enqueue webhook delivery", "webhook", w.ID, "error", err)
+			return 0, err
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+func subscribed(eventTypes []string, eventType string) bool {
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// deliveryColumns lists the delivery columns in the order scanDelivery expects them.
+const deliveryColumns = `d.id, d.webhookId, d.eventType, d.payload, d.status, d.attempts, d.lastError, d.lastStatusCode, d.nextAttemptAt, d.createdAt, d.updatedAt, w.url, w.secret`
+
+// scanDelivery scans a row selected with deliveryColumns.
+func scanDelivery(row scanner) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload string
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.LastError,
+		&d.LastStatusCode, &d.NextAttemptAt, &d.CreatedAt, &d.UpdatedAt, &d.URL, &d.Secret)
+	d.Payload = json.RawMessage(payload)
+	d.NextAttemptAt = d.NextAttemptAt.UTC()
+	d.CreatedAt = d.CreatedAt.UTC()
+	d.UpdatedAt = d.UpdatedAt.UTC()
+	return d, err
+}
+
+func (db *DB) queryDeliveries(ctx context.Context, where string, args ...any) ([]models.WebhookDelivery, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhookId WHERE `+where, args...)
+	if err != nil {
+		slog.Error("failed to query webhook deliveries", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			slog.Error("failed to scan webhook delivery row", "error", err)
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetDueWebhookDeliveries returns up to limit pending deliveries whose next
+// attempt is due at now, oldest first, including the webhook URL and secret.
+func (db *DB) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	ctx, done := trace(ctx, "get_due_webhook_deliveries")
+	defer done()
+
+	return db.queryDeliveries(ctx, `d.status = ? AND d.nextAttemptAt <= ? ORDER BY d.nextAttemptAt, d.createdAt LIMIT ?`,
+		models.DeliveryPending, now.UTC(), limit)
+}
+
+// GetWebhookDeliveries lists a client's deliveries, newest first, optionally
+// filtered by status. An empty clientID lists deliveries of all clients.
+func (db *DB) GetWebhookDeliveries(ctx context.Context, clientID, status string) ([]models.WebhookDelivery, error) {
+	ctx, done := trace(ctx, "get_webhook_deliveries")
+	defer done()
+
+	return db.queryDeliveries(ctx, `(? = '' OR w.clientId = ?) AND (? = '' OR d.status = ?) ORDER BY d.createdAt DESC, d.id`,
+		clientID, clientID, status, status)
+}
+
+// UpdateWebhookDelivery records the outcome of a delivery attempt.
+func (db *DB) UpdateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	ctx, done := trace(ctx, "update_webhook_delivery")
+	defer done()
+
+	_, err := db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = ?, attempts = ?, lastError = ?, lastStatusCode = ?, nextAttemptAt = ?, updatedAt = ? WHERE id = ?`,
+		d.Status, d.Attempts, d.LastError, d.LastStatusCode, d.NextAttemptAt.UTC(), d.UpdatedAt.UTC(), d.ID)
+	if err != nil {
+		slog.Error("failed to update webhook delivery", "id", d.ID, "error", err)
+	}
+	return err
+}
+
+// ReplayWebhookDelivery moves a dead delivery back to pending so it is sent
+// again with a fresh set of attempts. It reports whether a dead delivery was found.
+func (db *DB) ReplayWebhookDelivery(ctx context.Context, id string) (bool, error) {
+	ctx, done := trace(ctx, "replay_webhook_delivery")
+	defer done()
+
+	now := time.Now().UTC()
+	res, err := db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = ?, attempts = 0, nextAttemptAt = ?, updatedAt = ? WHERE id = ? AND status = ?`,
+		models.DeliveryPending, now, now, id, models.DeliveryDead)
+	if err != nil {
+		slog.Error("failed to replay webhook delivery", "id", id, "error", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		db.signalWebhookQueued()
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,49 @@
+// Package events lets in-process subscribers wait for new activity events.
+// The events themselves are stored in the database; the broker only tells
+// subscribers when to read them.
+package events
+
+import "sync"
+
+// Broker broadcasts that new events are available.
+type Broker struct {
+	mu      sync.Mutex
+	changed chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewBroker returns a Broker with no pending notification.
+func NewBroker() *Broker {
+	return &Broker{
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Changed returns a channel that is closed by the next call to Notify.
+// Subscribers should call Changed before reading events so that events
+// stored while they read are not missed.
+func (b *Broker) Changed() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.changed
+}
+
+// Notify wakes all subscribers waiting on Changed.
+func (b *Broker) Notify() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Done returns a channel that is closed when the broker is closed.
+func (b *Broker) Done() <-chan struct{} {
+	return b.done
+}
+
+// Close tells long-lived subscribers such as event streams to finish.
+func (b *Broker) Close() {
+	b.once.Do(func() { close(b.done) })
+}
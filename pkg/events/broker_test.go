@@ -0,0 +1,28 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+
+	first := b.Changed()
+	assert.Equal(t, first, b.Changed(), "no notification yet")
+	select {
+	case <-first:
+		t.Fatal("closed before Notify")
+	default:
+	}
+
+	b.Notify()
+	<-first
+	second := b.Changed()
+	assert.NotEqual(t, first, second)
+
+	b.Close()
+	b.Close()
+	<-b.Done()
+}
@@ -0,0 +1,85 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	return cw, cw.w.Write(columns)
+}
+
+// WriteRow writes the row, escaping strings that would be read as formulas.
+func (cw *csvWriter) WriteRow(values ...any) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			record[i] = escapeFormula(s)
+		} else {
+			record[i] = formatValue(v)
+		}
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type ndjsonWriter struct {
+	w       io.Writer
+	columns []string
+	buf     bytes.Buffer
+}
+
+func newNDJSONWriter(w io.Writer, columns []string) *ndjsonWriter {
+	return &ndjsonWriter{w: w, columns: columns}
+}
+
+// WriteRow writes the row as a JSON object with keys in column order.
+func (nw *ndjsonWriter) WriteRow(values ...any) error {
+	nw.buf.Reset()
+	nw.buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			nw.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(nw.columns[i])
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		nw.buf.Write(key)
+		nw.buf.WriteByte(':')
+		nw.buf.Write(value)
+	}
+	nw.buf.WriteString("}\n")
+	_, err := nw.w.Write(nw.buf.Bytes())
+	return err
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
+
+// formatValue formats a row value as text.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,136 @@
+// Package export writes tabular data as CSV, NDJSON or a minimal Office Open
+// XML spreadsheet, one row at a time.
+package export
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Supported formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// formats lists the supported formats in order of preference.
+var formats = []string{FormatCSV, FormatNDJSON, FormatXLSX}
+
+// contentTypes maps formats to their media types.
+var contentTypes = map[string]string{
+	FormatCSV:    "text/csv",
+	FormatNDJSON: "application/x-ndjson",
+	FormatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// ErrUnsupportedFormat is returned for formats and Accept headers that
+// select none of the supported formats.
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// ContentType returns the media type of format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Negotiate selects the format named by the format parameter, or else the
+// supported media type with the highest q-value in the Accept header, the
+// first of them on ties. Wildcards select the first format in the order
+// CSV, NDJSON, XLSX that the header does not refuse with q=0. CSV is the
+// default when neither selects a format.
+func Negotiate(accept, format string) (string, error) {
+	if format != "" {
+		if _, ok := contentTypes[format]; !ok {
+			return "", ErrUnsupportedFormat
+		}
+		return format, nil
+	}
+	if accept == "" {
+		return FormatCSV, nil
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []mediaRange
+	refused := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		if q == 0 {
+			refused[mediaType] = true
+			continue
+		}
+		ranges = append(ranges, mediaRange{mediaType, q})
+	}
+
+	best, bestQ := "", 0.0
+	for _, r := range ranges {
+		if f := matchFormat(r.mediaType, refused); f != "" && r.q > bestQ {
+			best, bestQ = f, r.q
+		}
+	}
+	if best == "" {
+		return "", ErrUnsupportedFormat
+	}
+	return best, nil
+}
+
+// matchFormat returns the first format mediaType covers whose media type is
+// not refused, or "" if there is none.
+func matchFormat(mediaType string, refused map[string]bool) string {
+	for _, f := range formats {
+		ct := contentTypes[f]
+		if refused[ct] {
+			continue
+		}
+		if mediaType == ct || mediaType == "*/*" || mediaType == "text/*" && f == FormatCSV {
+			return f
+		}
+	}
+	return ""
+}
+
+// escapeFormula prefixes s with a single quote if it starts with a
+// character that spreadsheet applications read as the start of a formula,
+// so exported values cannot run as formulas when the file is opened.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// Writer writes rows whose values correspond to the columns it was created with.
+type Writer interface {
+	// WriteRow writes one row. Values may be strings, integers, floats or booleans.
+	WriteRow(values ...any) error
+	// Close completes the output. It does not close the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a Writer producing format on w. The column names are
+// written as the CSV and spreadsheet header and used as the NDJSON keys.
+func NewWriter(w io.Writer, format string, columns []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatNDJSON:
+		return newNDJSONWriter(w, columns), nil
+	case FormatXLSX:
+		return newXLSXWriter(w, columns)
+	}
+	return nil, ErrUnsupportedFormat
+}
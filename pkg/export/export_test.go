@@ -0,0 +1,147 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		format      string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "Default", expected: FormatCSV},
+		{name: "Format parameter wins", accept: "text/csv", format: "xlsx", expected: FormatXLSX},
+		{name: "Accept NDJSON", accept: "application/x-ndjson", expected: FormatNDJSON},
+		{name: "First supported type", accept: "application/pdf, application/vnd.openxmlformats-officedocument.spreadsheetml.sheet;q=0.9", expected: FormatXLSX},
+		{name: "Highest q-value wins", accept: "text/csv;q=0.1, application/x-ndjson", expected: FormatNDJSON},
+		{name: "First of equal q-values", accept: "application/x-ndjson;q=0.5, text/csv;q=0.5", expected: FormatNDJSON},
+		{name: "Wildcard", accept: "*/*", expected: FormatCSV},
+		{name: "Wildcard below a supported type", accept: "*/*;q=0.1, application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", expected: FormatXLSX},
+		{name: "Wildcard without refused types", accept: "text/csv;q=0, */*", expected: FormatNDJSON},
+		{name: "Text wildcard", accept: "text/*", expected: FormatCSV},
+		{name: "Only refused types", accept: "text/csv;q=0", expectedErr: true},
+		{name: "Invalid q-value ignored", accept: "application/x-ndjson;q=high, text/csv;q=0.2", expected: FormatCSV},
+		{name: "Unsupported accept", accept: "application/pdf", expectedErr: true},
+		{name: "Unsupported format", format: "pdf", expectedErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			format, err := Negotiate(tc.accept, tc.format)
+			if tc.expectedErr {
+				require.ErrorIs(t, err, ErrUnsupportedFormat)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, format)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	columns := []string{"id", "name", "capacity", "utilization"}
+	rows := [][]any{
+		{"1", "Acme, Inc.", 100, 0.25},
+		{"2", `<Fish & "Chips">`, 5, 1.0},
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format:   FormatCSV,
+			expected: "id,name,capacity,utilization\n1,\"Acme, Inc.\",100,0.25\n2,\"<Fish & \"\"Chips\"\">\",5,1\n",
+		},
+		{
+			format: FormatNDJSON,
+			expected: `{"id":"1","name":"Acme, Inc.","capacity":100,"utilization":0.25}` + "\n" +
+				`{"id":"2","name":"\u003cFish \u0026 \"Chips\"\u003e","capacity":5,"utilization":1}` + "\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, tc.format, columns)
+			require.NoError(t, err)
+			for _, row := range rows {
+				require.NoError(t, w.WriteRow(row...))
+			}
+			require.NoError(t, w.Close())
+			assert.Equal(t, tc.expected, buf.String())
+		})
+	}
+
+	t.Run(FormatXLSX, func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, FormatXLSX, columns)
+		require.NoError(t, err)
+		for _, row := range rows {
+			require.NoError(t, w.WriteRow(row...))
+		}
+		require.NoError(t, w.Close())
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		var names []string
+		var sheet []byte
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+			if f.Name == "xl/worksheets/sheet1.xml" {
+				rc, err := f.Open()
+				require.NoError(t, err)
+				sheet, _ = io.ReadAll(rc)
+				rc.Close()
+			}
+		}
+		assert.ElementsMatch(t, []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"}, names)
+		assert.Contains(t, string(sheet), `<row><c t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`)
+		assert.Contains(t, string(sheet), `<t xml:space="preserve">&lt;Fish &amp; &#34;Chips&#34;&gt;</t>`)
+		assert.Contains(t, string(sheet), `<c><v>100</v></c><c><v>0.25</v></c></row>`)
+	})
+}
+
+func TestWriterEscapesFormulas(t *testing.T) {
+	columns := []string{"name", "note", "count"}
+	row := []any{"=HYPERLINK(\"http://x\")", "@SUM(A1)", -3}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatCSV, columns)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteRow(row...))
+	require.NoError(t, w.WriteRow("+1", "-", "a=b"))
+	require.NoError(t, w.Close())
+	assert.Equal(t, "name,note,count\n\"'=HYPERLINK(\"\"http://x\"\")\",'@SUM(A1),-3\n'+1,'-,a=b\n", buf.String())
+
+	buf.Reset()
+	w, err = NewWriter(&buf, FormatNDJSON, columns)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteRow(row...))
+	require.NoError(t, w.Close())
+	assert.Equal(t, `{"name":"=HYPERLINK(\"http://x\")","note":"@SUM(A1)","count":-3}`+"\n", buf.String(), "NDJSON is not opened as a spreadsheet")
+
+	buf.Reset()
+	w, err = NewWriter(&buf, FormatXLSX, columns)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteRow(row...))
+	require.NoError(t, w.Close())
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	rc, err := zr.Open("xl/worksheets/sheet1.xml")
+	require.NoError(t, err)
+	sheet, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	rc.Close()
+	assert.Contains(t, string(sheet), `<t xml:space="preserve">&#39;=HYPERLINK(&#34;http://x&#34;)</t>`)
+	assert.Contains(t, string(sheet), `<t xml:space="preserve">&#39;@SUM(A1)</t></is></c><c><v>-3</v></c>`)
+}
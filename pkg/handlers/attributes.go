@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"lead_management/pkg/attributes"
+	"lead_management/pkg/db"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// attributePrefix marks the query parameters and CSV columns that hold
+// custom attribute values.
+const attributePrefix = "attr."
+
+// DefineAttributeRequest is used to decode the JSON request payload.
+type DefineAttributeRequest struct {
+	Type     string   `json:"type"`
+	Values   []string `json:"values"`
+	Required bool     `json:"required"`
+}
+
+// attributeError answers the request for an *attributes.Error and reports
+// whether err was one.
+func attributeError(w http.ResponseWriter, err error) bool {
+	var attrErr *attributes.Error
+	if !errors.As(err, &attrErr) {
+		return false
+	}
+	http.Error(w, "Invalid "+attrErr.Error(), http.StatusBadRequest)
+	return true
+}
+
+// attributeFilter reads attr.<name>=value query parameters into attribute
+// values, typed by their definitions.
+func attributeFilter(query url.Values, defs []models.AttributeDefinition) (map[string]any, error) {
+	var values map[string]any
+	for key := range query {
+		name, ok := strings.CutPrefix(key, attributePrefix)
+		if !ok {
+			continue
+		}
+		value, err := parseAttribute(defs, name, query.Get(key))
+		if err != nil {
+			return nil, err
+		}
+		if values == nil {
+			values = make(map[string]any)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// parseAttribute converts the text of the named attribute to its typed value.
+func parseAttribute(defs []models.AttributeDefinition, name, text string) (any, error) {
+	for _, def := range defs {
+		if def.Name == name {
+			return attributes.Parse(def, text)
+		}
+	}
+	return nil, &attributes.Error{Attribute: name, Message: "is not defined"}
+}
+
+// entityParam returns the entity named in the request path, answering 404
+// if it has no custom attributes.
+func entityParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	entity := r.PathValue("entity")
+	if entity != models.EntityClient && entity != models.EntityLead {
+		http.Error(w, "Entity must be client or lead", http.StatusNotFound)
+		return "", false
+	}
+	return entity, true
+}
+
+// AttributesHandler lists the custom attribute definitions of clients or leads.
+func AttributesHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		entity, ok := entityParam(w, r)
+		if !ok {
+			return
+		}
+		defs, err := database.GetAttributeDefinitions(r.Context(), entity)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch attribute definitions", "entity", entity, "error", err)
+			http.Error(w, "Failed to fetch attribute definitions", http.StatusInternalServerError)
+			return
+		}
+		if defs == nil {
+			defs = []models.AttributeDefinition{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(defs)
+	}
+}
+
+// AttributeHandler serves a single attribute definition: PUT creates or
+// replaces it and DELETE removes it. Values already stored are not changed
+// by either.
+func AttributeHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entity, ok := entityParam(w, r)
+		if !ok {
+			return
+		}
+		name := r.PathValue("name")
+		logger := logging.FromContext(r.Context())
+		switch r.Method {
+		case "PUT":
+			var req DefineAttributeRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+			def := models.AttributeDefinition{Entity: entity, Name: name, Type: req.Type, Values: req.Values, Required: req.Required}
+			if err := attributes.CheckDefinition(def); err != nil {
+				attributeError(w, err)
+				return
+			}
+			if err := database.DefineAttribute(r.Context(), def); err != nil {
+				logger.Error("failed to define attribute", "entity", entity, "name", name, "error", err)
+				http.Error(w, "Failed to define attribute", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(def)
+		case "DELETE":
+			found, err := database.DeleteAttribute(r.Context(), entity, name)
+			if err != nil {
+				logger.Error("failed to delete attribute", "entity", entity, "name", name, "error", err)
+				http.Error(w, "Failed to delete attribute", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Attribute not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+		}
+	}
+}
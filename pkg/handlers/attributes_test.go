@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAttributeHandlers(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		contentType  string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Define enum",
+			method:       "PUT",
+			url:          "/attributes/client/tier",
+			body:         `{"type":"enum","values":["gold","silver"],"required":false}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"entity":"client","name":"tier","type":"enum","values":["gold","silver"],"required":false}`,
+		},
+		{
+			name:         "Redefine number",
+			method:       "PUT",
+			url:          "/attributes/client/seats",
+			body:         `{"type":"number","required":true}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"entity":"client","name":"seats","type":"number","required":true}`,
+		},
+		{
+			name:         "Unknown type",
+			method:       "PUT",
+			url:          "/attributes/client/since",
+			body:         `{"type":"time"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `Invalid attribute since has unknown type "time"`,
+		},
+		{
+			name:         "Invalid name",
+			method:       "PUT",
+			url:          "/attributes/client/crm-id",
+			body:         `{"type":"string"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid attribute crm-id name must start with a letter and contain only letters, digits and underscores",
+		},
+		{
+			name:         "Unknown entity",
+			method:       "GET",
+			url:          "/attributes/group",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Entity must be client or lead",
+		},
+		{
+			name:         "List definitions",
+			method:       "GET",
+			url:          "/attributes/client",
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"entity":"client","name":"region","type":"enum","values":["emea","apac"],"required":true},
+				{"entity":"client","name":"seats","type":"number","required":false}]`,
+		},
+		{
+			name:         "Create client with attributes",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"c2","name":"Two","leadCapacity":5,"workingHoursStart":"09:00","workingHoursEnd":"17:00","attributes":{"region":"apac","seats":2}}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"c2","name":"Two","priority":0,"leadCapacity":5,"currentLeadCount":0,
+				"workingHours":["0000-01-01T09:00:00Z","0000-01-01T17:00:00Z"],"version":1,"attributes":{"region":"apac","seats":2},"status":"active"}`,
+		},
+		{
+			name:         "Missing required attribute",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"c2","name":"Two","workingHoursStart":"09:00","workingHoursEnd":"17:00"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid attribute region is required",
+		},
+		{
+			name:         "Attribute of wrong type",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"c2","name":"Two","workingHoursStart":"09:00","workingHoursEnd":"17:00","attributes":{"region":"emea","seats":"3"}}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid attribute seats must be a number",
+		},
+		{
+			name:         "Criteria on undefined lead attribute",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"c2","name":"Two","workingHoursStart":"09:00","workingHoursEnd":"17:00","attributes":{"region":"emea"},"criteria":[{"attribute":"colour","in":["red"]}]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid attribute colour criterion refers to an undefined lead attribute",
+		},
+		{
+			name:         "Criteria of wrong type",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"c2","name":"Two","workingHoursStart":"09:00","workingHoursEnd":"17:00","attributes":{"region":"emea"},"criteria":[{"attribute":"vip","in":["yes"]}]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid attribute vip criterion value must be true or false",
+		},
+		{
+			name:         "Import CSV with attributes",
+			method:       "POST",
+			url:          "/clients/import",
+			contentType:  "text/csv",
+			body:         "id,name,workingHoursStart,workingHoursEnd,attr.region,attr.seats\nc3,Three,09:00,17:00,apac,7\n",
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"dryRun":false,"created":1,"updated":0,"errors":[]}`,
+		},
+		{
+			name:         "Import invalid attribute",
+			method:       "POST",
+			url:          "/clients/import",
+			contentType:  "text/csv",
+			body:         "id,name,workingHoursStart,workingHoursEnd,attr.region\nc4,Four,09:00,17:00,amer\n",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: `{"dryRun":false,"created":0,"updated":0,"errors":[{"row":2,"id":"c4","field":"attributes.region","message":"must be one of [emea apac]"}]}`,
+		},
+		{
+			name:         "Import missing attribute",
+			method:       "POST",
+			url:          "/clients/import",
+			body:         `[{"id":"c4","name":"Four","workingHoursStart":"09:00","workingHoursEnd":"17:00"}]`,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: `{"dryRun":false,"created":0,"updated":0,"errors":[{"row":1,"id":"c4","field":"attributes.region","message":"is required"}]}`,
+		},
+		{
+			name:         "Filter clients by attribute",
+			method:       "GET",
+			url:          "/client/all?attr.region=emea",
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":"c1","name":"One","priority":0,"leadCapacity":5,"currentLeadCount":1,
+				"workingHours":["0000-01-01T00:00:00Z","0000-01-01T23:59:00Z"],"version":1,"attributes":{"region":"emea","seats":3},"status":"active"}]`,
+		},
+		{
+			name:         "Filter by undefined attribute",
+			method:       "GET",
+			url:          "/client/all?attr.colour=red",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid attribute colour is not defined",
+		},
+		{
+			name:         "Filter by invalid value",
+			method:       "GET",
+			url:          "/client/all?attr.seats=many",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid attribute seats must be a number",
+		},
+		{
+			name:         "Create lead with attributes",
+			method:       "POST",
+			url:          "/lead/create",
+			body:         `{"id":"l2","attributes":{"vip":false}}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"l2","name":"","email":"","phone":"","status":"assigned","clientId":"c1","attributes":{"vip":false}}`,
+		},
+		{
+			name:         "Create lead with invalid attribute",
+			method:       "POST",
+			url:          "/lead/create",
+			body:         `{"id":"l2","attributes":{"vip":"yes"}}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid attribute vip must be true or false",
+		},
+		{
+			name:         "Filter leads by attribute",
+			method:       "GET",
+			url:          "/lead/all?attr.vip=true&status=assigned&clientId=c1",
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":"l1","name":"","email":"","phone":"","status":"assigned","clientId":"c1","attributes":{"vip":true}}]`,
+		},
+		{
+			name:         "Invalid lead limit",
+			method:       "GET",
+			url:          "/lead/all?limit=5000",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "limit must be between 1 and 1000",
+		},
+		{
+			name:         "Invalid lead status",
+			method:       "GET",
+			url:          "/lead/all?status=lost",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "status must be assigned, queued, duplicate or merged",
+		},
+		{
+			name:         "Delete definition",
+			method:       "DELETE",
+			url:          "/attributes/client/seats",
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Delete unknown definition",
+			method:       "DELETE",
+			url:          "/attributes/client/colour",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Attribute not found",
+		},
+		{
+			name:         "Incorrect HTTP method",
+			method:       "POST",
+			url:          "/attributes/client/seats",
+			expectedCode: http.StatusMethodNotAllowed,
+			expectedBody: "Unsupported HTTP method",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := db.InitDB(":memory:")
+			defer database.Close()
+			setupAttributesDatabase(database)
+			mux := http.NewServeMux()
+			SetupRoutes(mux, database)
+
+			req, _ := http.NewRequest(tc.method, tc.url, bytes.NewBufferString(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			assertResponse(t, rr, tc.expectedCode, tc.expectedBody)
+		})
+	}
+}
+
+// Helper function to set up client and lead attribute definitions with a
+// client and a lead using them
+func setupAttributesDatabase(database *db.DB) {
+	ctx := context.Background()
+	for _, def := range []models.AttributeDefinition{
+		{Entity: models.EntityClient, Name: "region", Type: models.AttributeEnum, Values: []string{"emea", "apac"}, Required: true},
+		{Entity: models.EntityClient, Name: "seats", Type: models.AttributeNumber},
+		{Entity: models.EntityLead, Name: "vip", Type: models.AttributeBoolean},
+	} {
+		if err := database.DefineAttribute(ctx, def); err != nil {
+			panic("Failed to setup database: " + err.Error())
+		}
+	}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "c1", Name: "One", LeadCapacity: 5, WorkingHours: allDay(), Attributes: map[string]any{"region": "emea", "seats": 3.0}},
+	})
+	if _, err := database.AssignLead(ctx, models.Lead{ID: "l1", Attributes: map[string]any{"vip": true}}); err != nil {
+		panic("Failed to setup database: " + err.Error())
+	}
+}
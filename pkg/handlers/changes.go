@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/logging"
+	"net/http"
+	"strconv"
+)
+
+// Change feed batch sizes.
+const (
+	defaultChangesLimit = 1000
+	maxChangesLimit     = 10000
+)
+
+// ChangesHandler returns a batch of the change log as NDJSON, one change per
+// line in the order the changes were made. The batch starts after the
+// cursor given as since (the start of the log when empty) and holds at most
+// limit changes. The X-Next-Cursor header carries the cursor to pass as
+// since for the next batch and X-Has-More tells whether it is already known
+// to be non-empty.
+func ChangesHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		since := query.Get("since")
+		after, err := db.ParseCursor(since)
+		if err != nil {
+			http.Error(w, "Invalid since cursor", http.StatusBadRequest)
+			return
+		}
+		limit := defaultChangesLimit
+		if v := query.Get("limit"); v != "" {
+			limit, err = strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > maxChangesLimit {
+				http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxChangesLimit), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// One extra change is read to tell whether more are waiting.
+		changes, err := database.GetChanges(r.Context(), after, limit+1)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch changes", "error", err)
+			http.Error(w, "Failed to fetch changes", http.StatusInternalServerError)
+			return
+		}
+		more := len(changes) > limit
+		if more {
+			changes = changes[:limit]
+		}
+		next := since
+		if len(changes) > 0 {
+			next = changes[len(changes)-1].Cursor
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("X-Next-Cursor", next)
+		w.Header().Set("X-Has-More", strconv.FormatBool(more))
+		enc := json.NewEncoder(w)
+		for _, c := range changes {
+			if err := enc.Encode(c); err != nil {
+				return
+			}
+		}
+	}
+}
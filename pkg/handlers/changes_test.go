@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangesHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "1", Name: "Open Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay()},
+	})
+	_, err := database.AssignLead(context.Background(), models.Lead{ID: "l1", Name: "Ada"})
+	require.NoError(t, err)
+
+	get := func(query string) (*httptest.ResponseRecorder, []models.Change) {
+		req, _ := http.NewRequest("GET", "/changes"+query, nil)
+		rr := httptest.NewRecorder()
+		ChangesHandler(database).ServeHTTP(rr, req)
+
+		var changes []models.Change
+		if rr.Code != http.StatusOK {
+			return rr, nil
+		}
+		scanner := bufio.NewScanner(rr.Body)
+		for scanner.Scan() {
+			var c models.Change
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &c))
+			changes = append(changes, c)
+		}
+		return rr, changes
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedCode   int
+		expectedKinds  []string
+		expectedCursor string
+		expectedMore   string
+	}{
+		{
+			name:           "Full log",
+			expectedCode:   http.StatusOK,
+			expectedKinds:  []string{"client/insert", "client/update", "lead/insert", "assignment/insert"},
+			expectedCursor: "4",
+			expectedMore:   "false",
+		},
+		{
+			name:           "First batch",
+			query:          "?limit=2",
+			expectedCode:   http.StatusOK,
+			expectedKinds:  []string{"client/insert", "client/update"},
+			expectedCursor: "2",
+			expectedMore:   "true",
+		},
+		{
+			name:           "Resume from cursor",
+			query:          "?since=2&limit=2",
+			expectedCode:   http.StatusOK,
+			expectedKinds:  []string{"lead/insert", "assignment/insert"},
+			expectedCursor: "4",
+			expectedMore:   "false",
+		},
+		{
+			name:           "Caught up",
+			query:          "?since=4",
+			expectedCode:   http.StatusOK,
+			expectedCursor: "4",
+			expectedMore:   "false",
+		},
+		{
+			name:         "Invalid cursor",
+			query:        "?since=abc",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Invalid limit",
+			query:        "?limit=0",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr, changes := get(tc.query)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			var kinds []string
+			for _, c := range changes {
+				kinds = append(kinds, c.Entity+"/"+c.Operation)
+			}
+			assert.Equal(t, tc.expectedKinds, kinds)
+			assert.Equal(t, tc.expectedCursor, rr.Header().Get("X-Next-Cursor"))
+			assert.Equal(t, tc.expectedMore, rr.Header().Get("X-Has-More"))
+			assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+		})
+	}
+}
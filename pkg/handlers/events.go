@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"lead_management/pkg/db"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// streamKeepAlive is how often an idle event stream sends a comment so
+// proxies do not close the connection.
+var streamKeepAlive = 15 * time.Second
+
+// streamBatchSize bounds the events read from the database at once.
+const streamBatchSize = 100
+
+// streamResetEvent is the event type telling a resuming client that events
+// it missed have been pruned.
+const streamResetEvent = "reset"
+
+// StreamReset is the data of a reset event.
+type StreamReset struct {
+	// LastEventID is the event the client asked to resume after.
+	LastEventID string `json:"lastEventId"`
+	// OldestEventID is the oldest event still buffered, which the stream
+	// continues with.
+	OldestEventID int64 `json:"oldestEventId"`
+}
+
+// EventStreamHandler streams activity events as Server-Sent Events. The
+// clientId and type query parameters (type may list several, comma
+// separated) filter the stream. A reconnecting client resumes after the
+// event named by the Last-Event-ID header or lastEventId parameter. If
+// events after it have already been pruned from the event buffer, a reset
+// event is sent first and the stream continues with the oldest buffered
+// event; without a Last-Event-ID only new events are sent.
+func EventStreamHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := dbEventFilter(query.Get("clientId"), query.Get("type"))
+		for _, t := range filter.Types {
+			if !slices.Contains(models.EventTypes, t) {
+				http.Error(w, "Unknown event type: "+t, http.StatusBadRequest)
+				return
+			}
+		}
+
+		logger := logging.FromContext(r.Context())
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = query.Get("lastEventId")
+		}
+		var last, oldest int64
+		if lastID != "" {
+			var err error
+			if last, err = strconv.ParseInt(lastID, 10, 64); err != nil {
+				http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+				return
+			}
+			if oldest, err = db.OldestEventSequence(r.Context()); err != nil {
+				logger.Error("failed to read oldest event", "error", err)
+				http.Error(w, "Failed to open event stream", http.StatusInternalServerError)
+				return
+			}
+		} else {
+			var err error
+			if last, err = db.LatestEventSequence(r.Context()); err != nil {
+				logger.Error("failed to read latest event", "error", err)
+				http.Error(w, "Failed to open event stream", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		rc := http.NewResponseController(w)
+		// Streams outlive the server's write timeout.
+		rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			logger.Error("event stream cannot be flushed", "error", err)
+			return
+		}
+
+		if oldest > last+1 {
+			// Events after last were pruned; the client must resynchronize.
+			last = oldest - 1
+			data, _ := json.Marshal(StreamReset{LastEventID: lastID, OldestEventID: oldest})
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", last, streamResetEvent, data)
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+		broker := db.Events()
+		for {
+			changed := broker.Changed()
+			events, err := db.GetEvents(r.Context(), last, filter, streamBatchSize)
+			if err != nil {
+				if r.Context().Err() == nil {
+					logger.Error("failed to read events", "error", err)
+				}
+				return
+			}
+			for _, e := range events {
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Sequence, e.Type, eventJSON(e))
+				last = e.Sequence
+			}
+			if len(events) > 0 {
+				if err := rc.Flush(); err != nil {
+					return
+				}
+				if len(events) == streamBatchSize {
+					continue
+				}
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-broker.Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			case <-changed:
+			}
+		}
+	}
+}
+
+// dbEventFilter builds the filter for the clientId and comma-separated type parameters.
+func dbEventFilter(clientID, types string) db.EventFilter {
+	filter := db.EventFilter{ClientID: clientID}
+	for _, t := range strings.Split(types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter.Types = append(filter.Types, t)
+		}
+	}
+	return filter
+}
+
+// eventJSON encodes an event on a single line, as SSE data lines cannot
+// contain newlines.
+func eventJSON(e models.Event) []byte {
+	data, _ := json.Marshal(e)
+	return data
+}
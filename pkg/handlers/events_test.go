@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent is one event read from a Server-Sent Events stream.
+type sseEvent struct {
+	id, event string
+	data      models.Event
+}
+
+// readSSE reads the next event from the stream, skipping comments.
+func readSSE(t *testing.T, r *bufio.Reader) sseEvent {
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && e.id != "":
+			return e
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.data))
+		}
+	}
+}
+
+func TestEventStreamHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "1", Name: "Open Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay()},
+		{ID: "2", Name: "Other Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay()},
+	})
+
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	open := func(t *testing.T, query, lastEventID string) (*http.Response, *bufio.Reader) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		t.Cleanup(cancel)
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/events/stream"+query, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	t.Run("Resume after Last-Event-ID with client filter", func(t *testing.T) {
+		resp, r := open(t, "?clientId=2", "0")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		e := readSSE(t, r)
+		assert.Equal(t, "2", e.id)
+		assert.Equal(t, models.EventClientCreated, e.event)
+		assert.Equal(t, "2", e.data.ClientID)
+	})
+
+	t.Run("Live events filtered by type", func(t *testing.T) {
+		_, r := open(t, "?type=lead.assigned,lead.queued", "")
+
+		_, err := database.UpdateClient(context.Background(), models.Client{ID: "1", Name: "Renamed", LeadCapacity: 10, WorkingHours: allDay()})
+		require.NoError(t, err)
+		_, err = database.AssignLead(context.Background(), models.Lead{ID: "l1", Name: "Ada"})
+		require.NoError(t, err)
+
+		e := readSSE(t, r)
+		assert.Equal(t, models.EventLeadAssigned, e.event)
+		var lead models.Lead
+		require.NoError(t, json.Unmarshal(e.data.Data, &lead))
+		assert.Equal(t, "l1", lead.ID)
+	})
+
+	t.Run("Unknown event type", func(t *testing.T) {
+		resp, _ := open(t, "?type=lead.lost", "")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Streams end when the broker closes", func(t *testing.T) {
+		_, r := open(t, "", "")
+		database.Events().Close()
+		_, err := r.ReadString('\n')
+		assert.Error(t, err)
+	})
+}
+
+func TestEventStreamReset(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	database.SetEventBufferSize(2)
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "1", Name: "First Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay()},
+		{ID: "2", Name: "Second Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay()},
+		{ID: "3", Name: "Third Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay()},
+	})
+
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/events/stream?lastEventId=0", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	r := bufio.NewReader(resp.Body)
+
+	// Event 1 has been pruned, so the client learns it missed events before
+	// the stream continues with the oldest one kept.
+	lines := make([]string, 4)
+	for i := range lines {
+		lines[i], err = r.ReadString('\n')
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"id: 1\n", "event: reset\n", `data: {"lastEventId":"0","oldestEventId":2}` + "\n", "\n"}, lines)
+
+	e := readSSE(t, r)
+	assert.Equal(t, "2", e.id)
+	assert.Equal(t, "2", e.data.ClientID)
+}
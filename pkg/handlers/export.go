@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"lead_management/pkg/db"
+	"lead_management/pkg/export"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// clientFilter reads the client list filters from query parameters:
+// minPriority, maxPriority, hasCapacity, name, status and attr.<name> for
+// the client attributes defs defines.
+func clientFilter(query url.Values, defs []models.AttributeDefinition) (db.ClientFilter, error) {
+	var filter db.ClientFilter
+	var err error
+	if filter.MinPriority, err = optionalInt(query, "minPriority"); err != nil {
+		return filter, err
+	}
+	if filter.MaxPriority, err = optionalInt(query, "maxPriority"); err != nil {
+		return filter, err
+	}
+	if v := query.Get("hasCapacity"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("Invalid hasCapacity")
+		}
+		filter.HasCapacity = &b
+	}
+	filter.Name = query.Get("name")
+	if filter.Status = query.Get("status"); filter.Status != "" && !slices.Contains(models.ClientStatuses, filter.Status) {
+		return filter, errors.New("Invalid status")
+	}
+	filter.Attributes, err = attributeFilter(query, defs)
+	return filter, err
+}
+
+// optionalInt parses the named query parameter, returning nil if it is absent.
+func optionalInt(query url.Values, name string) (*int, error) {
+	v := query.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, errors.New("Invalid " + name)
+	}
+	return &n, nil
+}
+
+// exportColumns are the columns of a client export.
+var exportColumns = []string{"id", "name", "priority", "leadCapacity", "currentLeadCount", "utilization", "workingHoursStart", "workingHoursEnd"}
+
+// exportRow returns the export values of a client in exportColumns order.
+func exportRow(c models.Client) []any {
+	utilization := 0.0
+	if c.LeadCapacity > 0 {
+		utilization = float64(c.CurrentLeadCount) / float64(c.LeadCapacity)
+	}
+	return []any{c.ID, c.Name, c.Priority, c.LeadCapacity, c.CurrentLeadCount, utilization,
+		c.WorkingHours[0].Format("15:04"), c.WorkingHours[1].Format("15:04")}
+}
+
+// ExportClientsHandler streams the clients selected by the list filters as
+// CSV, NDJSON or an XLSX spreadsheet, chosen by the format parameter or the
+// Accept header. Rows are written as they are read from the database.
+func ExportClientsHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		format, err := export.Negotiate(r.Header.Get("Accept"), query.Get("format"))
+		if err != nil {
+			http.Error(w, "Supported formats are csv, ndjson and xlsx", http.StatusNotAcceptable)
+			return
+		}
+		defs, err := database.GetAttributeDefinitions(r.Context(), models.EntityClient)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch attribute definitions", "error", err)
+			http.Error(w, "Failed to export clients", http.StatusInternalServerError)
+			return
+		}
+		filter, err := clientFilter(query, defs)
+		if attributeError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", export.ContentType(format))
+		w.Header().Set("Content-Disposition", `attachment; filename="clients.`+format+`"`)
+		writer, err := export.NewWriter(w, format, exportColumns)
+		if err == nil {
+			err = database.EachClient(r.Context(), filter, func(c models.Client) error {
+				return writer.WriteRow(exportRow(c)...)
+			})
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			// The status has been sent, so the truncated body is all the
+			// client will see; the log records why.
+			logging.FromContext(r.Context()).Error("failed to export clients", "format", format, "error", err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportClientsHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	hours := [2]time.Time{parseTime("09:00"), parseTime("17:00")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "a", Name: "Acme", Priority: 5, LeadCapacity: 100, CurrentLeadCount: 25, WorkingHours: hours},
+		{ID: "b", Name: "Beta", Priority: 1, LeadCapacity: 10, CurrentLeadCount: 10, WorkingHours: hours},
+	})
+
+	tests := []struct {
+		name                string
+		query               string
+		accept              string
+		expectedCode        int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "CSV by default",
+			expectedCode:        http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedBody: "id,name,priority,leadCapacity,currentLeadCount,utilization,workingHoursStart,workingHoursEnd\n" +
+				"a,Acme,5,100,25,0.25,09:00,17:00\n" +
+				"b,Beta,1,10,10,1,09:00,17:00\n",
+		},
+		{
+			name:                "NDJSON by Accept with filter",
+			query:               "?hasCapacity=false",
+			accept:              "application/x-ndjson",
+			expectedCode:        http.StatusOK,
+			expectedContentType: "application/x-ndjson",
+			expectedBody:        `{"id":"b","name":"Beta","priority":1,"leadCapacity":10,"currentLeadCount":10,"utilization":1,"workingHoursStart":"09:00","workingHoursEnd":"17:00"}` + "\n",
+		},
+		{
+			name:                "XLSX by format parameter",
+			query:               "?format=xlsx&minPriority=3",
+			expectedCode:        http.StatusOK,
+			expectedContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		},
+		{
+			name:         "Unsupported format",
+			query:        "?format=pdf",
+			expectedCode: http.StatusNotAcceptable,
+		},
+		{
+			name:         "Invalid filter",
+			query:        "?minPriority=high",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/clients/export"+tc.query, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rr := httptest.NewRecorder()
+			ExportClientsHandler(database).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tc.expectedContentType, rr.Header().Get("Content-Type"))
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetAllClientsHandlerFilters(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	hours := [2]time.Time{parseTime("09:00"), parseTime("17:00")}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "a", Name: "Acme North", Priority: 5, LeadCapacity: 100, WorkingHours: hours},
+		{ID: "b", Name: "Acme South", Priority: 1, LeadCapacity: 10, CurrentLeadCount: 10, WorkingHours: hours},
+		{ID: "c", Name: "100% Leads", Priority: 3, LeadCapacity: 10, WorkingHours: hours},
+	})
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode int
+		expectedIDs  []string
+	}{
+		{name: "No filter", expectedCode: http.StatusOK, expectedIDs: []string{"a", "b", "c"}},
+		{name: "Name is case-insensitive", query: "?name=acme", expectedCode: http.StatusOK, expectedIDs: []string{"a", "b"}},
+		{name: "Name wildcards are literal", query: "?name=0%25", expectedCode: http.StatusOK, expectedIDs: []string{"c"}},
+		{name: "Priority range", query: "?minPriority=2&maxPriority=4", expectedCode: http.StatusOK, expectedIDs: []string{"c"}},
+		{name: "With capacity", query: "?hasCapacity=true", expectedCode: http.StatusOK, expectedIDs: []string{"a", "c"}},
+		{name: "No match", query: "?name=zzz", expectedCode: http.StatusNotFound},
+		{name: "Invalid filter", query: "?hasCapacity=maybe", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/client/all"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			GetAllClientsHandler(database).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedCode == http.StatusOK {
+				var ids []string
+				for _, c := range decodeClients(t, rr) {
+					ids = append(ids, c.ID)
+				}
+				assert.Equal(t, tc.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func decodeClients(t *testing.T, rr *httptest.ResponseRecorder) []models.Client {
+	var clients []models.Client
+	if err := json.Unmarshal(rr.Body.Bytes(), &clients); err != nil {
+		t.Fatalf("Could not parse response: %v", err)
+	}
+	return clients
+}
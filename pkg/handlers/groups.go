@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"lead_management/pkg/db"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/models"
+	"lead_management/pkg/utils"
+	"net/http"
+	"strings"
+)
+
+// CreateGroupRequest is used to decode the JSON request payload.
+type CreateGroupRequest struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	ParentID         string `json:"parentId"`
+	Priority         int    `json:"priority"`
+	LeadCapacity     int    `json:"leadCapacity"`
+	CurrentLeadCount int    `json:"currentLeadCount"`
+	// Fallbacks are the IDs of the clients that receive the members'
+	// overflow, in order.
+	Fallbacks []string `json:"fallbacks"`
+}
+
+// group converts the request into a group with the given ID.
+func (req CreateGroupRequest) group(id string) (models.Group, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return models.Group{}, errors.New("Group name is required")
+	}
+	if req.LeadCapacity < 0 || req.CurrentLeadCount < 0 {
+		return models.Group{}, errors.New("Lead capacity and count must not be negative")
+	}
+	if err := db.CheckFallbacks("", req.Fallbacks); err != nil {
+		return models.Group{}, errors.New("Invalid " + err.Error())
+	}
+	return models.Group{
+		ID:               id,
+		Name:             req.Name,
+		ParentID:         req.ParentID,
+		Priority:         req.Priority,
+		LeadCapacity:     req.LeadCapacity,
+		CurrentLeadCount: req.CurrentLeadCount,
+		Fallbacks:        req.Fallbacks,
+	}, nil
+}
+
+// groupError answers the request for the group errors of the db package and
+// reports whether err was one of them.
+func groupError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, db.ErrGroupNotFound):
+		http.Error(w, "Parent group not found", http.StatusBadRequest)
+	case errors.Is(err, db.ErrGroupCycle):
+		http.Error(w, "Group cannot be nested within itself", http.StatusBadRequest)
+	case errors.Is(err, db.ErrGroupNotEmpty):
+		http.Error(w, "Group still has clients or subgroups", http.StatusConflict)
+	case errors.Is(err, db.ErrFallbackNotFound):
+		http.Error(w, "Fallback client not found", http.StatusBadRequest)
+	default:
+		return false
+	}
+	return true
+}
+
+// CreateGroupHandler handles the creation of a new client group.
+func CreateGroupHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req CreateGroupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		groupID := req.ID
+		if groupID == "" {
+			groupID = utils.GenerateUUID()
+		}
+		group, err := req.group(groupID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := database.CreateGroup(r.Context(), group); err != nil {
+			if groupError(w, err) {
+				return
+			}
+			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				http.Error(w, "Group ID already exists", http.StatusConflict)
+				return
+			}
+			logging.FromContext(r.Context()).Error("failed to create group", "error", err)
+			http.Error(w, "Failed to create group", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(group)
+	}
+}
+
+// GetAllGroupsHandler retrieves all client groups.
+func GetAllGroupsHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		groups, err := db.GetAllGroups(r.Context())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch groups", "error", err)
+			http.Error(w, "Failed to fetch groups", http.StatusInternalServerError)
+			return
+		}
+		if groups == nil {
+			groups = []models.Group{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(groups)
+	}
+}
+
+// GroupHandler serves a single group: GET retrieves it, PUT updates it and
+// DELETE removes it once it has no members.
+func GroupHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		logger := logging.FromContext(r.Context())
+		switch r.Method {
+		case "GET":
+			group, err := database.GetGroupByID(r.Context(), id)
+			if err != nil {
+				logger.Error("failed to fetch group", "id", id, "error", err)
+				http.Error(w, "Failed to fetch group", http.StatusInternalServerError)
+				return
+			}
+			if group == nil {
+				http.Error(w, "Group not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(group)
+		case "PUT":
+			var req CreateGroupRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+			group, err := req.group(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			found, err := database.UpdateGroup(r.Context(), group)
+			if groupError(w, err) {
+				return
+			}
+			if err != nil {
+				logger.Error("failed to update group", "id", id, "error", err)
+				http.Error(w, "Failed to update group", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Group not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(group)
+		case "DELETE":
+			found, err := database.DeleteGroup(r.Context(), id)
+			if groupError(w, err) {
+				return
+			}
+			if err != nil {
+				logger.Error("failed to delete group", "id", id, "error", err)
+				http.Error(w, "Failed to delete group", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Group not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// GroupReportHandler rolls up the clients of a group and its subgroups. On
+// /groups/report, without a group ID, it reports every top-level group.
+func GroupReportHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.PathValue("id")
+		reports, err := db.GroupReports(r.Context(), id)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to build group report", "id", id, "error", err)
+			http.Error(w, "Failed to build group report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if id == "" {
+			if reports == nil {
+				reports = []models.GroupReport{}
+			}
+			json.NewEncoder(w).Encode(reports)
+			return
+		}
+		if len(reports) == 0 {
+			http.Error(w, "Group not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(reports[0])
+	}
+}
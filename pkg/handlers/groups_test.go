@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGroupHandlers(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Create group",
+			method:       "POST",
+			url:          "/group/create",
+			body:         `{"id":"retail","name":"Retail","priority":1,"leadCapacity":50}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"retail","name":"Retail","priority":1,"leadCapacity":50,"currentLeadCount":0}`,
+		},
+		{
+			name:         "Create nested group",
+			method:       "POST",
+			url:          "/group/create",
+			body:         `{"id":"outlet","name":"Outlet","parentId":"branch"}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"outlet","name":"Outlet","parentId":"branch","priority":0,"leadCapacity":0,"currentLeadCount":0}`,
+		},
+		{
+			name:         "Unknown parent",
+			method:       "POST",
+			url:          "/group/create",
+			body:         `{"name":"Orphan","parentId":"missing"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Parent group not found",
+		},
+		{
+			name:         "Missing name",
+			method:       "POST",
+			url:          "/group/create",
+			body:         `{"id":"x"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Group name is required",
+		},
+		{
+			name:         "Duplicate ID",
+			method:       "POST",
+			url:          "/group/create",
+			body:         `{"id":"agency","name":"Again"}`,
+			expectedCode: http.StatusConflict,
+			expectedBody: "Group ID already exists",
+		},
+		{
+			name:         "Add client to group",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"c2","name":"Branch Client","leadCapacity":10,"workingHoursStart":"09:00","workingHoursEnd":"17:00","groupId":"branch"}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"c2","name":"Branch Client","priority":0,"leadCapacity":10,"currentLeadCount":0,
+				"workingHours":["0000-01-01T09:00:00Z","0000-01-01T17:00:00Z"],"version":1,"groupId":"branch","status":"active"}`,
+		},
+		{
+			name:         "Client in unknown group",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"c2","name":"Lost","workingHoursStart":"09:00","workingHoursEnd":"17:00","groupId":"missing"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Group not found",
+		},
+		{
+			name:         "Get group",
+			method:       "GET",
+			url:          "/group/branch",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"branch","name":"Branch","parentId":"agency","priority":0,"leadCapacity":0,"currentLeadCount":0}`,
+		},
+		{
+			name:         "Group not found",
+			method:       "GET",
+			url:          "/group/missing",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Group not found",
+		},
+		{
+			name:         "Nest group within itself",
+			method:       "PUT",
+			url:          "/group/agency",
+			body:         `{"name":"Agency","parentId":"branch"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Group cannot be nested within itself",
+		},
+		{
+			name:         "Update group",
+			method:       "PUT",
+			url:          "/group/agency",
+			body:         `{"name":"Agency","priority":3,"leadCapacity":8}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"agency","name":"Agency","priority":3,"leadCapacity":8,"currentLeadCount":0}`,
+		},
+		{
+			name:         "Report one group",
+			method:       "GET",
+			url:          "/group/agency/report",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"group":{"id":"agency","name":"Agency","priority":2,"leadCapacity":100,"currentLeadCount":0},
+				"clients":1,"clientCapacity":10,"clientLeadCount":4,"availableCapacity":6,"utilization":0,
+				"subgroups":[{"group":{"id":"branch","name":"Branch","parentId":"agency","priority":0,"leadCapacity":0,"currentLeadCount":0},
+					"clients":1,"clientCapacity":10,"clientLeadCount":4,"availableCapacity":6,"utilization":0.4,"subgroups":[]}]}`,
+		},
+		{
+			name:         "Report all groups",
+			method:       "GET",
+			url:          "/groups/report",
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"group":{"id":"agency","name":"Agency","priority":2,"leadCapacity":100,"currentLeadCount":0},
+				"clients":1,"clientCapacity":10,"clientLeadCount":4,"availableCapacity":6,"utilization":0,
+				"subgroups":[{"group":{"id":"branch","name":"Branch","parentId":"agency","priority":0,"leadCapacity":0,"currentLeadCount":0},
+					"clients":1,"clientCapacity":10,"clientLeadCount":4,"availableCapacity":6,"utilization":0.4,"subgroups":[]}]},
+				{"group":{"id":"spare","name":"Spare","priority":0,"leadCapacity":0,"currentLeadCount":0},
+					"clients":0,"clientCapacity":0,"clientLeadCount":0,"availableCapacity":0,"utilization":0,"subgroups":[]}]`,
+		},
+		{
+			name:         "Report unknown group",
+			method:       "GET",
+			url:          "/group/missing/report",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Group not found",
+		},
+		{
+			name:         "Delete group with members",
+			method:       "DELETE",
+			url:          "/group/branch",
+			expectedCode: http.StatusConflict,
+			expectedBody: "Group still has clients or subgroups",
+		},
+		{
+			name:         "Delete group without members",
+			method:       "DELETE",
+			url:          "/group/spare",
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Incorrect HTTP method",
+			method:       "PATCH",
+			url:          "/group/agency",
+			expectedCode: http.StatusMethodNotAllowed,
+			expectedBody: "Unsupported HTTP method",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := db.InitDB(":memory:")
+			defer database.Close()
+			setupGroupsDatabase(database)
+			mux := http.NewServeMux()
+			SetupRoutes(mux, database)
+
+			req, _ := http.NewRequest(tc.method, tc.url, bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			assertResponse(t, rr, tc.expectedCode, tc.expectedBody)
+		})
+	}
+}
+
+// Helper function to set up a capped agency group with a branch holding one
+// client, and an empty group
+func setupGroupsDatabase(database *db.DB) {
+	ctx := context.Background()
+	for _, g := range []models.Group{
+		{ID: "agency", Name: "Agency", Priority: 2, LeadCapacity: 100},
+		{ID: "branch", Name: "Branch", ParentID: "agency"},
+		{ID: "spare", Name: "Spare"},
+	} {
+		if err := database.CreateGroup(ctx, g); err != nil {
+			panic("Failed to setup database: " + err.Error())
+		}
+	}
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "c1", Name: "Branch Client", LeadCapacity: 10, CurrentLeadCount: 4, WorkingHours: [2]time.Time{parseTime("09:00"), parseTime("17:00")}, GroupID: "branch"},
+	})
+}
@@ -2,11 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"lead_management/pkg/db"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/metrics"
 	"lead_management/pkg/models"
+	"lead_management/pkg/rules"
+	"lead_management/pkg/tracing"
 	"lead_management/pkg/utils"
-	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -20,10 +26,84 @@ type CreateClientRequest struct {
 	CurrentLeadCount  int    `json:"currentLeadCount"`
 	WorkingHoursStart string `json:"workingHoursStart"`
 	WorkingHoursEnd   string `json:"workingHoursEnd"`
+	GroupID           string `json:"groupId"`
+	// Attributes holds custom attribute values by name.
+	Attributes map[string]any `json:"attributes"`
+	// Criteria restrict the leads the client accepts.
+	Criteria []models.Criterion `json:"criteria"`
+	// Rule is an eligibility rule, evaluated in Timezone.
+	Rule     string `json:"rule"`
+	Timezone string `json:"timezone"`
+	// Share is the client's target percentage of leads, from 0 to 100.
+	Share float64 `json:"share"`
+	// Pacing is even, front_loaded or curve, with 24 hourly weights in
+	// PacingCurve.
+	Pacing      string    `json:"pacing"`
+	PacingCurve []float64 `json:"pacingCurve"`
+	// ThroughputLimits cap the leads assigned within sliding windows.
+	ThroughputLimits []models.ThroughputLimit `json:"throughputLimits"`
+	// Status is active, paused or suspended. Updates without one keep the
+	// client's status.
+	Status       string `json:"status"`
+	StatusReason string `json:"statusReason"`
+	// Fallbacks are the IDs of the clients that receive the client's
+	// overflow, in order.
+	Fallbacks []string `json:"fallbacks"`
+}
+
+// client converts the request into a client with the given ID.
+func (req CreateClientRequest) client(id string) (models.Client, error) {
+	start, err := time.Parse("15:04", req.WorkingHoursStart)
+	if err != nil {
+		return models.Client{}, errors.New("Invalid working hours start time format")
+	}
+	end, err := time.Parse("15:04", req.WorkingHoursEnd)
+	if err != nil {
+		return models.Client{}, errors.New("Invalid working hours end time format")
+	}
+	if _, err := rules.Location(req.Timezone); err != nil {
+		return models.Client{}, errors.New("Invalid timezone")
+	}
+	if req.Share < 0 || req.Share > 100 {
+		return models.Client{}, errors.New("Share must be between 0 and 100")
+	}
+	if req.Status != "" && !slices.Contains(models.ClientStatuses, req.Status) {
+		return models.Client{}, errors.New("Invalid status")
+	}
+	client := models.Client{
+		ID:               id,
+		Name:             req.Name,
+		Priority:         req.Priority,
+		LeadCapacity:     req.LeadCapacity,
+		CurrentLeadCount: req.CurrentLeadCount,
+		WorkingHours:     [2]time.Time{start, end},
+		GroupID:          req.GroupID,
+		Attributes:       req.Attributes,
+		Criteria:         req.Criteria,
+		Rule:             req.Rule,
+		Timezone:         req.Timezone,
+		Share:            req.Share,
+		Pacing:           req.Pacing,
+		PacingCurve:      req.PacingCurve,
+		ThroughputLimits: req.ThroughputLimits,
+		Status:           req.Status,
+		StatusReason:     req.StatusReason,
+		Fallbacks:        req.Fallbacks,
+	}
+	if err := db.CheckPacing(client); err != nil {
+		return models.Client{}, errors.New("Invalid " + err.Error())
+	}
+	if err := db.CheckThroughput(client.ThroughputLimits); err != nil {
+		return models.Client{}, errors.New("Invalid " + err.Error())
+	}
+	if err := db.CheckFallbacks(id, client.Fallbacks); err != nil {
+		return models.Client{}, errors.New("Invalid " + err.Error())
+	}
+	return client, nil
 }
 
 // CreateClientHandler handles the creation of a new client.
-func CreateClientHandler(db *db.DB) http.HandlerFunc {
+func CreateClientHandler(database *db.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
@@ -36,70 +116,93 @@ func CreateClientHandler(db *db.DB) http.HandlerFunc {
 			return
 		}
 
-		start, err := time.Parse("15:04", req.WorkingHoursStart)
-		if err != nil {
-			http.Error(w, "Invalid working hours start time format", http.StatusBadRequest)
-			return
-		}
-		end, err := time.Parse("15:04", req.WorkingHoursEnd)
-		if err != nil {
-			http.Error(w, "Invalid working hours end time format", http.StatusBadRequest)
-			return
-		}
-
 		clientID := req.ID
 		if clientID == "" {
 			clientID = utils.GenerateUUID()
 		}
 
-		client := models.Client{
-			ID:               clientID,
-			Name:             req.Name,
-			Priority:         req.Priority,
-			LeadCapacity:     req.LeadCapacity,
-			CurrentLeadCount: req.CurrentLeadCount,
-			WorkingHours:     [2]time.Time{start, end},
+		client, err := req.client(clientID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		if err := db.CreateClient(client); err != nil {
+		if err := database.CreateClient(r.Context(), client); err != nil {
 			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
 				http.Error(w, "Client ID already exists", http.StatusConflict)
 				return
 			}
+			if errors.Is(err, db.ErrGroupNotFound) {
+				http.Error(w, "Group not found", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, db.ErrFallbackNotFound) {
+				http.Error(w, "Fallback client not found", http.StatusBadRequest)
+				return
+			}
+			if attributeError(w, err) || ruleError(w, err) {
+				return
+			}
+			logging.FromContext(r.Context()).Error("failed to create client", "error", err)
 			http.Error(w, "Failed to create client", http.StatusInternalServerError)
 			return
 		}
 
+		client.Version = 1
+		if client.Status == "" {
+			client.Status = models.ClientActive
+		}
+		w.Header().Set("ETag", clientETag(&client))
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(client)
 	}
 }
 
-// GetAllClientsHandler retrieves all client records from the database.
+// GetAllClientsHandler retrieves client records from the database,
+// optionally filtered by the minPriority, maxPriority, hasCapacity, name and
+// attr.<name> query parameters.
 func GetAllClientsHandler(db *db.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
 			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
 			return
 		}
-		clients, err := db.GetAllClients()
+		logger := logging.FromContext(r.Context())
+		defs, err := db.GetAttributeDefinitions(r.Context(), models.EntityClient)
+		if err != nil {
+			logger.Error("failed to fetch attribute definitions", "error", err)
+			http.Error(w, "Failed to fetch clients", http.StatusInternalServerError)
+			return
+		}
+		filter, err := clientFilter(r.URL.Query(), defs)
+		if attributeError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		clients, err := db.ListClients(r.Context(), filter)
 		if err != nil {
-			log.Printf("Error fetching clients: %v", err)
+			logger.Error("failed to fetch clients", "error", err)
 			http.Error(w, "Failed to fetch clients", http.StatusInternalServerError)
 			return
 		}
 		if len(clients) == 0 {
-			log.Println("No clients found in handler")
+			logger.Debug("no clients found")
 			http.Error(w, "No clients found", http.StatusNotFound)
 			return
 		}
-		log.Printf("Clients fetched in handler: %v", clients)
+		logger.Debug("clients fetched", "count", len(clients))
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(clients)
 	}
 }
 
-// GetClientByIDHandler retrieves a specific client by ID from the database.
+// GetClientByIDHandler retrieves a specific client by ID from the database,
+// with its version as the ETag. It answers 304 when the If-None-Match header
+// matches the ETag. With the asOf query parameter, an RFC 3339 timestamp, it
+// returns the state the client had at that time instead.
 func GetClientByIDHandler(db *db.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -107,8 +210,20 @@ func GetClientByIDHandler(db *db.DB) http.HandlerFunc {
 			return
 		}
 		id := strings.TrimPrefix(r.URL.Path, "/client/")
-		client, err := db.GetClientByID(id)
+		var client *models.Client
+		var err error
+		if v := r.URL.Query().Get("asOf"); v != "" {
+			asOf, perr := time.Parse(time.RFC3339Nano, v)
+			if perr != nil {
+				http.Error(w, "Invalid asOf timestamp", http.StatusBadRequest)
+				return
+			}
+			client, err = db.GetClientAsOf(r.Context(), id, asOf)
+		} else {
+			client, err = db.GetClientByID(r.Context(), id)
+		}
 		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch client", "id", id, "error", err)
 			http.Error(w, "Failed to fetch client", http.StatusInternalServerError)
 			return
 		}
@@ -116,10 +231,262 @@ func GetClientByIDHandler(db *db.DB) http.HandlerFunc {
 			http.Error(w, "Client not found", http.StatusNotFound)
 			return
 		}
+		if r.URL.Query().Get("asOf") == "" {
+			etag := clientETag(client)
+			w.Header().Set("ETag", etag)
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
 		json.NewEncoder(w).Encode(client)
 	}
 }
 
+// UpdateClientHandler replaces the details of an existing client. The
+// If-Match header must carry the client's current ETag, or "*" to update
+// whatever its version.
+func UpdateClientHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/client/")
+		version, ok := ifMatchVersion(w, r, database, id)
+		if !ok {
+			return
+		}
+
+		var req CreateClientRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		client, err := req.client(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client.Version = version
+		updated, err := database.UpdateClient(r.Context(), client)
+		if errors.Is(err, db.ErrVersionMismatch) {
+			http.Error(w, "Client has been modified", http.StatusPreconditionFailed)
+			return
+		}
+		if errors.Is(err, db.ErrGroupNotFound) {
+			http.Error(w, "Group not found", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, db.ErrFallbackNotFound) {
+			http.Error(w, "Fallback client not found", http.StatusBadRequest)
+			return
+		}
+		if attributeError(w, err) || ruleError(w, err) {
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to update client", "id", client.ID, "error", err)
+			http.Error(w, "Failed to update client", http.StatusInternalServerError)
+			return
+		}
+		if updated == nil {
+			http.Error(w, "Client not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", clientETag(updated))
+		json.NewEncoder(w).Encode(updated)
+	}
+}
+
+// DeleteClientHandler removes a client. Like updates, it requires an
+// If-Match header with the client's current ETag or "*".
+func DeleteClientHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/client/")
+		version, ok := ifMatchVersion(w, r, database, id)
+		if !ok {
+			return
+		}
+
+		found, err := database.DeleteClient(r.Context(), id, version)
+		if errors.Is(err, db.ErrVersionMismatch) {
+			http.Error(w, "Client has been modified", http.StatusPreconditionFailed)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to delete client", "id", id, "error", err)
+			http.Error(w, "Failed to delete client", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Client not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// clientETag returns the entity tag of a client's version.
+func clientETag(c *models.Client) string {
+	return `"` + strconv.Itoa(c.Version) + `"`
+}
+
+// ifMatchVersion returns the version of client id required by the If-Match
+// header, or 0 for "*". Of a list of tags, the one naming the client's
+// current version is required. If-Match uses the strong comparison, so weak
+// tags never match. If the header is missing or names no version it answers
+// the request and returns false.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request, database *db.DB, id string) (int, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		http.Error(w, "If-Match header required", http.StatusPreconditionRequired)
+		return 0, false
+	}
+	var versions []int
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return 0, true
+		}
+		if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+			continue
+		}
+		if version, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		http.Error(w, "Client has been modified", http.StatusPreconditionFailed)
+		return 0, false
+	}
+	if len(versions) > 1 {
+		client, err := database.GetClientByID(r.Context(), id)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch client", "id", id, "error", err)
+			http.Error(w, "Failed to fetch client", http.StatusInternalServerError)
+			return 0, false
+		}
+		if client != nil && slices.Contains(versions, client.Version) {
+			return client.Version, true
+		}
+	}
+	// The change itself is conditional on the version, and fails if it is
+	// not current.
+	return versions[0], true
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using
+// the weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientHandler serves a single client: GET retrieves it, PUT updates it and
+// DELETE removes it.
+func ClientHandler(db *db.DB) http.HandlerFunc {
+	get, update, remove := GetClientByIDHandler(db), UpdateClientHandler(db), DeleteClientHandler(db)
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PUT":
+			update(w, r)
+		case "DELETE":
+			remove(w, r)
+		default:
+			get(w, r)
+		}
+	}
+}
+
+// ClientHistoryHandler lists every recorded version of a client, oldest first.
+func ClientHistoryHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.PathValue("id")
+		versions, err := db.GetClientHistory(r.Context(), id)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch client history", "id", id, "error", err)
+			http.Error(w, "Failed to fetch client history", http.StatusInternalServerError)
+			return
+		}
+		if len(versions) == 0 {
+			http.Error(w, "Client not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(versions)
+	}
+}
+
+// ClientPacingHandler reports a paced client's progress through its current
+// working window.
+func ClientPacingHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.PathValue("id")
+		logger := logging.FromContext(r.Context())
+		client, err := db.GetClientByID(r.Context(), id)
+		if err != nil {
+			logger.Error("failed to fetch client", "id", id, "error", err)
+			http.Error(w, "Failed to fetch client pacing", http.StatusInternalServerError)
+			return
+		}
+		if client == nil {
+			http.Error(w, "Client not found", http.StatusNotFound)
+			return
+		}
+		pacing, err := db.Pacing(r.Context(), *client, time.Now().UTC())
+		if err != nil {
+			logger.Error("failed to fetch client pacing", "id", id, "error", err)
+			http.Error(w, "Failed to fetch client pacing", http.StatusInternalServerError)
+			return
+		}
+		if pacing == nil {
+			http.Error(w, "Client is not paced", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pacing)
+	}
+}
+
+// AvailabilityHandler reports how many leads each client can take right
+// now and what limits it.
+func AvailabilityHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		availability, err := db.Availability(r.Context(), time.Now().UTC())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch client availability", "error", err)
+			http.Error(w, "Failed to fetch client availability", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(availability)
+	}
+}
+
 // AssignLeadHandler determines the appropriate client for a lead.
 func AssignLeadHandler(db *db.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -127,11 +494,51 @@ func AssignLeadHandler(db *db.DB) http.HandlerFunc {
 			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
 			return
 		}
-		client, err := db.GetEligibleClient()
+		ctx, span := tracing.Start(r.Context(), "assign.find_eligible_client")
+		client, err := db.GetEligibleClient(ctx)
+		span.RecordError(err)
+		if client != nil {
+			span.SetAttribute("client.id", client.ID)
+		}
+		span.End()
 		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to find eligible client", "error", err)
+			http.Error(w, "No eligible client found", http.StatusNotFound)
+			return
+		}
+		if client == nil {
 			http.Error(w, "No eligible client found", http.StatusNotFound)
 			return
 		}
 		json.NewEncoder(w).Encode(client)
 	}
 }
+
+// MetricsHandler exposes application metrics in the Prometheus text format.
+// Client utilization and queue depth gauges are refreshed from the database
+// on every scrape.
+func MetricsHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		clients, err := db.GetAllClients(r.Context())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to refresh client utilization", "error", err)
+		} else {
+			metrics.ClientUtilization.Reset()
+			for _, c := range clients {
+				if c.LeadCapacity > 0 {
+					metrics.ClientUtilization.Set(float64(c.CurrentLeadCount)/float64(c.LeadCapacity), c.ID)
+				}
+			}
+		}
+		if queued, err := db.CountQueuedLeads(r.Context()); err != nil {
+			logging.FromContext(r.Context()).Error("failed to refresh pending queue depth", "error", err)
+		} else {
+			metrics.PendingQueueDepth.Set(float64(queued))
+		}
+		metrics.Default.Handler().ServeHTTP(w, r)
+	}
+}
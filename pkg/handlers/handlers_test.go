@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"lead_management/pkg/db"
+	"lead_management/pkg/metrics"
 	"lead_management/pkg/models"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -82,6 +85,7 @@ func TestCreateClientHandler(t *testing.T) {
 				}
 				assert.Equal(t, clientReq.Name, responseClient.Name)
 				assert.NotEmpty(t, responseClient.ID)
+				assert.Equal(t, models.ClientActive, responseClient.Status)
 			} else {
 				// Debugging output for non-201 responses
 				t.Logf("Response body: %s", rr.Body.String())
@@ -110,7 +114,7 @@ func TestGetAllClientsHandler(t *testing.T) {
 			method:       "GET",
 			expectedCode: http.StatusOK,
 			expectedData: []models.Client{
-				{ID: "1", Name: "Test Client", Priority: 1, LeadCapacity: 100, CurrentLeadCount: 50, WorkingHours: [2]time.Time{parseTime("09:00"), parseTime("17:00")}},
+				{ID: "1", Name: "Test Client", Priority: 1, LeadCapacity: 100, CurrentLeadCount: 50, WorkingHours: [2]time.Time{parseTime("09:00"), parseTime("17:00")}, Version: 1, Status: models.ClientActive},
 			},
 		},
 		{
@@ -161,7 +165,7 @@ func TestGetClientByIDHandler(t *testing.T) {
 			method:       "GET",
 			url:          "/client/1",
 			expectedCode: http.StatusOK,
-			expectedData: &models.Client{ID: "1", Name: "Test Client", Priority: 1, LeadCapacity: 100, CurrentLeadCount: 50, WorkingHours: [2]time.Time{parseTime("09:00"), parseTime("17:00")}},
+			expectedData: &models.Client{ID: "1", Name: "Test Client", Priority: 1, LeadCapacity: 100, CurrentLeadCount: 50, WorkingHours: [2]time.Time{parseTime("09:00"), parseTime("17:00")}, Version: 1, Status: models.ClientActive},
 		},
 		{
 			name:         "Client not found",
@@ -169,6 +173,25 @@ func TestGetClientByIDHandler(t *testing.T) {
 			url:          "/client/2",
 			expectedCode: http.StatusNotFound,
 		},
+		{
+			name:         "State as of now",
+			method:       "GET",
+			url:          "/client/1?asOf=" + time.Now().Add(time.Minute).UTC().Format(time.RFC3339),
+			expectedCode: http.StatusOK,
+			expectedData: &models.Client{ID: "1", Name: "Test Client", Priority: 1, LeadCapacity: 100, CurrentLeadCount: 50, WorkingHours: [2]time.Time{parseTime("09:00"), parseTime("17:00")}, Version: 1, Status: models.ClientActive},
+		},
+		{
+			name:         "State before creation",
+			method:       "GET",
+			url:          "/client/1?asOf=2020-01-01T00:00:00Z",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Invalid asOf",
+			method:       "GET",
+			url:          "/client/1?asOf=yesterday",
+			expectedCode: http.StatusBadRequest,
+		},
 		{
 			name:         "Incorrect HTTP method",
 			method:       "POST",
@@ -214,7 +237,7 @@ func TestAssignLeadHandler(t *testing.T) {
 			name:   "Successful assignment",
 			method: "GET",
 			setupData: func(db *db.DB) {
-				now := time.Now()
+				now := time.Now().UTC()
 				start := now.Add(-1 * time.Hour).Format("15:04")
 				end := now.Add(1 * time.Hour).Format("15:04")
 				setupEligibleClientsDatabase(db, []models.Client{
@@ -243,7 +266,9 @@ func TestAssignLeadHandler(t *testing.T) {
 				Priority:         10,
 				LeadCapacity:     100,
 				CurrentLeadCount: 20,
-				WorkingHours:     [2]time.Time{parseTime(time.Now().Add(-1 * time.Hour).Format("15:04")), parseTime(time.Now().Add(1 * time.Hour).Format("15:04"))},
+				WorkingHours:     [2]time.Time{parseTime(time.Now().UTC().Add(-1 * time.Hour).Format("15:04")), parseTime(time.Now().UTC().Add(1 * time.Hour).Format("15:04"))},
+				Version:          1,
+				Status:           models.ClientActive,
 			},
 		},
 		/*{
@@ -278,12 +303,17 @@ func TestAssignLeadHandler(t *testing.T) {
 			tc.setupData(database)
 
 			handler := AssignLeadHandler(database)
+			assigned := metrics.LeadAssignments.Value("1", metrics.OutcomeAssigned)
+			noEligible := metrics.NoEligibleClient.Value()
 
 			req, _ := http.NewRequest(tc.method, "/client/assign", nil)
 			rr := httptest.NewRecorder()
 			handler.ServeHTTP(rr, req)
 
 			assert.Equal(t, tc.expectedCode, rr.Code)
+			// Looking a client up assigns no lead, so it is not counted.
+			assert.Equal(t, assigned, metrics.LeadAssignments.Value("1", metrics.OutcomeAssigned))
+			assert.Equal(t, noEligible, metrics.NoEligibleClient.Value())
 
 			if tc.expectedCode == http.StatusOK {
 				var client models.Client
@@ -295,10 +325,96 @@ func TestAssignLeadHandler(t *testing.T) {
 	}
 }
 
+func TestMetricsHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+
+	setupDatabase(database)
+
+	tests := []struct {
+		name         string
+		method       string
+		expectedCode int
+		expectedBody []string
+	}{
+		{
+			name:         "Successful scrape",
+			method:       "GET",
+			expectedCode: http.StatusOK,
+			expectedBody: []string{
+				"# TYPE http_requests_total counter",
+				"# TYPE lead_assignments_total counter",
+				"# TYPE db_query_duration_seconds histogram",
+				"lead_pending_queue_depth 0",
+				`client_utilization_ratio{client="1"} 0.5`,
+			},
+		},
+		{
+			name:         "Incorrect HTTP method",
+			method:       "POST",
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := MetricsHandler(database)
+
+			req, _ := http.NewRequest(tc.method, "/metrics", nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			for _, line := range tc.expectedBody {
+				assert.Contains(t, rr.Body.String(), line)
+			}
+		})
+	}
+}
+
+// clockFields are the response fields set from the current time, which
+// assertResponse leaves out of the comparison.
+var clockFields = []string{"assignedAt", "receivedAt", "createdAt", "since", "until"}
+
+// assertResponse checks the status code of rr and its body, which must be
+// JSON equivalent to expectedBody, apart from clockFields, if that is a JSON
+// object or array and otherwise, as for error messages, equal to it.
+func assertResponse(t *testing.T, rr *httptest.ResponseRecorder, expectedCode int, expectedBody string) {
+	t.Helper()
+	assert.Equal(t, expectedCode, rr.Code, rr.Body.String())
+	if !strings.HasPrefix(expectedBody, "{") && !strings.HasPrefix(expectedBody, "[") {
+		assert.Equal(t, expectedBody, strings.TrimSuffix(rr.Body.String(), "\n"))
+		return
+	}
+	var expected, actual any
+	require.NoError(t, json.Unmarshal([]byte(expectedBody), &expected))
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &actual), rr.Body.String())
+	deleteClockFields(expected)
+	deleteClockFields(actual)
+	assert.Equal(t, expected, actual)
+}
+
+// deleteClockFields removes clockFields from a decoded JSON value.
+func deleteClockFields(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, f := range clockFields {
+			delete(v, f)
+		}
+		for _, e := range v {
+			deleteClockFields(e)
+		}
+	case []any:
+		for _, e := range v {
+			deleteClockFields(e)
+		}
+	}
+}
+
 // Helper function to set up the eligible clients database
 func setupEligibleClientsDatabase(database *db.DB, clients []models.Client) {
 	for _, client := range clients {
-		err := database.CreateClient(client)
+		err := database.CreateClient(context.Background(), client)
 		if err != nil {
 			panic("Failed to setup database: " + err.Error())
 		}
@@ -314,7 +430,7 @@ func setupDatabase(database *db.DB) {
 		CurrentLeadCount: 50,
 		WorkingHours:     [2]time.Time{parseTime("09:00"), parseTime("17:00")},
 	}
-	err := database.CreateClient(client)
+	err := database.CreateClient(context.Background(), client)
 	if err != nil {
 		panic("Failed to setup database: " + err.Error())
 	}
@@ -324,3 +440,448 @@ func parseTime(t string) time.Time {
 	parsedTime, _ := time.Parse("15:04", t)
 	return parsedTime
 }
+
+func TestUpdateClientHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	setupDatabase(database)
+
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+
+	tests := []struct {
+		name         string
+		url          string
+		ifMatch      string
+		body         string
+		expectedCode int
+		expectedETag string
+	}{
+		{
+			name:         "Missing If-Match",
+			url:          "/client/1",
+			body:         `{"name":"Renamed","priority":3,"leadCapacity":200,"currentLeadCount":50,"workingHoursStart":"08:00","workingHoursEnd":"18:00"}`,
+			expectedCode: http.StatusPreconditionRequired,
+		},
+		{
+			name:         "Stale If-Match",
+			url:          "/client/1",
+			ifMatch:      `"7"`,
+			body:         `{"name":"Renamed","priority":3,"leadCapacity":200,"currentLeadCount":50,"workingHoursStart":"08:00","workingHoursEnd":"18:00"}`,
+			expectedCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:         "Weak If-Match never matches",
+			url:          "/client/1",
+			ifMatch:      `W/"1"`,
+			body:         `{"name":"Renamed","priority":3,"leadCapacity":200,"currentLeadCount":50,"workingHoursStart":"08:00","workingHoursEnd":"18:00"}`,
+			expectedCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:         "Successful update",
+			url:          "/client/1",
+			ifMatch:      `"1"`,
+			body:         `{"name":"Renamed","priority":3,"leadCapacity":200,"currentLeadCount":50,"workingHoursStart":"08:00","workingHoursEnd":"18:00"}`,
+			expectedCode: http.StatusOK,
+			expectedETag: `"2"`,
+		},
+		{
+			name:         "Lost update is rejected",
+			url:          "/client/1",
+			ifMatch:      `"1"`,
+			body:         `{"name":"Overwritten","priority":1,"leadCapacity":10,"workingHoursStart":"08:00","workingHoursEnd":"18:00"}`,
+			expectedCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:         "Client not found",
+			url:          "/client/2",
+			ifMatch:      "*",
+			body:         `{"name":"Nobody","workingHoursStart":"08:00","workingHoursEnd":"18:00"}`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Invalid working hours",
+			url:          "/client/1",
+			ifMatch:      `"2"`,
+			body:         `{"name":"Renamed","workingHoursStart":"8am","workingHoursEnd":"18:00"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PUT", tc.url, bytes.NewBufferString(tc.body))
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedETag != "" {
+				assert.Equal(t, tc.expectedETag, rr.Header().Get("ETag"))
+			}
+		})
+	}
+
+	client, err := database.GetClientByID(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", client.Name)
+	assert.Equal(t, 200, client.LeadCapacity)
+	assert.Equal(t, 2, client.Version)
+}
+
+func TestUpdateClientHandlerAfterAssignment(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "1", Name: "Client", LeadCapacity: 10, WorkingHours: allDay()},
+	})
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+
+	req, _ := http.NewRequest("GET", "/client/1", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	etag := rr.Header().Get("ETag")
+	require.Equal(t, `"1"`, etag)
+
+	req, _ = http.NewRequest("POST", "/lead/create", bytes.NewBufferString(`{"id":"l1","name":"Ada"}`))
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	// The ETag read before the assignment is still current, and the update
+	// keeps the lead count.
+	req, _ = http.NewRequest("PUT", "/client/1", bytes.NewBufferString(`{"name":"Renamed","leadCapacity":20,"workingHoursStart":"00:00","workingHoursEnd":"23:59"}`))
+	req.Header.Set("If-Match", etag)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assertResponse(t, rr, http.StatusOK, `{"id":"1","name":"Renamed","priority":0,"leadCapacity":20,"currentLeadCount":1,
+		"workingHours":["0000-01-01T00:00:00Z","0000-01-01T23:59:00Z"],"version":2,"status":"active"}`)
+	assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "1", Name: "Client", LeadCapacity: 10, WorkingHours: allDay()},
+	})
+
+	tests := []struct {
+		name            string
+		ifMatch         string
+		expectedOK      bool
+		expectedVersion int
+		expectedCode    int
+	}{
+		{name: "Missing", expectedCode: http.StatusPreconditionRequired},
+		{name: "Any version", ifMatch: "*", expectedOK: true},
+		{name: "One tag", ifMatch: `"3"`, expectedOK: true, expectedVersion: 3},
+		{name: "List with the current tag", ifMatch: `"3", "1"`, expectedOK: true, expectedVersion: 1},
+		{name: "List with a weak current tag", ifMatch: `W/"1", "2"`, expectedOK: true, expectedVersion: 2},
+		{name: "Weak tag", ifMatch: `W/"1"`, expectedCode: http.StatusPreconditionFailed},
+		{name: "Malformed tag", ifMatch: "1", expectedCode: http.StatusPreconditionFailed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PUT", "/client/1", nil)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			rr := httptest.NewRecorder()
+			version, ok := ifMatchVersion(rr, req, database, "1")
+
+			assert.Equal(t, tc.expectedOK, ok)
+			assert.Equal(t, tc.expectedVersion, version)
+			if !tc.expectedOK {
+				assert.Equal(t, tc.expectedCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestGetClientByIDHandlerConditional(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	setupDatabase(database)
+
+	tests := []struct {
+		name         string
+		ifNoneMatch  string
+		expectedCode int
+	}{
+		{name: "No condition", expectedCode: http.StatusOK},
+		{name: "Current ETag", ifNoneMatch: `"1"`, expectedCode: http.StatusNotModified},
+		{name: "Weak current ETag", ifNoneMatch: `W/"1"`, expectedCode: http.StatusNotModified},
+		{name: "Any of several ETags", ifNoneMatch: `"3", "1"`, expectedCode: http.StatusNotModified},
+		{name: "Wildcard", ifNoneMatch: "*", expectedCode: http.StatusNotModified},
+		{name: "Stale ETag", ifNoneMatch: `"0"`, expectedCode: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/client/1", nil)
+			if tc.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			rr := httptest.NewRecorder()
+			GetClientByIDHandler(database).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+			if tc.expectedCode == http.StatusNotModified {
+				assert.Empty(t, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeleteClientHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	setupDatabase(database)
+
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+
+	tests := []struct {
+		name         string
+		url          string
+		ifMatch      string
+		expectedCode int
+	}{
+		{name: "Missing If-Match", url: "/client/1", expectedCode: http.StatusPreconditionRequired},
+		{name: "Stale If-Match", url: "/client/1", ifMatch: `"2"`, expectedCode: http.StatusPreconditionFailed},
+		{name: "Successful deletion", url: "/client/1", ifMatch: `"1"`, expectedCode: http.StatusNoContent},
+		{name: "Client already deleted", url: "/client/1", ifMatch: "*", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("DELETE", tc.url, nil)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+		})
+	}
+
+	client, err := database.GetClientByID(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Nil(t, client)
+}
+
+func TestClientHistoryHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+	setupDatabase(database)
+
+	client := models.Client{ID: "1", Name: "Renamed Client", Priority: 3, LeadCapacity: 100, CurrentLeadCount: 50, WorkingHours: [2]time.Time{parseTime("09:00"), parseTime("17:00")}}
+	_, err := database.UpdateClient(context.Background(), client)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		expectedCode  int
+		expectedNames []string
+	}{
+		{name: "Every version", method: "GET", url: "/client/1/history", expectedCode: http.StatusOK, expectedNames: []string{"Test Client", "Renamed Client"}},
+		{name: "Client not found", method: "GET", url: "/client/2/history", expectedCode: http.StatusNotFound},
+		{name: "Incorrect HTTP method", method: "POST", url: "/client/1/history", expectedCode: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, tc.url, nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedCode == http.StatusOK {
+				var versions []models.ClientVersion
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &versions))
+				var names []string
+				for _, v := range versions {
+					names = append(names, v.Client.Name)
+				}
+				assert.Equal(t, tc.expectedNames, names)
+				assert.Equal(t, models.OperationUpdate, versions[1].Operation)
+			}
+		})
+	}
+}
+
+func TestClientPacingHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+	setupDatabase(database)
+
+	curve := `[0,0,0,0,0,0,0,0,0,4,3,2,1,1,1,1,1,0,0,0,0,0,0,0]`
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		body         string
+		expectedCode int
+		expectedMode string
+	}{
+		{name: "Create evenly paced client", method: "POST", url: "/client/create", body: `{"id":"even","name":"Even","leadCapacity":50,"workingHoursStart":"09:00","workingHoursEnd":"17:00","pacing":"even"}`, expectedCode: http.StatusCreated},
+		{name: "Create client paced by curve", method: "POST", url: "/client/create", body: `{"id":"curve","name":"Curve","leadCapacity":50,"workingHoursStart":"09:00","workingHoursEnd":"17:00","pacing":"curve","pacingCurve":` + curve + `}`, expectedCode: http.StatusCreated},
+		{name: "Unknown pacing mode", method: "POST", url: "/client/create", body: `{"name":"Fast","workingHoursStart":"09:00","workingHoursEnd":"17:00","pacing":"fast"}`, expectedCode: http.StatusBadRequest},
+		{name: "Curve mode without curve", method: "POST", url: "/client/create", body: `{"name":"Flat","workingHoursStart":"09:00","workingHoursEnd":"17:00","pacing":"curve"}`, expectedCode: http.StatusBadRequest},
+		{name: "Even pacing", method: "GET", url: "/client/even/pacing", expectedCode: http.StatusOK, expectedMode: models.PacingEven},
+		{name: "Curve pacing", method: "GET", url: "/client/curve/pacing", expectedCode: http.StatusOK, expectedMode: models.PacingCurve},
+		{name: "Client not paced", method: "GET", url: "/client/1/pacing", expectedCode: http.StatusNotFound},
+		{name: "Client not found", method: "GET", url: "/client/missing/pacing", expectedCode: http.StatusNotFound},
+		{name: "Incorrect HTTP method", method: "POST", url: "/client/even/pacing", expectedCode: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, tc.url, bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code, rr.Body.String())
+			if tc.expectedMode != "" {
+				var pacing models.Pacing
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &pacing))
+				assert.Equal(t, tc.expectedMode, pacing.Mode)
+				assert.Equal(t, 50, pacing.Budget)
+			}
+		})
+	}
+}
+
+func TestAvailabilityHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		body         string
+		expectedCode int
+	}{
+		{name: "Create client with throughput limits", method: "POST", url: "/client/create", body: `{"id":"a","name":"A","leadCapacity":50,"workingHoursStart":"00:00","workingHoursEnd":"23:59","throughputLimits":[{"maxLeads":10,"per":"1h"},{"maxLeads":2,"per":"5m"}]}`, expectedCode: http.StatusCreated},
+		{name: "Zero maxLeads", method: "POST", url: "/client/create", body: `{"name":"B","workingHoursStart":"00:00","workingHoursEnd":"23:59","throughputLimits":[{"maxLeads":0,"per":"1h"}]}`, expectedCode: http.StatusBadRequest},
+		{name: "Invalid window", method: "POST", url: "/client/create", body: `{"name":"B","workingHoursStart":"00:00","workingHoursEnd":"23:59","throughputLimits":[{"maxLeads":5,"per":"hourly"}]}`, expectedCode: http.StatusBadRequest},
+		{name: "Availability", method: "GET", url: "/clients/availability", expectedCode: http.StatusOK},
+		{name: "Incorrect HTTP method", method: "POST", url: "/clients/availability", expectedCode: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, tc.url, bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code, rr.Body.String())
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/clients/availability", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	var availability []models.Availability
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &availability))
+	require.Len(t, availability, 1)
+	assert.Equal(t, 2, availability[0].Available)
+	assert.Equal(t, models.LimitThroughput, availability[0].LimitedBy)
+	assert.Len(t, availability[0].Throughput, 2)
+}
+
+func TestFallbackHandlers(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Create client with fallback",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"other","name":"Other","leadCapacity":10,"workingHoursStart":"00:00","workingHoursEnd":"23:59","fallbacks":["partner"]}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"other","name":"Other","priority":0,"leadCapacity":10,"currentLeadCount":0,
+				"workingHours":["0000-01-01T00:00:00Z","0000-01-01T23:59:00Z"],"version":1,"status":"active","fallbacks":["partner"]}`,
+		},
+		{
+			name:         "Unknown fallback",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"other","name":"Other","workingHoursStart":"00:00","workingHoursEnd":"23:59","fallbacks":["missing"]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Fallback client not found",
+		},
+		{
+			name:         "Fallback to itself",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"other","name":"Other","workingHoursStart":"00:00","workingHoursEnd":"23:59","fallbacks":["other"]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid fallbacks must not contain the client itself",
+		},
+		{
+			name:         "Create group with fallback",
+			method:       "POST",
+			url:          "/group/create",
+			body:         `{"id":"g","name":"Agency","fallbacks":["partner"]}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"g","name":"Agency","priority":0,"leadCapacity":0,"currentLeadCount":0,"fallbacks":["partner"]}`,
+		},
+		{
+			name:         "Group with unknown fallback",
+			method:       "POST",
+			url:          "/group/create",
+			body:         `{"id":"h","name":"Agency","fallbacks":["missing"]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Fallback client not found",
+		},
+		{
+			name:         "Assign overflow",
+			method:       "POST",
+			url:          "/lead/create",
+			body:         `{"id":"l1","name":"Ada"}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"l1","name":"Ada","email":"","phone":"","status":"assigned","clientId":"partner","fallbackFrom":"premium","fallbackStep":1}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := db.InitDB(":memory:")
+			defer database.Close()
+			setupEligibleClientsDatabase(database, []models.Client{
+				{ID: "partner", Name: "Partner", LeadCapacity: 10, WorkingHours: allDay()},
+				{ID: "premium", Name: "Premium", Priority: 10, LeadCapacity: 10, WorkingHours: [2]time.Time{parseTime("00:00"), parseTime("00:00")}, Fallbacks: []string{"partner"}},
+			})
+			mux := http.NewServeMux()
+			SetupRoutes(mux, database)
+
+			req, _ := http.NewRequest(tc.method, tc.url, bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			assertResponse(t, rr, tc.expectedCode, tc.expectedBody)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"lead_management/pkg/health"
+	"net/http"
+)
+
+// LivenessHandler reports that the process is up and able to serve requests.
+func LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": health.StatusOK})
+	}
+}
+
+// ReadinessHandler runs the checker and reports a per-check breakdown.
+// It answers 503 when any check fails, including while the server drains.
+func ReadinessHandler(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		report := checker.Check(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
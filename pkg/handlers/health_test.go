@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/health"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLivenessHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		expectedCode int
+	}{
+		{name: "Alive", method: "GET", expectedCode: http.StatusOK},
+		{name: "Incorrect HTTP method", method: "POST", expectedCode: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, "/healthz", nil)
+			rr := httptest.NewRecorder()
+			LivenessHandler().ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+		})
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		closeDB        bool
+		drain          bool
+		expectedCode   int
+		expectedChecks map[string]string
+	}{
+		{
+			name:           "Ready",
+			method:         "GET",
+			expectedCode:   http.StatusOK,
+			expectedChecks: map[string]string{"database": health.StatusOK, "schema": health.StatusOK, "shutdown": health.StatusOK},
+		},
+		{
+			name:           "Database unavailable",
+			method:         "GET",
+			closeDB:        true,
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"database": health.StatusFail, "schema": health.StatusFail, "shutdown": health.StatusOK},
+		},
+		{
+			name:           "Draining",
+			method:         "GET",
+			drain:          true,
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"database": health.StatusOK, "schema": health.StatusOK, "shutdown": health.StatusFail},
+		},
+		{
+			name:         "Incorrect HTTP method",
+			method:       "POST",
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := db.InitDB(":memory:")
+			defer database.Close()
+
+			checker := health.NewChecker()
+			checker.AddCheck("database", database.Ping)
+			checker.AddCheck("schema", database.CheckSchema)
+			if tc.closeDB {
+				database.Close()
+			}
+			if tc.drain {
+				checker.SetDraining()
+			}
+
+			req, _ := http.NewRequest(tc.method, "/readyz", nil)
+			rr := httptest.NewRecorder()
+			ReadinessHandler(checker).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedChecks == nil {
+				return
+			}
+			var report health.Report
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+			for name, status := range tc.expectedChecks {
+				assert.Equal(t, status, report.Checks[name].Status, name)
+			}
+		})
+	}
+}
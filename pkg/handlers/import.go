@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"lead_management/pkg/attributes"
+	"lead_management/pkg/db"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/models"
+	"lead_management/pkg/rules"
+	"lead_management/pkg/utils"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RowError describes why one imported row is invalid. Row is the 1-based
+// line number for CSV (the header is line 1) or the 1-based array index for JSON.
+type RowError struct {
+	Row     int    `json:"row"`
+	ID      string `json:"id,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportResponse is the result of a client import.
+type ImportResponse struct {
+	DryRun  bool       `json:"dryRun"`
+	Created int        `json:"created"`
+	Updated int        `json:"updated"`
+	Errors  []RowError `json:"errors"`
+}
+
+// importRow is a parsed row with its position in the upload.
+type importRow struct {
+	row int
+	req CreateClientRequest
+	// numbers holds the unparsed number cells of a CSV row by field.
+	numbers map[string]string
+	// attrs holds the unparsed attribute cells of a CSV row by name.
+	attrs map[string]string
+}
+
+// importFields maps lower-cased CSV column names to client fields.
+var importFields = map[string]string{
+	"id":                "id",
+	"name":              "name",
+	"priority":          "priority",
+	"leadcapacity":      "leadCapacity",
+	"currentleadcount":  "currentLeadCount",
+	"workinghoursstart": "workingHoursStart",
+	"workinghoursend":   "workingHoursEnd",
+	"groupid":           "groupId",
+	"rule":              "rule",
+	"timezone":          "timezone",
+	"share":             "share",
+	"pacing":            "pacing",
+	"pacingcurve":       "pacingCurve",
+	"throughputlimits":  "throughputLimits",
+	"status":            "status",
+	"statusreason":      "statusReason",
+	"fallbacks":         "fallbacks",
+}
+
+// ImportClientsHandler creates clients in bulk from a CSV file (Content-Type
+// text/csv) or a JSON array of client objects. Every row is validated and the
+// import is applied in one transaction only if all rows are valid. Query
+// parameters:
+//   - dryRun=true validates and reports without writing
+//   - mode=upsert updates clients whose ID exists instead of rejecting them
+//   - map=column:field,... maps CSV columns to client fields when the header
+//     does not use the field names
+//
+// CSV columns named attr.<name> hold custom attribute values.
+func ImportClientsHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		dryRun, _ := strconv.ParseBool(query.Get("dryRun"))
+		mode := query.Get("mode")
+		if mode != "" && mode != "insert" && mode != "upsert" {
+			http.Error(w, "mode must be insert or upsert", http.StatusBadRequest)
+			return
+		}
+
+		var rows []importRow
+		var err error
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			rows, err = parseCSVImport(r.Body, query.Get("map"))
+		case "application/json", "":
+			rows, err = parseJSONImport(r.Body)
+		default:
+			http.Error(w, "Content-Type must be text/csv or application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		defs, err := database.GetAttributeDefinitions(r.Context(), models.EntityClient)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch attribute definitions", "error", err)
+			http.Error(w, "Failed to import clients", http.StatusInternalServerError)
+			return
+		}
+
+		resp := ImportResponse{DryRun: dryRun, Errors: []RowError{}}
+		clients := make([]models.Client, 0, len(rows))
+		seen := make(map[string]int)
+		for _, row := range rows {
+			client, rowErr := validateImportRow(row, defs)
+			if rowErr == nil && client.ID != "" {
+				if first, ok := seen[client.ID]; ok {
+					rowErr = &RowError{Row: row.row, ID: client.ID, Field: "id", Message: fmt.Sprintf("duplicate of row %d", first)}
+				}
+				seen[client.ID] = row.row
+			}
+			if rowErr != nil {
+				resp.Errors = append(resp.Errors, *rowErr)
+				continue
+			}
+			if client.ID == "" {
+				client.ID = utils.GenerateUUID()
+			}
+			clients = append(clients, client)
+		}
+		if len(resp.Errors) > 0 {
+			writeImportResponse(w, http.StatusUnprocessableEntity, resp)
+			return
+		}
+
+		result, err := database.ImportClients(r.Context(), clients, db.ImportOptions{Upsert: mode == "upsert", DryRun: dryRun})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to import clients", "error", err)
+			http.Error(w, "Failed to import clients", http.StatusInternalServerError)
+			return
+		}
+		for _, i := range result.Conflicts {
+			resp.Errors = append(resp.Errors, RowError{Row: rows[i].row, ID: clients[i].ID, Field: "id", Message: "client already exists"})
+		}
+		if len(resp.Errors) > 0 {
+			writeImportResponse(w, http.StatusConflict, resp)
+			return
+		}
+		for _, rejected := range result.Rejected {
+			rowErr := RowError{Row: rows[rejected.Index].row, ID: clients[rejected.Index].ID, Field: "groupId", Message: "group does not exist"}
+			var attrErr *attributes.Error
+			var ruleErr *rules.Error
+			if errors.Is(rejected.Err, db.ErrFallbackNotFound) {
+				rowErr.Field, rowErr.Message = "fallbacks", "client does not exist"
+			} else if errors.As(rejected.Err, &attrErr) {
+				rowErr.Field, rowErr.Message = "attributes."+attrErr.Attribute, attrErr.Message
+			} else if errors.As(rejected.Err, &ruleErr) {
+				rowErr.Field, rowErr.Message = "rule", ruleErr.Error()
+			}
+			resp.Errors = append(resp.Errors, rowErr)
+		}
+		if len(resp.Errors) > 0 {
+			writeImportResponse(w, http.StatusUnprocessableEntity, resp)
+			return
+		}
+
+		resp.Created, resp.Updated = result.Created, result.Updated
+		status := http.StatusOK
+		if !dryRun && resp.Created > 0 {
+			status = http.StatusCreated
+		}
+		writeImportResponse(w, status, resp)
+	}
+}
+
+func writeImportResponse(w http.ResponseWriter, status int, resp ImportResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseJSONImport reads a JSON array of client objects.
+func parseJSONImport(body io.Reader) ([]importRow, error) {
+	var reqs []CreateClientRequest
+	if err := json.NewDecoder(body).Decode(&reqs); err != nil {
+		return nil, errors.New("Invalid request payload: expected a JSON array of clients")
+	}
+	rows := make([]importRow, len(reqs))
+	for i, req := range reqs {
+		rows[i] = importRow{row: i + 1, req: req}
+	}
+	return rows, nil
+}
+
+// parseCSVImport reads a CSV file whose header names the client fields,
+// either directly (case-insensitively) or through mapping, given as
+// "column:field,...". Number cells are kept unparsed so that invalid ones
+// are reported as row errors by validateImportRow.
+func parseCSVImport(body io.Reader, mapping string) ([]importRow, error) {
+	columns := make(map[string]string)
+	for _, pair := range strings.Split(mapping, ",") {
+		if pair == "" {
+			continue
+		}
+		i := strings.LastIndex(pair, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("Invalid map entry %q: expected column:field", pair)
+		}
+		field, ok := importFields[strings.ToLower(strings.TrimSpace(pair[i+1:]))]
+		if !ok {
+			return nil, fmt.Errorf("Invalid map entry %q: unknown field", pair)
+		}
+		columns[strings.ToLower(strings.TrimSpace(pair[:i]))] = field
+	}
+
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("Invalid CSV: missing header row")
+	}
+	fields := make([]string, len(header))
+	for i, column := range header {
+		key := strings.ToLower(strings.TrimSpace(column))
+		if field, ok := columns[key]; ok {
+			fields[i] = field
+		} else if strings.HasPrefix(key, attributePrefix) {
+			// Attribute names are case-sensitive, so keep the column's case.
+			fields[i] = attributePrefix + strings.TrimSpace(column)[len(attributePrefix):]
+		} else if field, ok := importFields[key]; ok {
+			fields[i] = field
+		} else {
+			return nil, fmt.Errorf("Unknown CSV column %q", column)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		row := importRow{row: line}
+		values := make(map[string]string, len(record))
+		for i, value := range record {
+			values[fields[i]] = strings.TrimSpace(value)
+		}
+		row.req = CreateClientRequest{
+			ID:                values["id"],
+			Name:              values["name"],
+			WorkingHoursStart: values["workingHoursStart"],
+			WorkingHoursEnd:   values["workingHoursEnd"],
+			GroupID:           values["groupId"],
+			Rule:              values["rule"],
+			Timezone:          values["timezone"],
+			Pacing:            values["pacing"],
+			Status:            values["status"],
+			StatusReason:      values["statusReason"],
+			Fallbacks:         strings.Fields(values["fallbacks"]),
+		}
+		row.numbers = map[string]string{
+			"priority":         values["priority"],
+			"leadCapacity":     values["leadCapacity"],
+			"currentLeadCount": values["currentLeadCount"],
+			"share":            values["share"],
+			"pacingCurve":      values["pacingCurve"],
+			"throughputLimits": values["throughputLimits"],
+		}
+		for field, value := range values {
+			if name, ok := strings.CutPrefix(field, attributePrefix); ok && value != "" {
+				if row.attrs == nil {
+					row.attrs = make(map[string]string)
+				}
+				row.attrs[name] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// validateImportRow converts a row into a client, or describes the first
+// problem with it. The attributes of CSV rows are typed using defs; all
+// attributes are checked against their definitions on import.
+func validateImportRow(row importRow, defs []models.AttributeDefinition) (models.Client, *RowError) {
+	req := row.req
+	fail := func(field, message string) (models.Client, *RowError) {
+		return models.Client{}, &RowError{Row: row.row, ID: req.ID, Field: field, Message: message}
+	}
+
+	for _, field := range []string{"priority", "leadCapacity", "currentLeadCount"} {
+		value := row.numbers[field]
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fail(field, "must be a whole number")
+		}
+		switch field {
+		case "priority":
+			req.Priority = n
+		case "leadCapacity":
+			req.LeadCapacity = n
+		case "currentLeadCount":
+			req.CurrentLeadCount = n
+		}
+	}
+	if value := row.numbers["share"]; value != "" {
+		share, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fail("share", "must be a number")
+		}
+		req.Share = share
+	}
+	for _, value := range strings.Fields(row.numbers["pacingCurve"]) {
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fail("pacingCurve", "must be numbers separated by spaces")
+		}
+		req.PacingCurve = append(req.PacingCurve, weight)
+	}
+	for _, value := range strings.Fields(row.numbers["throughputLimits"]) {
+		// Limits are written as maxLeads/per, e.g. 10/1h.
+		n, per, _ := strings.Cut(value, "/")
+		maxLeads, err := strconv.Atoi(n)
+		if err != nil {
+			return fail("throughputLimits", "must be limits such as 10/1h separated by spaces")
+		}
+		req.ThroughputLimits = append(req.ThroughputLimits, models.ThroughputLimit{MaxLeads: maxLeads, Per: per})
+	}
+
+	names := make([]string, 0, len(row.attrs))
+	for name := range row.attrs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		value, err := parseAttribute(defs, name, row.attrs[name])
+		var attrErr *attributes.Error
+		if errors.As(err, &attrErr) {
+			return fail("attributes."+name, attrErr.Message)
+		}
+		if req.Attributes == nil {
+			req.Attributes = make(map[string]any)
+		}
+		req.Attributes[name] = value
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		return fail("name", "is required")
+	}
+	if req.LeadCapacity < 0 {
+		return fail("leadCapacity", "must not be negative")
+	}
+	if req.CurrentLeadCount < 0 || req.CurrentLeadCount > req.LeadCapacity {
+		return fail("currentLeadCount", "must be between 0 and leadCapacity")
+	}
+	if _, err := time.Parse("15:04", req.WorkingHoursStart); err != nil {
+		return fail("workingHoursStart", "must be a time formatted as HH:MM")
+	}
+	if _, err := time.Parse("15:04", req.WorkingHoursEnd); err != nil {
+		return fail("workingHoursEnd", "must be a time formatted as HH:MM")
+	}
+	if _, err := rules.Location(req.Timezone); err != nil {
+		return fail("timezone", "must be an IANA time zone such as Europe/Berlin")
+	}
+	if req.Share < 0 || req.Share > 100 {
+		return fail("share", "must be between 0 and 100")
+	}
+	if err := db.CheckThroughput(req.ThroughputLimits); err != nil {
+		return fail("throughputLimits", err.Error())
+	}
+	if req.Status != "" && !slices.Contains(models.ClientStatuses, req.Status) {
+		return fail("status", "must be active, paused or suspended")
+	}
+	if err := db.CheckFallbacks(req.ID, req.Fallbacks); err != nil {
+		return fail("fallbacks", err.Error())
+	}
+	client, err := req.client(req.ID)
+	if err != nil {
+		// Only the pacing is left to check.
+		return fail("pacing", strings.TrimPrefix(err.Error(), "Invalid "))
+	}
+	return client, nil
+}
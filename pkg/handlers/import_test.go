@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lead_management/pkg/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportClientsHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		contentType     string
+		body            string
+		expectedCode    int
+		expectedCreated int
+		expectedUpdated int
+		expectedErrors  []RowError
+		expectedClients int
+	}{
+		{
+			name:        "CSV with header mapping",
+			query:       "?map=Agency:name,Cap:leadCapacity",
+			contentType: "text/csv",
+			body: "id,Agency,priority,Cap,workingHoursStart,workingHoursEnd\n" +
+				"a,Agency A,5,100,09:00,17:00\n" +
+				"b,Agency B,3,50,08:00,16:00\n",
+			expectedCode:    http.StatusCreated,
+			expectedCreated: 2,
+			expectedClients: 3,
+		},
+		{
+			name:        "JSON array with upsert",
+			query:       "?mode=upsert",
+			contentType: "application/json",
+			body: `[{"id":"1","name":"Renamed","priority":2,"leadCapacity":100,"currentLeadCount":50,"workingHoursStart":"09:00","workingHoursEnd":"17:00"},
+				{"name":"New","leadCapacity":10,"workingHoursStart":"09:00","workingHoursEnd":"17:00"}]`,
+			expectedCode:    http.StatusCreated,
+			expectedCreated: 1,
+			expectedUpdated: 1,
+			expectedClients: 2,
+		},
+		{
+			name:            "Dry run writes nothing",
+			query:           "?dryRun=true",
+			contentType:     "application/json",
+			body:            `[{"id":"x","name":"New","leadCapacity":10,"workingHoursStart":"09:00","workingHoursEnd":"17:00"}]`,
+			expectedCode:    http.StatusOK,
+			expectedCreated: 1,
+			expectedClients: 1,
+		},
+		{
+			name:        "Row errors reject the whole import",
+			contentType: "text/csv",
+			body: "id,name,leadCapacity,workingHoursStart,workingHoursEnd\n" +
+				"a,Good,10,09:00,17:00\n" +
+				"b,,10,09:00,17:00\n" +
+				"c,Bad Capacity,ten,09:00,17:00\n" +
+				"d,Bad Hours,10,9am,17:00\n" +
+				"a,Duplicate,10,09:00,17:00\n",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErrors: []RowError{
+				{Row: 3, ID: "b", Field: "name", Message: "is required"},
+				{Row: 4, ID: "c", Field: "leadCapacity", Message: "must be a whole number"},
+				{Row: 5, ID: "d", Field: "workingHoursStart", Message: "must be a time formatted as HH:MM"},
+				{Row: 6, ID: "a", Field: "id", Message: "duplicate of row 2"},
+			},
+			expectedClients: 1,
+		},
+		{
+			name:        "CSV with shares and pacing",
+			contentType: "text/csv",
+			body: "id,name,leadCapacity,workingHoursStart,workingHoursEnd,share,pacing,pacingCurve\n" +
+				"a,Even,10,09:00,17:00,30,even,\n" +
+				"b,Curve,10,09:00,17:00,70,curve,0 0 0 0 0 0 0 0 0 1 1 1 1 1 1 1 1 0 0 0 0 0 0 0\n" +
+				"c,Short Curve,10,09:00,17:00,,curve,1 2 3\n" +
+				"d,Big Share,10,09:00,17:00,150,,\n",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErrors: []RowError{
+				{Row: 4, ID: "c", Field: "pacing", Message: "pacingCurve must have 24 hourly weights"},
+				{Row: 5, ID: "d", Field: "share", Message: "must be between 0 and 100"},
+			},
+			expectedClients: 1,
+		},
+		{
+			name:        "CSV with statuses",
+			contentType: "text/csv",
+			body: "id,name,leadCapacity,workingHoursStart,workingHoursEnd,status,statusReason\n" +
+				"a,Paused,10,09:00,17:00,paused,vacation\n" +
+				"b,Unknown,10,09:00,17:00,asleep,\n",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErrors: []RowError{
+				{Row: 3, ID: "b", Field: "status", Message: "must be active, paused or suspended"},
+			},
+			expectedClients: 1,
+		},
+		{
+			name:        "CSV with fallbacks",
+			contentType: "text/csv",
+			body: "id,name,leadCapacity,workingHoursStart,workingHoursEnd,fallbacks\n" +
+				"p,Partner,10,09:00,17:00,\n" +
+				"q,Premium,10,09:00,17:00,p\n" +
+				"r,Unknown,10,09:00,17:00,p missing\n",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErrors: []RowError{
+				{Row: 4, ID: "r", Field: "fallbacks", Message: "client does not exist"},
+			},
+			expectedClients: 1,
+		},
+		{
+			name:         "Existing ID without upsert",
+			contentType:  "application/json",
+			body:         `[{"id":"1","name":"Again","leadCapacity":10,"workingHoursStart":"09:00","workingHoursEnd":"17:00"}]`,
+			expectedCode: http.StatusConflict,
+			expectedErrors: []RowError{
+				{Row: 1, ID: "1", Field: "id", Message: "client already exists"},
+			},
+			expectedClients: 1,
+		},
+		{
+			name:            "Unknown CSV column",
+			contentType:     "text/csv",
+			body:            "name,region\nA,EU\n",
+			expectedCode:    http.StatusBadRequest,
+			expectedClients: 1,
+		},
+		{
+			name:            "Unsupported content type",
+			contentType:     "application/xml",
+			body:            "<clients/>",
+			expectedCode:    http.StatusUnsupportedMediaType,
+			expectedClients: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := db.InitDB(":memory:")
+			defer database.Close()
+			setupDatabase(database)
+
+			req, _ := http.NewRequest("POST", "/clients/import"+tc.query, bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			rr := httptest.NewRecorder()
+			ImportClientsHandler(database).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code, rr.Body.String())
+			if rr.Header().Get("Content-Type") == "application/json" {
+				var resp ImportResponse
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				assert.Equal(t, tc.expectedCreated, resp.Created)
+				assert.Equal(t, tc.expectedUpdated, resp.Updated)
+				if tc.expectedErrors == nil {
+					tc.expectedErrors = []RowError{}
+				}
+				assert.Equal(t, tc.expectedErrors, resp.Errors)
+			}
+
+			clients, err := database.GetAllClients(context.Background())
+			require.NoError(t, err)
+			assert.Len(t, clients, tc.expectedClients)
+		})
+	}
+}
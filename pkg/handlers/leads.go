@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"lead_management/pkg/db"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/metrics"
+	"lead_management/pkg/models"
+	"lead_management/pkg/utils"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CreateLeadRequest is used to decode the JSON request payload.
+type CreateLeadRequest struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+	// Attributes holds custom attribute values by name.
+	Attributes map[string]any `json:"attributes"`
+}
+
+// CreateLeadHandler stores a new lead and assigns it to the most eligible
+// client, or queues it if no client is eligible. Duplicates are rejected
+// with 409 or attached to the original lead, depending on the dedup
+// policy.
+func CreateLeadHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req CreateLeadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		leadID := req.ID
+		if leadID == "" {
+			leadID = utils.GenerateUUID()
+		}
+
+		lead, err := database.AssignLead(r.Context(), models.Lead{
+			ID:         leadID,
+			Name:       req.Name,
+			Email:      req.Email,
+			Phone:      req.Phone,
+			Attributes: req.Attributes,
+		})
+		if err != nil {
+			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				http.Error(w, "Lead ID already exists", http.StatusConflict)
+				return
+			}
+			if attributeError(w, err) {
+				return
+			}
+			var dupErr *db.DuplicateError
+			if errors.As(err, &dupErr) {
+				metrics.LeadAssignments.Inc("", metrics.OutcomeDuplicate)
+				http.Error(w, "Duplicate of lead "+dupErr.Original, http.StatusConflict)
+				return
+			}
+			logging.FromContext(r.Context()).Error("failed to assign lead", "error", err)
+			metrics.LeadAssignments.Inc("", metrics.OutcomeError)
+			http.Error(w, "Failed to assign lead", http.StatusInternalServerError)
+			return
+		}
+
+		// Leads no client can take yet are queued and answered with 202, and
+		// duplicates attached to their original with 200.
+		status := http.StatusCreated
+		switch lead.Status {
+		case models.LeadQueued:
+			metrics.LeadAssignments.Inc("", metrics.OutcomeNoEligible)
+			metrics.NoEligibleClient.Inc()
+			status = http.StatusAccepted
+		case models.LeadDuplicate:
+			metrics.LeadAssignments.Inc("", metrics.OutcomeDuplicate)
+			status = http.StatusOK
+		default:
+			metrics.LeadAssignments.Inc(lead.ClientID, metrics.OutcomeAssigned)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(lead)
+	}
+}
+
+// Page sizes of the lead list.
+const (
+	defaultLeadLimit = 100
+	maxLeadLimit     = 1000
+)
+
+// ListLeadsHandler lists leads, newest first, optionally filtered by the
+// status, clientId and attr.<name> query parameters. The limit parameter caps
+// the number returned, at most 1000 and by default 100.
+func ListLeadsHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		logger := logging.FromContext(r.Context())
+		filter := db.LeadFilter{Status: query.Get("status"), ClientID: query.Get("clientId"), Limit: defaultLeadLimit}
+		if filter.Status != "" && !slices.Contains(models.LeadStatuses, filter.Status) {
+			http.Error(w, "status must be assigned, queued, duplicate or merged", http.StatusBadRequest)
+			return
+		}
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxLeadLimit {
+				http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = n
+		}
+		defs, err := database.GetAttributeDefinitions(r.Context(), models.EntityLead)
+		if err != nil {
+			logger.Error("failed to fetch attribute definitions", "error", err)
+			http.Error(w, "Failed to fetch leads", http.StatusInternalServerError)
+			return
+		}
+		filter.Attributes, err = attributeFilter(query, defs)
+		if attributeError(w, err) {
+			return
+		}
+
+		leads, err := database.ListLeads(r.Context(), filter)
+		if err != nil {
+			logger.Error("failed to fetch leads", "error", err)
+			http.Error(w, "Failed to fetch leads", http.StatusInternalServerError)
+			return
+		}
+		if leads == nil {
+			leads = []models.Lead{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(leads)
+	}
+}
+
+// GetLeadByIDHandler retrieves a specific lead by ID from the database.
+func GetLeadByIDHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.PathValue("id")
+		lead, err := db.GetLeadByID(r.Context(), id)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch lead", "id", id, "error", err)
+			http.Error(w, "Failed to fetch lead", http.StatusInternalServerError)
+			return
+		}
+		if lead == nil {
+			http.Error(w, "Lead not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(lead)
+	}
+}
+
+// ExplainLeadHandler describes how a lead was routed, using the state the
+// clients had when it was assigned.
+func ExplainLeadHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.PathValue("id")
+		explanation, err := db.ExplainLead(r.Context(), id)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to explain lead", "id", id, "error", err)
+			http.Error(w, "Failed to explain lead", http.StatusInternalServerError)
+			return
+		}
+		if explanation == nil {
+			http.Error(w, "Lead not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(explanation)
+	}
+}
+
+// MergeLeadsRequest is used to decode the JSON request payload.
+type MergeLeadsRequest struct {
+	// From is the ID of the lead merged into the one in the path.
+	From string `json:"from"`
+}
+
+// MergeLeadsHandler merges another lead into a lead (POST), combining their
+// details and histories, and returns the merged lead.
+func MergeLeadsHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		var req MergeLeadsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		id := r.PathValue("id")
+		switch req.From {
+		case "":
+			http.Error(w, "from is required", http.StatusBadRequest)
+			return
+		case id:
+			http.Error(w, "Cannot merge a lead into itself", http.StatusBadRequest)
+			return
+		}
+
+		lead, err := database.MergeLeads(r.Context(), id, req.From)
+		switch {
+		case errors.Is(err, db.ErrLeadNotFound):
+			http.Error(w, "Lead not found", http.StatusNotFound)
+		case errors.Is(err, db.ErrLeadMerged):
+			http.Error(w, "Lead already merged", http.StatusConflict)
+		case err != nil:
+			logging.FromContext(r.Context()).Error("failed to merge leads", "id", id, "from", req.From, "error", err)
+			http.Error(w, "Failed to merge leads", http.StatusInternalServerError)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(lead)
+		}
+	}
+}
+
+// LeadHistoryHandler lists the changes to a lead and its assignment,
+// including those of the leads merged into it, oldest first.
+func LeadHistoryHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.PathValue("id")
+		changes, err := db.GetLeadHistory(r.Context(), id)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch lead history", "id", id, "error", err)
+			http.Error(w, "Failed to fetch lead history", http.StatusInternalServerError)
+			return
+		}
+		if len(changes) == 0 {
+			http.Error(w, "Lead not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(changes)
+	}
+}
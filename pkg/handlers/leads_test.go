@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateLeadHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		clients        []models.Client
+		expectedCode   int
+		expectedClient string
+	}{
+		{
+			name:   "Successful assignment",
+			method: "POST",
+			body:   `{"name":"Ada","email":"ada@example.com"}`,
+			clients: []models.Client{
+				{ID: "1", Name: "Open Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay()},
+			},
+			expectedCode:   http.StatusCreated,
+			expectedClient: "1",
+		},
+		{
+			name:   "Client at capacity queues the lead",
+			method: "POST",
+			body:   `{"name":"Ada"}`,
+			clients: []models.Client{
+				{ID: "1", Name: "Full Client", Priority: 1, LeadCapacity: 1, CurrentLeadCount: 1, WorkingHours: allDay()},
+			},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "Invalid JSON data",
+			method:       "POST",
+			body:         `{invalid json}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Incorrect HTTP method",
+			method:       "GET",
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := db.InitDB(":memory:")
+			defer database.Close()
+			setupEligibleClientsDatabase(database, tc.clients)
+
+			req, _ := http.NewRequest(tc.method, "/lead/create", bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			CreateLeadHandler(database).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedCode == http.StatusCreated {
+				var lead models.Lead
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &lead))
+				assert.NotEmpty(t, lead.ID)
+				assert.Equal(t, tc.expectedClient, lead.ClientID)
+
+				client, err := database.GetClientByID(req.Context(), tc.expectedClient)
+				require.NoError(t, err)
+				assert.Equal(t, 1, client.CurrentLeadCount)
+			}
+			if tc.expectedCode == http.StatusAccepted {
+				var lead models.Lead
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &lead))
+				assert.Equal(t, models.LeadQueued, lead.Status)
+				assert.Empty(t, lead.ClientID)
+			}
+		})
+	}
+}
+
+// allDay returns working hours covering the whole day.
+func allDay() [2]time.Time {
+	return [2]time.Time{parseTime("00:00"), parseTime("23:59")}
+}
+
+func TestExplainLeadHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "1", Name: "Open Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay()},
+		{ID: "2", Name: "Full Client", Priority: 5, LeadCapacity: 0, WorkingHours: allDay()},
+	})
+	_, err := database.AssignLead(context.Background(), models.Lead{ID: "l1", Name: "Ada"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		expectedCode int
+	}{
+		{name: "Assigned lead", method: "GET", url: "/lead/l1/explain", expectedCode: http.StatusOK},
+		{name: "Lead not found", method: "GET", url: "/lead/l2/explain", expectedCode: http.StatusNotFound},
+		{name: "Incorrect HTTP method", method: "POST", url: "/lead/l1/explain", expectedCode: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, tc.url, nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedCode == http.StatusOK {
+				var explanation models.Explanation
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &explanation))
+				assert.Equal(t, "1", explanation.ClientID)
+				require.Len(t, explanation.Candidates, 2)
+				assert.Equal(t, "2", explanation.Candidates[0].Client.ID)
+				assert.Equal(t, []string{models.ReasonAtCapacity}, explanation.Candidates[0].Reasons)
+				assert.True(t, explanation.Candidates[1].Eligible)
+			}
+		})
+	}
+}
+
+func TestDuplicateLeads(t *testing.T) {
+	for _, tc := range []struct {
+		policy       string
+		expectedCode int
+	}{
+		{policy: db.DedupReject, expectedCode: http.StatusConflict},
+		{policy: db.DedupAttach, expectedCode: http.StatusOK},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			database := db.InitDB(":memory:")
+			defer database.Close()
+			setupEligibleClientsDatabase(database, []models.Client{
+				{ID: "1", Name: "Open Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay()},
+			})
+			require.NoError(t, database.SetDedup(context.Background(), db.DedupOptions{Keys: []string{db.DedupEmail}, Window: time.Hour, Policy: tc.policy}))
+			_, err := database.AssignLead(context.Background(), models.Lead{ID: "l1", Email: "ada@example.com"})
+			require.NoError(t, err)
+
+			req, _ := http.NewRequest("POST", "/lead/create", bytes.NewBufferString(`{"id":"l2","email":"Ada@Example.com"}`))
+			rr := httptest.NewRecorder()
+			CreateLeadHandler(database).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedCode == http.StatusOK {
+				var lead models.Lead
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &lead))
+				assert.Equal(t, models.LeadDuplicate, lead.Status)
+				assert.Equal(t, "l1", lead.DuplicateOf)
+			} else {
+				assert.Contains(t, rr.Body.String(), "l1")
+			}
+		})
+	}
+}
+
+func TestMergeLeadsHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "1", Name: "Open Client", Priority: 1, LeadCapacity: 10, WorkingHours: allDay()},
+	})
+	for _, lead := range []models.Lead{{ID: "l1", Name: "Ada"}, {ID: "l2", Email: "ada@example.com"}, {ID: "l3"}} {
+		_, err := database.AssignLead(context.Background(), lead)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		body         string
+		expectedCode int
+	}{
+		{name: "Merge", method: "POST", url: "/lead/l1/merge", body: `{"from":"l2"}`, expectedCode: http.StatusOK},
+		{name: "Already merged", method: "POST", url: "/lead/l3/merge", body: `{"from":"l2"}`, expectedCode: http.StatusConflict},
+		{name: "Lead not found", method: "POST", url: "/lead/l1/merge", body: `{"from":"l9"}`, expectedCode: http.StatusNotFound},
+		{name: "Into itself", method: "POST", url: "/lead/l1/merge", body: `{"from":"l1"}`, expectedCode: http.StatusBadRequest},
+		{name: "Missing from", method: "POST", url: "/lead/l1/merge", body: `{}`, expectedCode: http.StatusBadRequest},
+		{name: "Invalid JSON data", method: "POST", url: "/lead/l1/merge", body: `{invalid`, expectedCode: http.StatusBadRequest},
+		{name: "Incorrect HTTP method", method: "GET", url: "/lead/l1/merge", expectedCode: http.StatusMethodNotAllowed},
+		{name: "History", method: "GET", url: "/lead/l1/history", expectedCode: http.StatusOK},
+		{name: "History of unknown lead", method: "GET", url: "/lead/l9/history", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, tc.url, bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			if tc.method == "POST" {
+				var lead models.Lead
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &lead))
+				assert.Equal(t, "Ada", lead.Name)
+				assert.Equal(t, "ada@example.com", lead.Email)
+			} else {
+				var changes []models.Change
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &changes))
+				ids := make(map[string]bool)
+				for _, c := range changes {
+					ids[c.EntityID] = true
+				}
+				assert.Equal(t, map[string]bool{"l1": true, "l2": true}, ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"lead_management/pkg/auth"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/metrics"
+	"lead_management/pkg/tracing"
+	"lead_management/pkg/utils"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// requestIDHeader carries the request ID between clients, proxies and this service.
+const requestIDHeader = "X-Request-ID"
+
+// publicRoutes are served without authentication so probes and scrapers
+// do not need credentials.
+var publicRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush event streams.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Instrument wraps mux so every request gets a request-scoped logger
+// carrying the request ID and matched route, runs inside a server span
+// continuing any incoming W3C trace, is logged on completion and is counted
+// in the HTTP request metrics. When authenticator is enabled, requests to
+// non-public routes without valid credentials are rejected with 401.
+func Instrument(mux *http.ServeMux, authenticator *auth.Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" {
+			requestID = utils.GenerateUUID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		_, route := mux.Handler(r)
+		ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "HTTP "+r.Method+" "+route)
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("request.id", requestID)
+
+		logger := slog.Default().With(
+			slog.String("request_id", requestID),
+			slog.String("route", route),
+			slog.String("trace_id", span.Context().TraceID.String()),
+		)
+
+		principal := authenticator.Authenticate(r)
+		if principal != nil {
+			ctx = auth.WithPrincipal(ctx, principal)
+			logger = logger.With(slog.String("principal", principal.Name))
+			span.SetAttribute("auth.principal", principal.Name)
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		if authenticator.Enabled() && principal == nil && !publicRoutes[route] {
+			http.Error(rec, "Unauthorized", http.StatusUnauthorized)
+		} else {
+			mux.ServeHTTP(rec, r.WithContext(logging.WithContext(ctx, logger)))
+		}
+		span.SetAttribute("http.status_code", rec.status)
+
+		elapsed := time.Since(start)
+		status := strconv.Itoa(rec.status)
+		metrics.HTTPRequests.Inc(route, r.Method, status)
+		metrics.HTTPRequestDuration.Observe(elapsed.Seconds(), route, status)
+
+		logger.Info("request completed",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("duration", elapsed),
+		)
+	})
+}
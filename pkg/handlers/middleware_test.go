@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"lead_management/pkg/auth"
+	"lead_management/pkg/db"
+	"lead_management/pkg/metrics"
+	"lead_management/pkg/tracing"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrument(t *testing.T) {
+	tests := []struct {
+		name            string
+		requestID       string
+		expectGenerated bool
+	}{
+		{name: "Generates request ID", requestID: "", expectGenerated: true},
+		{name: "Propagates incoming request ID", requestID: "req-123"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			req, _ := http.NewRequest("GET", "/ping", nil)
+			if tc.requestID != "" {
+				req.Header.Set(requestIDHeader, tc.requestID)
+			}
+			before := metrics.HTTPRequests.Value("/ping", "GET", "418")
+			rr := httptest.NewRecorder()
+			Instrument(mux, nil).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusTeapot, rr.Code)
+			assert.Equal(t, before+1, metrics.HTTPRequests.Value("/ping", "GET", "418"))
+			if tc.expectGenerated {
+				assert.NotEmpty(t, rr.Header().Get(requestIDHeader))
+			} else {
+				assert.Equal(t, tc.requestID, rr.Header().Get(requestIDHeader))
+			}
+		})
+	}
+}
+
+// spanRecorder collects exported spans for assertions.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (s *spanRecorder) ExportSpan(span tracing.SpanData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spans = append(s.spans, span)
+	return nil
+}
+
+func (s *spanRecorder) Shutdown(ctx context.Context) error { return nil }
+
+func TestInstrumentTracing(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+
+	recorder := &spanRecorder{}
+	tracing.SetExporter(recorder)
+	defer tracing.SetExporter(nil)
+
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+
+	req, _ := http.NewRequest("GET", "/client/1", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	Instrument(mux, nil).ServeHTTP(rr, req)
+
+	require.Len(t, recorder.spans, 2)
+	dbSpan, serverSpan := recorder.spans[0], recorder.spans[1]
+	assert.Equal(t, "db.get_client_by_id", dbSpan.Name)
+	assert.Equal(t, "HTTP GET /client/", serverSpan.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serverSpan.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", serverSpan.ParentID)
+	assert.Equal(t, serverSpan.TraceID, dbSpan.TraceID)
+	assert.Equal(t, serverSpan.SpanID, dbSpan.ParentID)
+}
+
+func TestInstrumentAuthentication(t *testing.T) {
+	authenticator := auth.NewAuthenticator(auth.Options{APIKeys: map[string]string{"secret": "alice"}})
+
+	tests := []struct {
+		name              string
+		url               string
+		apiKey            string
+		expectedCode      int
+		expectedPrincipal string
+	}{
+		{name: "Valid API key", url: "/whoami", apiKey: "secret", expectedCode: http.StatusOK, expectedPrincipal: "alice"},
+		{name: "Missing API key", url: "/whoami", expectedCode: http.StatusUnauthorized},
+		{name: "Invalid API key", url: "/whoami", apiKey: "wrong", expectedCode: http.StatusUnauthorized},
+		{name: "Public route", url: "/healthz", expectedCode: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(auth.FromContext(r.Context()).Name))
+			})
+			mux.HandleFunc("/healthz", LivenessHandler())
+
+			req, _ := http.NewRequest("GET", tc.url, nil)
+			if tc.apiKey != "" {
+				req.Header.Set("X-API-Key", tc.apiKey)
+			}
+			rr := httptest.NewRecorder()
+			Instrument(mux, authenticator).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedPrincipal != "" {
+				assert.Equal(t, tc.expectedPrincipal, rr.Body.String())
+			}
+		})
+	}
+}
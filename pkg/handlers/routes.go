@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"lead_management/pkg/db"
+	"lead_management/pkg/health"
 	"net/http"
 )
 
@@ -10,12 +11,89 @@ func SetupRoutes(mux *http.ServeMux, database *db.DB) {
 	// Create a new client
 	mux.HandleFunc("/client/create", CreateClientHandler(database))
 
+	// Create or update clients in bulk from CSV or JSON
+	mux.HandleFunc("/clients/import", ImportClientsHandler(database))
+
+	// Export clients as CSV, NDJSON or XLSX
+	mux.HandleFunc("/clients/export", ExportClientsHandler(database))
+
+	// Target versus actual lead shares of clients
+	mux.HandleFunc("/clients/shares", ShareReportHandler(database))
+
+	// How many leads each client can take right now
+	mux.HandleFunc("/clients/availability", AvailabilityHandler(database))
+
 	// Retrieve all clients
 	mux.HandleFunc("/client/all", GetAllClientsHandler(database))
 
-	// Retrieve a specific client by their ID
-	mux.HandleFunc("/client/", GetClientByIDHandler(database))
+	// Retrieve or update a specific client by their ID
+	mux.HandleFunc("/client/", ClientHandler(database))
+
+	// Every recorded version of a client
+	mux.HandleFunc("/client/{id}/history", ClientHistoryHandler(database))
+
+	// Pacing state of a paced client
+	mux.HandleFunc("/client/{id}/pacing", ClientPacingHandler(database))
+
+	// Set a client's status now, or schedule status changes
+	mux.HandleFunc("/client/{id}/status", ClientStatusHandler(database))
+	mux.HandleFunc("/client/{id}/schedules", ClientSchedulesHandler(database))
+	mux.HandleFunc("/client/{id}/schedules/{scheduleId}", DeleteStatusScheduleHandler(database))
 
 	// Endpoint for assigning a lead to a client
 	mux.HandleFunc("/client/assign", AssignLeadHandler(database))
+
+	// Custom attribute definitions of clients and leads
+	mux.HandleFunc("/attributes/{entity}", AttributesHandler(database))
+	mux.HandleFunc("/attributes/{entity}/{name}", AttributeHandler(database))
+
+	// Test an eligibility rule against a sample lead
+	mux.HandleFunc("/rules/test", RuleTestHandler(database))
+
+	// Client groups and their roll-up reports
+	mux.HandleFunc("/group/create", CreateGroupHandler(database))
+	mux.HandleFunc("/group/all", GetAllGroupsHandler(database))
+	mux.HandleFunc("/group/{id}", GroupHandler(database))
+	mux.HandleFunc("/group/{id}/report", GroupReportHandler(database))
+	mux.HandleFunc("/groups/report", GroupReportHandler(database))
+
+	// Create a lead and assign it to the most eligible client
+	mux.HandleFunc("/lead/create", CreateLeadHandler(database))
+
+	// List leads, filtered by status, client and attributes
+	mux.HandleFunc("/lead/all", ListLeadsHandler(database))
+
+	// Retrieve a specific lead by its ID
+	mux.HandleFunc("/lead/{id}", GetLeadByIDHandler(database))
+
+	// Explain how a lead was routed
+	mux.HandleFunc("/lead/{id}/explain", ExplainLeadHandler(database))
+
+	// Merge a duplicate into a lead, and the combined history of a lead
+	mux.HandleFunc("/lead/{id}/merge", MergeLeadsHandler(database))
+	mux.HandleFunc("/lead/{id}/history", LeadHistoryHandler(database))
+
+	// List and register a client's webhooks
+	mux.HandleFunc("/client/{id}/webhooks", ClientWebhooksHandler(database))
+
+	// Remove a client's webhook
+	mux.HandleFunc("/client/{id}/webhooks/{webhookId}", DeleteWebhookHandler(database))
+
+	// Webhook delivery log, dead letters and manual replay
+	mux.HandleFunc("/webhooks/deliveries", WebhookDeliveriesHandler(database))
+	mux.HandleFunc("/webhooks/dead-letters", DeadLettersHandler(database))
+	mux.HandleFunc("/webhooks/deliveries/{id}/replay", ReplayDeliveryHandler(database))
+
+	// Live stream of activity events
+	mux.HandleFunc("/events/stream", EventStreamHandler(database))
+
+	// Change log feed for downstream replication
+	mux.HandleFunc("/changes", ChangesHandler(database))
+
+	// Prometheus metrics
+	mux.HandleFunc("/metrics", MetricsHandler(database))
+
+	// Liveness and readiness probes
+	mux.HandleFunc("/healthz", LivenessHandler())
+	mux.HandleFunc("/readyz", ReadinessHandler(health.Default))
 }
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"lead_management/pkg/db"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/models"
+	"lead_management/pkg/rules"
+	"net/http"
+	"time"
+)
+
+// RuleTestRequest is used to decode the JSON request payload.
+type RuleTestRequest struct {
+	Rule string `json:"rule"`
+	// Lead is the sample lead; only its attributes are used.
+	Lead     models.Lead `json:"lead"`
+	Timezone string      `json:"timezone"`
+	// At is the time to evaluate the rule at, by default now.
+	At *time.Time `json:"at"`
+}
+
+// RuleTestResponse is the outcome of a rule test.
+type RuleTestResponse struct {
+	Matched     bool      `json:"matched"`
+	EvaluatedAt time.Time `json:"evaluatedAt"`
+}
+
+// ruleError answers the request for a *rules.Error and reports whether err
+// was one.
+func ruleError(w http.ResponseWriter, err error) bool {
+	var ruleErr *rules.Error
+	if !errors.As(err, &ruleErr) {
+		return false
+	}
+	http.Error(w, "Invalid "+ruleErr.Error(), http.StatusBadRequest)
+	return true
+}
+
+// RuleTestHandler compiles a rule as it would be when saved on a client and
+// evaluates it against a sample lead, in the given time zone.
+func RuleTestHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req RuleTestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		loc, err := rules.Location(req.Timezone)
+		if err != nil {
+			http.Error(w, "Invalid timezone", http.StatusBadRequest)
+			return
+		}
+		defs, err := database.GetAttributeDefinitions(r.Context(), models.EntityLead)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to fetch attribute definitions", "error", err)
+			http.Error(w, "Failed to test rule", http.StatusInternalServerError)
+			return
+		}
+		rule, err := rules.Compile(req.Rule, defs)
+		if ruleError(w, err) {
+			return
+		}
+
+		at := time.Now()
+		if req.At != nil {
+			at = *req.At
+		}
+		at = at.In(loc)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(RuleTestResponse{
+			Matched:     rule.Eval(req.Lead.Attributes, at),
+			EvaluatedAt: at,
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleTestHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+	for _, def := range []models.AttributeDefinition{
+		{Entity: models.EntityLead, Name: "country", Type: models.AttributeString},
+		{Entity: models.EntityLead, Name: "budget", Type: models.AttributeNumber},
+	} {
+		require.NoError(t, database.DefineAttribute(context.Background(), def))
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		body            string
+		expectedCode    int
+		expectedMatched bool
+	}{
+		{name: "Rule met", method: "POST", body: `{"rule":"lead.country in [\"DE\",\"AT\"] && lead.budget > 5000 && !now.weekend","lead":{"attributes":{"country":"AT","budget":6000}},"at":"2024-03-01T12:00:00Z"}`, expectedCode: http.StatusOK, expectedMatched: true},
+		{name: "Weekend in the client's zone", method: "POST", body: `{"rule":"!now.weekend","timezone":"Asia/Tokyo","at":"2024-03-01T23:30:00Z"}`, expectedCode: http.StatusOK},
+		{name: "Invalid rule", method: "POST", body: `{"rule":"lead.budget > \"5000\""}`, expectedCode: http.StatusBadRequest},
+		{name: "Undefined attribute", method: "POST", body: `{"rule":"lead.region == \"emea\""}`, expectedCode: http.StatusBadRequest},
+		{name: "Invalid timezone", method: "POST", body: `{"rule":"now.hour > 9","timezone":"Mars/Olympus"}`, expectedCode: http.StatusBadRequest},
+		{name: "Invalid payload", method: "POST", body: `{`, expectedCode: http.StatusBadRequest},
+		{name: "Incorrect HTTP method", method: "GET", expectedCode: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, "/rules/test", bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.expectedCode, rr.Code, rr.Body.String())
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			var resp RuleTestResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, tc.expectedMatched, resp.Matched)
+		})
+	}
+
+	// Rules are validated when clients are saved.
+	body := `{"id":"c1","name":"One","workingHoursStart":"09:00","workingHoursEnd":"17:00","rule":"lead.budget >"}`
+	req, _ := http.NewRequest("POST", "/client/create", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	body = `{"id":"c1","name":"One","workingHoursStart":"09:00","workingHoursEnd":"17:00","rule":"lead.budget > 5000","timezone":"Europe/Berlin"}`
+	req, _ = http.NewRequest("POST", "/client/create", bytes.NewBufferString(body))
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var client models.Client
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &client))
+	assert.Equal(t, "Europe/Berlin", client.Timezone)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/logging"
+	"net/http"
+	"time"
+)
+
+// ShareReportHandler compares the target shares of clients with their
+// actual shares of the leads assigned within a window, given by the window
+// query parameter as a duration such as 24h, or the share strategy's window.
+func ShareReportHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		window := database.ShareWindow()
+		if v := r.URL.Query().Get("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				http.Error(w, "Invalid window", http.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+
+		report, err := database.ShareReport(r.Context(), window)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to build share report", "error", err)
+			http.Error(w, "Failed to build share report", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
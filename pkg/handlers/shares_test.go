@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareReportHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		expectedCode   int
+		expectedBody   string
+		expectedWindow time.Duration
+	}{
+		{
+			name:         "Create client with share",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"c","name":"C","leadCapacity":10,"workingHoursStart":"00:00","workingHoursEnd":"23:59","share":25}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"c","name":"C","priority":0,"leadCapacity":10,"currentLeadCount":0,
+				"workingHours":["0000-01-01T00:00:00Z","0000-01-01T23:59:00Z"],"version":1,"share":25,"status":"active"}`,
+		},
+		{
+			name:         "Share above 100",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"c","name":"C","workingHoursStart":"00:00","workingHoursEnd":"23:59","share":101}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Share must be between 0 and 100",
+		},
+		{
+			name:         "Negative share",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"c","name":"C","workingHoursStart":"00:00","workingHoursEnd":"23:59","share":-1}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Share must be between 0 and 100",
+		},
+		{
+			name:         "Report",
+			method:       "GET",
+			url:          "/clients/shares",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"total":1,"clients":[{"clientId":"b","name":"B","share":70,"targetShare":70,"actualShare":0,"delivered":0,"deficit":70},
+				{"clientId":"a","name":"A","share":30,"targetShare":30,"actualShare":100,"delivered":1,"deficit":-70}]}`,
+			expectedWindow: db.DefaultShareWindow,
+		},
+		{
+			name:         "Report with window",
+			method:       "GET",
+			url:          "/clients/shares?window=90m",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"total":1,"clients":[{"clientId":"b","name":"B","share":70,"targetShare":70,"actualShare":0,"delivered":0,"deficit":70},
+				{"clientId":"a","name":"A","share":30,"targetShare":30,"actualShare":100,"delivered":1,"deficit":-70}]}`,
+			expectedWindow: 90 * time.Minute,
+		},
+		{
+			name:         "Invalid window",
+			method:       "GET",
+			url:          "/clients/shares?window=soon",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid window",
+		},
+		{
+			name:         "Negative window",
+			method:       "GET",
+			url:          "/clients/shares?window=-1h",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid window",
+		},
+		{
+			name:         "Incorrect HTTP method",
+			method:       "POST",
+			url:          "/clients/shares",
+			expectedCode: http.StatusMethodNotAllowed,
+			expectedBody: "Unsupported HTTP method",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := db.InitDB(":memory:")
+			defer database.Close()
+			setupEligibleClientsDatabase(database, []models.Client{
+				{ID: "a", Name: "A", Priority: 2, LeadCapacity: 10, WorkingHours: allDay(), Share: 30},
+				{ID: "b", Name: "B", Priority: 1, LeadCapacity: 10, WorkingHours: allDay(), Share: 70},
+			})
+			_, err := database.AssignLead(context.Background(), models.Lead{ID: "l1", Name: "Ada"})
+			require.NoError(t, err)
+			mux := http.NewServeMux()
+			SetupRoutes(mux, database)
+
+			req, _ := http.NewRequest(tc.method, tc.url, bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			assertResponse(t, rr, tc.expectedCode, tc.expectedBody)
+			if tc.expectedWindow != 0 {
+				var report models.ShareReport
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+				assert.Equal(t, tc.expectedWindow, report.Until.Sub(report.Since))
+			}
+		})
+	}
+}
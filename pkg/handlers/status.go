@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"lead_management/pkg/db"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/models"
+	"lead_management/pkg/utils"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// SetStatusRequest is used to decode the JSON request payload.
+type SetStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// ClientStatusHandler sets a client's status (PUT), taking effect
+// immediately. Like updates, it requires an If-Match header with the
+// client's current ETag or "*".
+func ClientStatusHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.PathValue("id")
+		version, ok := ifMatchVersion(w, r, database, id)
+		if !ok {
+			return
+		}
+		var req SetStatusRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(models.ClientStatuses, req.Status) {
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+		client, err := database.SetClientStatus(r.Context(), id, req.Status, req.Reason, version)
+		if errors.Is(err, db.ErrVersionMismatch) {
+			http.Error(w, "Client has been modified", http.StatusPreconditionFailed)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to set client status", "id", id, "error", err)
+			http.Error(w, "Failed to set client status", http.StatusInternalServerError)
+			return
+		}
+		if client == nil {
+			http.Error(w, "Client not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", clientETag(client))
+		json.NewEncoder(w).Encode(client)
+	}
+}
+
+// ScheduleStatusRequest is used to decode the JSON request payload.
+type ScheduleStatusRequest struct {
+	Status   string     `json:"status"`
+	Reason   string     `json:"reason"`
+	StartsAt time.Time  `json:"startsAt"`
+	EndsAt   *time.Time `json:"endsAt"`
+}
+
+// ClientSchedulesHandler lists (GET) or creates (POST) a client's scheduled
+// status changes. A change whose start has already passed is applied
+// immediately.
+func ClientSchedulesHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID := r.PathValue("id")
+		switch r.Method {
+		case "GET":
+			schedules, err := db.GetStatusSchedules(r.Context(), clientID)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to fetch status schedules", "client", clientID, "error", err)
+				http.Error(w, "Failed to fetch status schedules", http.StatusInternalServerError)
+				return
+			}
+			if schedules == nil {
+				schedules = []models.StatusSchedule{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(schedules)
+		case "POST":
+			scheduleStatus(db, w, r, clientID)
+		default:
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func scheduleStatus(database *db.DB, w http.ResponseWriter, r *http.Request, clientID string) {
+	var req ScheduleStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(models.ClientStatuses, req.Status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	if req.StartsAt.IsZero() {
+		http.Error(w, "startsAt is required", http.StatusBadRequest)
+		return
+	}
+	if req.EndsAt != nil && !req.EndsAt.After(req.StartsAt) {
+		http.Error(w, "endsAt must be after startsAt", http.StatusBadRequest)
+		return
+	}
+
+	logger := logging.FromContext(r.Context())
+	now := time.Now().UTC()
+	schedule := models.StatusSchedule{
+		ID:        utils.GenerateUUID(),
+		ClientID:  clientID,
+		Status:    req.Status,
+		Reason:    req.Reason,
+		StartsAt:  req.StartsAt.UTC(),
+		State:     models.SchedulePending,
+		CreatedAt: now,
+	}
+	if req.EndsAt != nil {
+		end := req.EndsAt.UTC()
+		schedule.EndsAt = &end
+	}
+	if err := database.ScheduleStatus(r.Context(), schedule); err != nil {
+		if errors.Is(err, db.ErrClientNotFound) {
+			http.Error(w, "Client not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("failed to schedule client status", "client", clientID, "error", err)
+		http.Error(w, "Failed to schedule client status", http.StatusInternalServerError)
+		return
+	}
+	if !schedule.StartsAt.After(now) {
+		// Do not leave a change that is already due to the next scheduler pass.
+		if _, err := database.ApplyStatusSchedules(r.Context(), now); err != nil {
+			logger.Error("failed to apply scheduled client statuses", "error", err)
+		}
+		// Answer with the state the change was left in.
+		stored, err := database.GetStatusSchedule(r.Context(), clientID, schedule.ID)
+		if err != nil {
+			logger.Error("failed to fetch status schedule", "id", schedule.ID, "error", err)
+			http.Error(w, "Failed to fetch status schedule", http.StatusInternalServerError)
+			return
+		}
+		if stored != nil {
+			schedule = *stored
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// DeleteStatusScheduleHandler cancels a client's scheduled status change.
+func DeleteStatusScheduleHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		clientID, scheduleID := r.PathValue("id"), r.PathValue("scheduleId")
+		found, err := db.DeleteStatusSchedule(r.Context(), clientID, scheduleID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to delete status schedule", "id", scheduleID, "error", err)
+			http.Error(w, "Failed to delete status schedule", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Status schedule not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientStatusHandlers(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		ifMatch      string
+		body         string
+		generatedID  bool
+		expectedCode int
+		expectedBody string
+		expectedETag string
+	}{
+		{
+			name:         "Create paused client",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"b","name":"B","leadCapacity":10,"workingHoursStart":"00:00","workingHoursEnd":"23:59","status":"paused","statusReason":"onboarding"}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"b","name":"B","priority":0,"leadCapacity":10,"currentLeadCount":0,
+				"workingHours":["0000-01-01T00:00:00Z","0000-01-01T23:59:00Z"],"version":1,"status":"paused","statusReason":"onboarding"}`,
+			expectedETag: `"1"`,
+		},
+		{
+			name:         "Create client with invalid status",
+			method:       "POST",
+			url:          "/client/create",
+			body:         `{"id":"b","name":"B","workingHoursStart":"00:00","workingHoursEnd":"23:59","status":"asleep"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid status",
+		},
+		{
+			name:         "List paused clients",
+			method:       "GET",
+			url:          "/client/all?status=paused",
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":"a","name":"A","priority":0,"leadCapacity":10,"currentLeadCount":0,
+				"workingHours":["0000-01-01T00:00:00Z","0000-01-01T23:59:00Z"],"version":1,"status":"paused","statusReason":"onboarding"}]`,
+		},
+		{
+			name:         "List by invalid status",
+			method:       "GET",
+			url:          "/client/all?status=asleep",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid status",
+		},
+		{
+			name:         "Activate without If-Match",
+			method:       "PUT",
+			url:          "/client/a/status",
+			body:         `{"status":"active"}`,
+			expectedCode: http.StatusPreconditionRequired,
+			expectedBody: "If-Match header required",
+		},
+		{
+			name:         "Activate at stale version",
+			method:       "PUT",
+			url:          "/client/a/status",
+			ifMatch:      `"9"`,
+			body:         `{"status":"active"}`,
+			expectedCode: http.StatusPreconditionFailed,
+			expectedBody: "Client has been modified",
+		},
+		{
+			name:         "Activate",
+			method:       "PUT",
+			url:          "/client/a/status",
+			ifMatch:      `"1"`,
+			body:         `{"status":"active"}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"a","name":"A","priority":0,"leadCapacity":10,"currentLeadCount":0,
+				"workingHours":["0000-01-01T00:00:00Z","0000-01-01T23:59:00Z"],"version":2,"status":"active"}`,
+			expectedETag: `"2"`,
+		},
+		{
+			name:         "Invalid status",
+			method:       "PUT",
+			url:          "/client/a/status",
+			ifMatch:      "*",
+			body:         `{"status":"asleep"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid status",
+		},
+		{
+			name:         "Status of missing client",
+			method:       "PUT",
+			url:          "/client/missing/status",
+			ifMatch:      "*",
+			body:         `{"status":"paused"}`,
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Client not found",
+		},
+		{
+			name:         "Incorrect status method",
+			method:       "GET",
+			url:          "/client/a/status",
+			expectedCode: http.StatusMethodNotAllowed,
+			expectedBody: "Unsupported HTTP method",
+		},
+		{
+			name:         "Schedule vacation",
+			method:       "POST",
+			url:          "/client/a/schedules",
+			body:         `{"status":"paused","reason":"vacation","startsAt":"2099-07-03T18:00:00Z","endsAt":"2099-07-06T08:00:00Z"}`,
+			generatedID:  true,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"","clientId":"a","status":"paused","reason":"vacation","startsAt":"2099-07-03T18:00:00Z","endsAt":"2099-07-06T08:00:00Z","state":"pending"}`,
+		},
+		{
+			name:         "End before start",
+			method:       "POST",
+			url:          "/client/a/schedules",
+			body:         `{"status":"paused","startsAt":"2099-07-06T08:00:00Z","endsAt":"2099-07-03T18:00:00Z"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "endsAt must be after startsAt",
+		},
+		{
+			name:         "Missing start",
+			method:       "POST",
+			url:          "/client/a/schedules",
+			body:         `{"status":"paused"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "startsAt is required",
+		},
+		{
+			name:         "Invalid scheduled status",
+			method:       "POST",
+			url:          "/client/a/schedules",
+			body:         `{"status":"asleep","startsAt":"2099-07-03T18:00:00Z"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "Invalid status",
+		},
+		{
+			name:         "Schedule for missing client",
+			method:       "POST",
+			url:          "/client/missing/schedules",
+			body:         `{"status":"paused","startsAt":"2099-07-03T18:00:00Z"}`,
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Client not found",
+		},
+		{
+			name:         "Suspend now",
+			method:       "POST",
+			url:          "/client/a/schedules",
+			body:         `{"status":"suspended","reason":"unpaid","startsAt":"2020-01-01T00:00:00Z"}`,
+			generatedID:  true,
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":"","clientId":"a","status":"suspended","reason":"unpaid","startsAt":"2020-01-01T00:00:00Z","state":"done",
+				"previousStatus":"paused","previousReason":"onboarding"}`,
+		},
+		{
+			name:         "List schedules",
+			method:       "GET",
+			url:          "/client/a/schedules",
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":"s1","clientId":"a","status":"paused","reason":"vacation","startsAt":"2099-07-03T18:00:00Z","state":"pending","createdAt":"2024-07-01T09:00:00Z"}]`,
+		},
+		{
+			name:         "Delete schedule",
+			method:       "DELETE",
+			url:          "/client/a/schedules/s1",
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Delete missing schedule",
+			method:       "DELETE",
+			url:          "/client/a/schedules/missing",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Status schedule not found",
+		},
+		{
+			name:         "Incorrect schedules method",
+			method:       "PUT",
+			url:          "/client/a/schedules",
+			expectedCode: http.StatusMethodNotAllowed,
+			expectedBody: "Unsupported HTTP method",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := db.InitDB(":memory:")
+			defer database.Close()
+			setupStatusDatabase(database)
+			mux := http.NewServeMux()
+			SetupRoutes(mux, database)
+
+			req, _ := http.NewRequest(tc.method, tc.url, bytes.NewBufferString(tc.body))
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			// Schedule IDs are generated, so only their presence is checked.
+			if tc.generatedID {
+				var schedule models.StatusSchedule
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &schedule))
+				require.NotEmpty(t, schedule.ID)
+				rr.Body = bytes.NewBufferString(strings.Replace(rr.Body.String(), schedule.ID, "", 1))
+			}
+			assertResponse(t, rr, tc.expectedCode, tc.expectedBody)
+			assert.Equal(t, tc.expectedETag, rr.Header().Get("ETag"))
+		})
+	}
+}
+
+// Helper function to set up a paused client with a pending vacation
+func setupStatusDatabase(database *db.DB) {
+	ctx := context.Background()
+	setupEligibleClientsDatabase(database, []models.Client{
+		{ID: "a", Name: "A", LeadCapacity: 10, WorkingHours: allDay(), Status: models.ClientPaused, StatusReason: "onboarding"},
+	})
+	err := database.ScheduleStatus(ctx, models.StatusSchedule{
+		ID:        "s1",
+		ClientID:  "a",
+		Status:    models.ClientPaused,
+		Reason:    "vacation",
+		StartsAt:  time.Date(2099, 7, 3, 18, 0, 0, 0, time.UTC),
+		State:     models.SchedulePending,
+		CreatedAt: time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		panic("Failed to setup database: " + err.Error())
+	}
+}
+
+func TestScheduleStatusHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		expectedState string
+		clientStatus  string
+	}{
+		{
+			name:          "Due change is applied",
+			body:          `{"status":"suspended","reason":"unpaid","startsAt":"2020-01-01T00:00:00Z"}`,
+			expectedState: models.ScheduleDone,
+			clientStatus:  models.ClientSuspended,
+		},
+		{
+			name:          "Due change with an end is started",
+			body:          `{"status":"paused","reason":"vacation","startsAt":"2020-01-01T00:00:00Z","endsAt":"2099-01-01T00:00:00Z"}`,
+			expectedState: models.ScheduleStarted,
+			clientStatus:  models.ClientPaused,
+		},
+		{
+			name:          "Future change is pending",
+			body:          `{"status":"paused","reason":"vacation","startsAt":"2099-07-03T18:00:00Z"}`,
+			expectedState: models.SchedulePending,
+			clientStatus:  models.ClientActive,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := db.InitDB(":memory:")
+			defer database.Close()
+			setupEligibleClientsDatabase(database, []models.Client{
+				{ID: "a", Name: "A", LeadCapacity: 10, WorkingHours: allDay()},
+			})
+			mux := http.NewServeMux()
+			SetupRoutes(mux, database)
+
+			req, _ := http.NewRequest("POST", "/client/a/schedules", bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+			var schedule models.StatusSchedule
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &schedule))
+			assert.Equal(t, tc.expectedState, schedule.State)
+			stored, err := database.GetStatusSchedule(context.Background(), "a", schedule.ID)
+			require.NoError(t, err)
+			assert.Equal(t, stored, &schedule)
+
+			client, err := database.GetClientByID(context.Background(), "a")
+			require.NoError(t, err)
+			assert.Equal(t, tc.clientStatus, client.Status)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/logging"
+	"lead_management/pkg/models"
+	"lead_management/pkg/utils"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// CreateWebhookRequest is used to decode the JSON request payload.
+type CreateWebhookRequest struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"eventTypes"`
+}
+
+// ClientWebhooksHandler lists (GET) or registers (POST) a client's webhooks.
+// The signing secret is only returned in the response to the POST.
+func ClientWebhooksHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID := r.PathValue("id")
+		switch r.Method {
+		case "GET":
+			webhooks, err := db.GetWebhooksByClient(r.Context(), clientID)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to fetch webhooks", "client", clientID, "error", err)
+				http.Error(w, "Failed to fetch webhooks", http.StatusInternalServerError)
+				return
+			}
+			if webhooks == nil {
+				webhooks = []models.Webhook{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(webhooks)
+		case "POST":
+			createWebhook(db, w, r, clientID)
+		default:
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func createWebhook(db *db.DB, w http.ResponseWriter, r *http.Request, clientID string) {
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Invalid webhook URL", http.StatusBadRequest)
+		return
+	}
+	if len(req.EventTypes) == 0 {
+		req.EventTypes = models.WebhookEventTypes
+	}
+	for _, t := range req.EventTypes {
+		if !slices.Contains(models.WebhookEventTypes, t) {
+			http.Error(w, "Unknown event type: "+t, http.StatusBadRequest)
+			return
+		}
+	}
+
+	logger := logging.FromContext(r.Context())
+	client, err := db.GetClientByID(r.Context(), clientID)
+	if err != nil {
+		logger.Error("failed to fetch client", "id", clientID, "error", err)
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+	if client == nil {
+		http.Error(w, "Client not found", http.StatusNotFound)
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		secret = generateSecret()
+	}
+	webhook := models.Webhook{
+		ID:         utils.GenerateUUID(),
+		ClientID:   clientID,
+		URL:        req.URL,
+		Secret:     secret,
+		EventTypes: req.EventTypes,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := db.CreateWebhook(r.Context(), webhook); err != nil {
+		logger.Error("failed to create webhook", "error", err)
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// generateSecret returns a random 256-bit signing secret.
+func generateSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// DeleteWebhookHandler removes a client's webhook.
+func DeleteWebhookHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		clientID, webhookID := r.PathValue("id"), r.PathValue("webhookId")
+		found, err := db.DeleteWebhook(r.Context(), clientID, webhookID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to delete webhook", "id", webhookID, "error", err)
+			http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// WebhookDeliveriesHandler lists the delivery log, optionally filtered by the
+// clientId and status query parameters.
+func WebhookDeliveriesHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		writeDeliveries(db, w, r, query.Get("clientId"), query.Get("status"))
+	}
+}
+
+// DeadLettersHandler lists deliveries that exhausted their attempts.
+func DeadLettersHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		writeDeliveries(db, w, r, r.URL.Query().Get("clientId"), models.DeliveryDead)
+	}
+}
+
+func writeDeliveries(db *db.DB, w http.ResponseWriter, r *http.Request, clientID, status string) {
+	deliveries, err := db.GetWebhookDeliveries(r.Context(), clientID, status)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to fetch webhook deliveries", "error", err)
+		http.Error(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// ReplayDeliveryHandler queues a dead-lettered delivery to be sent again.
+func ReplayDeliveryHandler(db *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.PathValue("id")
+		found, err := db.ReplayWebhookDelivery(r.Context(), id)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to replay webhook delivery", "id", id, "error", err)
+			http.Error(w, "Failed to replay webhook delivery", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Dead-lettered delivery not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientWebhooksHandler(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	setupDatabase(database)
+
+	mux := http.NewServeMux()
+	SetupRoutes(mux, database)
+
+	serve := func(method, url, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		body         string
+		expectedCode int
+	}{
+		{name: "Unknown client", method: "POST", url: "/client/2/webhooks", body: `{"url":"https://example.com/hook"}`, expectedCode: http.StatusNotFound},
+		{name: "Invalid URL", method: "POST", url: "/client/1/webhooks", body: `{"url":"ftp://example.com"}`, expectedCode: http.StatusBadRequest},
+		{name: "Unknown event type", method: "POST", url: "/client/1/webhooks", body: `{"url":"https://example.com/hook","eventTypes":["lead.lost"]}`, expectedCode: http.StatusBadRequest},
+		{name: "Incorrect HTTP method", method: "PUT", url: "/client/1/webhooks", expectedCode: http.StatusMethodNotAllowed},
+		{name: "Delete unknown webhook", method: "DELETE", url: "/client/1/webhooks/nope", expectedCode: http.StatusNotFound},
+		{name: "Replay unknown delivery", method: "POST", url: "/webhooks/deliveries/nope/replay", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := serve(tc.method, tc.url, tc.body)
+			assert.Equal(t, tc.expectedCode, rr.Code)
+		})
+	}
+
+	t.Run("Create, list and delete", func(t *testing.T) {
+		rr := serve("POST", "/client/1/webhooks", `{"url":"https://example.com/hook"}`)
+		require.Equal(t, http.StatusCreated, rr.Code)
+		var created models.Webhook
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+		assert.Len(t, created.Secret, 64, "generated secret is returned once")
+		assert.Equal(t, models.WebhookEventTypes, created.EventTypes)
+
+		rr = serve("GET", "/client/1/webhooks", "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		var listed []models.Webhook
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+		require.Len(t, listed, 1)
+		assert.Equal(t, created.ID, listed[0].ID)
+		assert.Empty(t, listed[0].Secret)
+
+		rr = serve("DELETE", "/client/1/webhooks/"+created.ID, "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	})
+}
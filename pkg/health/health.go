@@ -0,0 +1,141 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports whether a dependency is usable. A nil error means healthy.
+type Check func(ctx context.Context) error
+
+// Status values used in reports.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckResult is the outcome of a single readiness check.
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the readiness breakdown returned by Checker.Check.
+type Report struct {
+	Ready  bool                   `json:"ready"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// ErrDraining is reported while the server is shutting down.
+var ErrDraining = errors.New("server is shutting down")
+
+// Checker aggregates dependency checks, background worker heartbeats and the
+// shutdown state into a readiness report.
+type Checker struct {
+	mu         sync.Mutex
+	checks     map[string]Check
+	heartbeats map[string]*Heartbeat
+	draining   atomic.Bool
+}
+
+// NewChecker returns a Checker with no checks registered.
+func NewChecker() *Checker {
+	return &Checker{
+		checks:     make(map[string]Check),
+		heartbeats: make(map[string]*Heartbeat),
+	}
+}
+
+// Default is the checker served by the readiness endpoint.
+var Default = NewChecker()
+
+// AddCheck registers a named dependency check, replacing any check with the same name.
+func (c *Checker) AddCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Heartbeat registers a background worker that must call Beat at least once
+// every maxAge to be considered alive. The worker counts as alive when registered.
+func (c *Checker) Heartbeat(name string, maxAge time.Duration) *Heartbeat {
+	h := &Heartbeat{maxAge: maxAge}
+	h.Beat()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.heartbeats[name] = h
+	return h
+}
+
+// SetDraining marks the server as shutting down, making it permanently not ready.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Check runs all registered checks and returns the readiness breakdown.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	heartbeats := make(map[string]*Heartbeat, len(c.heartbeats))
+	for name, h := range c.heartbeats {
+		heartbeats[name] = h
+	}
+	c.mu.Unlock()
+
+	report := Report{Ready: true, Checks: make(map[string]CheckResult)}
+	record := func(name string, err error) {
+		if err != nil {
+			report.Ready = false
+			report.Checks[name] = CheckResult{Status: StatusFail, Error: err.Error()}
+			return
+		}
+		report.Checks[name] = CheckResult{Status: StatusOK}
+	}
+
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		record(name, checks[name](ctx))
+	}
+	for name, h := range heartbeats {
+		record("worker:"+name, h.check())
+	}
+
+	var err error
+	if c.draining.Load() {
+		err = ErrDraining
+	}
+	record("shutdown", err)
+
+	return report
+}
+
+// Heartbeat tracks the liveness of a background worker.
+type Heartbeat struct {
+	maxAge time.Duration
+	last   atomic.Int64 // unix nanoseconds of the last beat
+}
+
+// Beat records that the worker is alive.
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+func (h *Heartbeat) check() error {
+	age := time.Since(time.Unix(0, h.last.Load()))
+	if age > h.maxAge {
+		return fmt.Errorf("last heartbeat %s ago, expected within %s", age.Round(time.Millisecond), h.maxAge)
+	}
+	return nil
+}
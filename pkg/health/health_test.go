@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+	tests := []struct {
+		name          string
+		setup         func(c *Checker)
+		expectedReady bool
+		expected      map[string]string
+	}{
+		{
+			name: "All checks pass",
+			setup: func(c *Checker) {
+				c.AddCheck("database", func(ctx context.Context) error { return nil })
+				c.Heartbeat("webhooks", time.Minute)
+			},
+			expectedReady: true,
+			expected:      map[string]string{"database": StatusOK, "worker:webhooks": StatusOK, "shutdown": StatusOK},
+		},
+		{
+			name: "Failing dependency",
+			setup: func(c *Checker) {
+				c.AddCheck("database", func(ctx context.Context) error { return errors.New("connection refused") })
+			},
+			expectedReady: false,
+			expected:      map[string]string{"database": StatusFail, "shutdown": StatusOK},
+		},
+		{
+			name: "Stale heartbeat",
+			setup: func(c *Checker) {
+				h := c.Heartbeat("scheduler", time.Minute)
+				h.last.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+			},
+			expectedReady: false,
+			expected:      map[string]string{"worker:scheduler": StatusFail, "shutdown": StatusOK},
+		},
+		{
+			name: "Draining",
+			setup: func(c *Checker) {
+				c.SetDraining()
+			},
+			expectedReady: false,
+			expected:      map[string]string{"shutdown": StatusFail},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewChecker()
+			tc.setup(c)
+
+			report := c.Check(context.Background())
+
+			assert.Equal(t, tc.expectedReady, report.Ready)
+			assert.Len(t, report.Checks, len(tc.expected))
+			for name, status := range tc.expected {
+				assert.Equal(t, status, report.Checks[name].Status, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Package identity normalizes the contact details of leads so that two
+// leads from the same person can be matched however the details were typed.
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// minPhoneDigits is the fewest digits a phone number key is made from.
+// Shorter numbers are too likely to be typos or extensions to match on.
+const minPhoneDigits = 6
+
+// E.164 numbers have at most 15 digits, including the country code, and in
+// practice no fewer than 8.
+const (
+	minE164Digits = 8
+	maxE164Digits = 15
+)
+
+// Email returns the matching key of an email address: trimmed and lower
+// case. It returns "" if the address has no local part or domain.
+func Email(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" || domain == "" || strings.Contains(domain, "@") {
+		return ""
+	}
+	return email
+}
+
+// Phone returns the matching key of a phone number: its digits, preceded by
+// "+" if the number is written in international form with a leading "+" or
+// "00". It returns "" if the number has fewer than minPhoneDigits digits.
+func Phone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	key := digits.String()
+	international := strings.HasPrefix(phone, "+")
+	if !international && strings.HasPrefix(key, "00") {
+		key, international = key[2:], true
+	}
+	if len(key) < minPhoneDigits {
+		return ""
+	}
+	if international {
+		return "+" + key
+	}
+	return key
+}
+
+// E164 returns the phone number in E.164 form, e.g. "+445550123456".
+// Numbers not written in international form are taken to be national
+// numbers of countryCode, the calling code without "+", dropping a leading
+// trunk "0". It returns "" if the number has no country code and
+// countryCode is empty, or is too short or too long to be valid.
+func E164(phone, countryCode string) string {
+	key := Phone(phone)
+	if key == "" {
+		return ""
+	}
+	if !strings.HasPrefix(key, "+") {
+		if countryCode == "" {
+			return ""
+		}
+		key = "+" + countryCode + strings.TrimPrefix(key, "0")
+	}
+	if n := len(key) - 1; n < minE164Digits || n > maxE164Digits {
+		return ""
+	}
+	return key
+}
+
+// NamePostcode returns the matching key of a name and postcode: a hash of
+// both, ignoring case, punctuation and spacing. It returns "" if either is
+// empty.
+func NamePostcode(name, postcode string) string {
+	name, postcode = strings.Join(words(name), " "), strings.Join(words(postcode), "")
+	if name == "" || postcode == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(name + "\x00" + postcode))
+	return hex.EncodeToString(sum[:])
+}
+
+// words returns the lower-case runs of letters and digits in s.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
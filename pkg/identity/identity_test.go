@@ -0,0 +1,84 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		want  string
+	}{
+		{"Plain", "jane@example.com", "jane@example.com"},
+		{"Case and spaces", "  Jane.Doe@Example.COM ", "jane.doe@example.com"},
+		{"Empty", "", ""},
+		{"No at sign", "jane.example.com", ""},
+		{"No local part", "@example.com", ""},
+		{"No domain", "jane@", ""},
+		{"Two at signs", "jane@doe@example.com", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Email(tc.email))
+		})
+	}
+}
+
+func TestPhone(t *testing.T) {
+	tests := []struct {
+		name  string
+		phone string
+		want  string
+	}{
+		{"Digits", "5551234567", "5551234567"},
+		{"Punctuation", "(555) 123-4567", "5551234567"},
+		{"Plus", "+1 555 123 4567", "+15551234567"},
+		{"Double zero", "001 555 123 4567", "+15551234567"},
+		{"Plus and double zero", "+00 1234567", "+001234567"},
+		{"Too short", "12-34", ""},
+		{"Empty", "", ""},
+		{"No digits", "n/a", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Phone(tc.phone))
+		})
+	}
+}
+
+func TestE164(t *testing.T) {
+	tests := []struct {
+		name        string
+		phone       string
+		countryCode string
+		want        string
+	}{
+		{"International", "+44 20 7946 0958", "", "+442079460958"},
+		{"Double zero", "0044 20 7946 0958", "1", "+442079460958"},
+		{"National with trunk zero", "020 7946 0958", "44", "+442079460958"},
+		{"National without trunk zero", "(555) 123-4567", "1", "+15551234567"},
+		{"National without country code", "020 7946 0958", "", ""},
+		{"Too short", "+1 234 567", "", ""},
+		{"Too long", "+1 2345 6789 0123 456", "", ""},
+		{"Empty", "", "44", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, E164(tc.phone, tc.countryCode))
+		})
+	}
+}
+
+func TestNamePostcode(t *testing.T) {
+	key := NamePostcode("Jane Doe", "SW1A 1AA")
+	assert.Len(t, key, 64)
+	assert.Equal(t, key, NamePostcode("  jane   DOE ", "sw1a1aa"))
+	assert.Equal(t, key, NamePostcode("Jane-Doe", "SW1A-1AA"))
+	assert.NotEqual(t, key, NamePostcode("Jane Doe", "SW1A 2AA"))
+	assert.NotEqual(t, key, NamePostcode("John Doe", "SW1A 1AA"))
+	assert.Empty(t, NamePostcode("", "SW1A 1AA"))
+	assert.Empty(t, NamePostcode("Jane Doe", " "))
+}
@@ -0,0 +1,86 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// component is a registered part of the application that must be stopped on shutdown.
+type component struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// Manager stops registered components in the reverse order of registration,
+// so anything registered early, like the database, outlives everything that
+// depends on it.
+type Manager struct {
+	mu         sync.Mutex
+	components []component
+	stopped    bool
+}
+
+// New returns an empty Manager.
+func New() *Manager {
+	return &Manager{}
+}
+
+// Register adds a component whose stop function is called on shutdown. Stop
+// functions should flush in-flight work and return when ctx is done.
+func (m *Manager) Register(name string, stop func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, component{name: name, stop: stop})
+}
+
+// Go runs a background worker until shutdown. The worker's context is
+// cancelled when the worker's turn to stop comes, and shutdown waits for run
+// to return, or for the shutdown deadline, before moving on.
+func (m *Manager) Go(name string, run func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+	m.Register(name, func(stopCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
+		}
+	})
+}
+
+// Shutdown stops all components in reverse registration order. Every component
+// is given a chance to stop even if an earlier one failed or the deadline in
+// ctx passed; the errors are joined. Calling Shutdown again does nothing.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return nil
+	}
+	m.stopped = true
+	components := m.components
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		start := time.Now()
+		if err := c.stop(ctx); err != nil {
+			slog.Error("component failed to stop", "component", c.name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			continue
+		}
+		slog.Info("component stopped", "component", c.name, "duration", time.Since(start))
+	}
+	return errors.Join(errs...)
+}
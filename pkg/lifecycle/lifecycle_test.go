@@ -0,0 +1,84 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	m := New()
+	m.Register("database", record("database"))
+	m.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		record("worker")(ctx)
+	})
+	m.Register("http", record("http"))
+
+	require.NoError(t, m.Shutdown(context.Background()))
+	assert.Equal(t, []string{"http", "worker", "database"}, order)
+
+	// A second shutdown is a no-op.
+	require.NoError(t, m.Shutdown(context.Background()))
+	assert.Len(t, order, 3)
+}
+
+func TestShutdownContinuesAfterErrors(t *testing.T) {
+	stopped := false
+	m := New()
+	m.Register("database", func(context.Context) error {
+		stopped = true
+		return nil
+	})
+	m.Register("http", func(context.Context) error { return errors.New("boom") })
+
+	err := m.Shutdown(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "http: boom")
+	assert.True(t, stopped)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	m := New()
+	release := make(chan struct{})
+	defer close(release)
+	m.Go("stuck", func(ctx context.Context) {
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := m.Shutdown(ctx)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestGoWaitsForInFlightWork(t *testing.T) {
+	m := New()
+	flushed := false
+	m.Go("sender", func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond) // simulate flushing a final batch
+		flushed = true
+	})
+
+	require.NoError(t, m.Shutdown(context.Background()))
+	assert.True(t, flushed)
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Options configures the application logger.
+type Options struct {
+	Level  string // debug, info, warn or error
+	Format string // json or text
+	Redact bool   // mask personal data such as names, emails and phones
+}
+
+// contextKey is the type used for values stored in a context by this package.
+type contextKey struct{}
+
+// New builds a logger writing to w according to the given options.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	if opts.Redact {
+		handlerOpts.ReplaceAttr = RedactAttr
+	}
+
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, handlerOpts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, handlerOpts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+}
+
+// Setup builds a logger and installs it as the slog and log package default.
+func Setup(w io.Writer, opts Options) error {
+	logger, err := New(w, opts)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// ParseLevel converts a level name into a slog.Level. An empty name means info.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+	return level, nil
+}
+
+// WithContext returns a copy of ctx carrying the given logger.
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the request-scoped logger stored in ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lead_management/pkg/models"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    slog.Level
+		expectedErr bool
+	}{
+		{name: "Empty defaults to info", input: "", expected: slog.LevelInfo},
+		{name: "Debug", input: "debug", expected: slog.LevelDebug},
+		{name: "Upper case warn", input: "WARN", expected: slog.LevelWarn},
+		{name: "Unknown level", input: "verbose", expectedErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			level, err := ParseLevel(tc.input)
+			if tc.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, level)
+		})
+	}
+}
+
+func TestNewRejectsUnknownFormat(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, Options{Format: "xml"})
+	require.Error(t, err)
+}
+
+func TestRedaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		redact   bool
+		expected map[string]string
+	}{
+		{
+			name:   "Redaction enabled",
+			redact: true,
+			expected: map[string]string{
+				"name":  "A***",
+				"email": "a***@example.com",
+				"phone": "***67",
+			},
+		},
+		{
+			name:   "Redaction disabled",
+			redact: false,
+			expected: map[string]string{
+				"name":  "Alice",
+				"email": "alice@example.com",
+				"phone": "+49 170 1234567",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := New(&buf, Options{Format: "json", Redact: tc.redact})
+			require.NoError(t, err)
+
+			logger.Info("lead received", "name", "Alice", "email", "alice@example.com", "phone", "+49 170 1234567")
+
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+			for key, value := range tc.expected {
+				assert.Equal(t, value, entry[key], key)
+			}
+		})
+	}
+}
+
+func TestRedactionOfNestedClient(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Format: "json", Redact: true})
+	require.NoError(t, err)
+
+	logger.Info("client created", "client", models.Client{ID: "1", Name: "Acme Corp"})
+
+	var entry struct {
+		Client map[string]any `json:"client"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "1", entry.Client["id"])
+	assert.Equal(t, "A***", entry.Client["name"])
+}
+
+func TestFromContext(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+
+	assert.Equal(t, slog.Default(), FromContext(context.Background()))
+	assert.Equal(t, logger, FromContext(WithContext(context.Background(), logger)))
+}
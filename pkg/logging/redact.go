@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// redactedKeys lists the attribute keys whose values are treated as personal data.
+var redactedKeys = map[string]func(string) string{
+	"name":  maskName,
+	"email": maskEmail,
+	"phone": maskPhone,
+}
+
+// RedactAttr is a slog ReplaceAttr function that masks personal data.
+// It applies to attributes at any group depth, so nested values such as
+// a client logged via its LogValue method are masked as well.
+func RedactAttr(groups []string, a slog.Attr) slog.Attr {
+	mask, ok := redactedKeys[strings.ToLower(a.Key)]
+	if !ok || a.Value.Kind() != slog.KindString {
+		return a
+	}
+	return slog.String(a.Key, mask(a.Value.String()))
+}
+
+// Mask masks value according to the redaction rule for key. Values under
+// keys that are not considered personal data are returned unchanged.
+func Mask(key, value string) string {
+	if mask, ok := redactedKeys[strings.ToLower(key)]; ok {
+		return mask(value)
+	}
+	return value
+}
+
+// maskName keeps the first character of a name, e.g. "Alice" -> "A***".
+func maskName(s string) string {
+	if s == "" {
+		return ""
+	}
+	r := []rune(s)
+	return string(r[0]) + "***"
+}
+
+// maskEmail keeps the first character of the local part and the domain,
+// e.g. "alice@example.com" -> "a***@example.com".
+func maskEmail(s string) string {
+	at := strings.LastIndex(s, "@")
+	if at < 0 {
+		return maskName(s)
+	}
+	return maskName(s[:at]) + s[at:]
+}
+
+// maskPhone keeps only the last two digits, e.g. "+49 170 1234567" -> "***67".
+func maskPhone(s string) string {
+	var digits []rune
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) <= 2 {
+		return "***"
+	}
+	return "***" + string(digits[len(digits)-2:])
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import "time"
+
+// Application metrics, registered with the Default registry.
+var (
+	// HTTPRequests counts handled requests per route, method and status code.
+	HTTPRequests = Default.NewCounter("http_requests_total",
+		"Total number of HTTP requests handled.", "route", "method", "status")
+
+	// HTTPRequestDuration observes request latency per route and status code.
+	HTTPRequestDuration = Default.NewHistogram("http_request_duration_seconds",
+		"HTTP request latency in seconds.", DefaultBuckets, "route", "status")
+
+	// LeadAssignments counts assignment attempts per client and outcome.
+	LeadAssignments = Default.NewCounter("lead_assignments_total",
+		"Total number of lead assignment attempts by client and outcome.", "client", "outcome")
+
+	// NoEligibleClient counts assignment attempts for which no client was eligible.
+	NoEligibleClient = Default.NewCounter("lead_no_eligible_client_total",
+		"Total number of lead assignment attempts with no eligible client.")
+
+	// DBQueryDuration observes database call latency per operation.
+	DBQueryDuration = Default.NewHistogram("db_query_duration_seconds",
+		"Database query latency in seconds.", DefaultBuckets, "operation")
+
+	// PendingQueueDepth is the number of queued leads waiting to be assigned.
+	PendingQueueDepth = Default.NewGauge("lead_pending_queue_depth",
+		"Number of leads waiting for an eligible client.")
+
+	// ClientUtilization is each client's current lead count divided by its capacity.
+	ClientUtilization = Default.NewGauge("client_utilization_ratio",
+		"Ratio of current lead count to lead capacity per client.", "client")
+)
+
+func init() {
+	// Unlabelled series are exposed as zero from the start so dashboards
+	// and alerts see them before the first event.
+	NoEligibleClient.Add(0)
+	PendingQueueDepth.Set(0)
+}
+
+// Assignment outcomes used as the outcome label of LeadAssignments.
+const (
+	OutcomeAssigned   = "assigned"
+	OutcomeNoEligible = "no_eligible_client"
+	OutcomeDuplicate  = "duplicate"
+	OutcomeError      = "error"
+)
+
+// ObserveQuery records the duration of a database operation started at start.
+// It is meant to be deferred: defer metrics.ObserveQuery("get_client", time.Now()).
+func ObserveQuery(operation string, start time.Time) {
+	DBQueryDuration.Observe(time.Since(start).Seconds(), operation)
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteText(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(r *Registry)
+		expected string
+	}{
+		{
+			name: "Counter with labels",
+			setup: func(r *Registry) {
+				c := r.NewCounter("requests_total", "Requests.", "route", "status")
+				c.Inc("/a", "200")
+				c.Add(2, "/a", "200")
+				c.Inc("/b", "404")
+			},
+			expected: "# HELP requests_total Requests.\n" +
+				"# TYPE requests_total counter\n" +
+				"requests_total{route=\"/a\",status=\"200\"} 3\n" +
+				"requests_total{route=\"/b\",status=\"404\"} 1\n",
+		},
+		{
+			name: "Gauge without labels",
+			setup: func(r *Registry) {
+				g := r.NewGauge("queue_depth", "Depth.")
+				g.Set(5)
+				g.Add(-2)
+			},
+			expected: "# HELP queue_depth Depth.\n" +
+				"# TYPE queue_depth gauge\n" +
+				"queue_depth 3\n",
+		},
+		{
+			name: "Histogram",
+			setup: func(r *Registry) {
+				h := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "op")
+				h.Observe(0.05, "get")
+				h.Observe(0.5, "get")
+				h.Observe(3, "get")
+			},
+			expected: "# HELP latency_seconds Latency.\n" +
+				"# TYPE latency_seconds histogram\n" +
+				"latency_seconds_bucket{op=\"get\",le=\"0.1\"} 1\n" +
+				"latency_seconds_bucket{op=\"get\",le=\"1\"} 2\n" +
+				"latency_seconds_bucket{op=\"get\",le=\"+Inf\"} 3\n" +
+				"latency_seconds_sum{op=\"get\"} 3.55\n" +
+				"latency_seconds_count{op=\"get\"} 3\n",
+		},
+		{
+			name: "Label values are escaped",
+			setup: func(r *Registry) {
+				r.NewCounter("escaped_total", "Escaped.", "v").Inc("a\"b\\c\nd")
+			},
+			expected: "# HELP escaped_total Escaped.\n" +
+				"# TYPE escaped_total counter\n" +
+				"escaped_total{v=\"a\\\"b\\\\c\\nd\"} 1\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry()
+			tc.setup(r)
+
+			var buf bytes.Buffer
+			require.NoError(t, r.WriteText(&buf))
+			assert.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
+
+func TestGaugeReset(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("utilization", "Utilization.", "client")
+	g.Set(0.5, "1")
+	g.Reset()
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	assert.NotContains(t, buf.String(), `client="1"`)
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("dup_total", "Dup.")
+	assert.Panics(t, func() { r.NewCounter("dup_total", "Dup.") })
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("hits_total", "Hits.").Inc()
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	assert.Contains(t, rr.Body.String(), "hits_total 1\n")
+}
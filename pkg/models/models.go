@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"log/slog"
 	"time"
 )
 
@@ -11,5 +13,480 @@ type Client struct {
 	Priority         int          `json:"priority"`
 	LeadCapacity     int          `json:"leadCapacity"`
 	CurrentLeadCount int          `json:"currentLeadCount"`
-	WorkingHours     [2]time.Time `json:"workingHours"` // Client opening and closing times
+	WorkingHours     [2]time.Time `json:"workingHours"` // Client opening and closing times, in UTC
+	// Version starts at 1 and is incremented by every change to the client's
+	// settings. Assigned leads only change CurrentLeadCount and leave it as
+	// it is. It is the client's ETag.
+	Version int `json:"version"`
+	// GroupID is the group the client belongs to, if any.
+	GroupID string `json:"groupId,omitempty"`
+	// Attributes holds the values of custom attributes by name.
+	Attributes map[string]any `json:"attributes,omitempty"`
+	// Criteria restrict the leads the client accepts. A client without
+	// criteria accepts any lead.
+	Criteria []Criterion `json:"criteria,omitempty"`
+	// Rule is an expression lead attributes and the time must satisfy for
+	// the client to be eligible, in the language of the rules package.
+	Rule string `json:"rule,omitempty"`
+	// Timezone is the IANA time zone rules are evaluated in; empty means UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Share is the percentage of leads the client should receive under the
+	// share strategy. Shares are relative to the sum of all clients' shares,
+	// so they need not add up to 100. Clients without a share are only
+	// chosen when no client with one is eligible.
+	Share float64 `json:"share,omitempty"`
+	// Pacing spreads the client's remaining capacity across its working
+	// hours: a paced client is not eligible while it is ahead of its pace.
+	// Empty means unpaced.
+	Pacing string `json:"pacing,omitempty"`
+	// PacingCurve holds a relative weight for each hour of the day, 0 to
+	// 23, in curve pacing.
+	PacingCurve []float64 `json:"pacingCurve,omitempty"`
+	// ThroughputLimits cap the leads the client is assigned within sliding
+	// windows, whatever its capacity.
+	ThroughputLimits []ThroughputLimit `json:"throughputLimits,omitempty"`
+	// Status is active, paused or suspended; only active clients are
+	// eligible for leads. StatusReason says why the status was set.
+	Status       string `json:"status"`
+	StatusReason string `json:"statusReason,omitempty"`
+	// Fallbacks are the IDs of the clients, in order, that receive the
+	// leads the client would be preferred for while it cannot take them.
+	Fallbacks []string `json:"fallbacks,omitempty"`
+}
+
+// Client statuses.
+const (
+	ClientActive    = "active"
+	ClientPaused    = "paused"
+	ClientSuspended = "suspended"
+)
+
+// ClientStatuses lists the valid client statuses.
+var ClientStatuses = []string{ClientActive, ClientPaused, ClientSuspended}
+
+// StatusSchedule changes a client's status to Status at StartsAt. If EndsAt
+// is set, the status the client had before is restored at EndsAt, unless
+// the status was changed again in between.
+type StatusSchedule struct {
+	ID       string     `json:"id"`
+	ClientID string     `json:"clientId"`
+	Status   string     `json:"status"`
+	Reason   string     `json:"reason,omitempty"`
+	StartsAt time.Time  `json:"startsAt"`
+	EndsAt   *time.Time `json:"endsAt,omitempty"`
+	// State is pending until the change is applied at StartsAt, started
+	// until the previous status is restored at EndsAt, and then done.
+	State string `json:"state"`
+	// PreviousStatus and PreviousReason are what the client had when the
+	// change was applied.
+	PreviousStatus string    `json:"previousStatus,omitempty"`
+	PreviousReason string    `json:"previousReason,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// Status schedule states.
+const (
+	SchedulePending = "pending"
+	ScheduleStarted = "started"
+	ScheduleDone    = "done"
+)
+
+// ThroughputLimit allows at most MaxLeads leads to be assigned to a client
+// within any window of length Per, a duration such as "1h" or "5m".
+type ThroughputLimit struct {
+	MaxLeads int    `json:"maxLeads"`
+	Per      string `json:"per"`
+}
+
+// Pacing modes.
+const (
+	PacingEven        = "even"         // at a constant rate
+	PacingFrontLoaded = "front_loaded" // fastest at the start, slowing down
+	PacingCurve       = "curve"        // following the client's PacingCurve
+)
+
+// Pacing is a paced client's progress through its current working window,
+// or the last one if it is closed.
+type Pacing struct {
+	Mode        string    `json:"mode"`
+	WindowStart time.Time `json:"windowStart"`
+	WindowEnd   time.Time `json:"windowEnd"`
+	// Budget is the capacity the client had left when the window opened.
+	Budget int `json:"budget"`
+	// Delivered is the number of leads assigned since the window opened.
+	Delivered int `json:"delivered"`
+	// Target is the number of leads the pace allows by now.
+	Target float64 `json:"target"`
+	// Ahead is set when more than Target leads were delivered, which makes
+	// the client ineligible until the pace catches up.
+	Ahead bool `json:"ahead"`
+}
+
+// Criterion restricts the leads a client accepts by one lead attribute. A
+// lead meets it if it has the attribute, with one of the In values when In
+// is given, and within Min and Max when they are given.
+type Criterion struct {
+	Attribute string   `json:"attribute"`
+	In        []any    `json:"in,omitempty"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+}
+
+// LogValue implements slog.LogValuer so clients are logged as structured
+// groups that the redaction policy can inspect field by field.
+func (c Client) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", c.ID),
+		slog.String("name", c.Name),
+		slog.Int("priority", c.Priority),
+		slog.Int("leadCapacity", c.LeadCapacity),
+		slog.Int("currentLeadCount", c.CurrentLeadCount),
+		slog.String("workingHoursStart", c.WorkingHours[0].Format("15:04")),
+		slog.String("workingHoursEnd", c.WorkingHours[1].Format("15:04")),
+		slog.String("groupId", c.GroupID),
+		slog.String("status", c.Status),
+	)
+}
+
+// Lead represents a lead. A queued lead is waiting for an eligible client
+// and has no ClientID or AssignedAt yet. A duplicate lead is never assigned;
+// it is attached to the original lead it duplicates, given by DuplicateOf.
+// A merged lead has been combined into the lead given by DuplicateOf.
+type Lead struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Phone      string    `json:"phone"`
+	Status     string    `json:"status"`
+	ClientID   string    `json:"clientId"`
+	AssignedAt time.Time `json:"assignedAt"`
+	ReceivedAt time.Time `json:"receivedAt"`
+	// Attributes holds the values of custom attributes by name.
+	Attributes map[string]any `json:"attributes,omitempty"`
+	// FallbackFrom is the preferred client whose fallback chain the lead
+	// was assigned through, and FallbackStep the 1-based position in the
+	// chain of the client it went to.
+	FallbackFrom string `json:"fallbackFrom,omitempty"`
+	FallbackStep int    `json:"fallbackStep,omitempty"`
+	// StickyFrom is the earlier lead from the same person whose client the
+	// lead was assigned to by sticky routing.
+	StickyFrom string `json:"stickyFrom,omitempty"`
+	// DuplicateOf is the lead a duplicate is attached to or a merged lead
+	// was combined into.
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+}
+
+// Lead statuses.
+const (
+	LeadAssigned  = "assigned"
+	LeadQueued    = "queued"
+	LeadDuplicate = "duplicate"
+	LeadMerged    = "merged"
+)
+
+// LeadStatuses lists all lead statuses.
+var LeadStatuses = []string{LeadAssigned, LeadQueued, LeadDuplicate, LeadMerged}
+
+// LogValue implements slog.LogValuer so personal data in leads can be redacted.
+func (l Lead) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", l.ID),
+		slog.String("name", l.Name),
+		slog.String("email", l.Email),
+		slog.String("phone", l.Phone),
+		slog.String("status", l.Status),
+		slog.String("clientId", l.ClientID),
+	)
+}
+
+// Activity event types.
+const (
+	EventClientCreated     = "client.created"
+	EventClientUpdated     = "client.updated"
+	EventLeadAssigned      = "lead.assigned"
+	EventLeadQueued        = "lead.queued"
+	EventCapacityExhausted = "client.capacity_exhausted"
+	EventGroupUpdated      = "group.updated"
+)
+
+// EventTypes lists all activity event types.
+var EventTypes = []string{EventClientCreated, EventClientUpdated, EventLeadAssigned, EventLeadQueued, EventCapacityExhausted, EventGroupUpdated}
+
+// Event is the envelope in which activity is delivered to subscribers.
+// Sequence orders events and identifies them in the event stream.
+type Event struct {
+	ID        string          `json:"id"`
+	Sequence  int64           `json:"sequence"`
+	Type      string          `json:"type"`
+	ClientID  string          `json:"clientId"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// WebhookEventTypes lists the event types a webhook may subscribe to. Queued
+// leads belong to no client yet and groups to none at all, so lead.queued and
+// group.updated are only available as a stream.
+var WebhookEventTypes = []string{EventClientCreated, EventClientUpdated, EventLeadAssigned, EventCapacityExhausted}
+
+// Webhook is an endpoint registered by a client to be notified of events.
+type Webhook struct {
+	ID         string    `json:"id"`
+	ClientID   string    `json:"clientId"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"` // only returned when the webhook is created
+	EventTypes []string  `json:"eventTypes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"   // waiting for its first or next attempt
+	DeliverySucceeded = "succeeded" // the endpoint answered with a 2xx status
+	DeliveryDead      = "dead"      // all attempts failed; can be replayed manually
+)
+
+// WebhookDelivery is one event to be delivered to one webhook, with its attempt history.
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhookId"`
+	EventType      string          `json:"eventType"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"lastError,omitempty"`
+	LastStatusCode int             `json:"lastStatusCode,omitempty"`
+	NextAttemptAt  time.Time       `json:"nextAttemptAt"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+
+	// URL and Secret are copied from the webhook for the dispatcher.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// Entities recorded in the change log.
+const (
+	EntityClient     = "client"
+	EntityLead       = "lead"
+	EntityAssignment = "assignment"
+	EntityGroup      = "group"
+)
+
+// Change log operations.
+const (
+	OperationInsert = "insert"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// Change is one entry of the append-only change log. Data holds the full
+// state of the entity after the change, or before it for deletions. Cursor
+// identifies the change's position in the log and can be passed back to
+// resume after it.
+type Change struct {
+	Cursor    string          `json:"cursor"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entityId"`
+	Operation string          `json:"operation"`
+	ChangedAt time.Time       `json:"changedAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Assignment records that a lead was assigned to a client.
+type Assignment struct {
+	LeadID     string    `json:"leadId"`
+	ClientID   string    `json:"clientId"`
+	AssignedAt time.Time `json:"assignedAt"`
+}
+
+// ClientVersion is the state of a client after one of its changes.
+// Sequence orders the versions of all clients. ChangedBy names the principal
+// that made the change; it is empty for anonymous requests and background
+// work such as queued lead assignment.
+type ClientVersion struct {
+	Sequence  int64     `json:"sequence"`
+	Operation string    `json:"operation"`
+	ChangedAt time.Time `json:"changedAt"`
+	ChangedBy string    `json:"changedBy"`
+	Client    Client    `json:"client"`
+}
+
+// Reasons a client was not eligible for a lead.
+const (
+	ReasonOutsideWorkingHours = "outside_working_hours"
+	ReasonAtCapacity          = "at_capacity"
+	ReasonGroupAtCapacity     = "group_at_capacity"
+	ReasonCriteriaNotMet      = "criteria_not_met"
+	ReasonRuleNotMet          = "rule_not_met"
+	ReasonAheadOfPace         = "ahead_of_pace"
+	ReasonThroughputLimited   = "throughput_limited"
+	ReasonPaused              = "paused"
+	ReasonSuspended           = "suspended"
+)
+
+// Candidate is a client considered for a lead, in the state it had when
+// the lead was routed.
+type Candidate struct {
+	Client Client `json:"client"`
+	// Priority is the client's priority plus those of its groups.
+	Priority int      `json:"priority"`
+	Eligible bool     `json:"eligible"`
+	Reasons  []string `json:"reasons,omitempty"`
+	// Misses lists the attributes of the client's criteria the lead did
+	// not meet.
+	Misses []string `json:"misses,omitempty"`
+	// ShareDeficit is how many percentage points the client was below its
+	// target share, when routing by share and the client has one.
+	ShareDeficit *float64 `json:"shareDeficit,omitempty"`
+	// Pacing is the pacing state of a paced client.
+	Pacing *Pacing `json:"pacing,omitempty"`
+	// Throughput is the client's use of its throughput limits.
+	Throughput []ThroughputUsage `json:"throughput,omitempty"`
+}
+
+// ThroughputUsage is how much of a throughput limit a client has used in
+// the window ending now.
+type ThroughputUsage struct {
+	ThroughputLimit
+	Used      int `json:"used"`
+	Remaining int `json:"remaining"`
+}
+
+// Limits on how many leads a client can take, in Availability.
+const (
+	LimitStatus        = "status"
+	LimitWorkingHours  = "working_hours"
+	LimitCapacity      = "capacity"
+	LimitGroupCapacity = "group_capacity"
+	LimitThroughput    = "throughput"
+	LimitPacing        = "pacing"
+)
+
+// Availability is how many leads a client can take right now, leaving
+// aside the criteria and rules that depend on the lead.
+type Availability struct {
+	ClientID  string `json:"clientId"`
+	Name      string `json:"name"`
+	Available int    `json:"available"`
+	// LimitedBy names the tightest limit on Available.
+	LimitedBy  string            `json:"limitedBy"`
+	Throughput []ThroughputUsage `json:"throughput,omitempty"`
+	Pacing     *Pacing           `json:"pacing,omitempty"`
+}
+
+// Explanation describes how a lead was routed: every client considered,
+// ranked as the assignment ranks them, and the client chosen, if any.
+// Queued leads are explained against the current state of the clients.
+type Explanation struct {
+	LeadID      string    `json:"leadId"`
+	Status      string    `json:"status"`
+	ClientID    string    `json:"clientId"`
+	EvaluatedAt time.Time `json:"evaluatedAt"`
+	// Route is how an assigned lead reached its client.
+	Route      *Route      `json:"route,omitempty"`
+	Candidates []Candidate `json:"candidates"`
+}
+
+// Routes by which a lead is assigned.
+const (
+	RouteSticky   = "sticky"
+	RouteFallback = "fallback"
+	RoutePriority = "priority"
+	RouteShare    = "share"
+)
+
+// Route describes how a lead reached its client: kept with the client of
+// an earlier lead by sticky routing, passed down a fallback chain, or
+// picked by the general priority or share ordering.
+type Route struct {
+	Via string `json:"via"`
+	// StickyFrom is the earlier lead whose client the lead was kept with.
+	StickyFrom string `json:"stickyFrom,omitempty"`
+	// FallbackFrom is the preferred client whose chain the lead went down,
+	// FallbackChain that chain as it was when the lead was assigned and
+	// FallbackStep the 1-based position in it of the client it went to.
+	FallbackFrom  string   `json:"fallbackFrom,omitempty"`
+	FallbackChain []string `json:"fallbackChain,omitempty"`
+	FallbackStep  int      `json:"fallbackStep,omitempty"`
+}
+
+// Group is a set of clients and nested groups, such as the branches of one
+// agency. A LeadCapacity of 0 leaves the group uncapped; otherwise it caps
+// the leads assigned to all members together, on top of each client's own
+// capacity. Priority is added to the priority of every member.
+type Group struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	ParentID         string `json:"parentId,omitempty"`
+	Priority         int    `json:"priority"`
+	LeadCapacity     int    `json:"leadCapacity"`
+	CurrentLeadCount int    `json:"currentLeadCount"`
+	// Fallbacks are the IDs of the clients that receive the overflow of
+	// every member, after the member's own fallbacks.
+	Fallbacks []string `json:"fallbacks,omitempty"`
+}
+
+// GroupReport rolls up the clients of a group and all its subgroups.
+type GroupReport struct {
+	Group Group `json:"group"`
+	// Clients is the number of member clients, directly or through subgroups.
+	Clients int `json:"clients"`
+	// ClientCapacity and ClientLeadCount sum the members' own capacities
+	// and lead counts.
+	ClientCapacity  int `json:"clientCapacity"`
+	ClientLeadCount int `json:"clientLeadCount"`
+	// AvailableCapacity is how many more leads the members can take within
+	// their own and the groups' caps.
+	AvailableCapacity int `json:"availableCapacity"`
+	// Utilization is the group's lead count over its cap, or over the
+	// members' total capacity for an uncapped group.
+	Utilization float64       `json:"utilization"`
+	Subgroups   []GroupReport `json:"subgroups"`
+}
+
+// ShareReport compares the target shares of clients with their shares of
+// the leads assigned from Since until Until.
+type ShareReport struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	// Total is the number of leads assigned in the window.
+	Total   int           `json:"total"`
+	Clients []ClientShare `json:"clients"`
+}
+
+// ClientShare is a client's line in a ShareReport. TargetShare is the
+// client's share as a percentage of all clients' shares and ActualShare the
+// percentage of the window's leads it was assigned.
+type ClientShare struct {
+	ClientID    string  `json:"clientId"`
+	Name        string  `json:"name"`
+	Share       float64 `json:"share"`
+	TargetShare float64 `json:"targetShare"`
+	ActualShare float64 `json:"actualShare"`
+	Delivered   int     `json:"delivered"`
+	// Deficit is TargetShare minus ActualShare; the share strategy favours
+	// the eligible client with the largest.
+	Deficit float64 `json:"deficit"`
+}
+
+// Custom attribute types.
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeEnum    = "enum"
+	AttributeBoolean = "boolean"
+	AttributeDate    = "date" // formatted as YYYY-MM-DD
+)
+
+// AttributeTypes lists all custom attribute types.
+var AttributeTypes = []string{AttributeString, AttributeNumber, AttributeEnum, AttributeBoolean, AttributeDate}
+
+// AttributeDefinition declares a custom attribute of clients or leads.
+// Entity is EntityClient or EntityLead.
+type AttributeDefinition struct {
+	Entity   string   `json:"entity"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Values   []string `json:"values,omitempty"` // the allowed values of an enum
+	Required bool     `json:"required"`
 }
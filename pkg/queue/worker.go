@@ -0,0 +1,60 @@
+// Package queue assigns queued leads once a client becomes eligible.
+package queue
+
+import (
+	"context"
+	"lead_management/pkg/db"
+	"lead_management/pkg/health"
+	"log/slog"
+	"time"
+)
+
+// batchSize bounds the leads assigned per pass so shutdown is not delayed
+// by a long queue.
+const batchSize = 100
+
+// Worker retries queued leads whenever a client or group changes, which may
+// have made a client eligible, and at least every interval as working hours
+// open. New and assigned leads only take capacity, so they do not trigger a
+// pass.
+type Worker struct {
+	db        *db.DB
+	interval  time.Duration
+	heartbeat *health.Heartbeat
+}
+
+// NewWorker returns a Worker assigning leads queued in database.
+func NewWorker(database *db.DB, interval time.Duration) *Worker {
+	return &Worker{db: database, interval: interval}
+}
+
+// SetHeartbeat makes the worker report liveness on h after every pass.
+func (w *Worker) SetHeartbeat(h *health.Heartbeat) {
+	w.heartbeat = h
+}
+
+// Run assigns queued leads until ctx is cancelled. A pass in progress when
+// ctx is cancelled is completed before Run returns.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		n, err := w.db.AssignQueuedLeads(context.WithoutCancel(ctx), batchSize)
+		if err != nil {
+			slog.Error("failed to assign queued leads", "error", err)
+		} else if n > 0 {
+			slog.Info("assigned queued leads", "count", n)
+		}
+		if w.heartbeat != nil {
+			w.heartbeat.Beat()
+		}
+		// Changes committed during the pass are still signalled, so they
+		// trigger another one.
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.db.ClientsChanged():
+		}
+	}
+}
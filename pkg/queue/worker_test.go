@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"context"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerAssignsQueuedLeads(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+
+	lead, err := database.AssignLead(ctx, models.Lead{ID: "l1", Name: "Ada"})
+	require.NoError(t, err)
+	require.Equal(t, models.LeadQueued, lead.Status)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		NewWorker(database, time.Hour).Run(runCtx)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	// Creating a client wakes the worker without waiting for the interval.
+	open, _ := time.Parse("15:04", "00:00")
+	closing, _ := time.Parse("15:04", "23:59")
+	require.NoError(t, database.CreateClient(ctx, models.Client{
+		ID: "c1", Name: "Client", Priority: 1, LeadCapacity: 5, WorkingHours: [2]time.Time{open, closing},
+	}))
+
+	assert.Eventually(t, func() bool {
+		l, err := database.GetLeadByID(ctx, "l1")
+		return err == nil && l.Status == models.LeadAssigned && l.ClientID == "c1"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	n, err := database.CountQueuedLeads(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
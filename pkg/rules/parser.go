@@ -0,0 +1,274 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Kinds of tokens.
+const (
+	tokenEOF = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind int
+	pos  int
+	text string
+}
+
+// operators lists the operator tokens, longest first so that "<=" is not
+// read as "<".
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","}
+
+// keywordOperators are the words that may be written instead of operators.
+var keywordOperators = map[string]string{"and": "&&", "or": "||", "not": "!"}
+
+// lex splits a rule into tokens.
+func lex(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(source) && source[i+1] >= '0' && source[i+1] <= '9':
+			j := i
+			for j < len(source) && (source[j] >= '0' && source[j] <= '9' || source[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, pos: i, text: source[i:j]})
+			i = j
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(source) && source[j] != c {
+				if source[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(source) {
+				return nil, &Error{Position: i, Message: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokenString, pos: i, text: source[i : j+1]})
+			i = j + 1
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(source) && (source[j] == '_' || source[j] == '.' || unicode.IsLetter(rune(source[j])) || unicode.IsDigit(rune(source[j]))) {
+				j++
+			}
+			word := source[i:j]
+			if op, ok := keywordOperators[word]; ok {
+				tokens = append(tokens, token{kind: tokenOperator, pos: i, text: op})
+			} else {
+				tokens = append(tokens, token{kind: tokenIdent, pos: i, text: word})
+			}
+			i = j
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(source[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, &Error{Position: i, Message: fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, token{kind: tokenOperator, pos: i, text: op})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source), text: "end of rule"}), nil
+}
+
+// parser is a recursive descent parser over the tokens of a rule. From
+// lowest to highest precedence the operators are ||, &&, ! and the
+// comparisons ==, !=, <, <=, >, >= and in.
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given operator or identifier.
+func (p *parser) accept(text string) (token, bool) {
+	t := p.peek()
+	if (t.kind == tokenOperator || t.kind == tokenIdent) && t.text == text {
+		return p.advance(), true
+	}
+	return t, false
+}
+
+func (p *parser) expect(text string) error {
+	if t, ok := p.accept(text); !ok {
+		return &Error{Position: t.pos, Message: fmt.Sprintf("expected %q, found %q", text, t.text)}
+	}
+	return nil
+}
+
+// nest fails if the expression is nested too deeply.
+func nest(depth int, t token) error {
+	if depth > maxDepth {
+		return &Error{Position: t.pos, Message: fmt.Sprintf("rule is nested more than %d levels deep", maxDepth)}
+	}
+	return nil
+}
+
+func (p *parser) parseOr(depth int) (*node, error) {
+	if err := nest(depth, p.peek()); err != nil {
+		return nil, err
+	}
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept("||")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &node{op: "||", pos: t.pos, args: []*node{left, right}}
+	}
+}
+
+func (p *parser) parseAnd(depth int) (*node, error) {
+	left, err := p.parseNot(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept("&&")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseNot(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &node{op: "&&", pos: t.pos, args: []*node{left, right}}
+	}
+}
+
+func (p *parser) parseNot(depth int) (*node, error) {
+	if t, ok := p.accept("!"); ok {
+		if err := nest(depth+1, t); err != nil {
+			return nil, err
+		}
+		arg, err := p.parseNot(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &node{op: "!", pos: t.pos, args: []*node{arg}}, nil
+	}
+	return p.parseComparison(depth)
+}
+
+func (p *parser) parseComparison(depth int) (*node, error) {
+	left, err := p.parsePrimary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if t, ok := p.accept(op); ok {
+			right, err := p.parsePrimary(depth)
+			if err != nil {
+				return nil, err
+			}
+			return &node{op: op, pos: t.pos, args: []*node{left, right}}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary(depth int) (*node, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &Error{Position: t.pos, Message: fmt.Sprintf("invalid number %q", t.text)}
+		}
+		return &node{op: "literal", pos: t.pos, value: n}, nil
+	case tokenString:
+		text := t.text
+		if text[0] == '\'' {
+			// Read single-quoted strings as double-quoted ones.
+			text = `"` + strings.ReplaceAll(strings.ReplaceAll(text[1:len(text)-1], `\'`, `'`), `"`, `\"`) + `"`
+		}
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, &Error{Position: t.pos, Message: "invalid string " + t.text}
+		}
+		return &node{op: "literal", pos: t.pos, value: s}, nil
+	case tokenIdent:
+		return identifier(t)
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			if err := nest(depth+1, t); err != nil {
+				return nil, err
+			}
+			n, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			list := &node{op: "list", pos: t.pos}
+			if _, ok := p.accept("]"); ok {
+				return list, nil
+			}
+			for {
+				item, err := p.parsePrimary(depth)
+				if err != nil {
+					return nil, err
+				}
+				if item.op != "literal" {
+					return nil, &Error{Position: item.pos, Message: "lists may only hold literal values"}
+				}
+				list.args = append(list.args, item)
+				if _, ok := p.accept(","); !ok {
+					return list, p.expect("]")
+				}
+			}
+		}
+	}
+	return nil, &Error{Position: t.pos, Message: fmt.Sprintf("unexpected %q", t.text)}
+}
+
+// identifier converts an identifier token into a literal or a variable.
+func identifier(t token) (*node, error) {
+	switch t.text {
+	case "true", "false":
+		return &node{op: "literal", pos: t.pos, value: t.text == "true"}, nil
+	}
+	scope, name, _ := strings.Cut(t.text, ".")
+	switch {
+	case scope == "lead" && name != "" && !strings.Contains(name, "."):
+		return &node{op: "lead", pos: t.pos, name: name}, nil
+	case scope == "now" && nowFields[name] != "":
+		return &node{op: "now", pos: t.pos, name: name}, nil
+	}
+	return nil, &Error{Position: t.pos, Message: fmt.Sprintf("unknown name %s: use lead.<attribute> or now.date, now.time, now.hour, now.minute, now.weekday or now.weekend", t.text)}
+}
@@ -0,0 +1,369 @@
+// Package rules implements the expression language of client eligibility
+// rules. A rule is a boolean expression over the lead's custom attributes and
+// the current time in the client's time zone, for example
+//
+//	lead.country in ["DE", "AT"] && lead.budget > 5000 && !now.weekend
+//
+// Rules have no loops, calls or side effects, and their size and nesting are
+// bounded, so evaluating one is always cheap.
+package rules
+
+import (
+	"fmt"
+	"lead_management/pkg/models"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits on the size of rules.
+const (
+	MaxLength = 2000
+	maxDepth  = 32
+)
+
+// Error describes why a rule is invalid. Position is the byte offset in the
+// rule at which the problem was found.
+type Error struct {
+	Position int
+	Message  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rule position %d: %s", e.Position, e.Message)
+}
+
+// Types of values in rules.
+const (
+	typeBool   = "boolean"
+	typeNumber = "number"
+	typeString = "string"
+	typeList   = "list of "
+)
+
+// nowFields are the fields of now, with their types:
+//   - date: the date as YYYY-MM-DD
+//   - time: the time of day as HH:MM
+//   - hour, minute: the time of day as numbers
+//   - weekday: Mon, Tue, Wed, Thu, Fri, Sat or Sun
+//   - weekend: whether it is Saturday or Sunday
+var nowFields = map[string]string{
+	"date":    typeString,
+	"time":    typeString,
+	"hour":    typeNumber,
+	"minute":  typeNumber,
+	"weekday": typeString,
+	"weekend": typeBool,
+}
+
+// Rule is a parsed rule, ready to be evaluated.
+type Rule struct {
+	source string
+	root   *node
+}
+
+// String returns the rule's source.
+func (r *Rule) String() string {
+	return r.source
+}
+
+// Compile parses a rule and checks it against the lead attribute
+// definitions: every lead attribute must be defined and used with its type.
+// It returns an *Error if the rule is invalid.
+func Compile(source string, defs []models.AttributeDefinition) (*Rule, error) {
+	r, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := r.root.check(defs)
+	if err != nil {
+		return nil, err
+	}
+	if typ != typeBool {
+		return nil, &Error{Position: r.root.pos, Message: "rule must be a condition, not a " + typ}
+	}
+	return r, nil
+}
+
+// Parse parses a rule without checking it against attribute definitions,
+// which may have changed since the rule was compiled. It returns an *Error
+// if the rule is not well-formed.
+func Parse(source string) (*Rule, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, &Error{Message: "rule is empty"}
+	}
+	if len(source) > MaxLength {
+		return nil, &Error{Message: fmt.Sprintf("rule is longer than %d characters", MaxLength)}
+	}
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &Error{Position: t.pos, Message: fmt.Sprintf("unexpected %q", t.text)}
+	}
+	return &Rule{source: source, root: root}, nil
+}
+
+// parsed caches the rules parsed by Eval by source.
+var parsed sync.Map
+
+// Eval parses the rule source, reusing earlier parses, and evaluates it.
+// A rule that cannot be parsed is not met.
+func Eval(source string, attributes map[string]any, now time.Time) (bool, error) {
+	if r, ok := parsed.Load(source); ok {
+		return r.(*Rule).Eval(attributes, now), nil
+	}
+	r, err := Parse(source)
+	if err != nil {
+		return false, err
+	}
+	parsed.Store(source, r)
+	return r.Eval(attributes, now), nil
+}
+
+// Eval reports whether a lead with the given attributes meets the rule at
+// now, which should be in the client's time zone. Comparisons involving an
+// attribute the lead lacks, or a value of another type than the rule
+// expects, are false.
+func (r *Rule) Eval(attributes map[string]any, now time.Time) bool {
+	v, _ := r.root.eval(&env{attributes: attributes, now: now}).(bool)
+	return v
+}
+
+// env holds the values a rule is evaluated against.
+type env struct {
+	attributes map[string]any
+	now        time.Time
+}
+
+// node is a node of a parsed rule. Leaves are literals (op "literal", with
+// value) and variables (op "lead" or "now", with name); other nodes apply op
+// to args.
+type node struct {
+	op    string
+	pos   int
+	value any
+	name  string
+	args  []*node
+}
+
+// check returns the type of the node's value, or an *Error if the node
+// misuses a type or refers to an undefined attribute.
+func (n *node) check(defs []models.AttributeDefinition) (string, error) {
+	fail := func(pos int, format string, args ...any) (string, error) {
+		return "", &Error{Position: pos, Message: fmt.Sprintf(format, args...)}
+	}
+	switch n.op {
+	case "literal":
+		return valueType(n.value), nil
+	case "list":
+		elem := ""
+		for _, arg := range n.args {
+			typ, err := arg.check(defs)
+			if err != nil {
+				return "", err
+			}
+			if elem != "" && typ != elem {
+				return fail(arg.pos, "list mixes %s and %s values", elem, typ)
+			}
+			elem = typ
+		}
+		return typeList + elem, nil
+	case "lead":
+		i := slices.IndexFunc(defs, func(def models.AttributeDefinition) bool { return def.Name == n.name })
+		if i < 0 {
+			return fail(n.pos, "lead attribute %s is not defined", n.name)
+		}
+		switch defs[i].Type {
+		case models.AttributeNumber:
+			return typeNumber, nil
+		case models.AttributeBoolean:
+			return typeBool, nil
+		}
+		return typeString, nil
+	case "now":
+		return nowFields[n.name], nil
+	}
+
+	types := make([]string, len(n.args))
+	for i, arg := range n.args {
+		typ, err := arg.check(defs)
+		if err != nil {
+			return "", err
+		}
+		types[i] = typ
+	}
+	switch n.op {
+	case "!", "&&", "||":
+		for i, typ := range types {
+			if typ != typeBool {
+				return fail(n.args[i].pos, "%s needs conditions, not a %s", n.op, typ)
+			}
+		}
+		return typeBool, nil
+	case "==", "!=":
+		if types[0] != types[1] || strings.HasPrefix(types[0], typeList) {
+			return fail(n.pos, "cannot compare %s with %s", types[0], types[1])
+		}
+		return typeBool, nil
+	case "<", "<=", ">", ">=":
+		if types[0] != types[1] || (types[0] != typeNumber && types[0] != typeString) {
+			return fail(n.pos, "cannot order %s and %s", types[0], types[1])
+		}
+		return typeBool, nil
+	case "in":
+		// An empty list literal has no element type and matches nothing.
+		if types[1] != typeList && types[1] != typeList+types[0] {
+			return fail(n.pos, "cannot look for %s in %s", types[0], types[1])
+		}
+		return typeBool, nil
+	}
+	return fail(n.pos, "unknown operator %s", n.op)
+}
+
+// valueType returns the rule type of a literal value.
+func valueType(v any) string {
+	switch v.(type) {
+	case float64:
+		return typeNumber
+	case bool:
+		return typeBool
+	}
+	return typeString
+}
+
+// eval returns the node's value: a float64, string, bool or []any, or nil
+// for an attribute the lead lacks.
+func (n *node) eval(e *env) any {
+	switch n.op {
+	case "literal":
+		return n.value
+	case "list":
+		values := make([]any, len(n.args))
+		for i, arg := range n.args {
+			values[i] = arg.eval(e)
+		}
+		return values
+	case "lead":
+		return e.attributes[n.name]
+	case "now":
+		return nowValue(n.name, e.now)
+	case "!":
+		b, _ := n.args[0].eval(e).(bool)
+		return !b
+	case "&&":
+		if b, _ := n.args[0].eval(e).(bool); !b {
+			return false
+		}
+		b, _ := n.args[1].eval(e).(bool)
+		return b
+	case "||":
+		if b, _ := n.args[0].eval(e).(bool); b {
+			return true
+		}
+		b, _ := n.args[1].eval(e).(bool)
+		return b
+	}
+
+	left, right := n.args[0].eval(e), n.args[1].eval(e)
+	switch n.op {
+	case "in":
+		list, _ := right.([]any)
+		return isScalar(left) && slices.Contains(list, left)
+	case "==":
+		return isScalar(left) && isScalar(right) && left == right
+	case "!=":
+		return isScalar(left) && isScalar(right) && valueType(left) == valueType(right) && left != right
+	}
+	c, ok := compare(left, right)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// isScalar reports whether v is a number, string or boolean.
+func isScalar(v any) bool {
+	switch v.(type) {
+	case float64, string, bool:
+		return true
+	}
+	return false
+}
+
+// compare orders two numbers or two strings. It reports false for other
+// values.
+func compare(a, b any) (int, bool) {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	}
+	return 0, false
+}
+
+// nowValue returns the named field of now.
+func nowValue(name string, now time.Time) any {
+	switch name {
+	case "date":
+		return now.Format("2006-01-02")
+	case "time":
+		return now.Format("15:04")
+	case "hour":
+		return float64(now.Hour())
+	case "minute":
+		return float64(now.Minute())
+	case "weekday":
+		return now.Weekday().String()[:3]
+	case "weekend":
+		return now.Weekday() == time.Saturday || now.Weekday() == time.Sunday
+	}
+	return nil
+}
+
+// locations caches loaded time zones by name.
+var locations sync.Map
+
+// Location returns the named IANA time zone, or UTC if name is empty.
+func Location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
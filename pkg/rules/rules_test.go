@@ -0,0 +1,114 @@
+package rules
+
+import (
+	"lead_management/pkg/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var leadDefinitions = []models.AttributeDefinition{
+	{Entity: models.EntityLead, Name: "country", Type: models.AttributeEnum, Values: []string{"DE", "AT", "FR"}},
+	{Entity: models.EntityLead, Name: "budget", Type: models.AttributeNumber},
+	{Entity: models.EntityLead, Name: "vip", Type: models.AttributeBoolean},
+	{Entity: models.EntityLead, Name: "since", Type: models.AttributeDate},
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name         string
+		rule         string
+		wantPosition int
+		wantErr      bool
+	}{
+		{name: "Combined conditions", rule: `lead.country in ["DE", "AT"] && lead.budget > 5000 && !now.weekend`},
+		{name: "Keywords and parentheses", rule: `(lead.vip or lead.budget >= 10000) and not now.hour < 9`},
+		{name: "Single-quoted strings", rule: `lead.since >= '2024-01-01' && now.weekday != 'Sun'`},
+		{name: "Empty list", rule: `lead.country in []`},
+		{name: "Empty rule", rule: "  ", wantErr: true},
+		{name: "Undefined attribute", rule: `lead.region == "emea"`, wantPosition: 0, wantErr: true},
+		{name: "Unknown name", rule: `lead.vip || client.priority > 1`, wantPosition: 12, wantErr: true},
+		{name: "Unknown time field", rule: `now.month == 1`, wantErr: true},
+		{name: "Number compared with string", rule: `lead.budget == "5000"`, wantPosition: 12, wantErr: true},
+		{name: "Ordering booleans", rule: `lead.vip > false`, wantErr: true},
+		{name: "Mixed list", rule: `lead.country in ["DE", 1]`, wantPosition: 23, wantErr: true},
+		{name: "Wrong list type", rule: `lead.budget in ["DE"]`, wantErr: true},
+		{name: "Not a condition", rule: `lead.budget`, wantErr: true},
+		{name: "Condition on a number", rule: `lead.vip && lead.budget`, wantPosition: 12, wantErr: true},
+		{name: "Unterminated string", rule: `lead.country == "DE`, wantPosition: 16, wantErr: true},
+		{name: "Missing parenthesis", rule: `(lead.vip`, wantPosition: 9, wantErr: true},
+		{name: "Trailing tokens", rule: `lead.vip lead.vip`, wantPosition: 9, wantErr: true},
+		{name: "Unexpected character", rule: `lead.budget = 1`, wantPosition: 12, wantErr: true},
+		{name: "Too deep", rule: strings.Repeat("(", 40) + "lead.vip" + strings.Repeat(")", 40), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := Compile(tc.rule, leadDefinitions)
+			if !tc.wantErr {
+				require.NoError(t, err)
+				assert.Equal(t, tc.rule, rule.String())
+				return
+			}
+			var ruleErr *Error
+			require.ErrorAs(t, err, &ruleErr)
+			if tc.wantPosition != 0 {
+				assert.Equal(t, tc.wantPosition, ruleErr.Position, ruleErr.Message)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	// A Friday and a Saturday.
+	friday := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	saturday := friday.AddDate(0, 0, 1)
+	rule := `lead.country in ["DE", "AT"] && lead.budget > 5000 && !now.weekend`
+
+	tests := []struct {
+		name       string
+		rule       string
+		attributes map[string]any
+		now        time.Time
+		expected   bool
+	}{
+		{name: "Rule met", rule: rule, attributes: map[string]any{"country": "AT", "budget": 6000.0}, now: friday, expected: true},
+		{name: "Wrong country", rule: rule, attributes: map[string]any{"country": "FR", "budget": 6000.0}, now: friday},
+		{name: "Budget too low", rule: rule, attributes: map[string]any{"country": "DE", "budget": 5000.0}, now: friday},
+		{name: "Weekend", rule: rule, attributes: map[string]any{"country": "DE", "budget": 6000.0}, now: saturday},
+		{name: "Missing attribute", rule: rule, attributes: map[string]any{"country": "DE"}, now: friday},
+		{name: "Negated missing attribute", rule: `!(lead.budget > 5000)`, now: friday, expected: true},
+		{name: "Value of another type", rule: `lead.budget > 5000`, attributes: map[string]any{"budget": "6000"}, now: friday},
+		{name: "Inequality of another type", rule: `lead.budget != 5000`, attributes: map[string]any{"budget": "6000"}, now: friday},
+		{name: "Time of day", rule: `now.time >= "09:00" && now.hour < 11 && now.minute == 30`, now: friday, expected: true},
+		{name: "Weekday and date", rule: `now.weekday == "Fri" && now.date == "2024-03-01"`, now: friday, expected: true},
+		{name: "Or", rule: `lead.vip || lead.budget > 100`, attributes: map[string]any{"vip": false, "budget": 200.0}, now: friday, expected: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			matched, err := Eval(tc.rule, tc.attributes, tc.now)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, matched)
+		})
+	}
+
+	_, err := Eval(`lead.vip &&`, nil, friday)
+	assert.Error(t, err)
+}
+
+func TestLocation(t *testing.T) {
+	loc, err := Location("")
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, loc)
+
+	loc, err = Location("Europe/Berlin")
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Berlin", loc.String())
+
+	_, err = Location("Mars/Olympus")
+	assert.Error(t, err)
+}
@@ -0,0 +1,51 @@
+// Package schedule applies scheduled client status changes as they fall due.
+package schedule
+
+import (
+	"context"
+	"lead_management/pkg/db"
+	"lead_management/pkg/health"
+	"log/slog"
+	"time"
+)
+
+// Scheduler applies the client status changes that are due every interval.
+type Scheduler struct {
+	db        *db.DB
+	interval  time.Duration
+	heartbeat *health.Heartbeat
+}
+
+// NewScheduler returns a Scheduler applying the status changes scheduled in
+// database.
+func NewScheduler(database *db.DB, interval time.Duration) *Scheduler {
+	return &Scheduler{db: database, interval: interval}
+}
+
+// SetHeartbeat makes the scheduler report liveness on h after every pass.
+func (s *Scheduler) SetHeartbeat(h *health.Heartbeat) {
+	s.heartbeat = h
+}
+
+// Run applies due status changes until ctx is cancelled. A pass in progress
+// when ctx is cancelled is completed before Run returns.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		n, err := s.db.ApplyStatusSchedules(context.WithoutCancel(ctx), time.Now().UTC())
+		if err != nil {
+			slog.Error("failed to apply scheduled client statuses", "error", err)
+		} else if n > 0 {
+			slog.Info("applied scheduled client statuses", "count", n)
+		}
+		if s.heartbeat != nil {
+			s.heartbeat.Beat()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
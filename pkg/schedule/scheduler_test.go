@@ -0,0 +1,45 @@
+package schedule
+
+import (
+	"context"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerAppliesDueStatuses(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+	ctx := context.Background()
+
+	open, _ := time.Parse("15:04", "00:00")
+	closing, _ := time.Parse("15:04", "23:59")
+	require.NoError(t, database.CreateClient(ctx, models.Client{
+		ID: "c1", Name: "Client", Priority: 1, LeadCapacity: 5, WorkingHours: [2]time.Time{open, closing},
+	}))
+	now := time.Now().UTC()
+	require.NoError(t, database.ScheduleStatus(ctx, models.StatusSchedule{
+		ID: "s1", ClientID: "c1", Status: models.ClientPaused, Reason: "vacation", StartsAt: now.Add(-time.Minute), CreatedAt: now,
+	}))
+
+	runCtx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		NewScheduler(database, time.Hour).Run(runCtx)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	// The first pass runs without waiting for the interval.
+	assert.Eventually(t, func() bool {
+		c, err := database.GetClientByID(ctx, "c1")
+		return err == nil && c.Status == models.ClientPaused && c.StatusReason == "vacation"
+	}, 5*time.Second, 10*time.Millisecond)
+}
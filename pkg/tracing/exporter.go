@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Exporter receives finished spans. Implementations must be safe for concurrent use.
+type Exporter interface {
+	ExportSpan(span SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+var (
+	exporterMu sync.RWMutex
+	exporter   Exporter
+)
+
+// SetExporter installs the exporter that receives all sampled spans.
+// A nil exporter disables export; spans are still created and propagated.
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporter = e
+}
+
+// Shutdown flushes and closes the installed exporter, if any.
+func Shutdown(ctx context.Context) error {
+	exporterMu.RLock()
+	e := exporter
+	exporterMu.RUnlock()
+	if e == nil {
+		return nil
+	}
+	return e.Shutdown(ctx)
+}
+
+func export(data SpanData) {
+	exporterMu.RLock()
+	e := exporter
+	exporterMu.RUnlock()
+	if e == nil {
+		return
+	}
+	if err := e.ExportSpan(data); err != nil {
+		slog.Warn("failed to export span", "span", data.Name, "error", err)
+	}
+}
+
+// WriterExporter writes each span as one JSON line to an io.Writer.
+type WriterExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// NewWriterExporter returns an exporter writing JSON lines to w.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+// NewFileExporter returns an exporter appending JSON lines to the file at path.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterExporter{enc: json.NewEncoder(f), c: f}, nil
+}
+
+// ExportSpan implements Exporter.
+func (e *WriterExporter) ExportSpan(span SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(span)
+}
+
+// Shutdown implements Exporter and closes the underlying file, if any.
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.c != nil {
+		return e.c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header name.
+const TraceparentHeader = "traceparent"
+
+// ParseTraceparent parses a W3C traceparent header value of the form
+// "00-<trace-id>-<parent-id>-<flags>".
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return sc, fmt.Errorf("malformed traceparent %q", value)
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("unsupported traceparent version %q", version)
+	}
+	if len(traceID) != 32 || len(spanID) != 16 || len(flags) != 2 {
+		return sc, fmt.Errorf("malformed traceparent %q", value)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(traceID)); err != nil {
+		return sc, fmt.Errorf("invalid trace id: %w", err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(spanID)); err != nil {
+		return sc, fmt.Errorf("invalid parent id: %w", err)
+	}
+	var f [1]byte
+	if _, err := hex.Decode(f[:], []byte(flags)); err != nil {
+		return sc, fmt.Errorf("invalid trace flags: %w", err)
+	}
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("traceparent %q has zero ids", value)
+	}
+	sc.Sampled = f[0]&0x01 == 1
+	return sc, nil
+}
+
+// FormatTraceparent renders sc as a version 00 traceparent header value.
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// Extract returns ctx continuing the trace in the request headers, if any.
+// Invalid headers are ignored and a new trace is started instead.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	value := header.Get(TraceparentHeader)
+	if value == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(value)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemoteParent(ctx, sc)
+}
+
+// Inject writes the traceparent of the current span in ctx into header.
+func Inject(ctx context.Context, header http.Header) {
+	if span := SpanFromContext(ctx); span != nil && span.Context().IsValid() {
+		header.Set(TraceparentHeader, FormatTraceparent(span.Context()))
+	}
+}
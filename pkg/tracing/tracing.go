@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace across services.
+type TraceID [16]byte
+
+// SpanID identifies a single span within a trace.
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether the trace ID is non-zero.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid reports whether the span ID is non-zero.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span that is propagated to other processes.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// SpanData is the finished, exportable form of a span.
+type SpanData struct {
+	Name       string         `json:"name"`
+	TraceID    string         `json:"traceId"`
+	SpanID     string         `json:"spanId"`
+	ParentID   string         `json:"parentId,omitempty"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Duration   time.Duration  `json:"durationNs"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Span is an in-progress unit of work. A nil *Span is safe to use and does nothing.
+type Span struct {
+	mu       sync.Mutex
+	name     string
+	context  SpanContext
+	parentID SpanID
+	start    time.Time
+	attrs    map[string]any
+	err      string
+	ended    bool
+}
+
+// Context returns the span's propagation context.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttribute records a key/value pair on the span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]any)
+	}
+	s.attrs[key] = value
+}
+
+// RecordError marks the span as failed. Nil errors are ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End finishes the span and hands it to the exporter if it is sampled.
+// Calling End more than once has no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	end := time.Now()
+	data := SpanData{
+		Name:       s.name,
+		TraceID:    s.context.TraceID.String(),
+		SpanID:     s.context.SpanID.String(),
+		Start:      s.start,
+		End:        end,
+		Duration:   end.Sub(s.start),
+		Attributes: s.attrs,
+		Error:      s.err,
+	}
+	if s.parentID.IsValid() {
+		data.ParentID = s.parentID.String()
+	}
+	s.mu.Unlock()
+
+	if s.context.Sampled {
+		export(data)
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the current span, or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+type remoteKey struct{}
+
+// ContextWithRemoteParent returns a copy of ctx whose next span continues the
+// trace described by sc, typically extracted from an incoming traceparent header.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Start creates a span that is a child of the span in ctx, or of a remote
+// parent set with ContextWithRemoteParent, or the root of a new trace.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	span := &Span{name: name, start: time.Now()}
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.context.TraceID = parent.context.TraceID
+		span.context.Sampled = parent.context.Sampled
+		span.parentID = parent.context.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok && remote.IsValid() {
+		span.context.TraceID = remote.TraceID
+		span.context.Sampled = remote.Sampled
+		span.parentID = remote.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.Sampled = true
+	}
+	rand.Read(span.context.SpanID[:])
+
+	return ContextWithSpan(ctx, span), span
+}
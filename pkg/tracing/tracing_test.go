@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingExporter keeps exported spans in memory.
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *recordingExporter) ExportSpan(span SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error { return nil }
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		sampled     bool
+		expectedErr bool
+	}{
+		{name: "Sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sampled: true},
+		{name: "Not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", sampled: false},
+		{name: "Too few parts", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-01", expectedErr: true},
+		{name: "Zero trace id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", expectedErr: true},
+		{name: "Invalid hex", value: "00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", expectedErr: true},
+		{name: "Forbidden version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", expectedErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tc.value)
+			if tc.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.sampled, sc.Sampled)
+			assert.Equal(t, tc.value, FormatTraceparent(sc))
+		})
+	}
+}
+
+func TestSpanHierarchyAndPropagation(t *testing.T) {
+	exp := &recordingExporter{}
+	SetExporter(exp)
+	defer SetExporter(nil)
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, server := Start(Extract(context.Background(), header), "server")
+	_, child := Start(ctx, "child")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	server.End()
+	server.End() // ending twice must not export twice
+
+	require.Len(t, exp.spans, 2)
+	childData, serverData := exp.spans[0], exp.spans[1]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serverData.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", serverData.ParentID)
+	assert.Equal(t, serverData.TraceID, childData.TraceID)
+	assert.Equal(t, serverData.SpanID, childData.ParentID)
+	assert.Equal(t, "boom", childData.Error)
+
+	out := http.Header{}
+	Inject(ctx, out)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+serverData.SpanID+"-01", out.Get(TraceparentHeader))
+}
+
+func TestUnsampledSpansAreNotExported(t *testing.T) {
+	exp := &recordingExporter{}
+	SetExporter(exp)
+	defer SetExporter(nil)
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := Start(Extract(context.Background(), header), "server")
+	span.End()
+
+	assert.Empty(t, exp.spans)
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	SetExporter(NewWriterExporter(&buf))
+	defer SetExporter(nil)
+
+	_, span := Start(context.Background(), "db.get_client_by_id")
+	span.SetAttribute("db.system", "sqlite")
+	span.End()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+	var data SpanData
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &data))
+	assert.Equal(t, "db.get_client_by_id", data.Name)
+	assert.Equal(t, "sqlite", data.Attributes["db.system"])
+	assert.Empty(t, data.ParentID)
+}
+
+func TestNilSpanIsSafe(t *testing.T) {
+	var span *Span
+	span.SetAttribute("k", "v")
+	span.RecordError(errors.New("ignored"))
+	span.End()
+	assert.False(t, span.Context().IsValid())
+}
@@ -0,0 +1,174 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"lead_management/pkg/db"
+	"lead_management/pkg/health"
+	"lead_management/pkg/models"
+	"lead_management/pkg/tracing"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Options tunes delivery and retry behaviour.
+type Options struct {
+	PollInterval   time.Duration // how often due deliveries are looked up
+	Timeout        time.Duration // per-request timeout
+	MaxAttempts    int           // attempts before a delivery is dead-lettered
+	InitialBackoff time.Duration // delay before the first retry
+	MaxBackoff     time.Duration // upper bound for the exponential backoff
+	BatchSize      int           // deliveries sent per lookup
+}
+
+// Dispatcher sends pending webhook deliveries and retries failures with
+// exponential backoff until they succeed or are dead-lettered.
+type Dispatcher struct {
+	db        *db.DB
+	client    *http.Client
+	opts      Options
+	heartbeat *health.Heartbeat
+	now       func() time.Time
+}
+
+// NewDispatcher returns a Dispatcher sending deliveries stored in database.
+func NewDispatcher(database *db.DB, opts Options) *Dispatcher {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 50
+	}
+	return &Dispatcher{
+		db:     database,
+		client: &http.Client{Timeout: opts.Timeout},
+		opts:   opts,
+		now:    time.Now,
+	}
+}
+
+// SetHeartbeat makes the dispatcher report liveness on h after every lookup
+// and delivery attempt.
+func (d *Dispatcher) SetHeartbeat(h *health.Heartbeat) {
+	d.heartbeat = h
+}
+
+// Run sends due deliveries every poll interval, and immediately when new
+// deliveries are queued, until ctx is cancelled. A batch in progress when ctx
+// is cancelled is completed before Run returns.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		// Deliveries in flight are not tied to ctx so shutdown lets them finish.
+		if _, err := d.ProcessDue(context.WithoutCancel(ctx)); err != nil {
+			slog.Error("failed to process webhook deliveries", "error", err)
+		}
+		d.beat()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.db.WebhookQueued():
+		}
+	}
+}
+
+// ProcessDue sends one batch of due deliveries and returns how many it attempted.
+// A delivery whose outcome cannot be recorded stays due, so it is sent again,
+// and the rest of the batch is still sent.
+func (d *Dispatcher) ProcessDue(ctx context.Context) (int, error) {
+	deliveries, err := d.db.GetDueWebhookDeliveries(ctx, d.now(), d.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, delivery := range deliveries {
+		d.attempt(ctx, &delivery)
+		d.beat()
+		if err := d.db.UpdateWebhookDelivery(ctx, delivery); err != nil {
+			slog.Error("failed to record webhook delivery attempt", "delivery", delivery.ID, "webhook", delivery.WebhookID, "error", err)
+		}
+	}
+	return len(deliveries), nil
+}
+
+// beat reports liveness, also between deliveries of a slow batch.
+func (d *Dispatcher) beat() {
+	if d.heartbeat != nil {
+		d.heartbeat.Beat()
+	}
+}
+
+// attempt sends a delivery once and updates its status for the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	ctx, span := tracing.Start(ctx, "webhook.deliver")
+	defer span.End()
+	span.SetAttribute("webhook.id", delivery.WebhookID)
+	span.SetAttribute("webhook.delivery_id", delivery.ID)
+	span.SetAttribute("webhook.event", delivery.EventType)
+
+	now := d.now()
+	delivery.Attempts++
+	delivery.UpdatedAt = now
+
+	statusCode, err := d.send(ctx, *delivery, now)
+	delivery.LastStatusCode = statusCode
+	span.SetAttribute("http.status_code", statusCode)
+	span.RecordError(err)
+
+	logger := slog.With("delivery", delivery.ID, "webhook", delivery.WebhookID, "attempt", delivery.Attempts)
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliverySucceeded
+		delivery.LastError = ""
+		logger.Info("webhook delivered", "status", statusCode)
+	case delivery.Attempts >= d.opts.MaxAttempts:
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = err.Error()
+		logger.Warn("webhook delivery dead-lettered", "error", err)
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+		logger.Info("webhook delivery failed, will retry", "error", err, "next_attempt", delivery.NextAttemptAt)
+	}
+}
+
+// send posts the signed payload and returns the response status code.
+func (d *Dispatcher) send(ctx context.Context, delivery models.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "lead-management-webhooks/1")
+	req.Header.Set(HeaderDeliveryID, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, fmt.Sprint(now.Unix()))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, now, delivery.Payload))
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the retry following the given attempt:
+// InitialBackoff doubled for every earlier failure, capped at MaxBackoff.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.opts.InitialBackoff
+	for i := 1; i < attempt && delay < d.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.opts.MaxBackoff {
+		delay = d.opts.MaxBackoff
+	}
+	return delay
+}
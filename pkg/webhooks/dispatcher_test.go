@@ -0,0 +1,220 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"lead_management/pkg/db"
+	"lead_management/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupWebhook creates an always-open client with a webhook pointing at url
+// and assigns one lead to it, which enqueues one delivery.
+func setupWebhook(t *testing.T, database *db.DB, url string) {
+	ctx := context.Background()
+	open, _ := time.Parse("15:04", "00:00")
+	closing, _ := time.Parse("15:04", "23:59")
+	require.NoError(t, database.CreateClient(ctx, models.Client{
+		ID: "c1", Name: "Client", Priority: 1, LeadCapacity: 10,
+		WorkingHours: [2]time.Time{open, closing},
+	}))
+	require.NoError(t, database.CreateWebhook(ctx, models.Webhook{
+		ID: "w1", ClientID: "c1", URL: url, Secret: "s3cret",
+		EventTypes: []string{models.EventLeadAssigned}, CreatedAt: time.Now(),
+	}))
+	lead, err := database.AssignLead(ctx, models.Lead{ID: "l1", Name: "Ada", Email: "ada@example.com"})
+	require.NoError(t, err)
+	require.NotNil(t, lead)
+}
+
+func TestDispatcherDeliversSignedPayload(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+
+	var received atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := Verify("s3cret", r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, time.Now(), 5*time.Minute)
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, models.EventLeadAssigned, r.Header.Get(HeaderEvent))
+		assert.NotEmpty(t, r.Header.Get(HeaderDeliveryID))
+
+		var event models.Event
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, models.EventLeadAssigned, event.Type)
+		assert.Equal(t, "c1", event.ClientID)
+		var lead models.Lead
+		require.NoError(t, json.Unmarshal(event.Data, &lead))
+		assert.Equal(t, "l1", lead.ID)
+
+		received.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	setupWebhook(t, database, receiver.URL)
+
+	d := NewDispatcher(database, Options{Timeout: time.Second, MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour})
+	n, err := d.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.EqualValues(t, 1, received.Load())
+
+	deliveries, err := database.GetWebhookDeliveries(context.Background(), "c1", "")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, models.DeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusNoContent, deliveries[0].LastStatusCode)
+
+	// Succeeded deliveries are not sent again.
+	n, err = d.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestDispatcherContinuesWhenAttemptIsNotRecorded(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+
+	// The database goes away during the first delivery, so no attempt of the
+	// batch can be recorded.
+	var received atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		database.Close()
+	}))
+	defer receiver.Close()
+	setupWebhook(t, database, receiver.URL)
+	_, err := database.AssignLead(context.Background(), models.Lead{ID: "l2", Name: "Grace"})
+	require.NoError(t, err)
+
+	d := NewDispatcher(database, Options{Timeout: time.Second, MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour})
+	n, err := d.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.EqualValues(t, 2, received.Load())
+}
+
+func TestDispatcherRetriesThenDeadLettersAndReplays(t *testing.T) {
+	database := db.InitDB(":memory:")
+	defer database.Close()
+
+	var healthy atomic.Bool
+	var received atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+	setupWebhook(t, database, receiver.URL)
+
+	now := time.Now()
+	d := NewDispatcher(database, Options{Timeout: time.Second, MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour})
+	d.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// First attempt fails and is scheduled one backoff later.
+	_, err := d.ProcessDue(ctx)
+	require.NoError(t, err)
+	deliveries, err := database.GetWebhookDeliveries(ctx, "c1", models.DeliveryPending)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, deliveries[0].LastStatusCode)
+	assert.WithinDuration(t, now.Add(time.Minute), deliveries[0].NextAttemptAt, time.Millisecond)
+
+	// Nothing is sent before the backoff has elapsed.
+	n, err := d.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// The remaining attempts fail and the delivery is dead-lettered.
+	for i := 0; i < 2; i++ {
+		now = now.Add(time.Hour)
+		_, err = d.ProcessDue(ctx)
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 3, received.Load())
+	dead, err := database.GetWebhookDeliveries(ctx, "", models.DeliveryDead)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Contains(t, dead[0].LastError, "503")
+
+	// A replayed delivery is sent again.
+	healthy.Store(true)
+	found, err := database.ReplayWebhookDelivery(ctx, dead[0].ID)
+	require.NoError(t, err)
+	assert.True(t, found)
+	_, err = d.ProcessDue(ctx)
+	require.NoError(t, err)
+	deliveries, err = database.GetWebhookDeliveries(ctx, "c1", models.DeliverySucceeded)
+	require.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.EqualValues(t, 4, received.Load())
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, Options{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{attempt: 1, expected: time.Second},
+		{attempt: 2, expected: 2 * time.Second},
+		{attempt: 4, expected: 8 * time.Second},
+		{attempt: 5, expected: 10 * time.Second},
+		{attempt: 60, expected: 10 * time.Second},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expected, d.backoff(tc.attempt), "attempt %d", tc.attempt)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"1"}`)
+	signature := Sign("secret", now, body)
+
+	tests := []struct {
+		name        string
+		secret      string
+		timestamp   string
+		signature   string
+		body        []byte
+		expectedErr bool
+	}{
+		{name: "Valid", secret: "secret", timestamp: "1700000000", signature: signature, body: body},
+		{name: "Wrong secret", secret: "other", timestamp: "1700000000", signature: signature, body: body, expectedErr: true},
+		{name: "Tampered body", secret: "secret", timestamp: "1700000000", signature: signature, body: []byte(`{"id":"2"}`), expectedErr: true},
+		{name: "Replayed timestamp", secret: "secret", timestamp: "1700000001", signature: signature, body: body, expectedErr: true},
+		{name: "Stale timestamp", secret: "secret", timestamp: "1699990000", signature: Sign("secret", time.Unix(1699990000, 0), body), body: body, expectedErr: true},
+		{name: "Malformed timestamp", secret: "secret", timestamp: "yesterday", signature: signature, body: body, expectedErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Verify(tc.secret, tc.timestamp, tc.signature, tc.body, now, 5*time.Minute)
+			if tc.expectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderDeliveryID = "X-Webhook-Id"
+	HeaderEvent      = "X-Webhook-Event"
+	HeaderTimestamp  = "X-Webhook-Timestamp"
+	HeaderSignature  = "X-Webhook-Signature"
+)
+
+// signaturePrefix names the algorithm in the signature header.
+const signaturePrefix = "sha256="
+
+// Sign returns the signature header value for body sent at timestamp. The
+// HMAC-SHA256 covers "<unix timestamp>.<body>" so a captured request cannot
+// be replayed with a different timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a received delivery.
+// Receivers should reject deliveries whose timestamp is older than tolerance.
+func Verify(secret, timestampHeader, signatureHeader string, body []byte, now time.Time, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp header")
+	}
+	timestamp := time.Unix(unix, 0)
+	if d := now.Sub(timestamp); d > tolerance || d < -tolerance {
+		return errors.New("timestamp outside tolerance")
+	}
+	if !strings.HasPrefix(signatureHeader, signaturePrefix) {
+		return errors.New("unsupported signature algorithm")
+	}
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signatureHeader)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}